@@ -0,0 +1,140 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// selectiveAdjustment changes the saturation, brightness or hue of the pixels within a hue and lightness range
+type selectiveAdjustment struct {
+	hueFrom, hueTo     float64 // in degrees, a range that wraps around 360 has a from value above the to value
+	lightFrom, lightTo float64 // in percent
+	saturation         float64 // change in percent points
+	brightness         float64 // change of the lightness in percent points
+	shift              float64 // hue change in degrees
+}
+
+// parseAdjustments parses adjustments in the format hue=200-260:light=20-80:sat=+30, every part is optional
+// but at least one of the changes sat, bright or shift has to be given
+func parseAdjustments(definitions []string) ([]selectiveAdjustment, error) {
+	var adjustments []selectiveAdjustment
+	for _, definition := range definitions {
+		adjustment := selectiveAdjustment{hueTo: 360, lightTo: 100}
+		changed := false
+		for _, part := range strings.Split(definition, ":") {
+			name, value, err := splitDefinition(part)
+			if err != nil {
+				return nil, err
+			}
+			switch name {
+			case "hue":
+				adjustment.hueFrom, adjustment.hueTo, err = parseAdjustmentRange(value, 360)
+			case "light":
+				adjustment.lightFrom, adjustment.lightTo, err = parseAdjustmentRange(value, 100)
+				if err == nil && adjustment.lightFrom > adjustment.lightTo {
+					err = fmt.Errorf("lightness range '%s' is reversed", value)
+				}
+			case "sat":
+				adjustment.saturation, err = parseAdjustmentChange(value, 100)
+				changed = true
+			case "bright":
+				adjustment.brightness, err = parseAdjustmentChange(value, 100)
+				changed = true
+			case "shift":
+				adjustment.shift, err = parseAdjustmentChange(value, 180)
+				changed = true
+			default:
+				err = fmt.Errorf("unknown adjustment '%s'", name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid adjustment '%s': %v", definition, err)
+			}
+		}
+		if !changed {
+			return nil, fmt.Errorf("adjustment '%s' contains no sat, bright or shift change", definition)
+		}
+		adjustments = append(adjustments, adjustment)
+	}
+	return adjustments, nil
+}
+
+// parseAdjustmentRange parses a range in the format from-to with values between 0 and max
+func parseAdjustmentRange(value string, max float64) (float64, float64, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("range '%s' is not in the format from-to", value)
+	}
+	from, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range start '%s'", parts[0])
+	}
+	to, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range end '%s'", parts[1])
+	}
+	if from < 0 || from > max || to < 0 || to > max {
+		return 0, 0, fmt.Errorf("range '%s' has to be between 0 and %g", value, max)
+	}
+	return from, to, nil
+}
+
+// parseAdjustmentChange parses a signed change like +30 that has to be between -max and max
+func parseAdjustmentChange(value string, max float64) (float64, error) {
+	change, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid change '%s'", value)
+	}
+	if change < -max || change > max {
+		return 0, fmt.Errorf("change '%s' has to be between %g and %g", value, -max, max)
+	}
+	return change, nil
+}
+
+// matches returns whether the color of the given hue and lightness is within the range of the adjustment
+func (a selectiveAdjustment) matches(h, s, l float64) bool {
+	if l*100 < a.lightFrom || l*100 > a.lightTo {
+		return false
+	}
+	if a.hueFrom == 0 && a.hueTo == 360 { // all hues including the grey shades
+		return true
+	}
+	if s == 0 { // grey shades have no hue
+		return false
+	}
+	if a.hueFrom <= a.hueTo {
+		return h >= a.hueFrom && h <= a.hueTo
+	}
+	return h >= a.hueFrom || h <= a.hueTo
+}
+
+// applyAdjustments applies the selective adjustments in the given order to the pixels within their ranges
+func (m *beadMachine) applyAdjustments(inputImage image.Image) image.Image {
+	if len(m.adjustments) == 0 {
+		return inputImage
+	}
+
+	return imaging.AdjustFunc(inputImage, func(c color.NRGBA) color.NRGBA {
+		h, s, l := rgbToHSL(float64(c.R), float64(c.G), float64(c.B))
+		changed := false
+		for _, adjustment := range m.adjustments {
+			if !adjustment.matches(h, s, l) {
+				continue
+			}
+			h = math.Mod(h+adjustment.shift+360, 360)
+			s = math.Max(0, math.Min(1, s+adjustment.saturation/100))
+			l = math.Max(0, math.Min(1, l+adjustment.brightness/100))
+			changed = true
+		}
+		if !changed {
+			return c
+		}
+		r, g, b := hslToRGB(h, s, l)
+		return color.NRGBA{clampChannel(r), clampChannel(g), clampChannel(b), c.A}
+	})
+}
@@ -0,0 +1,227 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"sort"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// analyzeHistogramBins is the amount of luminance ranges of the histogram
+const analyzeHistogramBins = 16
+
+// analyzeColorBits is the amount of bits per channel that colors are reduced to for finding dominant colors
+const analyzeColorBits = 4
+
+// colorShare is a color and its share of the pixels of an image
+type colorShare struct {
+	Color string  `json:"color"` // hex RGB color, the average of all pixels of the color range
+	Share float64 `json:"share"`
+}
+
+// colorAnalysis contains the color statistics of an image
+type colorAnalysis struct {
+	Width          int          `json:"width"`
+	Height         int          `json:"height"`
+	DistinctColors int          `json:"distinctColors"`
+	ColorRanges    int          `json:"colorRanges"` // distinct colors with reduced precision
+	DominantColors []colorShare `json:"dominantColors"`
+	Histogram      []float64    `json:"histogram"` // share of pixels per luminance range from dark to bright
+}
+
+// imageAnalysis is the result of the analyze command
+type imageAnalysis struct {
+	Source colorAnalysis  `json:"source"`
+	Target *colorAnalysis `json:"target,omitempty"` // the image resized to the target size
+}
+
+// analyzeCommand returns the command that analyzes the colors of an image without bead matching
+func analyzeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze file.jpg",
+		Short: "Report the dominant colors and color histogram of an image",
+		Long: `Report the dominant colors, the luminance histogram and the amount of distinct colors of an image
+and of the image resized to the target size, without matching it to a palette.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: startAnalyze,
+	}
+
+	cmd.Flags().StringP("input", "i", "", "image to analyze")
+	cmd.Flags().StringP("output", "o", "", "output filename for a JSON file with the analysis")
+	cmd.Flags().IntP("dominant-colors", "", 8, "amount of dominant colors to report")
+	cmd.Flags().IntP("width", "w", 0, "target width in pixel")
+	cmd.Flags().IntP("height", "e", 0, "target height in pixel")
+	cmd.Flags().IntP("boardswidth", "x", 0, "target width in amount of boards")
+	cmd.Flags().IntP("boardsheight", "y", 0, "target height in amount of boards")
+	cmd.Flags().IntP("boarddimension", "d", 20, "dimension of a board")
+	cmd.Flags().StringP("fit", "", fitStretch, "how to fit the image if width and height are given: contain, cover or stretch")
+	cmd.Flags().StringP("resample", "", resampleLanczos, "resampling filter for resizing the image: lanczos, linear, box or nearest")
+	_ = cmd.RegisterFlagCompletionFunc("fit", completeValues(fitContain, fitCover, fitStretch))
+	_ = cmd.RegisterFlagCompletionFunc("resample", completeValues(resampleLanczos, resampleLinear, resampleBox, resampleNearest))
+	return cmd
+}
+
+func startAnalyze(cmd *cobra.Command, args []string) error {
+	inputFileName, _ := cmd.Flags().GetString("input")
+	if inputFileName == "" && len(args) > 0 {
+		inputFileName = args[0]
+	}
+	if inputFileName == "" {
+		return cmd.Help()
+	}
+
+	logger := logger(cmd)
+	outputFileName, _ := cmd.Flags().GetString("output")
+	dominantColors, _ := cmd.Flags().GetInt("dominant-colors")
+	if err := validateFlagRanges(cmd.Flags()); err != nil {
+		logger.Error("Invalid flag value", zap.Error(err))
+		return usageError(err)
+	}
+
+	fit, _ := cmd.Flags().GetString("fit")
+	resample, _ := cmd.Flags().GetString("resample")
+	switch {
+	case fit != fitContain && fit != fitCover && fit != fitStretch:
+		logger.Error("Invalid fit strategy", zap.String("fit", fit))
+		return usageError(fmt.Errorf("invalid fit strategy '%s'", fit))
+	case resample != resampleLanczos && resample != resampleLinear && resample != resampleBox && resample != resampleNearest:
+		logger.Error("Invalid resampling filter", zap.String("resample", resample))
+		return usageError(fmt.Errorf("invalid resampling filter '%s'", resample))
+	}
+
+	m := newBeadMachine(logger)
+	m.inputFileName = inputFileName
+	m.width, _ = cmd.Flags().GetInt("width")
+	m.height, _ = cmd.Flags().GetInt("height")
+	m.boardsWidth, _ = cmd.Flags().GetInt("boardswidth")
+	m.boardsHeight, _ = cmd.Flags().GetInt("boardsheight")
+	m.boardDimension, _ = cmd.Flags().GetInt("boarddimension")
+	m.fit = fit
+	m.resample = resample
+
+	inputImage, err := readImageFile(inputFileName, true)
+	if err != nil {
+		logger.Error("Reading image file failed", zap.Error(err))
+		return inputError(err)
+	}
+
+	analysis := imageAnalysis{Source: analyzeColors(inputImage, dominantColors)}
+	logColorAnalysis(logger, "Source image", analysis.Source)
+
+	if m.width > 0 || m.height > 0 || m.boardsWidth > 0 || m.boardsHeight > 0 {
+		target, err := m.prepareImage()
+		if err != nil {
+			return err
+		}
+		targetAnalysis := analyzeColors(target, dominantColors)
+		analysis.Target = &targetAnalysis
+		logColorAnalysis(logger, "Target size", targetAnalysis)
+	}
+
+	if outputFileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(analysis, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(outputFileName, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Error("Writing analysis failed", zap.Error(err))
+		return outputError(errors.Wrap(err, "writing analysis file"))
+	}
+	return nil
+}
+
+// analyzeColors returns the color statistics of all pixels of the image that are not transparent
+func analyzeColors(img image.Image, dominantColors int) colorAnalysis {
+	nrgba := imaging.Clone(img)
+	bounds := nrgba.Bounds()
+	analysis := colorAnalysis{
+		Width:     bounds.Dx(),
+		Height:    bounds.Dy(),
+		Histogram: make([]float64, analyzeHistogramBins),
+	}
+
+	type colorRange struct {
+		count   int
+		r, g, b int // sums of the channels of all pixels
+	}
+	distinct := make(map[[3]uint8]struct{})
+	ranges := make(map[[3]uint8]*colorRange)
+	pixels := 0
+	shift := uint(8 - analyzeColorBits)
+
+	for i := 0; i+3 < len(nrgba.Pix); i += 4 {
+		if nrgba.Pix[i+3] == 0 { // transparent pixels are empty cells
+			continue
+		}
+		pixels++
+		rgb := [3]uint8{nrgba.Pix[i], nrgba.Pix[i+1], nrgba.Pix[i+2]}
+		distinct[rgb] = struct{}{}
+
+		key := [3]uint8{rgb[0] >> shift, rgb[1] >> shift, rgb[2] >> shift}
+		cr, ok := ranges[key]
+		if !ok {
+			cr = &colorRange{}
+			ranges[key] = cr
+		}
+		cr.count++
+		cr.r += int(rgb[0])
+		cr.g += int(rgb[1])
+		cr.b += int(rgb[2])
+
+		bin := int(luminance(rgb[:]) * analyzeHistogramBins / 256)
+		analysis.Histogram[minInt(bin, analyzeHistogramBins-1)]++
+	}
+	analysis.DistinctColors = len(distinct)
+	analysis.ColorRanges = len(ranges)
+	if pixels == 0 {
+		return analysis
+	}
+
+	for i := range analysis.Histogram {
+		analysis.Histogram[i] /= float64(pixels)
+	}
+
+	sorted := make([]*colorRange, 0, len(ranges))
+	for _, cr := range ranges {
+		sorted = append(sorted, cr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].r+sorted[i].g+sorted[i].b < sorted[j].r+sorted[j].g+sorted[j].b
+	})
+	for _, cr := range sorted[:minInt(dominantColors, len(sorted))] {
+		analysis.DominantColors = append(analysis.DominantColors, colorShare{
+			Color: fmt.Sprintf("#%02X%02X%02X", cr.r/cr.count, cr.g/cr.count, cr.b/cr.count),
+			Share: float64(cr.count) / float64(pixels),
+		})
+	}
+	return analysis
+}
+
+// logColorAnalysis logs the color statistics of an image
+func logColorAnalysis(logger *zap.Logger, name string, analysis colorAnalysis) {
+	logger.Info(name,
+		zap.Int("width", analysis.Width),
+		zap.Int("height", analysis.Height),
+		zap.Int("distinct colors", analysis.DistinctColors),
+		zap.Int("color ranges", analysis.ColorRanges))
+	for _, c := range analysis.DominantColors {
+		logger.Info("Dominant color", zap.String("color", c.Color), zap.Float64("share", c.Share))
+	}
+	for i, share := range analysis.Histogram {
+		logger.Info("Luminance histogram",
+			zap.Int("from", i*256/analyzeHistogramBins),
+			zap.Int("to", (i+1)*256/analyzeHistogramBins-1),
+			zap.Float64("share", share))
+	}
+}
@@ -0,0 +1,128 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// speechCommands are the text-to-speech programs that are looked for if speaking is enabled
+var speechCommands = []string{"say", "espeak-ng", "espeak", "spd-say"}
+
+var (
+	numberWords = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+		"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+	tensWords = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+)
+
+// assistCommand returns the command that steps through the placement of a pattern run by run
+func assistCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "assist",
+		Short: "Step through the placement of a pattern run by run",
+		Long: `Step through the placement of a pattern that was written with --pattern run by run.
+Press enter for the next run, b and enter to go back and q and enter to quit.`,
+		Args: cobra.NoArgs,
+		RunE: startAssist,
+	}
+	cmd.Flags().StringP("pattern", "", "", "JSON file of the bead pattern")
+	cmd.Flags().IntP("start", "", 1, "step number to start at")
+	cmd.Flags().BoolP("speak", "", false, "read every run aloud with a text-to-speech program like say or espeak")
+	cmd.Flags().StringP("speak-command", "", "", "text-to-speech program that gets the text as argument, detected automatically if not set")
+	return cmd
+}
+
+func startAssist(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	patternFileName, _ := cmd.Flags().GetString("pattern")
+	start, _ := cmd.Flags().GetInt("start")
+	speak, _ := cmd.Flags().GetBool("speak")
+	speakCommand, _ := cmd.Flags().GetString("speak-command")
+	if patternFileName == "" {
+		return cmd.Help()
+	}
+
+	pattern, err := loadPatternFile(patternFileName)
+	if err != nil {
+		logger.Error("Loading pattern failed", zap.Error(err))
+		return inputError(err)
+	}
+	steps := placementSteps(pattern)
+	if len(steps) == 0 {
+		logger.Warn("Pattern contains no beads to place")
+		return nil
+	}
+
+	if speak && speakCommand == "" {
+		for _, command := range speechCommands {
+			if _, err = exec.LookPath(command); err == nil {
+				speakCommand = command
+				break
+			}
+		}
+		if speakCommand == "" {
+			logger.Warn("No text-to-speech program found", zap.Strings("programs", speechCommands))
+		}
+	}
+
+	in := bufio.NewReader(cmd.InOrStdin())
+	out := cmd.OutOrStdout()
+	for i := minInt(maxInt(start, 1), len(steps)) - 1; i < len(steps); {
+		step := steps[i]
+		direction := "→"
+		if step.Reverse {
+			direction = "←"
+		}
+		fmt.Fprintf(out, "[%d/%d] Board %s, row %d %s: %s (%d more in this row) ",
+			i+1, len(steps), step.Board, step.Row, direction, placementRun{bead: step.Bead, count: step.Count}, step.Remaining)
+		if speakCommand != "" {
+			if err = exec.Command(speakCommand, spokenRun(step)).Run(); err != nil {
+				logger.Warn("Speaking failed", zap.String("program", speakCommand), zap.Error(err))
+			}
+		}
+
+		line, err := in.ReadString('\n')
+		if err != nil { // input was closed
+			fmt.Fprintln(out)
+			return nil
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "q":
+			return nil
+		case "b":
+			i = maxInt(i-1, 0)
+		default:
+			i++
+		}
+	}
+	fmt.Fprintln(out, "All beads placed.")
+	return nil
+}
+
+// spokenRun returns the text that is spoken for a run, like "four white" for 4×H1 White
+func spokenRun(step placementStep) string {
+	name := step.Bead
+	if parts := strings.SplitN(name, " ", 2); len(parts) == 2 { // skip the bead code
+		name = parts[1]
+	}
+	return numberWord(step.Count) + " " + strings.ToLower(name)
+}
+
+// numberWord returns the english word of numbers below 100 and the digits of larger numbers
+func numberWord(n int) string {
+	switch {
+	case n < 0 || n >= 100:
+		return strconv.Itoa(n)
+	case n < len(numberWords):
+		return numberWords[n]
+	case n%10 == 0:
+		return tensWords[n/10]
+	default:
+		return tensWords[n/10] + "-" + numberWords[n%10]
+	}
+}
@@ -0,0 +1,160 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// generated fills of the empty cells of a pattern
+const (
+	fillChecker  = "checker"
+	fillStripes  = "stripes"
+	fillGradient = "gradient"
+)
+
+// fillStripeWidth is the width in beads of every diagonal stripe
+const fillStripeWidth = 2
+
+// bayerMatrix is the 4x4 ordered dithering matrix that blends the bands of a gradient fill
+var bayerMatrix = [4][4]float64{
+	{0, 8, 2, 10},
+	{12, 4, 14, 6},
+	{3, 11, 1, 9},
+	{15, 7, 13, 5},
+}
+
+// backgroundFill is a generated fill of the empty cells of a pattern
+type backgroundFill struct {
+	kind  string
+	beads []string // bead codes or names
+}
+
+// fillNames returns the names of all background fills
+func fillNames() []string {
+	return []string{fillChecker, fillStripes, fillGradient}
+}
+
+// parseBackgroundFill parses a background fill like checker:H1,H47
+func parseBackgroundFill(value string) (*backgroundFill, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid background fill '%s', expected fill:beads like checker:H1,H47", value)
+	}
+	fill := &backgroundFill{kind: parts[0]}
+	if fill.kind != fillChecker && fill.kind != fillStripes && fill.kind != fillGradient {
+		return nil, fmt.Errorf("invalid background fill '%s', expected %s", fill.kind, strings.Join(fillNames(), ", "))
+	}
+	for _, bead := range strings.Split(parts[1], ",") {
+		if bead = strings.TrimSpace(bead); bead != "" {
+			fill.beads = append(fill.beads, bead)
+		}
+	}
+	if len(fill.beads) < 2 && fill.kind != fillChecker {
+		return nil, fmt.Errorf("background fill '%s' needs at least two beads", value)
+	}
+	if len(fill.beads) == 0 {
+		return nil, fmt.Errorf("background fill '%s' has no bead", value)
+	}
+	return fill, nil
+}
+
+// fillBackground replaces the background cells of the pattern by the generated fill. A checker fill
+// alternates the beads between neighboring cells, stripes run diagonally and a gradient blends the beads from
+// the top to the bottom with ordered dithering.
+func (m *beadMachine) fillBackground(pattern *Pattern) error {
+	cells, err := beadCells(pattern.Palette, m.backgroundFill.beads)
+	if err != nil {
+		return err
+	}
+
+	var source *image.NRGBA
+	if pattern.Source != nil {
+		source = image.NewNRGBA(image.Rect(0, 0, pattern.Width, pattern.Height))
+		draw.Draw(source, source.Bounds(), pattern.Source, pattern.Source.Bounds().Min, draw.Src)
+	}
+	background := backgroundCells(pattern)
+	filled := 0
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			if !background[x+y*pattern.Width] {
+				continue
+			}
+			cell := pattern.Cell(x, y)
+			*cell = cells[m.fillIndex(x, y, pattern.Height, len(cells))]
+			if source != nil {
+				source.Set(x, y, cell.Color)
+			}
+			filled++
+		}
+	}
+	if source != nil {
+		pattern.Source = source // the filled cells match their bead exactly
+	}
+
+	m.logger.Info("Background filled", zap.String("fill", m.backgroundFill.kind), zap.Int("cells", filled))
+	return nil
+}
+
+// backgroundCells returns the cells that belong to the background: all empty cells and the cells of the bead
+// of the top left corner that are connected to the pattern edges, like the white background of a drawing.
+// Enclosed areas of that bead are part of the motif and are kept.
+func backgroundCells(pattern *Pattern) []bool {
+	width, height := pattern.Width, pattern.Height
+	background := make([]bool, width*height)
+	corner := pattern.Cell(0, 0)
+	isBackground := func(x, y int) bool {
+		cell := pattern.Cell(x, y)
+		return cell.Empty() || (!corner.Empty() && cell.Bead == corner.Bead)
+	}
+
+	var stack []int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			cell := pattern.Cell(x, y)
+			i := x + y*width
+			if cell.Empty() || ((x == 0 || y == 0 || x == width-1 || y == height-1) && isBackground(x, y)) {
+				background[i] = true
+				stack = append(stack, i)
+			}
+		}
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%width, i/width
+		for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+				continue
+			}
+			if j := n.X + n.Y*width; !background[j] && isBackground(n.X, n.Y) {
+				background[j] = true
+				stack = append(stack, j)
+			}
+		}
+	}
+	return background
+}
+
+// fillIndex returns the index of the bead of the background fill at the cell position
+func (m *beadMachine) fillIndex(x, y, height, beads int) int {
+	switch m.backgroundFill.kind {
+	case fillStripes:
+		return (x + y) / fillStripeWidth % beads
+	case fillGradient:
+		if height < 2 {
+			return 0
+		}
+		position := float64(y) / float64(height-1) * float64(beads-1)
+		band := int(position)
+		if position-float64(band) > (bayerMatrix[y%4][x%4]+0.5)/16 {
+			band++
+		}
+		return minInt(band, beads-1)
+	default:
+		return (x + y) % beads
+	}
+}
@@ -0,0 +1,171 @@
+package beadmachine
+
+import (
+	"image"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// batchOutputFileName, batchPosterFileName and batchWordChartFileName are the output filenames of batch inputs if
+// none are given, they are prefixed with the input filename like the default output filenames of a single input
+const (
+	batchOutputFileName    = "beads.png"
+	batchPosterFileName    = "poster.pdf"
+	batchWordChartFileName = "wordchart.txt"
+)
+
+// outputName returns the filename of an output of the current input. For batches it is prefixed with the input
+// filename and a filename without a directory is placed next to the input. For sprite sheets the frame number
+// is appended.
+func (m *beadMachine) outputName(fileName string) string {
+	if m.outputPrefix == "" && m.frameSuffix == "" {
+		return fileName
+	}
+	dir, base := splitOutputPath(fileName)
+	if m.outputPrefix != "" && base == fileName {
+		dir = filepath.Dir(m.inputFileName)
+	}
+	return joinOutputPath(dir, m.outputPrefix+frameFileName(base, m.frameSuffix))
+}
+
+// selectBatchInput makes the input file of a batch the current input
+func (m *beadMachine) selectBatchInput(inputFileName, outputFileName string) {
+	base := filepath.Base(inputFileName)
+	m.inputFileName = inputFileName
+	m.outputPrefix = strings.TrimSuffix(base, filepath.Ext(base)) + "_"
+	if m.report != nil {
+		m.report.setInput(inputFileName)
+	}
+	m.outputFileName = outputFileName
+	if outputFileName == "" {
+		m.outputFileName = batchOutputFileName
+	}
+}
+
+// processBatch converts all input files of a batch, a failing input does not stop the other inputs from
+// being converted
+func (m *beadMachine) processBatch() error {
+	inputFileName, outputFileName := m.inputFileName, m.outputFileName
+	defer func() {
+		m.inputFileName, m.outputFileName, m.outputPrefix = inputFileName, outputFileName, ""
+	}()
+	if m.sharedPalette {
+		return m.processSharedPalette(outputFileName)
+	}
+
+	var c *checkpoint
+	if m.checkpointFileName != "" {
+		var err error
+		if c, err = m.openCheckpoint(); err != nil {
+			m.logger.Error("Opening checkpoint failed", zap.String("file", m.checkpointFileName), zap.Error(err))
+			return err
+		}
+		defer func() {
+			if err := c.close(); err != nil {
+				m.logger.Warn("Closing checkpoint failed", zap.Error(err))
+			}
+		}()
+	}
+
+	var batchErr error
+	failed, resumed := 0, 0
+	for i, input := range m.inputFileNames {
+		if err := m.cancelled(); err != nil { // the converted inputs keep their outputs
+			m.logger.Error("Batch cancelled", zap.Int("skipped", len(m.inputFileNames)-i), zap.Error(err))
+			batchErr = err
+			break
+		}
+		m.selectBatchInput(input, outputFileName)
+		var inputHash string
+		if c != nil {
+			hash, converted, err := c.check(input)
+			if converted {
+				m.logger.Info("Batch input already converted", zap.String("file", input))
+				resumed++
+				continue
+			}
+			if err != nil {
+				// processing the input reports the error
+				m.logger.Debug("Hashing batch input failed", zap.String("file", input), zap.Error(err))
+			}
+			inputHash = hash
+		}
+		m.logger.Info("Converting batch input", zap.String("file", input))
+		if err := m.processInput(); err != nil {
+			m.logger.Error("Batch input skipped", zap.String("file", input), zap.Error(err))
+			failed++
+			if batchErr == nil {
+				batchErr = err
+			}
+			continue
+		}
+		if c != nil && inputHash != "" {
+			if err := c.record(input, inputHash); err != nil {
+				m.logger.Warn("Recording checkpoint failed", zap.String("file", input), zap.Error(err))
+			}
+		}
+	}
+	m.logger.Info("Batch processed", zap.Int("inputs", len(m.inputFileNames)), zap.Int("failed", failed),
+		zap.Int("resumed", resumed))
+	return batchErr
+}
+
+// processSharedPalette converts all input files of a batch with the bead colors of a color limit selected
+// across all inputs, so that a set of related patterns uses the same beads
+func (m *beadMachine) processSharedPalette(outputFileName string) error {
+	var images []image.Image
+	counts := make([]int, len(m.inputFileNames)) // images per input, sprite sheets have an image per frame
+	for i, input := range m.inputFileNames {
+		if err := m.cancelled(); err != nil {
+			m.logger.Error("Batch cancelled", zap.Error(err))
+			return err
+		}
+		m.selectBatchInput(input, outputFileName)
+		if m.spriteSheet != "" {
+			frames, err := m.spriteFrames()
+			if err != nil {
+				return err
+			}
+			images = append(images, frames...)
+			counts[i] = len(frames)
+			continue
+		}
+		inputImage, err := m.prepareImage()
+		if err != nil {
+			return err
+		}
+		images = append(images, inputImage)
+		counts[i] = 1
+	}
+
+	patterns, err := m.matchImages(images)
+	if err != nil {
+		return err
+	}
+
+	var outputErr error
+	for i, input := range m.inputFileNames {
+		m.selectBatchInput(input, outputFileName)
+		inputPatterns := patterns[:counts[i]]
+		patterns = patterns[counts[i]:]
+		if m.spriteSheet != "" {
+			err = m.writeFrames(inputPatterns)
+		} else {
+			err = m.writeOutputs(inputPatterns[0])
+		}
+		if err != nil && outputErr == nil {
+			outputErr = err
+		}
+
+		if m.projectDBFileName != "" {
+			if err = m.saveProject(inputPatterns[0]); err != nil {
+				m.logger.Error("Saving project failed", zap.Error(err))
+				return failureError(err)
+			}
+		}
+	}
+	m.logger.Info("Batch processed with shared palette", zap.Int("inputs", len(m.inputFileNames)))
+	return outputErr
+}
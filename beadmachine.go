@@ -1,21 +1,42 @@
-package main
+package beadmachine
 
 import (
+	"context"
+	"crypto/ed25519"
+	"html/template"
 	"image"
 	"image/color"
 	_ "image/gif"
 	_ "image/jpeg"
-	"image/png"
-	"math"
 	"os"
-	"sync"
+	texttemplate "text/template"
 	"time"
 
-	"github.com/disintegration/imaging"
 	chromath "github.com/jkl1337/go-chromath"
 	"go.uber.org/zap"
 )
 
+// fit strategies for resizing an image when both width and height are given
+const (
+	fitContain = "contain" // keep the aspect ratio and fill the remaining area with empty cells
+	fitCover   = "cover"   // keep the aspect ratio and crop the image in the center
+	fitStretch = "stretch" // ignore the aspect ratio
+)
+
+// resampling filters for resizing an image
+const (
+	resampleLanczos = "lanczos" // sharp results for photos
+	resampleLinear  = "linear"
+	resampleBox     = "box"     // averages all covered pixel
+	resampleNearest = "nearest" // keeps the hard edges of pixel art
+)
+
+// alignments of the image when padding it to full boards
+const (
+	padAlignCenter  = "center"
+	padAlignTopLeft = "top-left"
+)
+
 // BeadConfig configures a bead color
 type BeadConfig struct {
 	R, G, B     uint8
@@ -24,143 +45,558 @@ type BeadConfig struct {
 	Flourescent bool
 }
 
+// colorMatch is a cached result of a bead color matching
+type colorMatch struct {
+	beadName string
+	distance float64
+}
+
 type beadMachine struct {
 	logger *zap.Logger
+	ctx    context.Context // cancels the conversion on Ctrl-C, a timeout or a closed GUI request
 
-	colorMatchCache     map[color.Color]string
-	colorMatchCacheLock sync.RWMutex
-	rgbLabCache         map[color.Color]chromath.Lab
-	rgbLabCacheLock     sync.RWMutex
-	beadStatsDone       chan struct{}
+	colorCache     *colorCache
+	colorCacheSize int
+	cachePrecision int // bits per color channel that colors are quantized to before matching
 
 	labTransformer *chromath.LabTransformer
 	rgbTransformer *chromath.RGBTransformer
+	colorDistance  ColorDistance // metric that picks the closest bead color
+	distanceName   string        // registered name of the color distance metric
 	beadFillPixel  color.RGBA
+	chartCellSize  int // size in pixel of the cells of the PNG and HTML charts, 0 for the default size
+
+	inputFileName         string
+	inputFileNames        []string     // all input files of a batch, the current one is inputFileName
+	composition           *composition // images that are arranged into the input image
+	sharedPalette         bool         // select the colors of a color limit across all inputs of a batch
+	checkpointFileName    string       // records the converted inputs of a batch
+	resume                bool         // skip the batch inputs that the checkpoint records as converted
+	outputPrefix          string       // prefix of the output filenames of the current batch input
+	galleryFileName       string
+	galleryEntries        []galleryEntry // written patterns of the run for the gallery and the notification
+	notifyWebhook         string         // webhook URL that is notified when the run finishes
+	fromClipboard         bool
+	toClipboard           bool
+	previewTerminal       bool          // show the pattern in the terminal after the conversion
+	previewColumns        int           // width of the terminal preview, 0 for the width of the terminal
+	previewInline         string        // graphics protocol that the PNG pattern is shown in the terminal with
+	watch                 bool          // convert again whenever the input or palette file changes
+	watchInterval         time.Duration // interval in which the watched files are checked for changes
+	watchPrevious         *Pattern      // pattern of the previous conversion of the watch
+	pdfPage               int           // page of a PDF input file, counted from 1
+	pdfDPI                int
+	ignoreExif            bool       // do not rotate JPEG inputs by their EXIF orientation
+	maxInputDimension     int        // maximum width and height of the input image, 0 for unlimited
+	maxInputMegapixels    float64    // maximum megapixels of the input image, 0 for unlimited
+	tracer                *tracer    // exports the spans of the pipeline stages, nil if tracing is disabled
+	span                  *traceSpan // current span that the spans of the stages are children of
+	spriteSheet           string     // grid of the sprite sheet frames like 4x4 or auto
+	spriteColumns         int
+	spriteRows            int
+	frameSuffix           string // suffix of the output filenames of the current sprite sheet frame
+	outputFileName        string
+	outDir                string                 // directory of all outputs, replaces the directory of their filenames
+	nameTemplate          *texttemplate.Template // filename template of all outputs like {{.Stem}}_{{.Width}}w
+	htmlFileName          string
+	htmlTemplate          *template.Template // custom template of the HTML output
+	htmlRenderer          string             // layout of the HTML output, a table or a canvas viewer
+	language              string             // language of the text in the HTML and PDF outputs
+	units                 string             // unit system of the physical dimensions
+	beadPitch             float64            // distance in mm between the centers of two neighboring beads
+	palette               string             // palette URI
+	comparisonPalettes    []string
+	previewWidths         []int              // bead widths of the quick previews that are written instead of the pattern
+	beadPrices            map[string]float64 // price per bead by palette name
+	gamutFileName         string
+	errorMapFileName      string
+	statsFileName         string
+	instructionsFileName  string
+	wordChartFileName     string
+	placementFileName     string
+	embedFileName         string
+	patternFileName       string
+	tilesDirectory        string
+	layersDirectory       string
+	posterFileName        string
+	colorByNumberFileName string
+	pdfFileName           string
+	pdfScale              string // fit the PDF chart to the page or print it in its real size
+	printActualSize       bool   // write the PNG output in the real size of the pattern
+	printDPI              int
+	regionsFileName       string
+	bundleFileName        string
+	signingKey            ed25519.PrivateKey // signs the manifest of the bundle
+	posterPaper           string
+	renderOutputs         []string
 
-	inputFileName   string
-	outputFileName  string
-	htmlFileName    string
-	paletteFileName string
+	projectDBFileName string
+	deductInventory   bool
 
 	width          int
 	height         int
 	boardsWidth    int
 	boardsHeight   int
 	boardDimension int
+	fit            string
+	resample       string
+	autoOrient     bool
+	optimizeSeams  bool
+	seamMargin     int
+	padToBoards    bool
+	padAlign       string
+	grid           string // square or offset, see gridOffset
+	tile           string // grid of the repeated motif like 3x2
+	tileColumns    int
+	tileRows       int
+	tileMirror     string
+	border         []string // border definitions like 2:H18
+	borders        []border
+	fill           string // generated fill of the empty cells like checker:H1,H47
+	backgroundFill *backgroundFill
+	maxBeads       int              // bead budget that the pattern is scaled down to, 0 for unlimited
+	strict         bool             // fail instead of scaling the pattern down to the bead budget
+	report         *reportCollector // collects the warnings and errors per batch input, nil without report
+	outputStatuses []outputStatus   // status of the written outputs of the current pattern, for the stats
 
-	beadStyle   bool
-	translucent bool
-	flourescent bool
+	goldenFileName  string // golden file that the pattern is compared to for regression tests
+	goldenTolerance int    // amount of cells that may differ from the golden file
+	updateGolden    bool   // write the golden file instead of comparing to it
+
+	beadStyle  bool
+	serpentine bool
+
+	coordinates         bool
+	colorblindSafe      bool
+	colors              []string // bead colors that the palette is restricted to, all if empty
+	simulateCVD         string
+	coordinatesInterval int
+	translucent         bool
+	flourescent         bool
+	mergeDuplicates     bool
+	duplicateThreshold  float64
+	substitutions       map[string]string // bead codes or names that are replaced after matching
+	maxColors           int
+	preserveFaces       bool
+	adaptiveDither      bool
+	autoTune            bool // search the dithering, contrast and max colors with the best score before converting
+	tuneIterations      int
 
 	noColorMatching bool
 	greyScale       bool
+	autoLevels      bool
+	autoContrast    bool
+	blackPoint      int
+	whitePoint      int
+	hueShift        float64
+	temperature     float64
+	tint            float64
+	adjust          []string // selective adjustment definitions
+	adjustments     []selectiveAdjustment
 	blur            float64
 	sharpen         float64
 	gamma           float64
 	contrast        float64
 	brightness      float64
+	stylize         string // artistic style that simplifies the image into flat colored regions
+	subjectFocus    bool   // flatten the background around the foreground subject
+
+	gamutThreshold float64
+	gamutWarnings  bool // log colors outside of the gamut as warnings, only if the threshold was set
+}
+
+// newBeadMachine returns a bead machine with initialized caches and color transformers
+func newBeadMachine(logger *zap.Logger) *beadMachine {
+	return &beadMachine{
+		logger: logger,
+		ctx:    context.Background(),
+
+		colorCache:     newColorCache(defaultColorCacheSize),
+		colorCacheSize: defaultColorCacheSize,
+		cachePrecision: maxCachePrecision,
+
+		labTransformer: chromath.NewLabTransformer(&chromath.IlluminantRefD50),
+		rgbTransformer: chromath.NewRGBTransformer(&chromath.SpaceSRGB, &chromath.AdaptationBradford, &chromath.IlluminantRefD50, &chromath.Scaler8bClamping, 1.0, nil),
+		colorDistance:  colorDistances[distanceCIEDE2000],
+		distanceName:   distanceCIEDE2000,
+		beadFillPixel:  color.RGBA{225, 225, 225, 255}, // light grey
+
+		boardDimension: 20,
+		language:       defaultLanguage,
+		units:          unitsMetric,
+		beadPitch:      beadSizes[defaultBeadSize],
+		pdfScale:       pdfScaleFit,
+		printDPI:       defaultPrintDPI,
+		posterPaper:    "A4",
+		pdfPage:        1,
+		pdfDPI:         defaultPDFDPI,
+		fit:            fitStretch,
+		resample:       resampleLanczos,
+		padAlign:       padAlignCenter,
+		tileMirror:     tileMirrorNone,
+		whitePoint:     255,
+
+		coordinatesInterval: 5,
+		duplicateThreshold:  1.0,
+	}
+}
+
+// process converts the input images to bead patterns and writes all outputs
+func (m *beadMachine) process() error {
+	if m.watch {
+		return m.watchInput()
+	}
+
+	start := time.Now()
+	m.span = m.tracer.start("beadmachine", nil)
+	m.span.set("inputs", len(m.inputFileNames))
+	var err error
+	if len(m.inputFileNames) > 1 {
+		err = m.processBatch()
+	} else {
+		err = m.processInput()
+	}
+
+	if m.galleryFileName != "" && len(m.galleryEntries) > 0 {
+		if galleryErr := m.writeGallery(); galleryErr != nil {
+			m.logger.Error("Writing gallery failed", zap.Error(galleryErr))
+			if err == nil {
+				err = outputError(galleryErr)
+			}
+		}
+	}
+	if m.notifyWebhook != "" {
+		m.notifyCompletion(time.Since(start), err)
+	}
+	if err != nil {
+		m.span.set("exit.code", exitCode(err))
+	}
+	m.span.finish(err)
+	if traceErr := m.tracer.flush(); traceErr != nil {
+		m.logger.Warn("Exporting trace failed", zap.Error(traceErr))
+	}
+	return err
+}
+
+// processInput converts the input image to a bead pattern and writes all outputs
+func (m *beadMachine) processInput() (err error) {
+	if len(m.comparisonPalettes) > 0 {
+		return m.comparePalettes()
+	}
+	if m.spriteSheet != "" {
+		return m.processSpriteSheet()
+	}
+	if len(m.previewWidths) > 0 {
+		return m.processPreviews()
+	}
+
+	if m.autoTune {
+		defer m.applyTuneSettings(m.currentTuneSettings()) // every input of a batch is tuned from the given settings
+		if err := m.tuneConversion(); err != nil {
+			return err
+		}
+	}
+
+	parent := m.span
+	m.span = m.tracer.start("convert", parent)
+	m.span.set("input", m.inputFileName)
+	defer func() {
+		m.span.finish(err)
+		m.span = parent
+	}()
+
+	pattern, err := m.convert()
+	if err != nil {
+		return err
+	}
+
+	outputErr := m.writeOutputs(pattern)
+	if m.goldenFileName != "" {
+		if err = m.verifyGolden(m.goldenFileName, pattern, m.goldenTolerance, m.updateGolden); err != nil {
+			m.logger.Error("Golden file check failed", zap.String("file", m.goldenFileName), zap.Error(err))
+			return failureError(err)
+		}
+	}
+	if m.toClipboard {
+		if err = writeClipboardImage(m.patternImage(pattern)); err != nil {
+			m.logger.Error("Copying pattern to clipboard failed", zap.Error(err))
+			if outputErr == nil {
+				outputErr = outputError(err)
+			}
+		} else {
+			m.logger.Info("Pattern copied to clipboard")
+		}
+	}
+	if m.previewTerminal {
+		columns := m.previewColumns
+		if columns == 0 {
+			columns = terminalColumns()
+		}
+		if err = writeTerminalPreview(os.Stdout, pattern, columns, terminalTrueColor()); err != nil {
+			m.logger.Error("Writing terminal preview failed", zap.Error(err))
+			if outputErr == nil {
+				outputErr = outputError(err)
+			}
+		}
+	}
+	if m.watch {
+		if err = m.writeWatchPreview(pattern, os.Stdout); err != nil {
+			m.logger.Error("Writing watch preview failed", zap.Error(err))
+			if outputErr == nil {
+				outputErr = outputError(err)
+			}
+		}
+	} else if m.previewInline != "" {
+		if err = m.writeInlinePreview(pattern, os.Stdout); err != nil {
+			m.logger.Error("Writing inline preview failed", zap.Error(err))
+			if outputErr == nil {
+				outputErr = outputError(err)
+			}
+		}
+	}
+
+	if m.projectDBFileName != "" {
+		if err = m.saveProject(pattern); err != nil {
+			m.logger.Error("Saving project failed", zap.Error(err))
+			return failureError(err)
+		}
+	}
+	return outputErr
+}
+
+// convert reads, filters and resizes the input image and matches it to the bead palette
+func (m *beadMachine) convert() (*Pattern, error) {
+	inputImage, err := m.prepareImage()
+	if err != nil {
+		return nil, err
+	}
+	return m.matchImage(inputImage)
+}
+
+// prepareImage reads, filters and resizes the input image
+func (m *beadMachine) prepareImage() (image.Image, error) {
+	newWidth, newHeight := m.targetSize()
+	inputImage, err := m.readInput(newWidth, newHeight)
+	if err != nil {
+		return nil, err
+	}
+	inputImage = m.applyFilters(inputImage) // apply filters before resizing for better results
+	return m.fitImage(inputImage)
 }
 
-func (m *beadMachine) process() {
-	inputImage, err := readImageFile(m.inputFileName)
+// readInput reads the input image, SVG files are rasterized at the given size if it is set
+func (m *beadMachine) readInput(newWidth, newHeight int) (image.Image, error) {
+	span := m.startSpan("decode")
+	var inputImage image.Image
+	var err error
+	switch {
+	case m.fromClipboard:
+		inputImage, err = readClipboardImage()
+	case m.composition != nil:
+		inputImage, err = m.composeImage()
+	case isSVGFile(m.inputFileName) && (newWidth > 0 || newHeight > 0): // rasterize vectors at the bead resolution
+		inputImage, err = rasterizeSVG(m.inputFileName, newWidth, newHeight, m.fit != fitStretch)
+	case isPDFFile(m.inputFileName):
+		inputImage, err = rasterizePDF(m.inputFileName, m.pdfPage, m.pdfDPI)
+	default:
+		if err = m.checkInputFileSize(m.inputFileName); err == nil {
+			inputImage, err = readImageFile(m.inputFileName, !m.ignoreExif)
+		}
+	}
+	if err == nil {
+		err = m.checkInputSize(inputImage.Bounds().Dx(), inputImage.Bounds().Dy())
+	}
 	if err != nil {
 		m.logger.Error("Reading image file failed", zap.Error(err))
-		return
+		span.finish(err)
+		return nil, inputError(err)
 	}
 
 	imageBounds := inputImage.Bounds()
 	m.logger.Info("Image pixels",
 		zap.Int("width", imageBounds.Dx()),
 		zap.Int("height", imageBounds.Dy()))
+	span.set("image.width", imageBounds.Dx())
+	span.set("image.height", imageBounds.Dy())
+	span.finish(nil)
+	return inputImage, nil
+}
 
-	inputImage = m.applyFilters(inputImage) // apply filters before resizing for better results
-
-	newWidth := m.width
-	// resize the image if needed
-	if m.boardsWidth > 0 { // a given boards number overrides a possible given pixel number
-		newWidth = m.boardsWidth * m.boardDimension
-	}
-
-	newHeight := m.height
-	if m.boardsHeight > 0 {
-		newHeight = m.boardsHeight * m.boardDimension
+// fitImage resizes the filtered image to the target size and the bead budget, optimizes the board seams and
+// pads it to full boards
+func (m *beadMachine) fitImage(inputImage image.Image) (image.Image, error) {
+	span := m.startSpan("resize")
+	if m.autoOrient {
+		inputImage = m.orientImage(inputImage)
 	}
+	newWidth, newHeight := m.targetSize()
+	original := inputImage
+	imageBounds := inputImage.Bounds()
 	resized := false
 	if newWidth > 0 || newHeight > 0 {
-		inputImage = imaging.Resize(inputImage, newWidth, newHeight, imaging.Lanczos)
+		inputImage = m.resizeImage(inputImage, newWidth, newHeight)
 		imageBounds = inputImage.Bounds()
 		resized = true
 	}
+	if m.maxBeads > 0 {
+		scaled, ok, err := m.fitBeadBudget(original, inputImage)
+		if err != nil {
+			span.finish(err)
+			return nil, err
+		}
+		if ok {
+			inputImage = scaled
+			imageBounds = inputImage.Bounds()
+			resized = true
+		}
+	}
+	if m.optimizeSeams {
+		inputImage = m.shiftSeams(inputImage)
+		imageBounds = inputImage.Bounds()
+		resized = true
+	}
+	if m.padToBoards {
+		inputImage = m.padImageToBoards(inputImage)
+		imageBounds = inputImage.Bounds()
+		resized = true
+	}
+	if m.grid == gridOffset {
+		inputImage = offsetImage(inputImage)
+	}
 
 	m.logger.Info("Bead board used",
-		zap.Int("width", calculateBeadBoardsNeeded(imageBounds.Dx())),
-		zap.Int("height", calculateBeadBoardsNeeded(imageBounds.Dy())))
-	m.logger.Info("Bead board measurement in cm",
-		zap.Float64("width", float64(imageBounds.Dx())*0.5),
-		zap.Float64("height", float64(imageBounds.Dy())*0.5))
-
-	beadModeImageBounds := imageBounds
-	if m.beadStyle { // each pixel will be a bead of 8x8 pixel
-		beadModeImageBounds.Max.X *= 8
-		beadModeImageBounds.Max.Y *= 8
-	}
-	outputImage := image.NewRGBA(beadModeImageBounds)
+		zap.Int("width", boardsNeeded(imageBounds.Dx(), m.boardDimension)),
+		zap.Int("height", boardsNeeded(imageBounds.Dy(), m.boardDimension)))
+	size := m.physicalSize(imageBounds.Dx(), imageBounds.Dy())
+	m.logger.Info("Bead board measurement",
+		zap.Float64("width", size.Width),
+		zap.Float64("height", size.Height),
+		zap.String("unit", size.Unit))
 
 	if resized || m.beadStyle {
 		m.logger.Info("Output image pixels",
 			zap.Int("width", imageBounds.Dx()),
 			zap.Int("height", imageBounds.Dy()))
 	}
+	span.set("pattern.width", imageBounds.Dx())
+	span.set("pattern.height", imageBounds.Dy())
+	span.finish(nil)
+	return inputImage, nil
+}
 
-	if m.noColorMatching {
-		for y := imageBounds.Min.Y; y < imageBounds.Max.Y; y++ {
-			for x := imageBounds.Min.X; x < imageBounds.Max.X; x++ {
-				pixelColor := inputImage.At(x, y)
-				r, g, b, _ := pixelColor.RGBA()
-				pixelRGBA := color.RGBA{uint8(r), uint8(g), uint8(b), 255} // A 255 = no transparency
-				outputImage.SetRGBA(x, y, pixelRGBA)
-			}
-		}
-	} else {
-		startTime := time.Now()
-		if err := m.processImage(imageBounds, inputImage, outputImage); err != nil {
-			m.logger.Error("Processing image failed", zap.Error(err))
-			return
-		}
-		elapsedTime := time.Since(startTime)
-		m.logger.Info("Image processed", zap.Duration("duration", elapsedTime))
+// targetSize returns the size in pixel that the image gets resized to, 0 for a dimension that is
+// calculated from the aspect ratio of the image
+func (m *beadMachine) targetSize() (int, int) {
+	newWidth := m.width
+	if m.boardsWidth > 0 { // a given boards number overrides a possible given pixel number
+		newWidth = m.boardsWidth * m.boardDimension
 	}
 
-	imageWriter, err := os.Create(m.outputFileName)
-	if err != nil {
-		m.logger.Error("Opening output image file failed", zap.Error(err))
-		return
+	newHeight := m.height
+	if m.boardsHeight > 0 {
+		newHeight = m.boardsHeight * m.boardDimension
 	}
-	defer imageWriter.Close()
+	return newWidth, newHeight
+}
 
-	if err = png.Encode(imageWriter, outputImage); err != nil {
-		m.logger.Error("Encoding png file failed", zap.Error(err))
+// matchImage matches the prepared image to the bead palette
+func (m *beadMachine) matchImage(inputImage image.Image) (*Pattern, error) {
+	patterns, err := m.matchImages([]image.Image{inputImage})
+	if err != nil {
+		return nil, err
 	}
+	return patterns[0], nil
 }
 
-// calculateBeadUsage calculates the bead usage
-func (m *beadMachine) calculateBeadUsage(beadUsageChan <-chan string) {
-	colorUsageCounts := make(map[string]int)
+// matchImages matches the prepared images to the bead palette, the bead colors of a color limit are selected
+// across all images so that they use the same colors
+func (m *beadMachine) matchImages(inputImages []image.Image) ([]*Pattern, error) {
+	span := m.startSpan("match")
+	var err error
+	defer func() { span.finish(err) }()
+	patterns := make([]*Pattern, len(inputImages))
+	if m.noColorMatching {
+		for i, inputImage := range inputImages {
+			patterns[i] = m.unmatchedPattern(inputImage)
+			if m.tile != "" {
+				patterns[i] = m.tilePattern(patterns[i])
+			}
+			patterns[i].Grid = m.patternGrid()
+		}
+		return patterns, nil
+	}
 
-	for beadName := range beadUsageChan {
-		colorUsageCounts[beadName]++
+	startTime := time.Now()
+	for i, inputImage := range inputImages {
+		if patterns[i], err = m.matchPattern(inputImage); err != nil {
+			if patterns[i] != nil && exitCode(err) == exitCancelled {
+				m.writePartialStats(patterns[i])
+			}
+			m.logger.Error("Processing image failed", zap.Error(err))
+			return nil, err
+		}
+	}
+	if m.maxColors > 0 {
+		if patterns, err = m.reduceColors(inputImages, patterns); err != nil {
+			m.logger.Error("Reducing bead colors failed", zap.Error(err))
+			return nil, err
+		}
 	}
+	if len(m.substitutions) > 0 {
+		for _, pattern := range patterns {
+			if err = m.substituteBeads(pattern); err != nil {
+				m.logger.Error("Substituting beads failed", zap.Error(err))
+				return nil, paletteError(err)
+			}
+		}
+	}
+	for i := range patterns {
+		if m.tile != "" {
+			patterns[i] = m.tilePattern(patterns[i])
+		}
+		if m.backgroundFill != nil {
+			if err = m.fillBackground(patterns[i]); err != nil {
+				m.logger.Error("Filling background failed", zap.Error(err))
+				return nil, paletteError(err)
+			}
+		}
+		if len(m.borders) > 0 {
+			if patterns[i], err = m.addBorders(patterns[i]); err != nil {
+				m.logger.Error("Adding border failed", zap.Error(err))
+				return nil, paletteError(err)
+			}
+		}
+		patterns[i].Grid = m.patternGrid()
+	}
+	elapsedTime := time.Since(startTime)
+	m.logger.Info("Image processed", zap.Duration("duration", elapsedTime))
+	span.set("images", len(inputImages))
+	span.set("distance", m.distanceName)
 
-	m.logger.Info("Bead colors", zap.Int("count", len(colorUsageCounts)))
-	for usedColor, count := range colorUsageCounts {
-		m.logger.Info("Beads used", zap.String("color", usedColor), zap.Int("count", count))
+	for _, pattern := range patterns {
+		stats := pattern.Stats()
+		m.logBeadUsage(stats)
+		m.logger.Info("Color matching error",
+			zap.Float64("mean", stats.MeanDistance),
+			zap.Float64("max", stats.MaxDistance))
+		m.logger.Info("Pattern complexity",
+			zap.Float64("average run length", stats.Complexity.AverageRunLength),
+			zap.Float64("color changes per row", stats.Complexity.ColorChangesPerRow),
+			zap.Int("single bead islands", stats.Complexity.Islands))
+		if m.gamutThreshold > 0 {
+			m.reportGamut(pattern)
+		}
+		if m.colorblindSafe {
+			m.checkColorblindSafety(pattern)
+		}
 	}
-	m.beadStatsDone <- struct{}{}
+	return patterns, nil
 }
 
-// calculateBeadBoardsNeeded calculates the needed bead boards based on the standard size of 29 beads for a dimension
-func calculateBeadBoardsNeeded(dimension int) int {
-	neededFloat := float64(dimension) / 29
-	neededFloat = math.Floor(neededFloat + .5)
-	return int(neededFloat) // round up
+// logBeadUsage logs the bead usage
+func (m *beadMachine) logBeadUsage(stats PatternStats) {
+	m.logger.Info("Bead colors", zap.Int("count", stats.Colors))
+	for usedColor, count := range stats.BeadCounts {
+		m.logger.Info("Beads used", zap.String("color", usedColor), zap.Int("count", count))
+	}
 }
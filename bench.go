@@ -0,0 +1,192 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"math/rand"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// benchAlgorithm is the name of the color matching algorithm that is benchmarked
+const benchAlgorithm = "linear"
+
+// benchResult is the measured throughput of a benchmark run
+type benchResult struct {
+	Algorithm   string        `json:"algorithm"`
+	Threads     int           `json:"threads"`
+	Width       int           `json:"width"`
+	Height      int           `json:"height"`
+	PaletteSize int           `json:"paletteSize"`
+	Duration    time.Duration `json:"duration"`   // in nanoseconds
+	Throughput  float64       `json:"throughput"` // megapixels per second
+}
+
+// benchCommand returns the command that benchmarks the color matching
+func benchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Benchmark the color matching with synthetic images",
+		Long: `Benchmark the color matching with synthetic images of random colors at several sizes, palette sizes
+and thread counts and report the throughput in megapixels per second.`,
+		Args: cobra.NoArgs,
+		RunE: startBench,
+	}
+	cmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette that the palette sizes are taken from")
+	cmd.Flags().IntSliceP("sizes", "", []int{50, 100, 200}, "widths and heights of the square synthetic images")
+	cmd.Flags().IntSliceP("palette-sizes", "", []int{8, 16, 0}, "amount of palette colors to match against (0 = all)")
+	cmd.Flags().IntSliceP("threads", "", benchDefaultThreads(), "thread counts to benchmark (0 = all CPUs)")
+	cmd.Flags().Int64P("seed", "", 1, "seed of the random colors of the synthetic images")
+	cmd.Flags().StringP("output", "o", "", "output filename for a JSON file with the results")
+	cmd.Flags().BoolP("stress", "", false, "look up the same colors from concurrent goroutines and check that every color is matched once, for CI runs with -race")
+	cmd.Flags().IntP("stress-colors", "", 4096, "amount of colors of the stress test")
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	return cmd
+}
+
+func startBench(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	palette, _ := cmd.Flags().GetString("palette")
+	sizes, _ := cmd.Flags().GetIntSlice("sizes")
+	paletteSizes, _ := cmd.Flags().GetIntSlice("palette-sizes")
+	threads, _ := cmd.Flags().GetIntSlice("threads")
+	seed, _ := cmd.Flags().GetInt64("seed")
+	outputFileName, _ := cmd.Flags().GetString("output")
+
+	if stress, _ := cmd.Flags().GetBool("stress"); stress {
+		return startStress(cmd, logger)
+	}
+	for _, values := range [][]int{sizes, paletteSizes, threads} {
+		for _, value := range values {
+			if value < 0 {
+				logger.Error("Invalid benchmark value", zap.Int("value", value))
+				return usageError(errors.New("benchmark values can not be negative"))
+			}
+		}
+	}
+
+	provider, err := openPalette(palette)
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+	beads, err := provider.Palette()
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+	beadNames := make([]string, 0, len(beads))
+	for name, bead := range beads {
+		if !bead.Translucent && !bead.Flourescent { // only the colors that are used by default
+			beadNames = append(beadNames, name)
+		}
+	}
+	sort.Strings(beadNames)
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	var results []benchResult
+	for _, size := range sizes {
+		img := benchImage(size, seed)
+		for _, paletteSize := range paletteSizes {
+			if paletteSize == 0 || paletteSize > len(beadNames) {
+				paletteSize = len(beadNames)
+			}
+			for _, threadCount := range threads {
+				if threadCount == 0 {
+					threadCount = runtime.NumCPU()
+				}
+				runtime.GOMAXPROCS(threadCount)
+
+				m := newBeadMachine(zap.NewNop()) // a new machine for empty caches
+				m.palette = palette
+				m.colors = beadNames[:paletteSize]
+				start := time.Now()
+				if _, err = m.matchPattern(img); err != nil {
+					logger.Error("Matching benchmark image failed", zap.Error(err))
+					return err
+				}
+				duration := time.Since(start)
+
+				result := benchResult{
+					Algorithm:   benchAlgorithm,
+					Threads:     runtime.GOMAXPROCS(0),
+					Width:       size,
+					Height:      size,
+					PaletteSize: paletteSize,
+					Duration:    duration,
+					Throughput:  float64(size*size) / 1e6 / duration.Seconds(),
+				}
+				results = append(results, result)
+				logger.Info("Benchmark",
+					zap.String("algorithm", result.Algorithm),
+					zap.Int("threads", result.Threads),
+					zap.Int("size", size),
+					zap.Int("palette size", paletteSize),
+					zap.Duration("duration", duration),
+					zap.Float64("megapixels/s", result.Throughput))
+			}
+		}
+	}
+
+	if outputFileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(outputFileName, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Error("Writing benchmark results failed", zap.Error(err))
+		return outputError(errors.Wrap(err, "writing benchmark results"))
+	}
+	return nil
+}
+
+// startStress runs the stress test of the color cache with four goroutines per CPU
+func startStress(cmd *cobra.Command, logger *zap.Logger) error {
+	colors, _ := cmd.Flags().GetInt("stress-colors")
+	if colors < 1 {
+		logger.Error("Invalid amount of stress test colors", zap.Int("stress-colors", colors))
+		return usageError(fmt.Errorf("invalid amount of stress test colors %d", colors))
+	}
+	goroutines := 4 * runtime.GOMAXPROCS(0)
+	start := time.Now()
+	if err := StressColorCache(goroutines, colors); err != nil {
+		logger.Error("Stress test failed", zap.Error(err))
+		return failureError(err)
+	}
+	logger.Info("Stress test passed",
+		zap.Int("goroutines", goroutines),
+		zap.Int("colors", colors),
+		zap.Duration("duration", time.Since(start)))
+	return nil
+}
+
+// benchDefaultThreads returns the thread counts that are benchmarked by default, a single thread and all CPUs
+func benchDefaultThreads() []int {
+	if runtime.NumCPU() == 1 {
+		return []int{1}
+	}
+	return []int{1, runtime.NumCPU()}
+}
+
+// benchImage returns a square image of random opaque colors, nearly every pixel has a different color so
+// that the color match cache does not hide the matching costs
+func benchImage(size int, seed int64) *image.NRGBA {
+	random := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i] = uint8(random.Intn(256))
+		img.Pix[i+1] = uint8(random.Intn(256))
+		img.Pix[i+2] = uint8(random.Intn(256))
+		img.Pix[i+3] = 255
+	}
+	return img
+}
@@ -0,0 +1,112 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// border is a frame of beads around the pattern, with several beads they alternate in a checkerboard
+type border struct {
+	width int
+	beads []string // bead codes or names
+}
+
+// parseBorders parses border definitions like 2:H18 or 1:H1,H18, every border is added outside of the
+// previous ones
+func parseBorders(definitions []string) ([]border, error) {
+	borders := make([]border, 0, len(definitions))
+	for _, definition := range definitions {
+		parts := strings.SplitN(definition, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid border '%s', expected width:bead like 2:H18", definition)
+		}
+		width, err := strconv.Atoi(parts[0])
+		if err != nil || width <= 0 {
+			return nil, fmt.Errorf("invalid border width '%s'", parts[0])
+		}
+		b := border{width: width}
+		for _, bead := range strings.Split(parts[1], ",") {
+			if bead = strings.TrimSpace(bead); bead != "" {
+				b.beads = append(b.beads, bead)
+			}
+		}
+		if len(b.beads) == 0 {
+			return nil, fmt.Errorf("border '%s' has no bead", definition)
+		}
+		borders = append(borders, b)
+	}
+	return borders, nil
+}
+
+// borderWidth returns the width of all borders around the pattern
+func (m *beadMachine) borderWidth() int {
+	width := 0
+	for _, b := range m.borders {
+		width += b.width
+	}
+	return width
+}
+
+// beadCells returns exactly matching cells of the palette beads with the given codes or names
+func beadCells(palette map[string]BeadConfig, beads []string) ([]Cell, error) {
+	cells := make([]Cell, len(beads))
+	for i, codeOrName := range beads {
+		name, ok := findBead(palette, codeOrName)
+		if !ok {
+			return nil, fmt.Errorf("bead '%s' is not part of the palette", codeOrName)
+		}
+		bead := palette[name]
+		cells[i] = Cell{Bead: name, Color: color.RGBA{bead.R, bead.G, bead.B, 255}}
+	}
+	return cells, nil
+}
+
+// addBorders adds the borders around the matched pattern. The border cells match their bead exactly, the
+// source image is extended with the bead colors so that the outputs that compare it to the pattern keep
+// working.
+func (m *beadMachine) addBorders(pattern *Pattern) (*Pattern, error) {
+	for _, b := range m.borders {
+		cells, err := beadCells(pattern.Palette, b.beads)
+		if err != nil {
+			return nil, err
+		}
+
+		framed := newPattern(pattern.Width+2*b.width, pattern.Height+2*b.width, pattern.BoardDimension)
+		framed.Symbols = pattern.Symbols
+		framed.Palette = pattern.Palette
+		source := image.NewNRGBA(image.Rect(0, 0, framed.Width, framed.Height))
+		for y := 0; y < framed.Height; y++ {
+			for x := 0; x < framed.Width; x++ {
+				px, py := x-b.width, y-b.width
+				if px >= 0 && py >= 0 && px < pattern.Width && py < pattern.Height {
+					*framed.Cell(x, y) = *pattern.Cell(px, py)
+					continue
+				}
+				cell := cells[(x+y)%len(cells)]
+				*framed.Cell(x, y) = cell
+				source.Set(x, y, cell.Color)
+			}
+		}
+		if pattern.Source != nil {
+			bounds := pattern.Source.Bounds()
+			r := image.Rect(b.width, b.width, b.width+bounds.Dx(), b.width+bounds.Dy())
+			draw.Draw(source, r, pattern.Source, bounds.Min, draw.Src)
+		}
+		framed.Source = source
+		pattern = framed
+	}
+
+	m.logger.Info("Border added",
+		zap.Int("width", m.borderWidth()),
+		zap.Int("pattern width", pattern.Width),
+		zap.Int("pattern height", pattern.Height),
+		zap.Int("boards width", boardsNeeded(pattern.Width, m.boardDimension)),
+		zap.Int("boards height", boardsNeeded(pattern.Height, m.boardDimension)))
+	return pattern, nil
+}
@@ -0,0 +1,81 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"go.uber.org/zap"
+)
+
+// budgetScaleStep is the factor that the size is reduced by until the pattern fits into the bead budget
+const budgetScaleStep = 0.95
+
+// estimateBeads returns the amount of beads that the pattern of the fitted image needs, including the tiles,
+// background fill, padding and borders that are added to it
+func (m *beadMachine) estimateBeads(img image.Image) int {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	beads := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0 { // transparent pixels are empty cells
+				beads++
+			}
+		}
+	}
+
+	border := 2 * m.borderWidth()
+	if m.backgroundFill != nil { // the fill turns all empty cells into beads, including the padding
+		beads = width * height
+		if m.padToBoards {
+			width = boardsNeeded(width+border, m.boardDimension)*m.boardDimension - border
+			height = boardsNeeded(height+border, m.boardDimension)*m.boardDimension - border
+			beads = width * height
+		}
+	}
+	if m.tile != "" {
+		beads *= m.tileColumns * m.tileRows
+		width, height = width*m.tileColumns, height*m.tileRows
+	}
+	return beads + (width+border)*(height+border) - width*height
+}
+
+// fitBeadBudget scales the fitted image down until its pattern needs no more beads than the bead budget, like
+// the beads of a classroom kit. Every smaller size is resized from the original image to keep the quality. It
+// returns false if the fitted image is within the budget already, in strict mode an exceeded budget fails.
+func (m *beadMachine) fitBeadBudget(original, fitted image.Image) (image.Image, bool, error) {
+	beads := m.estimateBeads(fitted)
+	if beads <= m.maxBeads {
+		m.logger.Info("Bead budget", zap.Int("beads", beads), zap.Int("budget", m.maxBeads))
+		return fitted, false, nil
+	}
+	if m.strict {
+		m.logger.Error("Bead budget exceeded", zap.Int("beads", beads), zap.Int("budget", m.maxBeads))
+		err := fmt.Errorf("the pattern needs %d beads, more than the budget of %d beads", beads, m.maxBeads)
+		return nil, false, &exitError{code: exitWarnings, err: err}
+	}
+
+	bounds := fitted.Bounds()
+	scale := math.Sqrt(float64(m.maxBeads) / float64(beads))
+	for {
+		width := maxInt(1, int(float64(bounds.Dx())*scale))
+		height := maxInt(1, int(float64(bounds.Dy())*scale))
+		scaled := m.resizeImage(original, width, height)
+		needed := m.estimateBeads(scaled)
+		if needed <= m.maxBeads {
+			m.logger.Warn("Pattern scaled down to the bead budget",
+				zap.Int("beads", beads),
+				zap.Int("budget", m.maxBeads),
+				zap.Int("scaled beads", needed),
+				zap.Int("width", width),
+				zap.Int("height", height))
+			return scaled, true, nil
+		}
+		if width == 1 && height == 1 {
+			m.logger.Error("Bead budget too small", zap.Int("beads", needed), zap.Int("budget", m.maxBeads))
+			return nil, false, failureError(fmt.Errorf("the bead budget of %d beads is too small for the borders and tiles of the pattern", m.maxBeads))
+		}
+		scale *= budgetScaleStep
+	}
+}
@@ -0,0 +1,129 @@
+package beadmachine
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bundleFile is a file of the bundle archive and the output format that it is rendered with
+type bundleFile struct {
+	name   string
+	format string
+}
+
+// bundleFiles returns the files of the bundle archive, they are named after the input file
+func (m *beadMachine) bundleFiles() []bundleFile {
+	base := filepath.Base(m.inputFileName)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	return []bundleFile{
+		{name: base + "_beads.png", format: "png"},
+		{name: base + ".html", format: "html"},
+		{name: base + ".pdf", format: "instructionspdf"},
+		{name: base + "_stats.json", format: "stats"},
+		{name: base + "_pattern.json", format: "json"},
+	}
+}
+
+// hashingWriter counts and hashes the bytes that are written to a bundle entry for the manifest
+type hashingWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	size int64
+}
+
+// Write writes the data to the entry and adds it to the checksum
+func (h *hashingWriter) Write(p []byte) (int, error) {
+	n, err := h.w.Write(p)
+	_, _ = h.hash.Write(p[:n])
+	h.size += int64(n)
+	return n, err
+}
+
+// renderBundle renders a zip archive with the PNG, HTML, instructions PDF, statistics and pattern JSON outputs
+// and the used palette, to share a complete project as a single file. The manifest lists the checksums of all
+// entries, with --sign it is signed so that buyers of a pattern can verify who created it.
+func (m *beadMachine) renderBundle(pattern *Pattern, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	var manifest bundleManifest
+	addEntry := func(name string, write func(w io.Writer) error) error {
+		entry, err := archive.Create(name)
+		if err != nil {
+			return errors.Wrap(err, "creating bundle entry")
+		}
+		hw := &hashingWriter{w: entry, hash: sha256.New()}
+		if err = write(hw); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, bundleManifestFile{
+			Name:   name,
+			Size:   hw.size,
+			SHA256: hex.EncodeToString(hw.hash.Sum(nil)),
+		})
+		return nil
+	}
+
+	for _, file := range m.bundleFiles() {
+		renderer, err := m.renderer(file.format)
+		if err != nil {
+			return err
+		}
+		err = addEntry(file.name, func(w io.Writer) error {
+			return errors.Wrapf(renderer.Render(pattern, w), "rendering bundle entry %s", file.name)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// the palette is stored in the format of palette files, so that the pattern can be converted again with it
+	data, err := json.MarshalIndent(pattern.Palette, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling palette")
+	}
+	err = addEntry("palette.json", func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return errors.Wrap(err, "writing palette")
+	})
+	if err != nil {
+		return err
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling bundle manifest")
+	}
+	if err = writeBundleEntry(archive, bundleManifestName, manifestData); err != nil {
+		return err
+	}
+	if m.signingKey != nil {
+		signature, err := signManifest(m.signingKey, manifestData)
+		if err != nil {
+			return err
+		}
+		if data, err = json.MarshalIndent(signature, "", "  "); err != nil {
+			return errors.Wrap(err, "marshalling bundle signature")
+		}
+		if err = writeBundleEntry(archive, bundleSignatureName, data); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(archive.Close(), "closing bundle")
+}
+
+// writeBundleEntry writes an entry that is not listed in the manifest to the bundle
+func writeBundleEntry(archive *zip.Writer, name string, data []byte) error {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return errors.Wrap(err, "creating bundle entry")
+	}
+	_, err = entry.Write(data)
+	return errors.Wrapf(err, "writing bundle entry %s", name)
+}
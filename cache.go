@@ -0,0 +1,143 @@
+package beadmachine
+
+import (
+	"image/color"
+	"sync"
+	"sync/atomic"
+)
+
+// colorCacheShards is the amount of independently locked parts of the color cache, a power of 2
+const colorCacheShards = 64
+
+// defaultColorCacheSize is the default maximum amount of colors in the color cache
+const defaultColorCacheSize = 1 << 20
+
+// maxCachePrecision is the amount of bits per color channel that keeps the colors unchanged
+const maxCachePrecision = 8
+
+// colorCacheShard is a part of the color cache with its own lock. Colors that are matched right now are pending,
+// so that other goroutines wait for their match instead of matching them again.
+type colorCacheShard struct {
+	sync.RWMutex
+	entries map[uint64]colorMatch
+	pending map[uint64]*pendingMatch
+}
+
+// pendingMatch is a color match that one goroutine computes while others wait for it
+type pendingMatch struct {
+	done  chan struct{} // closed when the match is set
+	match colorMatch
+}
+
+// colorCache is a size capped cache of color matches, it is split into shards to reduce the lock contention
+// of the matching goroutines. A full shard evicts a random entry for every new entry. Every color is matched
+// only once while it is cached, even if several goroutines look it up at the same time.
+type colorCache struct {
+	shards        [colorCacheShards]colorCacheShard
+	shardCapacity int // 0 disables the cache
+
+	hits     uint64 // lookups that found the match in the cache
+	shared   uint64 // lookups that waited for the match of another goroutine
+	computed uint64 // lookups that matched the color
+}
+
+// colorCacheStats are the counters of the lookups of a color cache
+type colorCacheStats struct {
+	Hits     uint64 `json:"hits"`
+	Shared   uint64 `json:"shared"`
+	Computed uint64 `json:"computed"`
+}
+
+// newColorCache returns a color cache that holds up to the given amount of colors, 0 disables the cache
+func newColorCache(size int) *colorCache {
+	c := &colorCache{shardCapacity: (size + colorCacheShards - 1) / colorCacheShards}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[uint64]colorMatch)
+		c.shards[i].pending = make(map[uint64]*pendingMatch)
+	}
+	return c
+}
+
+// colorKey returns the cache key of a color, the 16 bit channels of the color are kept
+func colorKey(c color.Color) uint64 {
+	r, g, b, a := c.RGBA()
+	return uint64(r)<<48 | uint64(g)<<32 | uint64(b)<<16 | uint64(a)
+}
+
+// shard returns the shard of the key, the key bits are mixed as similar colors differ only in few bits
+func (c *colorCache) shard(key uint64) *colorCacheShard {
+	return &c.shards[(key*0x9E3779B97F4A7C15)>>58%colorCacheShards]
+}
+
+// lookup returns the cached bead match of the color key or computes and caches it. Concurrent lookups of a key
+// that is not cached compute it once, the other goroutines wait for that match.
+func (c *colorCache) lookup(key uint64, compute func() colorMatch) colorMatch {
+	if c.shardCapacity == 0 {
+		atomic.AddUint64(&c.computed, 1)
+		return compute()
+	}
+	shard := c.shard(key)
+	shard.RLock()
+	match, ok := shard.entries[key]
+	shard.RUnlock()
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		return match
+	}
+
+	shard.Lock()
+	if match, ok = shard.entries[key]; ok { // cached between the read and the write lock
+		shard.Unlock()
+		atomic.AddUint64(&c.hits, 1)
+		return match
+	}
+	if p, ok := shard.pending[key]; ok {
+		shard.Unlock()
+		<-p.done
+		atomic.AddUint64(&c.shared, 1)
+		return p.match
+	}
+	p := &pendingMatch{done: make(chan struct{})}
+	shard.pending[key] = p
+	shard.Unlock()
+
+	p.match = compute()
+	atomic.AddUint64(&c.computed, 1)
+
+	shard.Lock()
+	delete(shard.pending, key)
+	if len(shard.entries) >= c.shardCapacity {
+		for evicted := range shard.entries { // the map iteration order is random
+			delete(shard.entries, evicted)
+			break
+		}
+	}
+	shard.entries[key] = p.match
+	shard.Unlock()
+	close(p.done)
+	return p.match
+}
+
+// stats returns the counters of the lookups so far
+func (c *colorCache) stats() colorCacheStats {
+	return colorCacheStats{
+		Hits:     atomic.LoadUint64(&c.hits),
+		Shared:   atomic.LoadUint64(&c.shared),
+		Computed: atomic.LoadUint64(&c.computed),
+	}
+}
+
+// quantizeColor reduces the color to the given amount of bits per channel, the channels are set to the center
+// of their quantization range to keep the average error low
+func quantizeColor(c color.Color, precision int) color.RGBA {
+	r, g, b, a := c.RGBA()
+	shift := uint(maxCachePrecision - precision)
+	quantize := func(v uint32) uint8 {
+		v >>= 8
+		if shift == 0 {
+			return uint8(v)
+		}
+		return uint8(v>>shift<<shift | 1<<(shift-1))
+	}
+	return color.RGBA{quantize(r), quantize(g), quantize(b), uint8(a >> 8)}
+}
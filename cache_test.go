@@ -0,0 +1,13 @@
+package beadmachine_test
+
+import (
+	"testing"
+
+	"github.com/cornelk/beadmachine"
+)
+
+func TestColorCacheStress(t *testing.T) {
+	if err := beadmachine.StressColorCache(16, 4096); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image/color"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// stressPrecision is the cache precision of the matching stress, so that different colors share cache entries
+const stressPrecision = 5
+
+// StressColorCache looks up the same colors from the given amount of goroutines at once and returns an error if a
+// color was matched more than once while it was cached or if a goroutine got another match than the others. It
+// stresses a cache without evictions, a cache that evicts on every lookup and the color matching of the Hama
+// palette with quantized colors. Run it with the race detector, like from a test or with bench --stress:
+//
+//	if err := StressColorCache(16, 4096); err != nil {
+//		t.Fatal(err)
+//	}
+func StressColorCache(goroutines, colors int) error {
+	if goroutines < 1 || colors < 1 {
+		return errors.New("the stress test needs at least one goroutine and color")
+	}
+	if err := stressCache(newColorCache(colors*colorCacheShards), goroutines, colors, true); err != nil {
+		return errors.Wrap(err, "cache without evictions")
+	}
+	if err := stressCache(newColorCache(colorCacheShards), goroutines, colors, false); err != nil {
+		return errors.Wrap(err, "evicting cache")
+	}
+	return errors.Wrap(stressMatching(goroutines, colors), "color matching")
+}
+
+// stressCache looks up all keys from every goroutine, each starting at another key so that the goroutines collide
+// on the pending matches. Without evictions every key has to be computed exactly once.
+func stressCache(cache *colorCache, goroutines, colors int, once bool) error {
+	computed := make([]uint32, colors)
+	var mismatches uint32
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < colors; i++ {
+				key := (g*colors/goroutines + i) % colors
+				match := cache.lookup(uint64(key), func() colorMatch {
+					atomic.AddUint32(&computed[key], 1)
+					runtime.Gosched() // gives the other goroutines time to find the pending match
+					return colorMatch{beadName: strconv.Itoa(key), distance: float64(key)}
+				})
+				if match.beadName != strconv.Itoa(key) || match.distance != float64(key) {
+					atomic.AddUint32(&mismatches, 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d lookups returned the match of another color", mismatches)
+	}
+	stats := cache.stats()
+	if lookups := uint64(goroutines * colors); stats.Hits+stats.Shared+stats.Computed != lookups {
+		return fmt.Errorf("%d of %d lookups were counted", stats.Hits+stats.Shared+stats.Computed, lookups)
+	}
+	if !once {
+		return nil
+	}
+	for key, count := range computed {
+		if count != 1 {
+			return fmt.Errorf("color %d was matched %d times", key, count)
+		}
+	}
+	return nil
+}
+
+// stressMatching matches random colors to the Hama palette from all goroutines at once and compares every match
+// to the uncached match of the quantized color
+func stressMatching(goroutines, colors int) error {
+	m := newBeadMachine(zap.NewNop())
+	m.palette = "embedded:hama"
+	m.cachePrecision = stressPrecision
+	_, beadLab, err := m.loadPalette()
+	if err != nil {
+		return err
+	}
+
+	random := rand.New(rand.NewSource(1))
+	pixels := make([]color.RGBA, colors)
+	want := make([]colorMatch, colors)
+	for i := range pixels {
+		pixels[i] = color.RGBA{uint8(random.Intn(256)), uint8(random.Intn(256)), uint8(random.Intn(256)), 255}
+		want[i] = m.matchColor(beadLab, quantizeColor(pixels[i], stressPrecision))
+	}
+
+	var mismatches uint32
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < colors; i++ {
+				index := (g*colors/goroutines + i) % colors
+				bead, distance := m.findSimilarColor(beadLab, pixels[index])
+				if bead != want[index].beadName || distance != want[index].distance {
+					atomic.AddUint32(&mismatches, 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d colors were matched to another bead than without the cache", mismatches)
+	}
+	return nil
+}
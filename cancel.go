@@ -0,0 +1,78 @@
+package beadmachine
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// cancelCheckInterval is the amount of colors that are matched between the checks for a cancelled conversion
+const cancelCheckInterval = 256
+
+// interruptContext returns a context that is cancelled on Ctrl-C and after the timeout if it is set. A second
+// Ctrl-C terminates the process immediately.
+func interruptContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	timeoutCtx, timeoutCancel := ctx, cancel
+	if timeout > 0 {
+		timeoutCtx, timeoutCancel = context.WithTimeout(ctx, timeout)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-timeoutCtx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return timeoutCtx, func() {
+		timeoutCancel()
+		cancel()
+	}
+}
+
+// cancelled returns an error if the conversion was cancelled by Ctrl-C or exceeded its timeout
+func (m *beadMachine) cancelled() error {
+	switch m.ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return cancelledError(errors.New("the conversion timed out"))
+	default:
+		return cancelledError(errors.New("the conversion was cancelled"))
+	}
+}
+
+// writePartialStats writes the statistics of a pattern whose matching was cancelled, so that a long
+// conversion that was stopped still reports the beads of the matched cells
+func (m *beadMachine) writePartialStats(pattern *Pattern) {
+	if m.statsFileName == "" {
+		return
+	}
+	o := output{format: "stats", fileName: m.statsFileName, renderer: RendererFunc(m.renderPartialStats)}
+	var err error
+	if o.fileName, err = m.outputPath(o, pattern); err == nil {
+		err = writeOutput(o, pattern)
+	}
+	if err != nil {
+		m.logger.Error("Writing partial stats failed", zap.Error(err))
+		return
+	}
+	m.logger.Info("Partial stats written", zap.String("file", o.fileName))
+}
+
+// renderPartialStats renders the statistics of a partially matched pattern as JSON
+func (m *beadMachine) renderPartialStats(pattern *Pattern, w io.Writer) error {
+	stats := m.PatternStats(pattern)
+	stats.Partial = true
+	return writeStats(stats, w)
+}
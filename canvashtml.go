@@ -0,0 +1,341 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// HTML renderers of the html output
+const (
+	htmlRendererTable  = "table"  // a table cell per bead, printable and readable without JavaScript
+	htmlRendererCanvas = "canvas" // the pattern as compact JSON drawn on a canvas, fast for huge patterns
+)
+
+// canvasPattern is the pattern data of the canvas HTML viewer
+type canvasPattern struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Board  int          `json:"board"`
+	Beads  []canvasBead `json:"beads"`
+	Runs   []int        `json:"runs"` // pairs of bead index and count of the cells row by row, -1 for empty cells
+}
+
+// canvasBead is a color of the canvas HTML viewer
+type canvasBead struct {
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+	Text   string `json:"text"` // color of the symbol and name drawn on the bead
+	Symbol string `json:"symbol,omitempty"`
+	Count  int    `json:"count"`
+}
+
+// canvasHTMLHeader contains the styles and the viewer element of the canvas HTML viewer
+const canvasHTMLHeader = `<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style type="text/css">
+body { font-family: sans-serif; margin: 0; }
+#view { height: 80vh; border-bottom: 2px solid black; outline: none; }
+p, table { margin: 8px; }
+.lg td { padding: 2px 8px; }
+.fp { color: #606060; font-size: x-small; }
+</style>
+</head>
+<body>
+<div id="view"></div>
+`
+
+// canvasViewerScript contains the viewer that draws a pattern on a canvas in the view element, the pattern is drawn
+// once into an image with a pixel per bead that is scaled on every frame, grid lines and symbols are only drawn when
+// zoomed in. It is shared by the canvas HTML viewer and the embeddable widget.
+const canvasViewerScript = `function beadmachineViewer(view, pattern, text) {
+  var canvas = document.createElement("canvas"), status = document.createElement("div"), ctx = canvas.getContext("2d");
+  canvas.style.display = "block";
+  status.style.cssText = "position: absolute; top: 0; left: 0; padding: 4px 8px; color: #000000; " +
+    "background-color: rgba(255, 255, 255, 0.85); font: small sans-serif;";
+  view.style.position = "relative";
+  view.style.overflow = "hidden";
+  view.style.cursor = "grab";
+  view.style.touchAction = "none";
+  if (view.clientHeight === 0) { view.style.height = "480px"; }
+  view.tabIndex = 0;
+  view.appendChild(canvas);
+  view.appendChild(status);
+  var cells = new Int32Array(pattern.width * pattern.height);
+  for (var i = 0, c = 0; i < pattern.runs.length; i += 2) {
+    cells.fill(pattern.runs[i], c, c + pattern.runs[i + 1]);
+    c += pattern.runs[i + 1];
+  }
+  var image = document.createElement("canvas");
+  image.width = pattern.width;
+  image.height = pattern.height;
+  var imageCtx = image.getContext("2d"), pixels = imageCtx.createImageData(pattern.width, pattern.height);
+  cells.forEach(function(bead, i) {
+    if (bead < 0) { return; }
+    var rgb = parseInt(pattern.beads[bead].color.substring(1), 16);
+    pixels.data[4 * i] = rgb >> 16;
+    pixels.data[4 * i + 1] = (rgb >> 8) & 255;
+    pixels.data[4 * i + 2] = rgb & 255;
+    pixels.data[4 * i + 3] = 255;
+  });
+  imageCtx.putImageData(pixels, 0, 0);
+
+  var scale = 1, offsetX = 0, offsetY = 0, drag = null, hover = null;
+  function boardName(column, row) {
+    var letters = "";
+    for (column++; column > 0; column = Math.floor((column - 1) / 26)) {
+      letters = String.fromCharCode(65 + (column - 1) % 26) + letters;
+    }
+    return letters + (row + 1);
+  }
+  function fit() {
+    scale = Math.min(view.clientWidth / pattern.width, view.clientHeight / pattern.height);
+    offsetX = (view.clientWidth - pattern.width * scale) / 2;
+    offsetY = (view.clientHeight - pattern.height * scale) / 2;
+  }
+  function lines(from, to, step, color, width, vertical, x0, y0, x1, y1) {
+    ctx.strokeStyle = color;
+    ctx.lineWidth = width;
+    ctx.beginPath();
+    for (var i = Math.ceil(from / step) * step; i <= to; i += step) {
+      if (vertical) {
+        ctx.moveTo(offsetX + i * scale, offsetY + y0 * scale);
+        ctx.lineTo(offsetX + i * scale, offsetY + y1 * scale);
+      } else {
+        ctx.moveTo(offsetX + x0 * scale, offsetY + i * scale);
+        ctx.lineTo(offsetX + x1 * scale, offsetY + i * scale);
+      }
+    }
+    ctx.stroke();
+  }
+  function draw() {
+    var width = view.clientWidth, height = view.clientHeight, ratio = window.devicePixelRatio || 1;
+    canvas.width = width * ratio;
+    canvas.height = height * ratio;
+    canvas.style.width = width + "px";
+    canvas.style.height = height + "px";
+    ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+    ctx.fillStyle = "#FFFFFF";
+    ctx.fillRect(0, 0, width, height);
+    ctx.imageSmoothingEnabled = false;
+    ctx.drawImage(image, offsetX, offsetY, pattern.width * scale, pattern.height * scale);
+
+    var x0 = Math.max(0, Math.floor(-offsetX / scale)), y0 = Math.max(0, Math.floor(-offsetY / scale));
+    var x1 = Math.min(pattern.width, Math.ceil((width - offsetX) / scale));
+    var y1 = Math.min(pattern.height, Math.ceil((height - offsetY) / scale));
+    if (x0 >= x1 || y0 >= y1) { return; }
+    if (scale >= 8) {
+      lines(x0, x1, 1, "#C0C0C0", 1, true, x0, y0, x1, y1);
+      lines(y0, y1, 1, "#C0C0C0", 1, false, x0, y0, x1, y1);
+    }
+    if (scale * pattern.board >= 4) {
+      lines(x0, x1, pattern.board, "#000000", 2, true, x0, y0, x1, y1);
+      lines(y0, y1, pattern.board, "#000000", 2, false, x0, y0, x1, y1);
+    }
+    if (scale >= 24) {
+      ctx.font = Math.floor(scale / 3) + "px sans-serif";
+      ctx.textAlign = "center";
+      ctx.textBaseline = "middle";
+      for (var y = y0; y < y1; y++) {
+        for (var x = x0; x < x1; x++) {
+          var bead = cells[x + y * pattern.width];
+          if (bead < 0) { continue; }
+          ctx.fillStyle = pattern.beads[bead].text;
+          var label = pattern.beads[bead].symbol || pattern.beads[bead].name.split(" ")[0];
+          ctx.fillText(label, offsetX + (x + 0.5) * scale, offsetY + (y + 0.5) * scale, scale - 2);
+        }
+      }
+    }
+    if (hover) {
+      ctx.strokeStyle = "#FF00FF";
+      ctx.lineWidth = 2;
+      ctx.strokeRect(offsetX + hover.x * scale, offsetY + hover.y * scale, scale, scale);
+    }
+  }
+  function show() {
+    var info = "";
+    if (hover) {
+      var bead = cells[hover.x + hover.y * pattern.width];
+      info = "<b>" + text.board + " " + boardName(Math.floor(hover.x / pattern.board), Math.floor(hover.y / pattern.board)) +
+        ", " + text.column + " " + (hover.x % pattern.board + 1) + ", " + text.row + " " + (hover.y % pattern.board + 1) +
+        ": " + (bead < 0 ? text.empty : pattern.beads[bead].name.replace(/&/g, "&amp;").replace(/</g, "&lt;")) + "</b> ";
+    }
+    status.innerHTML = info + "<span style=\"color: #606060\">" + text.move + "</span>";
+  }
+  function zoom(factor, x, y) {
+    var fitted = Math.min(view.clientWidth / pattern.width, view.clientHeight / pattern.height);
+    var next = Math.min(Math.max(scale * factor, fitted / 4), 100);
+    offsetX = x - (x - offsetX) * next / scale;
+    offsetY = y - (y - offsetY) * next / scale;
+    scale = next;
+    draw();
+  }
+  view.addEventListener("wheel", function(e) {
+    e.preventDefault();
+    var r = view.getBoundingClientRect();
+    zoom(Math.exp(-e.deltaY * (e.deltaMode === 1 ? 0.05 : 0.002)), e.clientX - r.left, e.clientY - r.top);
+  }, {passive: false});
+  view.addEventListener("pointerdown", function(e) {
+    drag = {x: e.clientX - offsetX, y: e.clientY - offsetY};
+    view.setPointerCapture(e.pointerId);
+    view.style.cursor = "grabbing";
+  });
+  view.addEventListener("pointerup", function(e) {
+    drag = null;
+    view.style.cursor = "grab";
+  });
+  view.addEventListener("pointermove", function(e) {
+    if (drag) {
+      offsetX = e.clientX - drag.x;
+      offsetY = e.clientY - drag.y;
+    }
+    var r = view.getBoundingClientRect();
+    var x = Math.floor((e.clientX - r.left - offsetX) / scale), y = Math.floor((e.clientY - r.top - offsetY) / scale);
+    hover = x >= 0 && y >= 0 && x < pattern.width && y < pattern.height ? {x: x, y: y} : null;
+    draw();
+    show();
+  });
+  view.addEventListener("keydown", function(e) {
+    if (e.key === "0") {
+      fit();
+      draw();
+    } else if (e.key === "+" || e.key === "=") {
+      zoom(1.5, view.clientWidth / 2, view.clientHeight / 2);
+    } else if (e.key === "-") {
+      zoom(1 / 1.5, view.clientWidth / 2, view.clientHeight / 2);
+    }
+  });
+  window.addEventListener("resize", draw);
+  fit();
+  draw();
+  show();
+}
+`
+
+// canvasPatternData returns the beads of the pattern ordered by count and the run length encoded cells
+func canvasPatternData(pattern *Pattern) canvasPattern {
+	data := canvasPattern{Width: pattern.Width, Height: pattern.Height, Board: pattern.BoardDimension}
+	index := make(map[string]int)
+	cellBeads := make([]int, len(pattern.Cells))
+	for i, cell := range pattern.Cells {
+		cellBeads[i] = -1
+		if cell.Empty() {
+			continue
+		}
+		hex := fmt.Sprintf("#%02X%02X%02X", cell.Color.R, cell.Color.G, cell.Color.B)
+		key := cell.Bead + hex // cells without color matching have no bead name but distinct colors
+		bead, ok := index[key]
+		if !ok {
+			bead = len(data.Beads)
+			index[key] = bead
+			data.Beads = append(data.Beads, canvasBead{
+				Name:   cell.Bead,
+				Color:  hex,
+				Text:   canvasTextColor(cell.Color),
+				Symbol: pattern.Symbols[cell.Bead],
+			})
+		}
+		data.Beads[bead].Count++
+		cellBeads[i] = bead
+	}
+
+	order := make([]int, len(data.Beads))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := data.Beads[order[i]], data.Beads[order[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	beads := make([]canvasBead, len(order))
+	position := make([]int, len(order))
+	for i, bead := range order {
+		beads[i] = data.Beads[bead]
+		position[bead] = i
+	}
+	data.Beads = beads
+
+	data.Runs = []int{}
+	for i := 0; i < len(cellBeads); {
+		j := i + 1
+		for j < len(cellBeads) && cellBeads[j] == cellBeads[i] {
+			j++
+		}
+		bead := cellBeads[i]
+		if bead >= 0 {
+			bead = position[bead]
+		}
+		data.Runs = append(data.Runs, bead, j-i)
+		i = j
+	}
+	return data
+}
+
+// canvasTexts returns the translated texts of the canvas viewer as JSON object
+func (m *beadMachine) canvasTexts() ([]byte, error) {
+	text, err := json.Marshal(map[string]string{
+		"empty":  m.tr("empty"),
+		"board":  m.tr("Board"),
+		"column": m.tr("column"),
+		"row":    m.tr("row"),
+		"move":   m.tr("wheel to zoom, drag to move, 0 to fit"),
+	})
+	return text, errors.Wrap(err, "marshalling canvas viewer texts")
+}
+
+// canvasTextColor returns the color of labels drawn on the bead color
+func canvasTextColor(c color.RGBA) string {
+	if luminance([]uint8{c.R, c.G, c.B}) < 128 {
+		return "#FFFFFF"
+	}
+	return "#000000"
+}
+
+// renderCanvasHTML renders a HTML file that draws the pattern on a canvas that can be zoomed with the mouse wheel
+// and moved by dragging. The pattern is embedded as run length encoded JSON, which keeps huge patterns small and
+// fast to open compared to a table cell per bead.
+func (m *beadMachine) renderCanvasHTML(pattern *Pattern, writer io.Writer) error {
+	data := canvasPatternData(pattern)
+	patternData, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "marshalling canvas pattern")
+	}
+	text, err := m.canvasTexts()
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, canvasHTMLHeader, html.EscapeString(m.tr("Bead patterns")))
+	fmt.Fprintf(w, "<p>%s</p>\n<table class=\"lg\">\n", html.EscapeString(m.tr("Pattern size: %s", m.formatSize(pattern.Width, pattern.Height))))
+	for _, bead := range data.Beads {
+		fmt.Fprintf(w, "<tr><td bgcolor=\"%s\">&nbsp;&nbsp;&nbsp;</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			bead.Color, bead.Symbol, html.EscapeString(bead.Name), m.formatInt(bead.Count))
+	}
+	w.WriteString("</table>\n")
+	footer, err := m.htmlFingerprint(pattern)
+	if err != nil {
+		return err
+	}
+	w.WriteString(footer)
+	w.WriteString("<script>\nvar pattern = ")
+	w.Write(patternData)
+	w.WriteString(";\nvar text = ")
+	w.Write(text)
+	w.WriteString(";\n</script>\n<script>\n")
+	w.WriteString(canvasViewerScript)
+	w.WriteString("beadmachineViewer(document.getElementById(\"view\"), pattern, text);\n")
+	w.WriteString("document.getElementById(\"view\").focus();\n</script>\n</body>\n</html>\n")
+	return errors.Wrap(w.Flush(), "writing canvas HTML bead pattern file")
+}
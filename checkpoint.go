@@ -0,0 +1,114 @@
+package beadmachine
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// checkpointRecord is a line of the checkpoint file, it records a batch input that was converted completely
+type checkpointRecord struct {
+	Input        string    `json:"input"`
+	InputHash    string    `json:"inputHash"`    // SHA-256 of the input file
+	SettingsHash string    `json:"settingsHash"` // fingerprint of the conversion settings and the palette
+	Time         time.Time `json:"time"`
+}
+
+// checkpoint records the converted inputs of a batch, so that an interrupted batch can be resumed. The records are
+// appended as JSON lines, a line that was cut off by the interruption is ignored when resuming.
+type checkpoint struct {
+	file         *os.File
+	settingsHash string
+	converted    map[string]string // input files of the resumed checkpoint by their hash
+}
+
+// openCheckpoint opens the checkpoint file of the batch, with --resume the inputs that it records as converted
+// with the same settings are loaded, otherwise a new checkpoint is started
+func (m *beadMachine) openCheckpoint() (*checkpoint, error) {
+	palette, _, err := m.loadPalette()
+	if err != nil {
+		return nil, paletteError(err)
+	}
+	settingsHash, err := settingsFingerprint(m.settings(), palette)
+	if err != nil {
+		return nil, failureError(err)
+	}
+	c := &checkpoint{settingsHash: settingsHash, converted: make(map[string]string)}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if m.resume {
+		if err = c.load(m.checkpointFileName); err != nil {
+			return nil, inputError(err)
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+	if c.file, err = os.OpenFile(m.checkpointFileName, flags, 0644); err != nil {
+		return nil, outputError(errors.Wrap(err, "opening checkpoint file"))
+	}
+	return c, nil
+}
+
+// load reads the records of the checkpoint file that match the settings, a missing file is an empty checkpoint
+func (c *checkpoint) load(fileName string) error {
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "opening checkpoint file")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record checkpointRecord
+		if json.Unmarshal(scanner.Bytes(), &record) != nil || record.SettingsHash != c.settingsHash {
+			continue
+		}
+		c.converted[record.Input] = record.InputHash
+	}
+	return errors.Wrap(scanner.Err(), "reading checkpoint file")
+}
+
+// check returns the hash of the input file and whether the checkpoint records it as converted with the settings
+func (c *checkpoint) check(inputFileName string) (string, bool, error) {
+	f, err := os.Open(inputFileName)
+	if err != nil {
+		return "", false, errors.Wrap(err, "opening image file")
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", false, errors.Wrap(err, "reading image file")
+	}
+	inputHash := hex.EncodeToString(hash.Sum(nil))
+	converted, ok := c.converted[inputFileName]
+	return inputHash, ok && converted == inputHash, nil
+}
+
+// record appends the converted input to the checkpoint file
+func (c *checkpoint) record(inputFileName, inputHash string) error {
+	data, err := json.Marshal(checkpointRecord{
+		Input:        inputFileName,
+		InputHash:    inputHash,
+		SettingsHash: c.settingsHash,
+		Time:         time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling checkpoint record")
+	}
+	_, err = c.file.Write(append(data, '\n'))
+	return errors.Wrap(err, "writing checkpoint file")
+}
+
+// close closes the checkpoint file
+func (c *checkpoint) close() error {
+	return errors.Wrap(c.file.Close(), "closing checkpoint file")
+}
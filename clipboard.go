@@ -0,0 +1,183 @@
+package beadmachine
+
+import (
+	"bytes"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// clipboardFileName is the input filename of images from the clipboard, the default output filenames are based on it
+const clipboardFileName = "clipboard.png"
+
+// clipboardTool is an external program that reads or writes a PNG image of the clipboard, {file} in the
+// arguments is replaced by the name of a temporary PNG file for tools that can not use stdin or stdout
+type clipboardTool struct {
+	command string
+	args    []string
+}
+
+// windowsClipboardPrefix loads the assemblies of the Windows clipboard and image classes
+const windowsClipboardPrefix = "Add-Type -AssemblyName System.Windows.Forms; Add-Type -AssemblyName System.Drawing; "
+
+// clipboardReaders returns the tools that read an image from the clipboard in the order of preference
+func clipboardReaders() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{"osascript", []string{"-e", "get the clipboard as «class PNGf»"}}}
+	case "windows":
+		return []clipboardTool{{"powershell", []string{"-NoProfile", "-STA", "-Command", windowsClipboardPrefix +
+			"$img = [System.Windows.Forms.Clipboard]::GetImage(); if ($img -eq $null) { exit 1 }; " +
+			"$img.Save('{file}', [System.Drawing.Imaging.ImageFormat]::Png)"}}}
+	default:
+		tools := []clipboardTool{
+			{"xclip", []string{"-selection", "clipboard", "-target", "image/png", "-out"}},
+			{"wl-paste", []string{"--no-newline", "--type", "image/png"}},
+		}
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			tools[0], tools[1] = tools[1], tools[0]
+		}
+		return tools
+	}
+}
+
+// clipboardWriters returns the tools that write a PNG image to the clipboard in the order of preference
+func clipboardWriters() []clipboardTool {
+	switch runtime.GOOS {
+	case "darwin":
+		return []clipboardTool{{"osascript", []string{"-e", "set the clipboard to (read (POSIX file \"{file}\") as «class PNGf»)"}}}
+	case "windows":
+		return []clipboardTool{{"powershell", []string{"-NoProfile", "-STA", "-Command", windowsClipboardPrefix +
+			"[System.Windows.Forms.Clipboard]::SetImage([System.Drawing.Image]::FromFile('{file}'))"}}}
+	default:
+		tools := []clipboardTool{
+			{"xclip", []string{"-selection", "clipboard", "-target", "image/png", "-in"}},
+			{"wl-copy", []string{"--type", "image/png"}},
+		}
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			tools[0], tools[1] = tools[1], tools[0]
+		}
+		return tools
+	}
+}
+
+// findClipboardTool returns the first installed tool and its path
+func findClipboardTool(tools []clipboardTool) (clipboardTool, string, error) {
+	var names []string
+	for _, tool := range tools {
+		if path, err := exec.LookPath(tool.command); err == nil {
+			return tool, path, nil
+		}
+		names = append(names, tool.command)
+	}
+	return clipboardTool{}, "", errors.Errorf("the clipboard is not supported, install %s", strings.Join(names, " or "))
+}
+
+// usesFile returns whether the tool reads or writes the image through a temporary file
+func (t clipboardTool) usesFile() bool {
+	for _, arg := range t.args {
+		if strings.Contains(arg, "{file}") {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare returns the command of the tool with the temporary filename set in its arguments
+func (t clipboardTool) prepare(path, fileName string) *exec.Cmd {
+	args := make([]string, len(t.args))
+	for i, arg := range t.args {
+		args[i] = strings.Replace(arg, "{file}", fileName, -1)
+	}
+	return exec.Command(path, args...)
+}
+
+// readClipboardImage returns the image of the clipboard
+func readClipboardImage() (image.Image, error) {
+	tool, path, err := findClipboardTool(clipboardReaders())
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if tool.usesFile() {
+		file, err := ioutil.TempFile("", "beadmachine-*.png")
+		if err != nil {
+			return nil, errors.Wrap(err, "creating temporary file")
+		}
+		file.Close()
+		defer os.Remove(file.Name())
+		if output, err := tool.prepare(path, file.Name()).CombinedOutput(); err != nil {
+			return nil, errors.Wrapf(err, "reading clipboard with %s: %s", tool.command, strings.TrimSpace(string(output)))
+		}
+		if data, err = ioutil.ReadFile(file.Name()); err != nil {
+			return nil, errors.Wrap(err, "reading clipboard image")
+		}
+	} else {
+		var stderr bytes.Buffer
+		cmd := tool.prepare(path, "")
+		cmd.Stderr = &stderr
+		if data, err = cmd.Output(); err != nil {
+			return nil, errors.Wrapf(err, "reading clipboard with %s: %s", tool.command, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	if runtime.GOOS == "darwin" { // AppleScript returns the data as «data PNGf89504E47...»
+		text := strings.TrimSpace(string(data))
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "«data PNGf"), "»")
+		if data, err = hex.DecodeString(text); err != nil {
+			return nil, errors.New("the clipboard contains no image")
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "the clipboard contains no image")
+	}
+	return img, nil
+}
+
+// writeClipboardImage copies the image as PNG to the clipboard
+func writeClipboardImage(img image.Image) error {
+	tool, path, err := findClipboardTool(clipboardWriters())
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, img); err != nil {
+		return errors.Wrap(err, "encoding png")
+	}
+
+	var cmd *exec.Cmd
+	if tool.usesFile() {
+		file, err := ioutil.TempFile("", "beadmachine-*.png")
+		if err != nil {
+			return errors.Wrap(err, "creating temporary file")
+		}
+		defer os.Remove(file.Name())
+		_, err = file.Write(buf.Bytes())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return errors.Wrap(err, "writing temporary file")
+		}
+		cmd = tool.prepare(path, file.Name())
+	} else {
+		cmd = tool.prepare(path, "")
+		cmd.Stdin = &buf
+	}
+	// the output is not captured, as the tools on Linux keep running in the background to serve the clipboard
+	if err = cmd.Run(); err != nil {
+		return errors.Wrapf(err, "writing clipboard with %s", tool.command)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+// Command beadmachine is the command line of the bead pattern creator, all of its functionality is provided by the
+// beadmachine package.
+package main
+
+import (
+	"os"
+
+	"github.com/cornelk/beadmachine"
+)
+
+func main() {
+	os.Exit(beadmachine.Execute())
+}
@@ -0,0 +1,43 @@
+package beadmachine
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"github.com/disintegration/imaging"
+)
+
+// adobeMarker is an APP14 JPEG segment of Adobe with the transform "unknown", that marks the 4 components of a
+// JPEG image as CMYK
+var adobeMarker = []byte{0xff, 0xee, 0x00, 0x0e, 'A', 'd', 'o', 'b', 'e', 0x00, 0x64, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+// decodeImage decodes the image data, CMYK JPEG images of print workflows are converted to RGB so that
+// filters, matching and outputs all see the same colors. Go only decodes CMYK JPEG images with the APP14
+// marker of Adobe, which stores the channels inverted. Images without the marker are decoded with an added
+// one and inverted back, their EXIF orientation is not applied.
+func decodeImage(data []byte, autoOrient bool) (image.Image, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(autoOrient))
+	if _, ok := err.(jpeg.UnsupportedError); ok && len(data) > 2 {
+		patched := make([]byte, 0, len(data)+len(adobeMarker))
+		patched = append(patched, data[:2]...) // the marker follows the start of image marker
+		patched = append(patched, adobeMarker...)
+		patched = append(patched, data[2:]...)
+		if cmyk, patchedErr := imaging.Decode(bytes.NewReader(patched)); patchedErr == nil {
+			if c, ok := cmyk.(*image.CMYK); ok {
+				for i := range c.Pix {
+					c.Pix[i] = 255 - c.Pix[i]
+				}
+				img, err = c, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c, ok := img.(*image.CMYK); ok {
+		return imaging.Clone(c), nil
+	}
+	return img, nil
+}
@@ -0,0 +1,88 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// colorBalanceScale is the gain change of a color channel at a temperature or tint of 100
+const colorBalanceScale = 0.5
+
+// applyColorBalance shifts the hues of the image and changes its temperature and tint, this moves the source
+// colors toward hues that the bead palette covers well
+func (m *beadMachine) applyColorBalance(inputImage image.Image) image.Image {
+	if m.hueShift == 0 && m.temperature == 0 && m.tint == 0 {
+		return inputImage
+	}
+
+	// the temperature moves between blue and red, the tint between green and magenta
+	redGain := 1 + m.temperature/100*colorBalanceScale
+	greenGain := 1 - m.tint/100*colorBalanceScale
+	blueGain := 1 - m.temperature/100*colorBalanceScale
+
+	return imaging.AdjustFunc(inputImage, func(c color.NRGBA) color.NRGBA {
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		if m.hueShift != 0 {
+			h, s, l := rgbToHSL(r, g, b)
+			r, g, b = hslToRGB(math.Mod(h+m.hueShift+360, 360), s, l)
+		}
+		return color.NRGBA{clampChannel(r * redGain), clampChannel(g * greenGain), clampChannel(b * blueGain), c.A}
+	})
+}
+
+// clampChannel rounds the color channel value and clamps it to the valid range
+func clampChannel(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+// rgbToHSL converts the color channels in the range 0 - 255 to the hue in degrees and the saturation and
+// lightness in the range 0 - 1
+func rgbToHSL(r, g, b float64) (float64, float64, float64) {
+	r, g, b = r/255, g/255, b/255
+	max := math.Max(r, math.Max(g, b))
+	min := math.Min(r, math.Min(g, b))
+	l := (max + min) / 2
+	if max == min { // grey shades have no hue
+		return 0, 0, l
+	}
+
+	d := max - min
+	s := d / (1 - math.Abs(2*l-1))
+	var h float64
+	switch max {
+	case r:
+		h = math.Mod((g-b)/d+6, 6)
+	case g:
+		h = (b-r)/d + 2
+	default:
+		h = (r-g)/d + 4
+	}
+	return h * 60, s, l
+}
+
+// hslToRGB converts the hue in degrees and the saturation and lightness in the range 0 - 1 to color channels
+// in the range 0 - 255
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	offset := l - c/2
+	return (r + offset) * 255, (g + offset) * 255, (b + offset) * 255
+}
@@ -0,0 +1,178 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// color by number layout in points
+const (
+	colorByNumberMinCell       = 14.0 // smallest cell size whose number is legible, larger patterns get a page per board
+	colorByNumberLegendColumns = 3
+	colorByNumberLegendWidth   = (pdfA4Width - 2*instructionsMargin) / colorByNumberLegendColumns
+	colorByNumberLegendLine    = 16.0
+	colorByNumberSwatch        = 10.0
+)
+
+var colorByNumberLineColor = color.RGBA{120, 120, 120, 255}
+
+// colorNumbers returns the numbers of the beads of the pattern, counted from 1 for the most used bead
+func colorNumbers(pattern *Pattern) ([]string, map[string]int) {
+	counts := pattern.Stats().BeadCounts
+	beads := make([]string, 0, len(counts))
+	for bead := range counts {
+		beads = append(beads, bead)
+	}
+	sort.Slice(beads, func(i, j int) bool {
+		if counts[beads[i]] != counts[beads[j]] {
+			return counts[beads[i]] > counts[beads[j]]
+		}
+		return beads[i] < beads[j]
+	})
+	numbers := make(map[string]int, len(beads))
+	for i, bead := range beads {
+		numbers[bead] = i + 1
+	}
+	return beads, numbers
+}
+
+// renderColorByNumber renders the pattern as uncolored grid whose cells show the number of their bead, with a
+// numbered legend of the bead colors below it. Kids place the beads like in a color by number book and the
+// sheet doubles as printable activity sheet. Patterns that are too large for a legible page get a page per board.
+func (m *beadMachine) renderColorByNumber(pattern *Pattern, w io.Writer) error {
+	if pattern.Width == 0 || pattern.Height == 0 {
+		return fmt.Errorf("the pattern is empty")
+	}
+	beads, numbers := colorNumbers(pattern)
+
+	type area struct {
+		title          string
+		x0, y0, x1, y1 int
+	}
+	areas := []area{{m.tr("Color by number"), 0, 0, pattern.Width, pattern.Height}}
+	if m.colorByNumberCellSize(pattern.Width, pattern.Height, len(beads)) < colorByNumberMinCell {
+		areas = nil
+		dimension := pattern.BoardDimension
+		for boardY := 0; boardY*dimension < pattern.Height; boardY++ {
+			for boardX := 0; boardX*dimension < pattern.Width; boardX++ {
+				x0, y0 := boardX*dimension, boardY*dimension
+				x1, y1 := minInt(x0+dimension, pattern.Width), minInt(y0+dimension, pattern.Height)
+				title := m.tr("Board %s (columns %d-%d, rows %d-%d)", boardName(boardX, boardY), x0+1, x1, y0+1, y1)
+				areas = append(areas, area{title, x0, y0, x1, y1})
+			}
+		}
+	}
+
+	doc := &pdfDocument{}
+	for _, a := range areas {
+		// the legend of every page only lists the beads that are used on it
+		var pageBeads []string
+		counts := make(map[string]int)
+		for y := a.y0; y < a.y1; y++ {
+			for x := a.x0; x < a.x1; x++ {
+				if cell := pattern.Cell(x, y); !cell.Empty() {
+					counts[cell.Bead]++
+				}
+			}
+		}
+		for _, bead := range beads {
+			if counts[bead] > 0 {
+				pageBeads = append(pageBeads, bead)
+			}
+		}
+
+		page := doc.addPage(pdfA4Width, pdfA4Height)
+		page.setFillColor(posterMarkColor)
+		page.text(instructionsMargin, instructionsMargin, pdfFontBold, instructionsHeadingSize, a.title)
+		cellSize := m.colorByNumberCellSize(a.x1-a.x0, a.y1-a.y0, len(pageBeads))
+		top := instructionsMargin + instructionsLineHeight
+		if m.coordinates {
+			top += pdfCoordinatesHeight
+		}
+		drawNumberCells(page, pattern, numbers, a.x0, a.y0, a.x1, a.y1, top, cellSize)
+		if m.coordinates {
+			m.drawPDFCoordinates(page, pattern, a.x0, a.y0, a.x1, a.y1, instructionsMargin, top, cellSize)
+		}
+		m.drawNumberLegend(page, pattern.Palette, pageBeads, numbers, counts, top+float64(a.y1-a.y0)*cellSize+instructionsLineHeight)
+	}
+	if err := m.addPDFFingerprint(doc, pattern); err != nil {
+		return err
+	}
+	return doc.write(w)
+}
+
+// colorByNumberCellSize returns the cell size that fits an area of cells and the legend of the given amount of
+// beads on a page, below the coordinate labels if they are enabled
+func (m *beadMachine) colorByNumberCellSize(width, height, beads int) float64 {
+	legendRows := (beads + colorByNumberLegendColumns - 1) / colorByNumberLegendColumns
+	legendHeight := float64(legendRows)*colorByNumberLegendLine + instructionsLineHeight
+	availableWidth := pdfA4Width - 2*instructionsMargin
+	availableHeight := pdfA4Height - 2*instructionsMargin - instructionsLineHeight - legendHeight
+	if m.coordinates {
+		availableHeight -= pdfCoordinatesHeight
+	}
+	return math.Min(availableWidth/float64(width), availableHeight/float64(height))
+}
+
+// drawNumberCells draws the outlines of the cells of the area with the number of their bead, thicker lines
+// mark the board borders
+func drawNumberCells(page *pdfPage, pattern *Pattern, numbers map[string]int, x0, y0, x1, y1 int,
+	top, cellSize float64) {
+	fontSize := cellSize * 0.5
+	page.setStrokeColor(colorByNumberLineColor)
+	page.setLineWidth(0.5)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			cell := pattern.Cell(x, y)
+			if cell.Empty() {
+				continue
+			}
+			left, cellTop := instructionsMargin+float64(x-x0)*cellSize, top+float64(y-y0)*cellSize
+			page.rect(left, cellTop, cellSize, cellSize, false, true)
+			number := strconv.Itoa(numbers[cell.Bead])
+			page.text(left+(cellSize-pdfTextWidth(number, fontSize))/2, cellTop+cellSize/2+fontSize*0.35,
+				pdfFontRegular, fontSize, number)
+		}
+	}
+
+	page.setStrokeColor(posterBoardColor)
+	page.setLineWidth(1)
+	width, height := float64(x1-x0)*cellSize, float64(y1-y0)*cellSize
+	for x := x0; x <= x1; x++ {
+		if x%pattern.BoardDimension == 0 || x == x1 {
+			page.line(instructionsMargin+float64(x-x0)*cellSize, top, instructionsMargin+float64(x-x0)*cellSize, top+height)
+		}
+	}
+	for y := y0; y <= y1; y++ {
+		if y%pattern.BoardDimension == 0 || y == y1 {
+			page.line(instructionsMargin, top+float64(y-y0)*cellSize, instructionsMargin+width, top+float64(y-y0)*cellSize)
+		}
+	}
+}
+
+// drawNumberLegend draws the numbered legend of the beads with a color swatch and their count in columns
+func (m *beadMachine) drawNumberLegend(page *pdfPage, palette map[string]BeadConfig, beads []string, numbers,
+	counts map[string]int, top float64) {
+	page.setStrokeColor(posterMarkColor)
+	page.setLineWidth(0.5)
+	for i, bead := range beads {
+		x := instructionsMargin + float64(i%colorByNumberLegendColumns)*colorByNumberLegendWidth
+		y := top + float64(i/colorByNumberLegendColumns)*colorByNumberLegendLine
+		c := palette[bead]
+		page.setFillColor(color.RGBA{c.R, c.G, c.B, 255})
+		page.rect(x, y, colorByNumberSwatch, colorByNumberSwatch, true, true)
+		page.setFillColor(posterMarkColor)
+		name := bead
+		label := fmt.Sprintf("%d = %s (%s)", numbers[bead], name, m.formatInt(counts[bead]))
+		for pdfTextWidth(label, instructionsFontSize) > colorByNumberLegendWidth-colorByNumberSwatch-8 && name != "" {
+			runes := []rune(name) // long bead names are shortened to fit into their column
+			name = string(runes[:len(runes)-1])
+			label = fmt.Sprintf("%d = %s. (%s)", numbers[bead], name, m.formatInt(counts[bead]))
+		}
+		page.text(x+colorByNumberSwatch+4, y+colorByNumberSwatch-1, pdfFontRegular, instructionsFontSize, label)
+	}
+}
@@ -0,0 +1,212 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// comparisonGap is the space in pixel between the patterns of the palette comparison image
+const comparisonGap = 16
+
+// paletteComparison contains the matching statistics of a palette of a comparison run
+type paletteComparison struct {
+	Name          string  `json:"name"`
+	Palette       string  `json:"palette"` // palette URI
+	Colors        int     `json:"colors"`
+	Beads         int     `json:"beads"`
+	MeanDistance  float64 `json:"meanDistance"`
+	TotalDistance float64 `json:"totalDistance"`
+	MaxDistance   float64 `json:"maxDistance"`
+	Cost          float64 `json:"cost,omitempty"` // price of all beads, only set if a bead price of the palette is known
+}
+
+// comparisonPalette returns the name and URI of a palette of the comparison, names of embedded palettes
+// like hama are used as embedded palette and everything else as palette URI
+func comparisonPalette(palette string) (name, uri string) {
+	if _, ok := embeddedPalettes[palette]; ok {
+		return palette, "embedded:" + palette
+	}
+	name = filepath.Base(palette)
+	if parts := strings.SplitN(palette, ":", 2); len(parts) == 2 && parts[0] == "embedded" {
+		name = parts[1]
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)), palette
+}
+
+// parseBeadPrices parses the bead price definitions in the format palette=price
+func parseBeadPrices(definitions map[string]string) (map[string]float64, error) {
+	prices := make(map[string]float64, len(definitions))
+	for name, value := range definitions {
+		price, err := strconv.ParseFloat(value, 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("invalid bead price '%s' of palette '%s'", value, name)
+		}
+		prices[name] = price
+	}
+	return prices, nil
+}
+
+// comparePalettes matches the prepared image to every palette of the comparison and writes a PNG per
+// palette, a side-by-side image of all patterns and optionally the statistics of all palettes
+func (m *beadMachine) comparePalettes() error {
+	inputImage, err := m.prepareImage()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var patterns []*Pattern
+	var comparisons []paletteComparison
+	for _, palette := range m.comparisonPalettes {
+		name, uri := comparisonPalette(palette)
+		m.logger.Info("Matching palette", zap.String("name", name), zap.String("palette", uri))
+		m.palette = uri
+		m.colorCache = newColorCache(m.colorCacheSize) // matches depend on the palette
+
+		pattern, err := m.matchImage(inputImage)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		patterns = append(patterns, pattern)
+		comparisons = append(comparisons, m.comparePattern(name, uri, pattern))
+	}
+
+	best := 0
+	for i, c := range comparisons {
+		fields := []zap.Field{
+			zap.String("name", c.Name),
+			zap.Int("colors", c.Colors),
+			zap.Float64("mean ΔE", c.MeanDistance),
+			zap.Float64("total ΔE", c.TotalDistance),
+		}
+		if c.Cost > 0 {
+			fields = append(fields, zap.Float64("cost", c.Cost))
+		}
+		m.logger.Info("Palette comparison", fields...)
+		if c.MeanDistance < comparisons[best].MeanDistance {
+			best = i
+		}
+	}
+	m.logger.Info("Closest palette", zap.String("name", comparisons[best].Name))
+
+	pngRenderer, _ := m.renderer("png")
+	outputs := []output{
+		{
+			format:   "compare",
+			fileName: m.variantFileName("compare"),
+			renderer: RendererFunc(func(_ *Pattern, w io.Writer) error {
+				return m.renderComparison(names, patterns, w)
+			}),
+		},
+	}
+	for i := range names {
+		pattern := patterns[i]
+		outputs = append(outputs, output{
+			format:   "png",
+			fileName: m.variantFileName(names[i]),
+			renderer: RendererFunc(func(_ *Pattern, w io.Writer) error {
+				return pngRenderer.Render(pattern, w)
+			}),
+		})
+	}
+	if m.statsFileName != "" {
+		outputs = append(outputs, output{
+			format:   "stats",
+			fileName: m.statsFileName,
+			renderer: RendererFunc(func(_ *Pattern, w io.Writer) error {
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return errors.Wrap(encoder.Encode(comparisons), "encoding palette comparison")
+			}),
+		})
+	}
+
+	failed := 0
+	for i, o := range outputs {
+		var pattern *Pattern // the size of the palette patterns is available to the name template
+		if i > 0 && i <= len(patterns) {
+			pattern = patterns[i-1]
+		}
+		if o.fileName, err = m.outputPath(o, pattern); err != nil {
+			m.logger.Error("Preparing output failed", zap.String("format", o.format), zap.Error(err))
+			return usageError(err)
+		}
+		if err = writeOutput(o, nil); err != nil {
+			m.logger.Error("Writing output failed",
+				zap.String("format", o.format),
+				zap.String("file", o.fileName),
+				zap.Error(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return outputError(fmt.Errorf("%d of %d outputs failed", failed, len(outputs)))
+	}
+	return nil
+}
+
+// comparePattern returns the comparison statistics of the pattern that was matched to the palette
+func (m *beadMachine) comparePattern(name, uri string, pattern *Pattern) paletteComparison {
+	stats := pattern.Stats()
+	c := paletteComparison{
+		Name:         name,
+		Palette:      uri,
+		Colors:       stats.Colors,
+		Beads:        stats.Beads,
+		MeanDistance: stats.MeanDistance,
+		MaxDistance:  stats.MaxDistance,
+	}
+	c.TotalDistance = stats.MeanDistance * float64(stats.Beads)
+	if price, ok := m.beadPrices[name]; ok {
+		c.Cost = price * float64(stats.Beads)
+	}
+	return c
+}
+
+// renderComparison renders the patterns of all palettes next to each other with the palette names above
+func (m *beadMachine) renderComparison(names []string, patterns []*Pattern, w io.Writer) error {
+	face := basicfont.Face7x13
+	top := face.Height + coordinateLabelPadding
+
+	images := make([]*image.RGBA, len(patterns))
+	columns := make([]int, len(patterns)) // widths of the pattern and its label
+	width, height := -comparisonGap, 0
+	for i, pattern := range patterns {
+		images[i] = m.patternImage(pattern)
+		bounds := images[i].Bounds()
+		columns[i] = maxInt(bounds.Dx(), len(names[i])*face.Advance)
+		width += columns[i] + comparisonGap
+		height = maxInt(height, bounds.Dy())
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, top+height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(coordinateBackground), image.Point{}, draw.Src)
+	x := 0
+	for i, patternImage := range images {
+		bounds := patternImage.Bounds()
+		draw.Draw(img, bounds.Add(image.Point{x, top}), patternImage, bounds.Min, draw.Over)
+		d := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(coordinateTextColor),
+			Face: face,
+			Dot:  fixed.P(x, face.Height-face.Descent),
+		}
+		d.DrawString(names[i])
+		x += columns[i] + comparisonGap
+	}
+	return errors.Wrap(png.Encode(w, img), "encoding palette comparison")
+}
@@ -0,0 +1,149 @@
+package beadmachine
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+	"go.uber.org/zap"
+)
+
+// completionCommand returns the command that generates shell completion scripts
+func completionCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "completion bash|zsh|fish|powershell",
+		Short: "Generate a shell completion script",
+		Long: `Generate a shell completion script that is written to stdout, for example:
+
+  bash:       source <(beadmachine completion bash)
+  zsh:        beadmachine completion zsh > "${fpath[1]}/_beadmachine"
+  fish:       beadmachine completion fish > ~/.config/fish/completions/beadmachine.fish
+  powershell: beadmachine completion powershell | Out-String | Invoke-Expression`,
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Args:      cobra.ExactValidArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root := cmd.Root()
+			var err error
+			switch args[0] {
+			case "bash":
+				err = root.GenBashCompletion(os.Stdout)
+			case "zsh":
+				err = root.GenZshCompletion(os.Stdout)
+			case "fish":
+				err = root.GenFishCompletion(os.Stdout, true)
+			case "powershell":
+				err = root.GenPowerShellCompletion(os.Stdout)
+			}
+			if err != nil {
+				return outputError(errors.Wrap(err, "generating completion script"))
+			}
+			return nil
+		},
+	}
+}
+
+// docsCommand returns the command that generates the documentation of all commands
+func docsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Generate documentation",
+	}
+
+	manCmd := &cobra.Command{
+		Use:   "man",
+		Short: "Generate man pages for all commands",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			logger := logger(cmd)
+			dir, _ := cmd.Flags().GetString("dir")
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				logger.Error("Creating man page directory failed", zap.Error(err))
+				return outputError(err)
+			}
+
+			header := &doc.GenManHeader{
+				Title:   "BEADMACHINE",
+				Section: "1",
+				Source:  "beadmachine",
+			}
+			if err := doc.GenManTree(cmd.Root(), header, dir); err != nil {
+				logger.Error("Generating man pages failed", zap.Error(err))
+				return outputError(err)
+			}
+			logger.Info("Man pages generated", zap.String("directory", dir))
+			return nil
+		},
+	}
+	manCmd.Flags().StringP("dir", "", "man", "output directory for the man pages")
+
+	cmd.AddCommand(manCmd)
+	return cmd
+}
+
+// registerFlagCompletions registers the dynamic completions of the flag values of the root command
+func registerFlagCompletions(cmd *cobra.Command) {
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	_ = cmd.RegisterFlagCompletionFunc("compare-palettes", completePalette)
+	_ = cmd.RegisterFlagCompletionFunc("fit", completeValues(fitContain, fitCover, fitStretch))
+	_ = cmd.RegisterFlagCompletionFunc("resample", completeValues(resampleLanczos, resampleLinear, resampleBox, resampleNearest))
+	_ = cmd.RegisterFlagCompletionFunc("pad-align", completeValues(padAlignCenter, padAlignTopLeft))
+	_ = cmd.RegisterFlagCompletionFunc("grid", completeValues(gridSquare, gridOffset))
+	_ = cmd.RegisterFlagCompletionFunc("craft", completeValues(craftPegboard, craftLoom))
+	_ = cmd.RegisterFlagCompletionFunc("tile-mirror", completeValues(tileMirrorNone, tileMirrorHorizontal, tileMirrorVertical, tileMirrorBoth))
+	_ = cmd.RegisterFlagCompletionFunc("preset", completePreset)
+	_ = cmd.RegisterFlagCompletionFunc("preview-inline", completeValues(inlineNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("distance", completeValues(colorDistanceNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("simulate-cvd", completeValues(cvdTypeNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("poster", completeValues(posterPaperNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("lang", completeValues(languageNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("html-renderer", completeValues(htmlRendererTable, htmlRendererCanvas))
+	_ = cmd.RegisterFlagCompletionFunc("units", completeValues(unitsMetric, unitsImperial))
+	_ = cmd.RegisterFlagCompletionFunc("bead-size", completeValues(beadSizeNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("stylize", completeValues(stylizeNames()...))
+	_ = cmd.RegisterFlagCompletionFunc("pdf-scale", completeValues(pdfScaleFit, pdfScaleActual))
+	_ = cmd.RegisterFlagCompletionFunc("render", completeRenderFormat)
+}
+
+// completeValues returns a completion function for a fixed list of values
+func completeValues(values ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completePalette completes the embedded palette URIs and JSON palette files
+func completePalette(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var completions []string
+	for _, name := range embeddedPaletteNames() {
+		completions = append(completions, "embedded:"+name)
+	}
+	files, _ := filepath.Glob(toComplete + "*.json")
+	completions = append(completions, files...)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completePreset completes the names of the built-in and user presets
+func completePreset(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return presetNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRenderFormat completes the output format names of the --render flag
+func completeRenderFormat(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if strings.Contains(toComplete, "=") { // the filename is completed by the shell
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	var completions []string
+	for name := range newBeadMachine(zap.NewNop()).builtinRenderers() {
+		completions = append(completions, name+"=")
+	}
+	for _, name := range registeredRendererNames() {
+		completions = append(completions, name+"=")
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,199 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// composition is the layout of several input images that are combined into a single pattern
+type composition struct {
+	inputFileNames []string
+	columns        int // columns and rows of the grid, 0 for a square grid
+	rows           int
+	cellWidth      int // size in beads that every image is fitted into, 0 to keep the image sizes
+	cellHeight     int
+	gap            int           // empty cells between the grid cells
+	offsets        []image.Point // positions of the images in cells, replaces the grid if set
+}
+
+// composeCommand returns the command that arranges several images into a single pattern. It has all flags of
+// the root command, so that the composed image is converted like a single input.
+func composeCommand(rootCmd *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compose file.png...",
+		Short: "Arrange several images into a single pattern",
+		Long: `Arrange several images into a single pattern, in a grid or at the given offsets, and convert it like a
+single input. All images are matched against the same palette and share the beads of a color limit, like a
+set of emoji on one large board layout. The outputs are named after the first image unless -o is given.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: startCompose,
+	}
+	rootCmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name != "grid" { // the grid of compose arranges the images, the bead grid is --bead-grid
+			cmd.Flags().AddFlag(flag)
+		}
+	})
+	cmd.Flags().StringP("grid", "", "", "columns and rows of the grid like 4x2, defaults to a square grid")
+	cmd.Flags().StringP("bead-grid", "", gridSquare, "bead grid of the pattern: square, or offset for peyote and brick stitch where every second row is shifted by half a bead")
+	cmd.Flags().StringP("cell-size", "", "", "size in beads like 16x16 that every image is fitted into, defaults to the size of the largest image")
+	cmd.Flags().IntP("gap", "", 0, "empty cells between the images of the grid")
+	cmd.Flags().StringArrayP("offset", "", nil, "position of an image in cells like 20,0 instead of the grid, given once per image in their order")
+	return cmd
+}
+
+func startCompose(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	grid, _ := cmd.Flags().GetString("grid")
+	cellSize, _ := cmd.Flags().GetString("cell-size")
+	gap, _ := cmd.Flags().GetInt("gap")
+	offsets, _ := cmd.Flags().GetStringArray("offset")
+
+	c := &composition{inputFileNames: args, gap: gap}
+	if input, _ := cmd.Flags().GetString("input"); input != "" {
+		c.inputFileNames = append([]string{input}, args...)
+	}
+	for _, name := range []string{"sprite-sheet", "from-clipboard", "shared-palette"} {
+		if cmd.Flags().Changed(name) {
+			logger.Error("A composition is a single input image", zap.String("flag", name))
+			return usageError(fmt.Errorf("compose can not be used with --%s", name))
+		}
+	}
+	if grid != "" {
+		columns, rows, ok := parseGrid(grid)
+		if !ok || columns*rows < len(c.inputFileNames) {
+			logger.Error("Invalid grid", zap.String("grid", grid), zap.Int("images", len(c.inputFileNames)))
+			return usageError(fmt.Errorf("invalid grid '%s' for %d images, expected columns x rows like 4x2", grid, len(c.inputFileNames)))
+		}
+		c.columns, c.rows = columns, rows
+	}
+	if cellSize != "" {
+		var ok bool
+		if c.cellWidth, c.cellHeight, ok = parseGrid(cellSize); !ok {
+			logger.Error("Invalid cell size", zap.String("cell-size", cellSize))
+			return usageError(fmt.Errorf("invalid cell size '%s', expected width x height like 16x16", cellSize))
+		}
+	}
+	if len(offsets) > 0 {
+		if grid != "" || len(offsets) != len(c.inputFileNames) {
+			logger.Error("Invalid offsets", zap.Int("offsets", len(offsets)), zap.Int("images", len(c.inputFileNames)))
+			return usageError(fmt.Errorf("--offset has to be given once per image and can not be used with --grid"))
+		}
+		for _, offset := range offsets {
+			p, err := parseOffset(offset)
+			if err != nil {
+				logger.Error("Invalid offset", zap.Error(err))
+				return usageError(err)
+			}
+			c.offsets = append(c.offsets, p)
+		}
+	}
+	return runBeadMachine(cmd, c.inputFileNames[:1], c)
+}
+
+// parseGrid parses two positive numbers like 4x2
+func parseGrid(value string) (int, int, bool) {
+	parts := strings.Split(strings.ToLower(value), "x")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	a, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	b, err := strconv.Atoi(parts[1])
+	if err != nil || a <= 0 || b <= 0 {
+		return 0, 0, false
+	}
+	return a, b, true
+}
+
+// parseOffset parses the position of a composed image like 20,0
+func parseOffset(value string) (image.Point, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) == 2 {
+		x, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err == nil {
+			var y int
+			y, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err == nil && x >= 0 && y >= 0 {
+				return image.Pt(x, y), nil
+			}
+		}
+	}
+	return image.Point{}, fmt.Errorf("invalid offset '%s', expected x,y like 20,0", value)
+}
+
+// composeImage reads the images of the composition and draws them onto a transparent image, the space
+// between them becomes empty cells. Every image is centered in its grid cell.
+func (m *beadMachine) composeImage() (image.Image, error) {
+	c := m.composition
+	images := make([]image.Image, len(c.inputFileNames))
+	cellWidth, cellHeight := c.cellWidth, c.cellHeight
+	for i, fileName := range c.inputFileNames {
+		if err := m.checkInputFileSize(fileName); err != nil {
+			return nil, errors.Wrapf(err, "reading %s", fileName)
+		}
+		img, err := readImageFile(fileName, !m.ignoreExif)
+		if err != nil {
+			return nil, errors.Wrapf(err, "reading %s", fileName)
+		}
+		if c.cellWidth > 0 {
+			img = m.fitCell(img, c.cellWidth, c.cellHeight)
+		} else {
+			cellWidth, cellHeight = maxInt(cellWidth, img.Bounds().Dx()), maxInt(cellHeight, img.Bounds().Dy())
+		}
+		images[i] = img
+	}
+
+	var bounds image.Rectangle // the grid keeps the empty space of its cells
+	positions := make([]image.Point, len(images))
+	if len(c.offsets) > 0 {
+		copy(positions, c.offsets)
+	} else {
+		columns, rows := c.columns, c.rows
+		if columns == 0 {
+			columns = int(math.Ceil(math.Sqrt(float64(len(images)))))
+			rows = (len(images) + columns - 1) / columns
+		}
+		for i, img := range images {
+			x := i%columns*(cellWidth+c.gap) + (cellWidth-img.Bounds().Dx())/2
+			y := i/columns*(cellHeight+c.gap) + (cellHeight-img.Bounds().Dy())/2
+			positions[i] = image.Pt(x, y)
+		}
+		bounds.Max = image.Pt(columns*(cellWidth+c.gap)-c.gap, rows*(cellHeight+c.gap)-c.gap)
+	}
+
+	for i, img := range images {
+		bounds = bounds.Union(image.Rectangle{Min: positions[i], Max: positions[i].Add(img.Bounds().Size())})
+	}
+	composed := image.NewNRGBA(image.Rect(0, 0, bounds.Max.X, bounds.Max.Y))
+	for i, img := range images {
+		r := image.Rectangle{Min: positions[i], Max: positions[i].Add(img.Bounds().Size())}
+		draw.Draw(composed, r, img, img.Bounds().Min, draw.Over)
+	}
+
+	m.logger.Info("Images composed",
+		zap.Int("images", len(images)),
+		zap.Int("width", bounds.Max.X),
+		zap.Int("height", bounds.Max.Y))
+	return composed, nil
+}
+
+// fitCell resizes the image to the largest size that fits into the cell while keeping its aspect ratio
+func (m *beadMachine) fitCell(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	scale := math.Min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+	newWidth := maxInt(1, int(math.Round(float64(bounds.Dx())*scale)))
+	newHeight := maxInt(1, int(math.Round(float64(bounds.Dy())*scale)))
+	return imaging.Resize(img, newWidth, newHeight, m.resampleFilter())
+}
@@ -0,0 +1,64 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// defaultConverterPalette is the palette of a converter without a palette option
+const defaultConverterPalette = "embedded:hama"
+
+// Options are the settings of a Converter, zero values keep the defaults of the command line
+type Options struct {
+	Palette        string // palette URI like embedded:hama or colors_hama.json, defaults to embedded:hama
+	Width          int    // width of the pattern in beads, 0 keeps the aspect ratio or the width of the image
+	Height         int    // height of the pattern in beads, 0 keeps the aspect ratio or the height of the image
+	BoardDimension int    // beads per side of a board, defaults to 20
+	Distance       string // registered color distance metric of the matching, defaults to ciede2000
+}
+
+// Converter converts images into bead patterns in memory without reading input files or writing outputs, for
+// programs that embed beadmachine and for regression tests of the color matching. Metrics, renderers and palette
+// providers that are registered before the conversion can be used with it.
+type Converter struct {
+	m *beadMachine
+}
+
+// NewConverter returns a converter with the options that logs nothing, the default settings convert an image
+// deterministically
+func NewConverter(options Options) (*Converter, error) {
+	if options.Width < 0 || options.Height < 0 || options.BoardDimension < 0 {
+		return nil, errors.New("invalid options, the width, height and board dimension can not be negative")
+	}
+	m := newBeadMachine(zap.NewNop())
+	m.palette = defaultConverterPalette
+	if options.Palette != "" {
+		m.palette = options.Palette
+	}
+	m.width, m.height = options.Width, options.Height
+	if options.BoardDimension > 0 {
+		m.boardDimension = options.BoardDimension
+	}
+	if options.Distance != "" {
+		distance, ok := registeredColorDistance(options.Distance)
+		if !ok {
+			return nil, fmt.Errorf("invalid color distance metric '%s', expected %s", options.Distance,
+				strings.Join(colorDistanceNames(), ", "))
+		}
+		m.colorDistance, m.distanceName = distance, options.Distance
+	}
+	return &Converter{m: m}, nil
+}
+
+// Convert runs the conversion pipeline on the image, from the filters to the substitutions and borders
+func (c *Converter) Convert(img image.Image) (*Pattern, error) {
+	img, err := c.m.fitImage(c.m.applyFilters(img))
+	if err != nil {
+		return nil, err
+	}
+	return c.m.matchImage(img)
+}
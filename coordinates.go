@@ -0,0 +1,229 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"strconv"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// coordinateLabelPadding is the space in pixel between coordinate labels and the pattern
+const coordinateLabelPadding = 4
+
+// coordinate labels of the PDF outputs in points
+const (
+	pdfCoordinateFontSize = 6.0
+	pdfCoordinateLine     = 7.0
+	pdfCoordinatePadding  = 2.0
+	pdfCoordinatesHeight  = 2*pdfCoordinateLine + pdfCoordinatePadding // space above the cells for the labels
+)
+
+// coordinate labels of the SVG outputs in cells
+const (
+	svgCoordinateFontSize = 0.6
+	svgCoordinatePadding  = 0.3
+)
+
+var (
+	coordinateBackground = color.RGBA{255, 255, 255, 255}
+	coordinateTextColor  = color.RGBA{96, 96, 96, 255}
+	boardLabelTextColor  = color.RGBA{0, 0, 0, 255}
+)
+
+// coordinateLabeled returns whether the 0 based cell index gets a coordinate label, the first cell and
+// every cell at a multiple of the coordinates interval is labeled with its 1 based number
+func (m *beadMachine) coordinateLabeled(index int) bool {
+	return index == 0 || (index+1)%m.coordinatesInterval == 0
+}
+
+// boardColumnName returns the letters of a board column, like A for the first board column
+func boardColumnName(column int) string {
+	name := boardName(column, 0)
+	return name[:len(name)-1]
+}
+
+// addImageCoordinates returns a copy of the pattern image with board names and row and column numbers
+// drawn along the top and left edges
+func (m *beadMachine) addImageCoordinates(patternImage *image.RGBA, pattern *Pattern, cellSize int) *image.RGBA {
+	face := basicfont.Face7x13
+	charWidth := face.Advance
+	lineHeight := face.Height
+
+	boardsY := boardsNeeded(pattern.Height, pattern.BoardDimension)
+	boardLabelWidth := len(strconv.Itoa(boardsY))*charWidth + coordinateLabelPadding
+	numberLabelWidth := len(strconv.Itoa(pattern.Height))*charWidth + coordinateLabelPadding
+	left := boardLabelWidth + numberLabelWidth
+	top := 2*lineHeight + coordinateLabelPadding
+
+	bounds := patternImage.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, left+bounds.Dx(), top+bounds.Dy()))
+	draw.Draw(img, img.Bounds(), image.NewUniform(coordinateBackground), image.Point{}, draw.Src)
+	draw.Draw(img, bounds.Add(image.Point{left, top}), patternImage, bounds.Min, draw.Src)
+
+	drawText := func(x, y int, s string, c color.RGBA) {
+		d := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(c),
+			Face: face,
+			Dot:  fixed.P(x, y),
+		}
+		d.DrawString(s)
+	}
+
+	// column numbers and board column letters along the top edge, labels that would overlap are skipped
+	nextFree := 0
+	for x := 0; x < pattern.Width; x++ {
+		center := left + x*cellSize + cellSize/2
+		if x%pattern.BoardDimension == 0 {
+			drawText(left+x*cellSize, lineHeight-face.Descent, boardColumnName(x/pattern.BoardDimension), boardLabelTextColor)
+		}
+		if !m.coordinateLabeled(x) {
+			continue
+		}
+		label := strconv.Itoa(x + 1)
+		labelX := center - len(label)*charWidth/2
+		if labelX < nextFree {
+			continue
+		}
+		drawText(labelX, 2*lineHeight-face.Descent, label, coordinateTextColor)
+		nextFree = labelX + (len(label)+1)*charWidth
+	}
+
+	// row numbers and board row numbers along the left edge
+	nextFree = 0
+	for y := 0; y < pattern.Height; y++ {
+		baseline := top + y*cellSize + cellSize/2 + face.Ascent/2
+		if y%pattern.BoardDimension == 0 {
+			drawText(0, top+y*cellSize+face.Ascent, strconv.Itoa(y/pattern.BoardDimension+1), boardLabelTextColor)
+		}
+		if !m.coordinateLabeled(y) || baseline-face.Ascent < nextFree {
+			continue
+		}
+		label := strconv.Itoa(y + 1)
+		drawText(left-coordinateLabelPadding-len(label)*charWidth, baseline, label, coordinateTextColor)
+		nextFree = baseline + face.Descent
+	}
+
+	return img
+}
+
+// drawPDFCoordinates draws board names and row and column numbers along the top and left edges of the cells of the
+// area, whose top left corner is at left and top. The first row and column of the area are labeled as well, so that
+// every poster panel shows where it starts. Labels that would overlap are skipped.
+func (m *beadMachine) drawPDFCoordinates(page *pdfPage, pattern *Pattern, x0, y0, x1, y1 int, left, top, cellSize float64) {
+	spaceWidth := pdfTextWidth(" ", pdfCoordinateFontSize)
+	numberWidth := pdfTextWidth(strconv.Itoa(pattern.Height), pdfCoordinateFontSize)
+	boardWidth := pdfTextWidth(strconv.Itoa(boardsNeeded(pattern.Height, pattern.BoardDimension)), pdfCoordinateFontSize)
+
+	// column numbers and board column letters along the top edge
+	nextNumber, nextBoard := 0.0, 0.0
+	for x := x0; x < x1; x++ {
+		cellLeft := left + float64(x-x0)*cellSize
+		if x == x0 || x%pattern.BoardDimension == 0 {
+			name := boardColumnName(x / pattern.BoardDimension)
+			if labelX := cellLeft + pdfCoordinatePadding; labelX >= nextBoard {
+				page.setFillColor(boardLabelTextColor)
+				page.text(labelX, top-pdfCoordinatePadding-pdfCoordinateLine, pdfFontBold, pdfCoordinateFontSize, name)
+				nextBoard = labelX + pdfTextWidth(name, pdfCoordinateFontSize) + spaceWidth
+			}
+		}
+		if x != x0 && !m.coordinateLabeled(x) {
+			continue
+		}
+		label := strconv.Itoa(x + 1)
+		width := pdfTextWidth(label, pdfCoordinateFontSize)
+		labelX := cellLeft + (cellSize-width)/2
+		if labelX < nextNumber {
+			continue
+		}
+		page.setFillColor(coordinateTextColor)
+		page.text(labelX, top-pdfCoordinatePadding, pdfFontRegular, pdfCoordinateFontSize, label)
+		nextNumber = labelX + width + spaceWidth
+	}
+
+	// row numbers and board row numbers along the left edge
+	nextNumber, nextBoard = 0, 0
+	for y := y0; y < y1; y++ {
+		cellTop := top + float64(y-y0)*cellSize
+		if y == y0 || y%pattern.BoardDimension == 0 {
+			if baseline := cellTop + pdfCoordinateFontSize; cellTop >= nextBoard {
+				page.setFillColor(boardLabelTextColor)
+				page.text(left-2*pdfCoordinatePadding-numberWidth-boardWidth, baseline, pdfFontBold, pdfCoordinateFontSize,
+					strconv.Itoa(y/pattern.BoardDimension+1))
+				nextBoard = baseline + pdfCoordinatePadding
+			}
+		}
+		if y != y0 && !m.coordinateLabeled(y) {
+			continue
+		}
+		baseline := cellTop + cellSize/2 + pdfCoordinateFontSize*0.35
+		if baseline-pdfCoordinateFontSize < nextNumber {
+			continue
+		}
+		label := strconv.Itoa(y + 1)
+		page.setFillColor(coordinateTextColor)
+		page.text(left-pdfCoordinatePadding-pdfTextWidth(label, pdfCoordinateFontSize), baseline, pdfFontRegular,
+			pdfCoordinateFontSize, label)
+		nextNumber = baseline
+	}
+}
+
+// svgCoordinatesMargin returns the space in cells left of and above the pattern that writeSVGCoordinates needs
+func svgCoordinatesMargin(pattern *Pattern) (float64, float64) {
+	labels := strconv.Itoa(pattern.Height) + strconv.Itoa(boardsNeeded(pattern.Height, pattern.BoardDimension))
+	left := pdfTextWidth(labels, svgCoordinateFontSize) + 3*svgCoordinatePadding
+	return math.Ceil(left*10) / 10, 2*svgCoordinateFontSize + 2*svgCoordinatePadding // a short viewBox
+}
+
+// writeSVGCoordinates writes a layer with board names and row and column numbers along the top and left edges of
+// the pattern, the text widths are approximated by the widths of Helvetica
+func (m *beadMachine) writeSVGCoordinates(w *bufio.Writer, pattern *Pattern) {
+	left, top := svgCoordinatesMargin(pattern)
+	fmt.Fprintf(w, "<g id=\"coordinates\" inkscape:groupmode=\"layer\" inkscape:label=\"Coordinates\" "+
+		"font-family=\"Helvetica, Arial, sans-serif\" font-size=\"%g\">\n", svgCoordinateFontSize)
+	text := func(x, y float64, anchor string, c color.RGBA, s string) {
+		fmt.Fprintf(w, "<text x=\"%g\" y=\"%g\" text-anchor=\"%s\" fill=\"#%02X%02X%02X\">%s</text>\n",
+			x, y, anchor, c.R, c.G, c.B, s)
+	}
+
+	// column numbers and board column letters along the top edge
+	nextFree := -left
+	for x := 0; x < pattern.Width; x++ {
+		if x%pattern.BoardDimension == 0 {
+			text(float64(x), -svgCoordinatePadding-svgCoordinateFontSize, "start", boardLabelTextColor,
+				boardColumnName(x/pattern.BoardDimension))
+		}
+		if !m.coordinateLabeled(x) {
+			continue
+		}
+		label := strconv.Itoa(x + 1)
+		width := pdfTextWidth(label, svgCoordinateFontSize)
+		if float64(x)+(1-width)/2 < nextFree {
+			continue
+		}
+		text(float64(x)+0.5, -svgCoordinatePadding, "middle", coordinateTextColor, label)
+		nextFree = float64(x) + (1+width)/2 + svgCoordinatePadding
+	}
+
+	// row numbers and board row numbers along the left edge
+	nextFree = -top
+	for y := 0; y < pattern.Height; y++ {
+		if y%pattern.BoardDimension == 0 {
+			text(-left, float64(y)+svgCoordinateFontSize, "start", boardLabelTextColor, strconv.Itoa(y/pattern.BoardDimension+1))
+		}
+		baseline := float64(y) + 0.5 + svgCoordinateFontSize*0.35
+		if !m.coordinateLabeled(y) || baseline-svgCoordinateFontSize < nextFree {
+			continue
+		}
+		text(-svgCoordinatePadding, baseline, "end", coordinateTextColor, strconv.Itoa(y+1))
+		nextFree = baseline
+	}
+	w.WriteString("</g>\n")
+}
@@ -0,0 +1,169 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jkl1337/go-chromath"
+	"github.com/jkl1337/go-chromath/deltae"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// cvdMinDistance is the color distance (ΔE) that two bead colors need to have under simulated color vision
+// deficiency to be considered distinguishable
+const cvdMinDistance = 10.0
+
+// cvdTypes contains the simulation matrices of the color vision deficiencies for linear RGB values,
+// based on Machado, Oliveira and Fernandes (2009) with a severity of 1.0
+var cvdTypes = map[string][3][3]float64{
+	"protanopia": {
+		{0.152286, 1.052583, -0.204868},
+		{0.114503, 0.786281, 0.099216},
+		{-0.003882, -0.048116, 1.051998},
+	},
+	"deuteranopia": {
+		{0.367322, 0.860646, -0.227968},
+		{0.280085, 0.672501, 0.047413},
+		{-0.011820, 0.042940, 0.968881},
+	},
+	"tritanopia": {
+		{1.255528, -0.076749, -0.178779},
+		{-0.078411, 0.930809, 0.147602},
+		{0.004733, 0.691367, 0.303900},
+	},
+}
+
+// patternSymbols are assigned to bead colors that need to be distinguished by more than their color
+var patternSymbols = []string{"●", "▲", "■", "◆", "★", "✚", "✖", "♥", "♣", "♠", "☀", "☾", "○", "△", "□", "◇"}
+
+// cvdTypeNames returns the sorted names of the supported color vision deficiencies
+func cvdTypeNames() []string {
+	var names []string
+	for name := range cvdTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// simulateCVD returns the color as it is perceived with the given color vision deficiency
+func simulateCVD(c color.RGBA, matrix [3][3]float64) color.RGBA {
+	linear := [3]float64{srgbToLinear(c.R), srgbToLinear(c.G), srgbToLinear(c.B)}
+	var simulated [3]uint8
+	for i, row := range matrix {
+		simulated[i] = linearToSRGB(row[0]*linear[0] + row[1]*linear[1] + row[2]*linear[2])
+	}
+	return color.RGBA{simulated[0], simulated[1], simulated[2], c.A}
+}
+
+// srgbToLinear converts a sRGB channel value to linear RGB
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts a linear RGB channel value to sRGB, values out of range are clamped
+func linearToSRGB(f float64) uint8 {
+	if f <= 0.0031308 {
+		f *= 12.92
+	} else {
+		f = 1.055*math.Pow(f, 1/2.4) - 0.055
+	}
+	return uint8(math.Max(0, math.Min(255, math.Round(f*255))))
+}
+
+// labColor converts the color to the Lab color space
+func (m *beadMachine) labColor(c color.RGBA) chromath.Lab {
+	rgb := chromath.RGB{float64(c.R), float64(c.G), float64(c.B)}
+	return m.labTransformer.Invert(m.rgbTransformer.Convert(rgb))
+}
+
+// checkColorblindSafety reports all pairs of used bead colors that are hard to distinguish with a color
+// vision deficiency and assigns symbols to the beads of these pairs
+func (m *beadMachine) checkColorblindSafety(pattern *Pattern) {
+	beadColors := make(map[string]color.RGBA)
+	for _, cell := range pattern.Cells {
+		if !cell.Empty() && cell.Bead != "" {
+			beadColors[cell.Bead] = cell.Color
+		}
+	}
+	var beads []string
+	for bead := range beadColors {
+		beads = append(beads, bead)
+	}
+	sort.Strings(beads)
+
+	ambiguous := make(map[string]bool)
+	for _, cvd := range cvdTypeNames() {
+		simulated := make(map[string]chromath.Lab, len(beads))
+		for _, bead := range beads {
+			simulated[bead] = m.labColor(simulateCVD(beadColors[bead], cvdTypes[cvd]))
+		}
+
+		for i, bead1 := range beads {
+			for _, bead2 := range beads[i+1:] {
+				distance := deltae.CIE2000(simulated[bead1], simulated[bead2], &deltae.KLChDefault)
+				if distance >= cvdMinDistance {
+					continue
+				}
+				m.logger.Warn("Bead colors are hard to distinguish with color vision deficiency",
+					zap.String("type", cvd),
+					zap.String("color1", bead1),
+					zap.String("color2", bead2),
+					zap.Float64("distance", distance))
+				ambiguous[bead1] = true
+				ambiguous[bead2] = true
+			}
+		}
+	}
+
+	pattern.Symbols = make(map[string]string)
+	for _, bead := range beads {
+		if !ambiguous[bead] {
+			continue
+		}
+		symbol := strconv.Itoa(len(pattern.Symbols) + 1)
+		if len(pattern.Symbols) < len(patternSymbols) {
+			symbol = patternSymbols[len(pattern.Symbols)]
+		}
+		pattern.Symbols[bead] = symbol
+	}
+	m.logger.Info("Symbols assigned for color vision deficiency", zap.Int("count", len(pattern.Symbols)))
+}
+
+// cvdPreviewRenderer returns a renderer for a PNG preview of the pattern image with simulated color vision deficiency
+func (m *beadMachine) cvdPreviewRenderer(cvd string) Renderer {
+	return RendererFunc(func(pattern *Pattern, w io.Writer) error {
+		img := m.patternImage(pattern)
+		bounds := img.Bounds()
+		simulated := image.NewRGBA(bounds)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				simulated.SetRGBA(x, y, simulateCVD(img.RGBAAt(x, y), cvdTypes[cvd]))
+			}
+		}
+		return errors.Wrap(png.Encode(w, simulated), "encoding CVD preview")
+	})
+}
+
+// variantFileName returns the PNG filename of a variant of the pattern like a color vision deficiency
+// preview, it is based on the PNG output filename or the input filename
+func (m *beadMachine) variantFileName(variant string) string {
+	base := m.outputFileName
+	if base == "" {
+		base = m.inputFileName
+	}
+	return fmt.Sprintf("%s_%s.png", strings.TrimSuffix(base, filepath.Ext(base)), variant)
+}
@@ -0,0 +1,103 @@
+package beadmachine
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/jkl1337/go-chromath"
+	"github.com/jkl1337/go-chromath/deltae"
+)
+
+// built-in color distance metrics
+const (
+	distanceCIEDE2000 = "ciede2000" // perceptual ΔE with corrections for blues and greys
+	distanceCIE94     = "cie94"     // perceptual ΔE of the graphic arts
+	distanceCIE76     = "cie76"     // euclidean distance in Lab, fast but less uniform
+	distanceHyAB      = "hyab"      // lightness and chroma difference that suits large color differences
+	distanceRGB       = "rgb"       // weighted euclidean distance in sRGB
+)
+
+// ColorDistance is a metric of the difference between two colors, the color matching picks the bead whose color
+// has the smallest distance to the pixel. The colors are given in CIE Lab with the D50 illuminant.
+type ColorDistance interface {
+	Distance(a, b chromath.Lab) float64
+}
+
+// ColorDistanceFunc is an adapter to allow the use of ordinary functions as color distance metrics
+type ColorDistanceFunc func(a, b chromath.Lab) float64
+
+// Distance calls f(a, b)
+func (f ColorDistanceFunc) Distance(a, b chromath.Lab) float64 {
+	return f(a, b)
+}
+
+var (
+	colorDistances = map[string]ColorDistance{
+		distanceCIEDE2000: ColorDistanceFunc(func(a, b chromath.Lab) float64 {
+			return deltae.CIE2000(a, b, &deltae.KLChDefault)
+		}),
+		distanceCIE94: ColorDistanceFunc(func(a, b chromath.Lab) float64 {
+			return deltae.CIE94(a, b, &deltae.KLCH94GraphicArts)
+		}),
+		distanceCIE76: ColorDistanceFunc(deltae.CIE76),
+		distanceHyAB: ColorDistanceFunc(func(a, b chromath.Lab) float64 {
+			return math.Abs(a.L()-b.L()) + math.Hypot(a.A()-b.A(), a.B()-b.B())
+		}),
+		distanceRGB: newRGBDistance(),
+	}
+	colorDistancesLock sync.RWMutex
+)
+
+// RegisterColorDistance registers a color distance metric for the given name, like a metric that is tuned to
+// photographed bead measurements. An already registered metric with the same name gets replaced.
+func RegisterColorDistance(name string, distance ColorDistance) {
+	colorDistancesLock.Lock()
+	colorDistances[name] = distance
+	colorDistancesLock.Unlock()
+}
+
+// registeredColorDistance returns the registered color distance metric for the given name
+func registeredColorDistance(name string) (ColorDistance, bool) {
+	colorDistancesLock.RLock()
+	distance, ok := colorDistances[name]
+	colorDistancesLock.RUnlock()
+	return distance, ok
+}
+
+// colorDistanceNames returns the sorted names of all registered color distance metrics
+func colorDistanceNames() []string {
+	colorDistancesLock.RLock()
+	names := make([]string, 0, len(colorDistances))
+	for name := range colorDistances {
+		names = append(names, name)
+	}
+	colorDistancesLock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// rgbDistance is the weighted euclidean distance of the sRGB colors, which weights the channels by the red
+// mean like the human eye. It is fast to reason about for palettes that were measured as RGB.
+type rgbDistance struct {
+	labTransformer *chromath.LabTransformer
+	rgbTransformer *chromath.RGBTransformer
+}
+
+// newRGBDistance returns the weighted RGB distance metric with the transformers of the color matching
+func newRGBDistance() *rgbDistance {
+	return &rgbDistance{
+		labTransformer: chromath.NewLabTransformer(&chromath.IlluminantRefD50),
+		rgbTransformer: chromath.NewRGBTransformer(&chromath.SpaceSRGB, &chromath.AdaptationBradford,
+			&chromath.IlluminantRefD50, &chromath.Scaler8bClamping, 1.0, nil),
+	}
+}
+
+// Distance returns the red mean weighted distance of the colors in sRGB
+func (d *rgbDistance) Distance(a, b chromath.Lab) float64 {
+	rgbA := d.rgbTransformer.Invert(d.labTransformer.Convert(a))
+	rgbB := d.rgbTransformer.Invert(d.labTransformer.Convert(b))
+	redMean := (rgbA[0] + rgbB[0]) / 2
+	dr, dg, db := rgbA[0]-rgbB[0], rgbA[1]-rgbB[1], rgbA[2]-rgbB[2]
+	return math.Sqrt((2+redMean/256)*dr*dr + 4*dg*dg + (2+(255-redMean)/256)*db*db)
+}
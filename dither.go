@@ -0,0 +1,142 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// saliencyPercentile is the percentile of the detail values that gets the full dithering strength, so that
+// the strength does not depend on a few extreme edges
+const saliencyPercentile = 0.9
+
+// saliencyMap returns the dithering strength between 0 and 1 for every pixel of the image. Pixels with much
+// detail in their neighborhood get a strong dithering, smooth areas like backgrounds get none.
+func (m *beadMachine) saliencyMap(img *image.NRGBA) []float64 {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	lum := make([]float64, width*height)
+	for i := range lum {
+		lum[i] = luminance(img.Pix[i*4 : i*4+3])
+	}
+	at := func(x, y int) float64 {
+		return lum[minInt(maxInt(x, 0), width-1)+minInt(maxInt(y, 0), height-1)*width]
+	}
+
+	// the detail is the gradient magnitude of the Sobel operator, averaged over the 3x3 neighborhood
+	gradient := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			gradient[x+y*width] = math.Hypot(gx, gy)
+		}
+	}
+	saliency := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			var count int
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if nx, ny := x+dx, y+dy; nx >= 0 && ny >= 0 && nx < width && ny < height {
+						sum += gradient[nx+ny*width]
+						count++
+					}
+				}
+			}
+			saliency[x+y*width] = sum / float64(count)
+		}
+	}
+
+	sorted := append([]float64(nil), saliency...)
+	sort.Float64s(sorted)
+	scale := sorted[int(float64(len(sorted)-1)*saliencyPercentile)]
+	for i := range saliency {
+		if scale > 0 {
+			saliency[i] = math.Min(1, saliency[i]/scale)
+		} else {
+			saliency[i] = 0
+		}
+	}
+
+	if m.preserveFaces { // faces always get the full dithering for their fine shading
+		faces := detectFaces(img)
+		for i, face := range faceMask(img, faces) {
+			if face {
+				saliency[i] = 1
+			}
+		}
+		m.logger.Debug("Dithering faces", zap.Int("faces", len(faces)))
+	}
+	return saliency
+}
+
+// ditherPattern matches all pixel of the image to a bead and diffuses the color error to the neighboring
+// pixels with the Floyd-Steinberg weights. The error is scaled by the saliency of the pixel, so detailed
+// regions are dithered and smooth regions are matched to flat colors.
+func (m *beadMachine) ditherPattern(inputImage image.Image) (*Pattern, error) {
+	beadConfig, beadLab, err := m.loadPalette()
+	if err != nil {
+		return nil, paletteError(err)
+	}
+
+	img := imaging.Clone(inputImage)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	pattern := newPattern(width, height, m.boardDimension)
+	pattern.Palette = beadConfig
+	pattern.Source = inputImage
+
+	saliency := m.saliencyMap(img)
+	diffused := make([][3]float64, width*height) // diffused color error per pixel
+	diffuse := func(x, y int, e [3]float64, weight float64) {
+		if x < 0 || x >= width || y >= height || img.Pix[(x+y*width)*4+3] == 0 {
+			return
+		}
+		for c := range e {
+			diffused[x+y*width][c] += e[c] * weight
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		if err := m.cancelled(); err != nil {
+			return pattern, err
+		}
+		for x := 0; x < width; x++ {
+			i := x + y*width
+			pixel := img.Pix[i*4 : i*4+4]
+			if pixel[3] == 0 { // transparent pixels are empty cells
+				continue
+			}
+			source := color.RGBA{pixel[0], pixel[1], pixel[2], 255}
+			adjusted := color.RGBA{
+				clampChannel(float64(pixel[0]) + diffused[i][0]*saliency[i]),
+				clampChannel(float64(pixel[1]) + diffused[i][1]*saliency[i]),
+				clampChannel(float64(pixel[2]) + diffused[i][2]*saliency[i]),
+				255,
+			}
+
+			beadName, _ := m.findSimilarColor(beadLab, adjusted)
+			bead := beadConfig[beadName]
+			beadColor := color.RGBA{bead.R, bead.G, bead.B, 255}
+			cell := pattern.Cell(x, y)
+			cell.Bead = beadName
+			cell.Color = beadColor
+			cell.Distance = m.colorDistance.Distance(m.labColor(source), m.labColor(beadColor))
+
+			e := [3]float64{
+				float64(adjusted.R) - float64(bead.R),
+				float64(adjusted.G) - float64(bead.G),
+				float64(adjusted.B) - float64(bead.B),
+			}
+			diffuse(x+1, y, e, 7.0/16)
+			diffuse(x-1, y+1, e, 3.0/16)
+			diffuse(x, y+1, e, 5.0/16)
+			diffuse(x+1, y+1, e, 1.0/16)
+		}
+	}
+	return pattern, nil
+}
@@ -0,0 +1,58 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// embedWidgetScript renders the pattern of the widget into the element whose id is set as data-target attribute of
+// the script tag, or into a new element in place of the script tag. Targets that follow the script tag are rendered
+// once the page is loaded.
+const embedWidgetScript = `  var script = document.currentScript, target = script ? script.getAttribute("data-target") : null;
+  function render() {
+    var view = target ? document.getElementById(target) : null;
+    if (!view) {
+      view = document.createElement("div");
+      if (script) { script.parentNode.insertBefore(view, script); } else { document.body.appendChild(view); }
+    }
+    beadmachineViewer(view, pattern, text);
+  }
+  if (target && !document.getElementById(target) && document.readyState === "loading") {
+    document.addEventListener("DOMContentLoaded", render);
+  } else {
+    render();
+  }
+`
+
+// renderEmbedJS renders a self-contained script that shows the pattern in the canvas viewer on any webpage, it is
+// included with <script src="pattern.js" data-target="element id"></script>
+func (m *beadMachine) renderEmbedJS(pattern *Pattern, writer io.Writer) error {
+	patternData, err := json.Marshal(canvasPatternData(pattern))
+	if err != nil {
+		return errors.Wrap(err, "marshalling widget pattern")
+	}
+	text, err := m.canvasTexts()
+	if err != nil {
+		return err
+	}
+	fingerprint, _, err := m.fingerprint(pattern)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, "// beadmachine pattern widget of %dx%d beads, fingerprint %s\n", pattern.Width, pattern.Height, fingerprint)
+	w.WriteString("// <script src=\"pattern.js\" data-target=\"element id\"></script>\n(function() {\n  var pattern = ")
+	w.Write(patternData)
+	w.WriteString(";\n  var text = ")
+	w.Write(text)
+	w.WriteString(";\n")
+	w.WriteString(canvasViewerScript)
+	w.WriteString(embedWidgetScript)
+	w.WriteString("})();\n")
+	return errors.Wrap(w.Flush(), "writing pattern widget script")
+}
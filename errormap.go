@@ -0,0 +1,52 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// errorMapMaxDistance is the color distance that is shown as the hottest color in the error map,
+// it is fixed to make error maps of different palettes and settings comparable
+const errorMapMaxDistance = 25.0
+
+// errorMapGradient is the color gradient used for the error map, from a perfect match to the max distance
+var errorMapGradient = []color.RGBA{
+	{0, 0, 0, 255},     // black
+	{0, 0, 255, 255},   // blue
+	{0, 255, 0, 255},   // green
+	{255, 255, 0, 255}, // yellow
+	{255, 0, 0, 255},   // red
+}
+
+// renderErrorMap renders a heatmap image of the color matching error of every bead
+func (m *beadMachine) renderErrorMap(pattern *Pattern, w io.Writer) error {
+	errorImage := image.NewRGBA(image.Rect(0, 0, pattern.Width, pattern.Height))
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			errorImage.SetRGBA(x, y, errorMapColor(pattern.Cell(x, y).Distance))
+		}
+	}
+
+	return errors.Wrap(png.Encode(w, errorImage), "encoding error map")
+}
+
+// errorMapColor returns the heatmap color for the given color distance
+func errorMapColor(distance float64) color.RGBA {
+	position := math.Min(distance/errorMapMaxDistance, 1.0) * float64(len(errorMapGradient)-1)
+	index := int(position)
+	if index >= len(errorMapGradient)-1 {
+		return errorMapGradient[len(errorMapGradient)-1]
+	}
+
+	from, to := errorMapGradient[index], errorMapGradient[index+1]
+	fraction := position - float64(index)
+	blend := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*fraction)
+	}
+	return color.RGBA{blend(from.R, to.R), blend(from.G, to.G), blend(from.B, to.B), 255}
+}
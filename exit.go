@@ -0,0 +1,105 @@
+package beadmachine
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// exit codes of the command, scripts can use them to detect the kind of failure
+const (
+	exitSuccess   = 0
+	exitFailure   = 1 // general failure
+	exitUsage     = 2 // invalid command line arguments or flag values
+	exitInput     = 3 // the input image could not be read
+	exitPalette   = 4 // the palette could not be loaded
+	exitOutput    = 5 // at least one output could not be written
+	exitWarnings  = 6 // warnings were logged in strict mode
+	exitCancelled = 7 // the conversion was cancelled by Ctrl-C or exceeded its timeout
+)
+
+// exitError is an error that has already been logged and determines the exit code of the command
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+// failureError returns an error with the general failure exit code
+func failureError(err error) error {
+	return &exitError{code: exitFailure, err: err}
+}
+
+// usageError returns an error for an invalid command line argument or flag value
+func usageError(err error) error {
+	return &exitError{code: exitUsage, err: err}
+}
+
+// inputError returns an error for an input image that could not be read
+func inputError(err error) error {
+	return &exitError{code: exitInput, err: err}
+}
+
+// paletteError returns an error for a palette that could not be loaded
+func paletteError(err error) error {
+	return &exitError{code: exitPalette, err: err}
+}
+
+// outputError returns an error for outputs that could not be written
+func outputError(err error) error {
+	return &exitError{code: exitOutput, err: err}
+}
+
+// cancelledError returns an error for a conversion that was cancelled or exceeded its timeout
+func cancelledError(err error) error {
+	return &exitError{code: exitCancelled, err: err}
+}
+
+// exitCode returns the exit code for an error returned by a command, errors that are not an exitError
+// or wrap one are returned by cobra for invalid arguments
+func exitCode(err error) int {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if e, ok := err.(*exitError); ok {
+			return e.code
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return exitUsage
+}
+
+// warningCounter counts the warnings that are logged by a logger
+type warningCounter struct {
+	count int64
+}
+
+// logger returns a logger that counts all logged warnings
+func (c *warningCounter) logger(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.Hooks(func(entry zapcore.Entry) error {
+		if entry.Level == zapcore.WarnLevel {
+			atomic.AddInt64(&c.count, 1)
+		}
+		return nil
+	}))
+}
+
+// strictError returns an error if warnings were logged
+func (c *warningCounter) strictError() error {
+	count := atomic.LoadInt64(&c.count)
+	if count == 0 {
+		return nil
+	}
+	return &exitError{code: exitWarnings, err: fmt.Errorf("%d warnings logged in strict mode", count)}
+}
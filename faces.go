@@ -0,0 +1,109 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+)
+
+// face regions are skin colored regions of at least this fraction of the image pixels
+const minFaceArea = 0.005
+
+// faceColorWeight is the factor by which face pixels count more than other pixels when the colors are reduced
+const faceColorWeight = 8
+
+// minSkinLuma is the minimum brightness of skin pixels, darker pixels are shadows, hair or background
+const minSkinLuma = 50
+
+// isSkinColor returns whether the color is within the skin tone range of the YCbCr color space, the range
+// covers light and dark skin tones as the chroma of skin varies much less than its brightness
+func isSkinColor(c color.Color) bool {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	if rgba.A == 0 {
+		return false
+	}
+	y, cb, cr := color.RGBToYCbCr(rgba.R, rgba.G, rgba.B)
+	return y >= minSkinLuma && cb >= 77 && cb <= 127 && cr >= 133 && cr <= 173
+}
+
+// detectFaces returns the bounds of skin colored regions of the image that have the size and shape of a face,
+// the bounds are relative to the image origin. This lightweight detector needs no trained model and works at
+// the small sizes of bead patterns, but it can also detect hands or skin colored objects.
+func detectFaces(img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	skin := make([]bool, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			skin[x+y*width] = isSkinColor(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	minArea := maxInt(4, int(float64(width*height)*minFaceArea))
+	visited := make([]bool, width*height)
+	var faces []image.Rectangle
+	for start := range skin {
+		if !skin[start] || visited[start] {
+			continue
+		}
+
+		// collect the rows of the connected skin region with a flood fill
+		rowWidths := make(map[int]int)
+		rowBounds := make(map[int]image.Rectangle)
+		region := image.Rect(start%width, start/width, start%width+1, start/width+1)
+		stack := []int{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := i%width, i/width
+			rowWidths[y]++
+			rowBounds[y] = rowBounds[y].Union(image.Rect(x, y, x+1, y+1))
+			region = region.Union(image.Rect(x, y, x+1, y+1))
+
+			neighbors := []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}}
+			for _, n := range neighbors {
+				if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+					continue
+				}
+				if j := n.X + n.Y*width; skin[j] && !visited[j] {
+					visited[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+
+		// a face ends at the neck, where the region gets much narrower than the head
+		area, maxWidth := 0, 0
+		var face image.Rectangle
+		for y := region.Min.Y; y < region.Max.Y; y++ {
+			if y-region.Min.Y >= 3 && rowWidths[y]*2 < maxWidth {
+				break
+			}
+			area += rowWidths[y]
+			maxWidth = maxInt(maxWidth, rowWidths[y])
+			face = face.Union(rowBounds[y])
+		}
+
+		// faces are compact regions that are about as high as wide or a bit higher
+		aspect := float64(face.Dy()) / float64(face.Dx())
+		fill := float64(area) / float64(face.Dx()*face.Dy())
+		if area >= minArea && aspect >= 0.6 && aspect <= 2.5 && fill >= 0.4 {
+			faces = append(faces, face)
+		}
+	}
+	return faces
+}
+
+// faceMask returns for every pixel of the image whether it is part of a detected face region
+func faceMask(img image.Image, faces []image.Rectangle) []bool {
+	width := img.Bounds().Dx()
+	mask := make([]bool, width*img.Bounds().Dy())
+	for _, face := range faces {
+		for y := face.Min.Y; y < face.Max.Y; y++ {
+			for x := face.Min.X; x < face.Max.X; x++ {
+				mask[x+y*width] = true
+			}
+		}
+	}
+	return mask
+}
@@ -0,0 +1,201 @@
+package beadmachine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// fingerprintLength is the amount of hex characters of the SHA-256 hash that are used as fingerprint
+const fingerprintLength = 16
+
+// fingerprintSettingsID is the id of the HTML script element that contains the conversion settings
+const fingerprintSettingsID = "beadmachine-settings"
+
+var (
+	htmlFingerprintPattern = regexp.MustCompile(`data-fingerprint="([0-9a-f]+)"`)
+	htmlSettingsPattern    = regexp.MustCompile(`(?s)<script type="application/json" id="` + fingerprintSettingsID + `">(.*?)</script>`)
+	pdfFingerprintPattern  = regexp.MustCompile(`/Subject <([0-9a-fA-F]+)>`)
+	pdfSettingsPattern     = regexp.MustCompile(`/Keywords <([0-9a-fA-F]+)>`)
+)
+
+// settingsFingerprint returns the fingerprint of the conversion settings and the complete palette, the
+// same settings and palette always result in the same fingerprint
+func settingsFingerprint(settings conversionSettings, palette map[string]BeadConfig) (string, error) {
+	data, err := json.Marshal(struct {
+		Settings conversionSettings    `json:"settings"`
+		Palette  map[string]BeadConfig `json:"palette"`
+	}{settings, palette})
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling fingerprint data")
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:fingerprintLength], nil
+}
+
+// fingerprint returns the fingerprint and the JSON encoded settings of the conversion of the pattern
+func (m *beadMachine) fingerprint(pattern *Pattern) (string, []byte, error) {
+	settings := m.settings()
+	fingerprint, err := settingsFingerprint(settings, pattern.Palette)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "marshalling settings")
+	}
+	return fingerprint, data, nil
+}
+
+// fingerprintFooter returns the footer text with the fingerprint of the PDF outputs
+func fingerprintFooter(fingerprint string) string {
+	return "beadmachine fingerprint " + fingerprint
+}
+
+// addPDFFingerprint adds the fingerprint as footer to every page and stores it with the settings in the
+// document information of the PDF
+func (m *beadMachine) addPDFFingerprint(doc *pdfDocument, pattern *Pattern) error {
+	fingerprint, settings, err := m.fingerprint(pattern)
+	if err != nil {
+		return err
+	}
+	doc.info = map[string]string{
+		"Subject":  fingerprint,
+		"Keywords": string(settings),
+	}
+	footer := fingerprintFooter(fingerprint)
+	for _, page := range doc.pages {
+		page.setFillColor(coordinateTextColor)
+		page.text(page.width-pdfTextWidth(footer, pdfFooterSize)-pdfFooterMargin, page.height-pdfFooterMargin,
+			pdfFontRegular, pdfFooterSize, footer)
+	}
+	return nil
+}
+
+// htmlFingerprint returns the HTML footer with the fingerprint and the settings of the conversion, the
+// JSON encoding escapes all HTML characters of the settings
+func (m *beadMachine) htmlFingerprint(pattern *Pattern) (string, error) {
+	fingerprint, settings, err := m.fingerprint(pattern)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("<p class=\"fp\" data-fingerprint=\"%s\">beadmachine fingerprint %s</p>\n"+
+		"<script type=\"application/json\" id=\"%s\">%s</script>\n",
+		fingerprint, fingerprint, fingerprintSettingsID, string(settings)), nil
+}
+
+// readFingerprint returns the fingerprint and the settings that are embedded in a HTML or PDF output
+func readFingerprint(fileName string) (string, conversionSettings, error) {
+	var settings conversionSettings
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", settings, errors.Wrap(err, "reading file")
+	}
+
+	var fingerprint string
+	var settingsData []byte
+	if bytes.HasPrefix(data, []byte("%PDF")) {
+		fingerprintMatch := pdfFingerprintPattern.FindSubmatch(data)
+		settingsMatch := pdfSettingsPattern.FindSubmatch(data)
+		if fingerprintMatch == nil || settingsMatch == nil {
+			return "", settings, errors.New("file contains no fingerprint")
+		}
+		fingerprintData, err := hex.DecodeString(string(fingerprintMatch[1]))
+		if err != nil {
+			return "", settings, errors.Wrap(err, "decoding fingerprint")
+		}
+		fingerprint = string(fingerprintData)
+		if settingsData, err = hex.DecodeString(string(settingsMatch[1])); err != nil {
+			return "", settings, errors.Wrap(err, "decoding settings")
+		}
+	} else {
+		fingerprintMatch := htmlFingerprintPattern.FindSubmatch(data)
+		settingsMatch := htmlSettingsPattern.FindSubmatch(data)
+		if fingerprintMatch == nil || settingsMatch == nil {
+			return "", settings, errors.New("file contains no fingerprint")
+		}
+		fingerprint = string(fingerprintMatch[1])
+		settingsData = settingsMatch[1]
+	}
+
+	if err = json.Unmarshal(settingsData, &settings); err != nil {
+		return "", settings, errors.Wrap(err, "parsing settings")
+	}
+	return fingerprint, settings, nil
+}
+
+// verifyCommand returns the command that verifies the fingerprint of a HTML or PDF output
+func verifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify file.html|file.pdf|bundle.zip",
+		Short: "Verify the settings fingerprint of a HTML or PDF pattern or the signature of a bundle",
+		Long: `Verify the settings fingerprint of a HTML or PDF pattern and print the settings that it was
+created with. The fingerprint is recalculated from the embedded settings and the palette, a different
+fingerprint means that the settings or the palette changed since the pattern was created.
+
+A bundle is verified against the checksums of its manifest and the signature of the manifest, a changed,
+added or removed file fails the verification. With --key the bundle has to be signed with the private key
+of the given public key, which proves who created it.`,
+		Args: cobra.ExactArgs(1),
+		RunE: startVerify,
+	}
+	cmd.Flags().StringP("palette", "p", "", "bead palette to verify against, defaults to the palette of the embedded settings")
+	cmd.Flags().StringP("key", "", "", "Ed25519 public key PEM file of the seller that a bundle has to be signed with")
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	return cmd
+}
+
+func startVerify(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	palette, _ := cmd.Flags().GetString("palette")
+	keyFileName, _ := cmd.Flags().GetString("key")
+	if isBundle(args[0]) {
+		return startVerifyBundle(logger, args[0], keyFileName)
+	}
+
+	fingerprint, settings, err := readFingerprint(args[0])
+	if err != nil {
+		logger.Error("Reading fingerprint failed", zap.Error(err))
+		return inputError(err)
+	}
+	settingsData, _ := json.Marshal(settings)
+	logger.Info("Pattern settings", zap.String("fingerprint", fingerprint), zap.String("settings", string(settingsData)))
+
+	if palette == "" {
+		palette = settings.Palette
+	}
+	var beads map[string]BeadConfig
+	if !settings.NoColorMatching { // the palette is not loaded without color matching
+		provider, err := openPalette(palette)
+		if err == nil {
+			beads, err = provider.Palette()
+		}
+		if err != nil {
+			logger.Error("Loading palette failed", zap.Error(err))
+			return paletteError(err)
+		}
+	}
+
+	expected, err := settingsFingerprint(settings, beads)
+	if err != nil {
+		logger.Error("Calculating fingerprint failed", zap.Error(err))
+		return failureError(err)
+	}
+	if expected != fingerprint {
+		logger.Error("Fingerprint does not match, the settings or the palette changed",
+			zap.String("fingerprint", fingerprint),
+			zap.String("expected", expected),
+			zap.String("palette", palette))
+		return failureError(fmt.Errorf("fingerprint %s does not match %s", fingerprint, expected))
+	}
+	logger.Info("Fingerprint verified", zap.String("fingerprint", fingerprint), zap.String("palette", palette))
+	return nil
+}
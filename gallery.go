@@ -0,0 +1,130 @@
+package beadmachine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// galleryThumbnailSize is the maximum width and height in pixel of the thumbnails in the gallery
+const galleryThumbnailSize = 240
+
+// galleryEntry is a pattern that was written in the run with its outputs
+type galleryEntry struct {
+	name    string
+	pattern *Pattern
+	outputs []output
+}
+
+// addGalleryEntry remembers the written pattern of the current input for the gallery and the notification
+func (m *beadMachine) addGalleryEntry(pattern *Pattern, outputs []output) {
+	name := filepath.Base(m.inputFileName)
+	if m.frameSuffix != "" {
+		name += " " + strings.TrimPrefix(m.frameSuffix, "_")
+	}
+	m.galleryEntries = append(m.galleryEntries, galleryEntry{name: name, pattern: pattern, outputs: outputs})
+}
+
+// writeGallery writes a HTML contact sheet of all patterns of the run with thumbnails, statistics, links to the
+// outputs and a shopping list of the beads of all patterns
+func (m *beadMachine) writeGallery() error {
+	file, err := os.Create(m.galleryFileName)
+	if err != nil {
+		return errors.Wrap(err, "creating gallery file")
+	}
+	defer file.Close()
+	dir, err := filepath.Abs(filepath.Dir(m.galleryFileName))
+	if err != nil {
+		return errors.Wrap(err, "getting gallery directory")
+	}
+
+	w := bufio.NewWriter(file)
+	title := html.EscapeString(m.tr("Bead patterns"))
+	fmt.Fprintf(w, "<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", title)
+	w.WriteString("<style type=\"text/css\">\n")
+	w.WriteString("body { font-family: sans-serif; }\n")
+	w.WriteString(".gl { display: flex; flex-wrap: wrap; }\n")
+	w.WriteString(".it { margin: 8px; padding: 8px; border: 1px solid #C0C0C0; width: 260px; }\n")
+	w.WriteString(".it img { max-width: 240px; max-height: 240px; image-rendering: pixelated; }\n")
+	w.WriteString(".st { color: #606060; font-size: smaller; }\n")
+	w.WriteString(".lg td { padding: 2px 8px; }\n")
+	fmt.Fprintf(w, "</style>\n</head>\n<body>\n<h2>%s</h2>\n<div class=\"gl\">\n", title)
+
+	totals := make(map[string]int)
+	palette := make(map[string]BeadConfig)
+	for _, entry := range m.galleryEntries {
+		thumbnail := imaging.Fit(m.patternImage(entry.pattern), galleryThumbnailSize, galleryThumbnailSize, imaging.NearestNeighbor)
+		var buf bytes.Buffer
+		if err = png.Encode(&buf, thumbnail); err != nil {
+			return errors.Wrap(err, "encoding thumbnail")
+		}
+
+		stats := entry.pattern.Stats()
+		fmt.Fprintf(w, "<div class=\"it\">\n<b>%s</b><br>\n", html.EscapeString(entry.name))
+		fmt.Fprintf(w, "<img src=\"data:image/png;base64,%s\"><br>\n", base64.StdEncoding.EncodeToString(buf.Bytes()))
+		fmt.Fprintf(w, "<span class=\"st\">%s</span><br>\n", html.EscapeString(m.tr(
+			"%sx%s beads on %sx%s boards, %s beads in %s colors, mean error %s",
+			m.formatInt(stats.Width), m.formatInt(stats.Height), m.formatInt(stats.BoardsWidth), m.formatInt(stats.BoardsHeight),
+			m.formatInt(stats.Beads), m.formatInt(stats.Colors), m.formatFloat(stats.MeanDistance, 1))))
+		for _, o := range entry.outputs {
+			// the outputs are linked relative to the gallery, so that the directory can be moved or shared
+			link, _ := filepath.Abs(o.fileName)
+			if relative, err := filepath.Rel(dir, link); err == nil {
+				link = relative
+			}
+			if _, _, remote := remoteOutput(o.fileName); remote { // uploaded outputs keep their object storage URI
+				link = o.fileName
+			}
+			fmt.Fprintf(w, "<a href=\"%s\">%s</a> ", html.EscapeString(filepath.ToSlash(link)), html.EscapeString(o.format))
+		}
+		w.WriteString("\n</div>\n")
+
+		for bead, count := range stats.BeadCounts {
+			totals[bead] += count
+			palette[bead] = entry.pattern.Palette[bead]
+		}
+	}
+	w.WriteString("</div>\n")
+
+	beads := make([]string, 0, len(totals))
+	total := 0
+	for bead, count := range totals {
+		beads = append(beads, bead)
+		total += count
+	}
+	sort.Slice(beads, func(i, j int) bool {
+		if totals[beads[i]] != totals[beads[j]] {
+			return totals[beads[i]] > totals[beads[j]]
+		}
+		return beads[i] < beads[j]
+	})
+	fmt.Fprintf(w, "<h3>%s</h3>\n<p>%s</p>\n<table class=\"lg\">\n", html.EscapeString(m.tr("Shopping list")),
+		html.EscapeString(m.tr("%s beads in %s colors for %s patterns",
+			m.formatInt(total), m.formatInt(len(beads)), m.formatInt(len(m.galleryEntries)))))
+	for _, bead := range beads {
+		c := palette[bead]
+		fmt.Fprintf(w, "<tr><td bgcolor=\"#%02X%02X%02X\">&nbsp;&nbsp;&nbsp;</td><td>%s</td><td>%s</td></tr>\n",
+			c.R, c.G, c.B, html.EscapeString(bead), m.formatInt(totals[bead]))
+	}
+	w.WriteString("</table>\n</body>\n</html>\n")
+
+	if err = w.Flush(); err != nil {
+		return errors.Wrap(err, "writing gallery file")
+	}
+	if err = file.Close(); err != nil {
+		return errors.Wrap(err, "closing gallery file")
+	}
+	m.logger.Info("Gallery written", zap.String("file", m.galleryFileName), zap.Int("patterns", len(m.galleryEntries)))
+	return nil
+}
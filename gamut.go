@@ -0,0 +1,77 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// gamutMarkerPixel marks pixels in the gamut map that are outside of the palette gamut
+var gamutMarkerPixel = color.RGBA{255, 0, 255, 255} // magenta
+
+// reportGamut reports all pattern regions whose best bead match is farther away than the gamut threshold. They are
+// only logged as warnings if the threshold was set, so that the default threshold does not fail ordinary images
+// with --strict.
+func (m *beadMachine) reportGamut(pattern *Pattern) {
+	boardsX := boardsNeeded(pattern.Width, pattern.BoardDimension)
+	boardsY := boardsNeeded(pattern.Height, pattern.BoardDimension)
+	boardCounts := make([]int, boardsX*boardsY)
+	outOfGamut := 0
+
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			if pattern.Cell(x, y).Distance <= m.gamutThreshold {
+				continue
+			}
+			outOfGamut++
+			boardCounts[x/pattern.BoardDimension+(y/pattern.BoardDimension)*boardsX]++
+		}
+	}
+
+	if outOfGamut == 0 {
+		m.logger.Info("All colors are within the palette gamut", zap.Float64("threshold", m.gamutThreshold))
+		return
+	}
+
+	log := m.logger.Info
+	if m.gamutWarnings {
+		log = m.logger.Warn
+	}
+	log("Colors outside of palette gamut",
+		zap.Float64("threshold", m.gamutThreshold),
+		zap.Int("count", outOfGamut),
+		zap.Float64("percent", float64(outOfGamut)*100/float64(len(pattern.Cells))))
+	for i, count := range boardCounts {
+		if count == 0 {
+			continue
+		}
+		log("Board with colors outside of palette gamut",
+			zap.Int("column", i%boardsX+1),
+			zap.Int("row", i/boardsX+1),
+			zap.Int("count", count))
+	}
+}
+
+// renderGamutMap renders an image that shows the source image in grey shades with all pixels
+// outside of the palette gamut highlighted
+func (m *beadMachine) renderGamutMap(pattern *Pattern, w io.Writer) error {
+	gamutImage := image.NewRGBA(image.Rect(0, 0, pattern.Width, pattern.Height))
+	sourceBounds := pattern.Source.Bounds()
+
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			if pattern.Cell(x, y).Distance > m.gamutThreshold {
+				gamutImage.SetRGBA(x, y, gamutMarkerPixel)
+				continue
+			}
+			grey := color.GrayModel.Convert(pattern.Source.At(sourceBounds.Min.X+x, sourceBounds.Min.Y+y)).(color.Gray)
+			gamutImage.SetRGBA(x, y, color.RGBA{grey.Y, grey.Y, grey.Y, 255})
+		}
+	}
+
+	return errors.Wrap(png.Encode(w, gamutImage), "encoding gamut map")
+}
@@ -5,7 +5,10 @@ go 1.13
 require (
 	github.com/disintegration/imaging v1.6.2
 	github.com/jkl1337/go-chromath v0.0.0-20140428033135-240283655afd
+	github.com/mattn/go-sqlite3 v1.14.5
 	github.com/pkg/errors v0.8.1
-	github.com/spf13/cobra v0.0.5
+	github.com/spf13/cobra v1.1.1
+	github.com/spf13/pflag v1.0.5
 	go.uber.org/zap v1.13.0
+	golang.org/x/image v0.0.0-20191009234506-e7c1f5e7dbb8
 )
@@ -0,0 +1,233 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// goldenSymbols are the symbols of the beads in the rows of a golden file, "." is an empty cell
+const goldenSymbols = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ!#$%&()*+,-/:;<=>?@[]^_{|}~"
+
+// goldenEmpty is the symbol of an empty cell in a golden file
+const goldenEmpty = "."
+
+// goldenMaxChanges is the amount of the most frequent changes that describe a difference to a golden file
+const goldenMaxChanges = 10
+
+// goldenPattern is a golden file of a pattern for regression tests of the color matching. Every row is a string
+// with a symbol per cell, so that a changed match shows up as a readable text diff instead of a PNG diff.
+type goldenPattern struct {
+	Settings conversionSettings `json:"settings"` // the settings that the pattern was converted with
+	Width    int                `json:"width"`
+	Height   int                `json:"height"`
+	Legend   map[string]string  `json:"legend"` // bead of every symbol, unmatched colors are given as #rrggbb
+	Rows     []string           `json:"rows"`
+}
+
+// goldenDiff is the difference between a golden pattern and a converted pattern
+type goldenDiff struct {
+	Width, Height int            // the size of the converted pattern if it differs from the golden pattern
+	Cells         int            // amount of cells with a different bead
+	Changes       map[string]int // amount of cells per change like "H1 White -> H2 Cream"
+}
+
+// GoldenT is the part of testing.T that CheckGolden needs, so that regression tests can call it directly
+type GoldenT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// cellBead returns the bead of a cell that is compared by golden files, the color of an unmatched cell and an
+// empty string for an empty cell
+func cellBead(cell Cell) string {
+	switch {
+	case cell.Empty():
+		return ""
+	case cell.Bead != "":
+		return cell.Bead
+	default:
+		return fmt.Sprintf("#%02x%02x%02x", cell.Color.R, cell.Color.G, cell.Color.B)
+	}
+}
+
+// newGoldenPattern returns the golden pattern of the pattern, the symbols are assigned to the beads in the
+// order of their names so that the same beads get the same symbols
+func (m *beadMachine) newGoldenPattern(pattern *Pattern) (*goldenPattern, error) {
+	beadSet := make(map[string]bool)
+	for _, cell := range pattern.Cells {
+		if bead := cellBead(cell); bead != "" {
+			beadSet[bead] = true
+		}
+	}
+	beads := make([]string, 0, len(beadSet))
+	for bead := range beadSet {
+		beads = append(beads, bead)
+	}
+	if len(beads) > len(goldenSymbols) {
+		return nil, fmt.Errorf("the pattern has %d beads, golden files support up to %d", len(beads), len(goldenSymbols))
+	}
+	sort.Strings(beads)
+
+	golden := &goldenPattern{
+		Settings: m.settings(),
+		Width:    pattern.Width,
+		Height:   pattern.Height,
+		Legend:   make(map[string]string, len(beads)),
+		Rows:     make([]string, pattern.Height),
+	}
+	symbols := make(map[string]string, len(beads))
+	for i, bead := range beads {
+		symbol := goldenSymbols[i : i+1]
+		symbols[bead] = symbol
+		golden.Legend[symbol] = bead
+	}
+	for y := 0; y < pattern.Height; y++ {
+		var row strings.Builder
+		for x := 0; x < pattern.Width; x++ {
+			if bead := cellBead(*pattern.Cell(x, y)); bead != "" {
+				row.WriteString(symbols[bead])
+			} else {
+				row.WriteString(goldenEmpty)
+			}
+		}
+		golden.Rows[y] = row.String()
+	}
+	return golden, nil
+}
+
+// readGoldenFile reads a golden pattern file
+func readGoldenFile(fileName string) (*goldenPattern, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading golden file")
+	}
+	golden := &goldenPattern{}
+	if err = json.Unmarshal(data, golden); err != nil {
+		return nil, errors.Wrap(err, "parsing golden file")
+	}
+	if len(golden.Rows) != golden.Height {
+		return nil, errors.New("golden file has invalid dimensions")
+	}
+	for _, row := range golden.Rows {
+		if len(row) != golden.Width {
+			return nil, errors.New("golden file has invalid dimensions")
+		}
+	}
+	return golden, nil
+}
+
+// writeGoldenFile writes the golden pattern file
+func writeGoldenFile(fileName string, golden *goldenPattern) error {
+	data, err := json.MarshalIndent(golden, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling golden file")
+	}
+	data = append(data, '\n')
+	return errors.Wrap(ioutil.WriteFile(fileName, data, 0644), "writing golden file")
+}
+
+// bead returns the bead of the cell of the golden pattern, an empty string for an empty cell
+func (g *goldenPattern) bead(x, y int) string {
+	return g.Legend[g.Rows[y][x:x+1]]
+}
+
+// compareGolden returns the difference between the golden pattern and the converted pattern, the beads are
+// compared by name so that the symbols of both may differ
+func compareGolden(want, got *goldenPattern) goldenDiff {
+	diff := goldenDiff{Changes: make(map[string]int)}
+	if want.Width != got.Width || want.Height != got.Height {
+		diff.Width, diff.Height = got.Width, got.Height
+		diff.Cells = maxInt(want.Width*want.Height, got.Width*got.Height)
+		return diff
+	}
+	describe := func(bead string) string {
+		if bead == "" {
+			return "empty"
+		}
+		return bead
+	}
+	for y := 0; y < want.Height; y++ {
+		for x := 0; x < want.Width; x++ {
+			if before, after := want.bead(x, y), got.bead(x, y); before != after {
+				diff.Cells++
+				diff.Changes[describe(before)+" -> "+describe(after)]++
+			}
+		}
+	}
+	return diff
+}
+
+// String describes the difference with the most frequent changes first
+func (d goldenDiff) String() string {
+	if d.Width > 0 || d.Height > 0 {
+		return fmt.Sprintf("the pattern size changed to %dx%d", d.Width, d.Height)
+	}
+	changes := make([]string, 0, len(d.Changes))
+	for change := range d.Changes {
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if d.Changes[changes[i]] != d.Changes[changes[j]] {
+			return d.Changes[changes[i]] > d.Changes[changes[j]]
+		}
+		return changes[i] < changes[j]
+	})
+	more := ""
+	if len(changes) > goldenMaxChanges {
+		more = fmt.Sprintf(" and %d more", len(changes)-goldenMaxChanges)
+		changes = changes[:goldenMaxChanges]
+	}
+	for i, change := range changes {
+		changes[i] = fmt.Sprintf("%s (%d)", change, d.Changes[change])
+	}
+	return fmt.Sprintf("%d cells differ: %s%s", d.Cells, strings.Join(changes, ", "), more)
+}
+
+// CheckGolden reports an error to the test if the pattern differs from the golden file in more than the
+// tolerated amount of cells. With update the golden file is written from the pattern instead, like after an
+// intended change of the color matching.
+func (c *Converter) CheckGolden(t GoldenT, fileName string, pattern *Pattern, tolerance int, update bool) {
+	t.Helper()
+	if err := c.m.verifyGolden(fileName, pattern, tolerance, update); err != nil {
+		t.Errorf("%s: %v", fileName, err)
+	}
+}
+
+// verifyGolden returns an error if the pattern differs from the golden file in more than the tolerated amount
+// of cells, with update the golden file is written from the pattern instead
+func (m *beadMachine) verifyGolden(fileName string, pattern *Pattern, tolerance int, update bool) error {
+	got, err := m.newGoldenPattern(pattern)
+	if err != nil {
+		return err
+	}
+	if update {
+		if err = writeGoldenFile(fileName, got); err != nil {
+			return err
+		}
+		m.logger.Info("Golden file updated", zap.String("file", fileName))
+		return nil
+	}
+
+	want, err := readGoldenFile(fileName)
+	if err != nil {
+		return err
+	}
+	wantSettings, _ := json.Marshal(want.Settings)
+	gotSettings, _ := json.Marshal(got.Settings)
+	if string(wantSettings) != string(gotSettings) {
+		m.logger.Warn("Settings differ from the golden file", zap.String("file", fileName),
+			zap.String("golden", string(wantSettings)), zap.String("settings", string(gotSettings)))
+	}
+	diff := compareGolden(want, got)
+	if diff.Cells > tolerance || diff.Width > 0 || diff.Height > 0 {
+		return errors.New(diff.String())
+	}
+	m.logger.Info("Pattern matches golden file", zap.String("file", fileName), zap.Int("cells", diff.Cells))
+	return nil
+}
@@ -0,0 +1,35 @@
+package beadmachine_test
+
+import (
+	"flag"
+	"image"
+	_ "image/png"
+	"os"
+	"testing"
+
+	"github.com/cornelk/beadmachine"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestGoldenYoshi(t *testing.T) {
+	f, err := os.Open("examples/yoshi_thinking_in.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	converter, err := beadmachine.NewConverter(beadmachine.Options{Palette: "embedded:hama", Width: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := converter.Convert(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converter.CheckGolden(t, "testdata/yoshi_thinking_hama.golden.json", pattern, 0, *update)
+}
@@ -0,0 +1,64 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+)
+
+// bead grids of the pattern, on an offset grid every second row is shifted by half a cell to the right like the
+// beads of peyote and brick stitch beadweaving
+const (
+	gridSquare = "square"
+	gridOffset = "offset"
+)
+
+// Offset returns whether the pattern is on an offset grid
+func (p *Pattern) Offset() bool {
+	return p.Grid == gridOffset
+}
+
+// rowShift returns the shift of the row to the right in cells, half a cell for every second row of an offset grid
+func (p *Pattern) rowShift(y int) float64 {
+	if p.Offset() && y%2 == 1 {
+		return 0.5
+	}
+	return 0
+}
+
+// patternGrid returns the grid that is stored in the matched patterns, square grids are not stored
+func (m *beadMachine) patternGrid() string {
+	if m.grid == gridOffset {
+		return gridOffset
+	}
+	return ""
+}
+
+// offsetImage resamples every second row of the image half a pixel to the right, so that every cell of an offset
+// grid gets the color at its shifted position. The last cell of a shifted row sticks out of the image and keeps
+// the color of the last pixel.
+func offsetImage(img image.Image) *image.NRGBA {
+	source := imaging.Clone(img)
+	offset := imaging.Clone(source)
+	width, height := source.Bounds().Dx(), source.Bounds().Dy()
+	for y := 1; y < height; y += 2 {
+		for x := 0; x < width-1; x++ {
+			offset.SetNRGBA(x, y, averageNRGBA(source.NRGBAAt(x, y), source.NRGBAAt(x+1, y)))
+		}
+	}
+	return offset
+}
+
+// averageNRGBA returns the average of the two colors, weighted by their alpha so that transparent pixels do not
+// darken the color
+func averageNRGBA(a, b color.NRGBA) color.NRGBA {
+	alpha := int(a.A) + int(b.A)
+	if alpha == 0 {
+		return color.NRGBA{}
+	}
+	channel := func(ca, cb uint8) uint8 {
+		return uint8((int(ca)*int(a.A) + int(cb)*int(b.A) + alpha/2) / alpha)
+	}
+	return color.NRGBA{R: channel(a.R, b.R), G: channel(a.G, b.G), B: channel(a.B, b.B), A: uint8((alpha + 1) / 2)}
+}
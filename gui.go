@@ -0,0 +1,399 @@
+package beadmachine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// guiMaxUpload is the maximum size in bytes of an image that is uploaded to the GUI
+const guiMaxUpload = 64 << 20
+
+// guiExports contains the output formats that the GUI exports, with their filename extension
+var guiExports = map[string]string{
+	"png":             ".png",
+	"html":            ".html",
+	"json":            ".json",
+	"instructionspdf": ".pdf",
+	"poster":          "_poster.pdf",
+}
+
+// guiResult is the response of a GUI conversion
+type guiResult struct {
+	Preview      string  `json:"preview"` // PNG data URL of the pattern in bead style
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	BoardsWidth  int     `json:"boardsWidth"`
+	BoardsHeight int     `json:"boardsHeight"`
+	Beads        int     `json:"beads"`
+	Colors       int     `json:"colors"`
+	MeanDistance float64 `json:"meanDistance"`
+}
+
+// guiCommand returns the command that starts the graphical user interface in the browser
+func guiCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gui",
+		Short: "Start the graphical user interface in the browser",
+		Long: `Start the graphical user interface, a local web page that is opened in the browser instead of a native
+window, so that the binary needs no GUI libraries. Images can be dropped onto the page, the settings are adjusted
+with sliders and the pattern is exported as PNG, HTML, JSON or PDF. The GUI uses the same conversion pipeline as the command line and needs no installation.`,
+		Args: cobra.NoArgs,
+		RunE: startGUI,
+	}
+	cmd.Flags().StringP("listen", "", "127.0.0.1:0", "address that the GUI listens on, port 0 picks a free port")
+	cmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette that is selected by default")
+	cmd.Flags().BoolP("no-browser", "", false, "do not open the browser, only print the address")
+	cmd.Flags().DurationP("timeout", "", 0, "cancel a conversion that takes longer than the given duration like 30s (0 = unlimited)")
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	return cmd
+}
+
+func startGUI(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	listen, _ := cmd.Flags().GetString("listen")
+	palette, _ := cmd.Flags().GetString("palette")
+	noBrowser, _ := cmd.Flags().GetBool("no-browser")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		logger.Error("Starting GUI failed", zap.Error(err))
+		return usageError(errors.Wrap(err, "listening"))
+	}
+	url := "http://" + listener.Addr().String() + "/"
+	logger.Info("GUI started", zap.String("url", url))
+	if !noBrowser {
+		if err = openBrowser(url); err != nil {
+			logger.Warn("Opening browser failed, open the URL manually", zap.String("url", url), zap.Error(err))
+		}
+	}
+
+	palettes := []string{palette}
+	for _, name := range embeddedPaletteNames() {
+		if "embedded:"+name != palette {
+			palettes = append(palettes, "embedded:"+name)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data, _ := json.Marshal(palettes)
+		fmt.Fprintf(w, guiPageHTML, string(data))
+	})
+	mux.HandleFunc("/convert", func(w http.ResponseWriter, r *http.Request) {
+		serveGUIConversion(logger, palette, timeout, w, r)
+	})
+	return failureError(http.Serve(listener, mux))
+}
+
+// openBrowser opens the URL in the default browser of the system
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// serveGUIConversion converts the uploaded image with the settings of the form and responds with a preview
+// or, if an export format is given, with the output file. The palette is used if the form selects none.
+func serveGUIConversion(logger *zap.Logger, palette string, timeout time.Duration, w http.ResponseWriter,
+	r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, guiMaxUpload)
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		http.Error(w, "no image uploaded", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// the image is stored in a temporary file with its extension, so that SVG and PDF files are rasterized
+	input, err := ioutil.TempFile("", "beadmachine-gui-*"+filepath.Ext(header.Filename))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(input.Name())
+	_, err = io.Copy(input, file)
+	if closeErr := input.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m := newBeadMachine(logger)
+	m.ctx = r.Context() // a closed browser tab cancels the conversion
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		m.ctx, cancel = context.WithTimeout(m.ctx, timeout)
+		defer cancel()
+	}
+	m.inputFileName = input.Name()
+	m.palette = palette
+	if err = m.applyGUISettings(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pattern, err := m.convert()
+	if err != nil && exitCode(err) == exitCancelled {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if format := r.FormValue("export"); format != "" {
+		extension, ok := guiExports[format]
+		if !ok {
+			http.Error(w, "unknown export format", http.StatusBadRequest)
+			return
+		}
+		renderer, err := m.renderer(format)
+		if err == nil {
+			var buf bytes.Buffer
+			if err = renderer.Render(pattern, &buf); err == nil {
+				name := defaultOutputFileName(header.Filename)
+				name = name[:len(name)-len(".png")] + extension
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(name)))
+				_, _ = w.Write(buf.Bytes())
+				return
+			}
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.beadStyle = true // the preview always shows the beads
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, m.patternImage(pattern)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	stats := pattern.Stats()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(guiResult{
+		Preview:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		Width:        stats.Width,
+		Height:       stats.Height,
+		BoardsWidth:  stats.BoardsWidth,
+		BoardsHeight: stats.BoardsHeight,
+		Beads:        stats.Beads,
+		Colors:       stats.Colors,
+		MeanDistance: stats.MeanDistance,
+	})
+}
+
+// applyGUISettings sets the conversion settings of the GUI form, numeric values are checked against the
+// ranges of the command line flags
+func (m *beadMachine) applyGUISettings(r *http.Request) error {
+	number := func(name string) (float64, error) {
+		value := r.FormValue(name)
+		if value == "" {
+			return 0, nil
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value '%s' for %s", value, name)
+		}
+		for _, fr := range flagRanges {
+			if fr.name == name && (f < fr.min || f > fr.max) {
+				return 0, fmt.Errorf("%s has to be between %g and %g", name, fr.min, fr.max)
+			}
+		}
+		return f, nil
+	}
+
+	values := map[string]*float64{
+		"blur":       &m.blur,
+		"sharpen":    &m.sharpen,
+		"contrast":   &m.contrast,
+		"brightness": &m.brightness,
+	}
+	for name, target := range values {
+		value, err := number(name)
+		if err != nil {
+			return err
+		}
+		*target = value
+	}
+	ints := map[string]*int{
+		"boardswidth": &m.boardsWidth,
+		"max-colors":  &m.maxColors,
+	}
+	for name, target := range ints {
+		value, err := number(name)
+		if err != nil {
+			return err
+		}
+		*target = int(value)
+	}
+
+	if palette := r.FormValue("palette"); palette != "" {
+		m.palette = palette
+	}
+	m.beadStyle = r.FormValue("beadstyle") == "on"
+	m.translucent = r.FormValue("translucent") == "on"
+	m.flourescent = r.FormValue("flourescent") == "on"
+	m.autoContrast = r.FormValue("auto-contrast") == "on"
+	m.adaptiveDither = r.FormValue("adaptive-dither") == "on"
+	m.coordinates = r.FormValue("coordinates") == "on"
+	return nil
+}
+
+// guiPageHTML is the page of the GUI, %s is replaced by the JSON array of the selectable palettes
+const guiPageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>beadmachine</title>
+<style type="text/css">
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#settings { width: 280px; padding: 16px; background: #F0F0F0; overflow-y: auto; }
+#settings label { display: block; margin: 10px 0 2px; }
+#settings input[type=range], #settings select { width: 100%%; }
+#main { flex: 1; display: flex; flex-direction: column; align-items: center; justify-content: center; }
+#drop { border: 3px dashed #A0A0A0; border-radius: 8px; padding: 40px; color: #606060; text-align: center; }
+#drop.over { border-color: #4080FF; color: #4080FF; }
+#preview { max-width: 90%%; max-height: 75vh; image-rendering: pixelated; display: none; }
+#info { margin-top: 8px; color: #606060; }
+button { margin: 4px 2px; }
+</style>
+</head>
+<body>
+<form id="settings">
+<label>Palette</label><select name="palette" id="palette"></select>
+<label>Width in boards: <span id="boardswidth-value">2</span></label>
+<input type="range" name="boardswidth" min="1" max="10" value="2">
+<label>Maximum colors (0 = all): <span id="max-colors-value">0</span></label>
+<input type="range" name="max-colors" min="0" max="40" value="0">
+<label>Contrast: <span id="contrast-value">0</span></label>
+<input type="range" name="contrast" min="-100" max="100" value="0">
+<label>Brightness: <span id="brightness-value">0</span></label>
+<input type="range" name="brightness" min="-100" max="100" value="0">
+<label>Blur: <span id="blur-value">0</span></label>
+<input type="range" name="blur" min="0" max="10" step="0.1" value="0">
+<label>Sharpen: <span id="sharpen-value">0</span></label>
+<input type="range" name="sharpen" min="0" max="10" step="0.1" value="0">
+<label><input type="checkbox" name="auto-contrast"> Auto contrast</label>
+<label><input type="checkbox" name="adaptive-dither"> Adaptive dithering</label>
+<label><input type="checkbox" name="translucent"> Translucent colors</label>
+<label><input type="checkbox" name="flourescent"> Flourescent colors</label>
+<label><input type="checkbox" name="beadstyle"> Bead style PNG</label>
+<label><input type="checkbox" name="coordinates"> Coordinates</label>
+<p>
+<button type="button" data-export="png">PNG</button>
+<button type="button" data-export="html">HTML</button>
+<button type="button" data-export="instructionspdf">Instructions PDF</button>
+<button type="button" data-export="poster">Poster PDF</button>
+<button type="button" data-export="json">JSON</button>
+</p>
+</form>
+<div id="main">
+<div id="drop">Drop an image here or <input type="file" id="file" accept="image/*,.svg,.pdf"></div>
+<img id="preview">
+<div id="info"></div>
+</div>
+<script>
+var palettes = %s;
+var form = document.getElementById("settings");
+var select = document.getElementById("palette");
+palettes.forEach(function (p) { var o = document.createElement("option"); o.text = p; select.add(o); });
+var image = null;
+var pending = null;
+
+function formData(exportFormat) {
+  var data = new FormData(form);
+  data.append("image", image, image.name);
+  if (exportFormat) { data.append("export", exportFormat); }
+  return data;
+}
+
+function convert() {
+  if (!image) { return; }
+  clearTimeout(pending);
+  pending = setTimeout(function () {
+    document.getElementById("info").textContent = "Converting...";
+    fetch("/convert", { method: "POST", body: formData() }).then(function (response) {
+      if (!response.ok) { return response.text().then(function (t) { throw new Error(t); }); }
+      return response.json();
+    }).then(function (r) {
+      var preview = document.getElementById("preview");
+      preview.src = r.preview;
+      preview.style.display = "block";
+      document.getElementById("drop").style.display = "none";
+      document.getElementById("info").textContent = r.width + "x" + r.height + " beads on " + r.boardsWidth + "x" +
+        r.boardsHeight + " boards, " + r.beads + " beads in " + r.colors + " colors, mean error " + r.meanDistance.toFixed(1);
+    }).catch(function (e) { document.getElementById("info").textContent = "Error: " + e.message; });
+  }, 200);
+}
+
+function setImage(file) { image = file; convert(); }
+
+form.addEventListener("input", function (e) {
+  var value = document.getElementById(e.target.name + "-value");
+  if (value) { value.textContent = e.target.value; }
+  convert();
+});
+document.getElementById("file").addEventListener("change", function (e) { setImage(e.target.files[0]); });
+document.body.addEventListener("dragover", function (e) { e.preventDefault(); document.getElementById("drop").className = "over"; });
+document.body.addEventListener("dragleave", function () { document.getElementById("drop").className = ""; });
+document.body.addEventListener("drop", function (e) {
+  e.preventDefault();
+  document.getElementById("drop").className = "";
+  if (e.dataTransfer.files.length > 0) { setImage(e.dataTransfer.files[0]); }
+});
+document.querySelectorAll("button[data-export]").forEach(function (button) {
+  button.addEventListener("click", function () {
+    if (!image) { return; }
+    var format = button.getAttribute("data-export");
+    fetch("/convert", { method: "POST", body: formData(format) }).then(function (response) {
+      if (!response.ok) { return response.text().then(function (t) { throw new Error(t); }); }
+      var name = /filename="([^"]+)"/.exec(response.headers.get("Content-Disposition"));
+      return response.blob().then(function (blob) {
+        var link = document.createElement("a");
+        link.href = URL.createObjectURL(blob);
+        link.download = name ? name[1] : "pattern";
+        link.click();
+      });
+    }).catch(function (e) { document.getElementById("info").textContent = "Error: " + e.message; });
+  });
+});
+</script>
+</body>
+</html>
+`
@@ -1,30 +1,79 @@
-package main
+package beadmachine
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
+	"html"
 	"image"
 	"image/color"
-	"io/ioutil"
-	"os"
+	"io"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/jkl1337/go-chromath"
-	"github.com/jkl1337/go-chromath/deltae"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
-// writeHTMLBeadInstructionFile writes a HTML file with instructions on how to make the bead based image
-func (m *beadMachine) writeHTMLBeadInstructionFile(outputImageBounds image.Rectangle, outputImage *image.RGBA, outputImageBeadNames []string) error {
-	htmlFile, err := os.Create(m.htmlFileName)
-	if err != nil {
-		return errors.Wrap(err, "creating HTML bead instruction file")
-	}
+// htmlSectionBoards is the amount of boards above which the HTML pattern gets a section per board instead of a
+// single table, browsers become unusably slow with tables of hundreds of thousands of cells
+const htmlSectionBoards = 16
+
+// htmlRowHeight is the estimated height in pixel of a table row of the HTML pattern, browsers reserve it for the
+// board sections that are not rendered yet
+const htmlRowHeight = 20
+
+// htmlThemeStyles contains the dark mode of the HTML pattern on screens and the print stylesheet, which keeps the bead
+// colors, prints the symbols in black and starts every board row or board section on a new page
+const htmlThemeStyles = `#theme { position: fixed; top: 8px; right: 8px; }
+@media screen {
+body.dark { background-color: #1E1E1E; color: #E0E0E0; }
+.dark a { color: #8AB4F8; }
+.dark .lb { border-left-color: #E0E0E0 !important; }
+.dark .rb { border-right-color: #E0E0E0 !important; }
+.dark .tb td { border-top-color: #E0E0E0 !important; }
+.dark .bb td { border-bottom-color: #E0E0E0 !important; }
+.dark .bg td:nth-child(even) { background-color: #303030; }
+.dark .co, .dark .fp { color: #A0A0A0; }
+}
+@media print {
+#theme, nav { display: none; }
+td { -webkit-print-color-adjust: exact; print-color-adjust: exact; }
+td span { color: #000000 !important; background-color: #FFFFFF; }
+tr.bb:not(:last-child) { break-after: page; }
+section { content-visibility: visible; }
+section + section { break-before: page; }
+}
+`
 
-	w := bufio.NewWriter(htmlFile)
-	w.WriteString("<html>\n<head>\n")
+// htmlThemeScript toggles the dark mode of the HTML pattern, it starts in the mode of the last visit or of the
+// system setting
+const htmlThemeScript = `<script>
+(function() {
+  var dark = window.matchMedia && window.matchMedia("(prefers-color-scheme: dark)").matches;
+  try {
+    if (localStorage.getItem("beadmachine-dark") !== null) { dark = localStorage.getItem("beadmachine-dark") === "1"; }
+  } catch (e) {}
+  document.body.classList.toggle("dark", dark);
+  document.getElementById("theme").addEventListener("click", function() {
+    dark = document.body.classList.toggle("dark");
+    try { localStorage.setItem("beadmachine-dark", dark ? "1" : "0"); } catch (e) {}
+  });
+})();
+</script>
+`
+
+// renderHTML renders a HTML file with instructions on how to make the bead based image. Large patterns are written
+// as a section per board that browsers only lay out when it is scrolled into view. A button toggles a dark mode and
+// printing starts every board row or section on a new page.
+func (m *beadMachine) renderHTML(pattern *Pattern, writer io.Writer) error {
+	boardsX := boardsNeeded(pattern.Width, pattern.BoardDimension)
+	boardsY := boardsNeeded(pattern.Height, pattern.BoardDimension)
+	sections := boardsX*boardsY > htmlSectionBoards
+
+	w := bufio.NewWriter(writer)
+	w.WriteString("<html>\n<head>\n<meta charset=\"utf-8\">\n")
 	w.WriteString("<style type=\"text/css\">\n")
 	w.WriteString("td { text-align: center }\n")
 	w.WriteString(".lb { border-left: 2px solid black !important; }\n")
@@ -32,95 +81,261 @@ func (m *beadMachine) writeHTMLBeadInstructionFile(outputImageBounds image.Recta
 	w.WriteString(".tb td { border-top: 2px solid black !important; }\n")
 	w.WriteString(".bb td { border-bottom: 2px solid black !important; }\n")
 	w.WriteString(".bg td:nth-child(even) { background-color: #E0E0E0; }\n")
+	w.WriteString(".co { color: #606060; font-size: smaller; }\n")
+	w.WriteString(".bn { font-weight: bold; vertical-align: top; }\n")
+	w.WriteString(".lg td { padding: 2px 8px; }\n")
+	w.WriteString(".fp { color: #606060; font-size: x-small; }\n")
+	if s := m.chartCellSize; s > 0 { // big cells for young kids and classroom projectors
+		fmt.Fprintf(w, ".cc td { width: %dpx; min-width: %dpx; height: %dpx; font-size: %dpx; }\n", s, s, s, maxInt(1, s/2))
+		if pattern.Offset() {
+			fmt.Fprintf(w, ".cc td.hc { width: %dpx; min-width: %dpx; }\n", maxInt(1, s/2), maxInt(1, s/2))
+		}
+	}
+	if pattern.Offset() {
+		w.WriteString(".hc { padding: 0; }\n")
+	}
+	if sections {
+		rowHeight := htmlRowHeight + maxInt(htmlRowHeight, m.chartCellSize)
+		fmt.Fprintf(w, "section { content-visibility: auto; contain-intrinsic-size: auto %dpx; }\n",
+			pattern.BoardDimension*rowHeight+3*htmlRowHeight)
+		w.WriteString(".bo td { padding: 2px 6px; }\n")
+	}
+	w.WriteString(htmlThemeStyles)
 	w.WriteString("</style>\n</head>\n<body>\n")
+	fmt.Fprintf(w, "<button id=\"theme\">%s</button>\n", html.EscapeString(m.tr("Dark mode")))
+	w.WriteString(htmlThemeScript)
+
+	if sections {
+		m.writeHTMLBoardSections(w, pattern, boardsX, boardsY)
+	} else {
+		m.writeHTMLTable(w, pattern, image.Rect(0, 0, pattern.Width, pattern.Height))
+	}
+
+	fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(m.tr("Pattern size: %s", m.formatSize(pattern.Width, pattern.Height))))
+	if len(pattern.Symbols) > 0 {
+		m.writeHTMLSymbolLegend(w, pattern)
+	}
+	footer, err := m.htmlFingerprint(pattern)
+	if err != nil {
+		return err
+	}
+	w.WriteString(footer)
+	w.WriteString("</body>\n</html>\n")
+	return errors.Wrap(w.Flush(), "writing HTML bead instruction file")
+}
+
+// writeHTMLBoardSections writes a grid of links to all boards and a section with the table of every board
+func (m *beadMachine) writeHTMLBoardSections(w *bufio.Writer, pattern *Pattern, boardsX, boardsY int) {
+	w.WriteString("<nav>\n<table class=\"bo\">\n")
+	for boardY := 0; boardY < boardsY; boardY++ {
+		w.WriteString("<tr>")
+		for boardX := 0; boardX < boardsX; boardX++ {
+			name := boardName(boardX, boardY)
+			fmt.Fprintf(w, "<td><a href=\"#board-%s\">%s</a></td>", name, name)
+		}
+		w.WriteString("</tr>\n")
+	}
+	w.WriteString("</table>\n</nav>\n")
+
+	for boardY := 0; boardY < boardsY; boardY++ {
+		for boardX := 0; boardX < boardsX; boardX++ {
+			name := boardName(boardX, boardY)
+			x0, y0 := boardX*pattern.BoardDimension, boardY*pattern.BoardDimension
+			x1, y1 := minInt(x0+pattern.BoardDimension, pattern.Width), minInt(y0+pattern.BoardDimension, pattern.Height)
+			title := m.tr("Board %s (columns %d-%d, rows %d-%d)", name, x0+1, x1, y0+1, y1)
+			fmt.Fprintf(w, "<section id=\"board-%s\">\n<h3>%s</h3>\n", name, html.EscapeString(title))
+			m.writeHTMLTable(w, pattern, image.Rect(x0, y0, x1, y1))
+			w.WriteString("</section>\n")
+		}
+	}
+}
+
+// writeHTMLTable writes the table of the cells of the pattern within the bounds, every pattern row is a table row
+// of colored cells and a table row of bead names. The cells of an offset grid span two table columns and every
+// second row starts with a half cell, so that it is shifted by half a bead.
+func (m *beadMachine) writeHTMLTable(w *bufio.Writer, pattern *Pattern, bounds image.Rectangle) {
 	w.WriteString("<table style=\"border-spacing: 0px;\">\n")
+	if m.coordinates {
+		m.writeHTMLColumnCoordinates(w, pattern, bounds)
+	}
 
-	for y := outputImageBounds.Min.Y; y < outputImageBounds.Max.Y; y++ {
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		var classes []string
+		if y == bounds.Min.Y { // draw top bead board horizontal border
+			classes = append(classes, "tb")
+		}
+		if m.chartCellSize > 0 {
+			classes = append(classes, "cc")
+		}
 		w.WriteString("<tr")
-		if y == 0 { // // draw top bead board horizontal border
-			w.WriteString(" class=\"tb\"")
+		if len(classes) > 0 {
+			w.WriteString(" class=\"" + strings.Join(classes, " ") + "\"")
 		}
 		w.WriteString(">")
+		if m.coordinates {
+			m.writeHTMLRowCoordinates(w, pattern, y)
+		}
+		writeHTMLRowShift(w, pattern, y, true)
 
-		var pixel color.RGBA
 		// write a line with colored cells
-		for x := outputImageBounds.Min.X; x < outputImageBounds.Max.X; x++ {
-			if m.beadStyle {
-				pixel = outputImage.RGBAAt((x*8)+1, (y*8)+1)
-			} else {
-				pixel = outputImage.RGBAAt(x, y)
-			}
-			colorstring := fmt.Sprintf("#%02X%02X%02X", pixel.R, pixel.G, pixel.B)
-
-			w.WriteString("<td bgcolor=\"" + colorstring + "\"")
-			if x == 0 {
-				w.WriteString(" class=\"lb\"") // draw left bead board vertical border
-			} else {
-				if (x+1)%m.boardDimension == 0 { // draw bead board vertical border
-					w.WriteString(" class=\"rb\"")
-				}
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := pattern.Cell(x, y).Color
+			w.WriteString("<td")
+			if pixel.A != 0 { // empty cells have no color
+				fmt.Fprintf(w, " bgcolor=\"#%02X%02X%02X\"", pixel.R, pixel.G, pixel.B)
 			}
-			w.WriteString(">&nbsp;</td>")
+			w.WriteString(htmlBorderClass(pattern, bounds, x) + htmlCellSpan(pattern))
+			w.WriteString(">" + htmlCellSymbol(pattern, pattern.Cell(x, y)) + "</td>")
 		}
+		writeHTMLRowShift(w, pattern, y, false)
 		w.WriteString("</tr>\n")
 
 		w.WriteString("<tr class=\"bg")
-		if y > 0 && (y+1)%m.boardDimension == 0 { // draw bead board horizontal border
+		if y > bounds.Min.Y && (y+1)%pattern.BoardDimension == 0 { // draw bead board horizontal border
 			w.WriteString(" bb")
 		}
 		w.WriteString("\">")
+		if m.coordinates {
+			w.WriteString("<td class=\"co\"></td>")
+		}
+		writeHTMLRowShift(w, pattern, y, true)
 
 		// write a line with bead names
-		for x := outputImageBounds.Min.X; x < outputImageBounds.Max.X; x++ {
-			beadName := outputImageBeadNames[x+y*outputImageBounds.Max.X]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			beadName := pattern.Cell(x, y).Bead
 			shortName := strings.Split(beadName, " ")
 
-			w.WriteString("<td")
-			if x == 0 {
-				w.WriteString(" class=\"lb\"") // draw left bead board vertical border
-			} else {
-				if (x+1)%m.boardDimension == 0 { // draw bead board vertical border
-					w.WriteString(" class=\"rb\"")
-				}
-			}
+			w.WriteString("<td" + htmlBorderClass(pattern, bounds, x) + htmlCellSpan(pattern))
 			w.WriteString(">&nbsp;" + shortName[0] + "&nbsp;</td>") // only print first part of name
 		}
+		writeHTMLRowShift(w, pattern, y, false)
 		w.WriteString("</tr>\n")
 	}
+	w.WriteString("</table>\n")
+}
+
+// htmlBorderClass returns the class attribute of the bead board vertical borders of a cell in the given column
+func htmlBorderClass(pattern *Pattern, bounds image.Rectangle, x int) string {
+	switch {
+	case x == bounds.Min.X: // draw left bead board vertical border
+		return " class=\"lb\""
+	case (x+1)%pattern.BoardDimension == 0: // draw bead board vertical border
+		return " class=\"rb\""
+	default:
+		return ""
+	}
+}
+
+// htmlCellSpan returns the colspan attribute of the cells, the cells of an offset grid span two table columns
+func htmlCellSpan(pattern *Pattern) string {
+	if pattern.Offset() {
+		return " colspan=\"2\""
+	}
+	return ""
+}
+
+// writeHTMLRowShift writes the half cell of a row of an offset grid, at the start of a shifted row and at the end
+// of the other rows
+func writeHTMLRowShift(w *bufio.Writer, pattern *Pattern, y int, start bool) {
+	if pattern.Offset() && (pattern.rowShift(y) > 0) == start {
+		w.WriteString("<td class=\"hc\"></td>")
+	}
+}
+
+// htmlCellSymbol returns the content of a colored cell, the bead symbol in a contrasting color or a space
+func htmlCellSymbol(pattern *Pattern, cell *Cell) string {
+	symbol, ok := pattern.Symbols[cell.Bead]
+	if !ok || cell.Empty() {
+		return "&nbsp;"
+	}
+	textColor := "#000000"
+	if luminance([]uint8{cell.Color.R, cell.Color.G, cell.Color.B}) < 128 {
+		textColor = "#FFFFFF"
+	}
+	return "<span style=\"color: " + textColor + "\">" + symbol + "</span>"
+}
+
+// writeHTMLSymbolLegend writes a table with the symbols, colors and names of all beads that have a symbol
+func (m *beadMachine) writeHTMLSymbolLegend(w *bufio.Writer, pattern *Pattern) {
+	var beads []string
+	for bead := range pattern.Symbols {
+		beads = append(beads, bead)
+	}
+	sort.Strings(beads)
+
+	fmt.Fprintf(w, "<h3>%s</h3>\n<table class=\"lg\">\n", html.EscapeString(m.tr("Symbols")))
+	for _, bead := range beads {
+		c := pattern.Palette[bead]
+		fmt.Fprintf(w, "<tr><td>%s</td><td bgcolor=\"#%02X%02X%02X\">&nbsp;&nbsp;&nbsp;</td><td>%s</td></tr>\n",
+			pattern.Symbols[bead], c.R, c.G, c.B, html.EscapeString(bead))
+	}
+	w.WriteString("</table>\n")
+}
+
+// writeHTMLColumnCoordinates writes table rows with the board column letters and column numbers of the bounds
+func (m *beadMachine) writeHTMLColumnCoordinates(w *bufio.Writer, pattern *Pattern, bounds image.Rectangle) {
+	w.WriteString("<tr><td class=\"co\" colspan=\"2\"></td>")
+	span := 1
+	if pattern.Offset() {
+		span = 2
+	}
+	for x := bounds.Min.X; x < bounds.Max.X; x += pattern.BoardDimension {
+		columns := minInt(pattern.BoardDimension, bounds.Max.X-x)
+		fmt.Fprintf(w, "<td class=\"bn\" colspan=\"%d\">%s</td>", columns*span, boardColumnName(x/pattern.BoardDimension))
+	}
+	writeHTMLRowShift(w, pattern, 0, false)
+	w.WriteString("</tr>\n")
 
-	w.WriteString("</table>\n</body>\n</html>\n")
-	w.Flush()
-	htmlFile.Close()
-	return nil
+	w.WriteString("<tr><td class=\"co\" colspan=\"2\"></td>")
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		w.WriteString("<td class=\"co\"" + htmlCellSpan(pattern) + ">")
+		if m.coordinateLabeled(x) {
+			w.WriteString(strconv.Itoa(x + 1))
+		}
+		w.WriteString("</td>")
+	}
+	writeHTMLRowShift(w, pattern, 0, false)
+	w.WriteString("</tr>\n")
+}
+
+// writeHTMLRowCoordinates writes the board row number and row number cells of a table row
+func (m *beadMachine) writeHTMLRowCoordinates(w *bufio.Writer, pattern *Pattern, y int) {
+	if y%pattern.BoardDimension == 0 { // the board row number spans both table rows of all pattern rows of the board
+		rows := minInt(pattern.BoardDimension, pattern.Height-y)
+		fmt.Fprintf(w, "<td class=\"bn\" rowspan=\"%d\">%d</td>", 2*rows, y/pattern.BoardDimension+1)
+	}
+	w.WriteString("<td class=\"co\">")
+	if m.coordinateLabeled(y) {
+		w.WriteString(strconv.Itoa(y + 1))
+	}
+	w.WriteString("</td>")
 }
 
 // findSimilarColor finds the most similar color from bead palette to the given pixel
-func (m *beadMachine) findSimilarColor(cfgLab map[chromath.Lab]string, pixel color.Color) string {
-	m.colorMatchCacheLock.RLock()
-	match, found := m.colorMatchCache[pixel]
-	m.colorMatchCacheLock.RUnlock()
-	if found {
-		return match
-	}
-
-	m.rgbLabCacheLock.RLock()
-	labPixel, found := m.rgbLabCache[pixel]
-	m.rgbLabCacheLock.RUnlock()
-	if !found {
-		r, g, b, _ := pixel.RGBA()
-		rgb := chromath.RGB{float64(uint8(r)), float64(uint8(g)), float64(uint8(b))}
-		xyz := m.rgbTransformer.Convert(rgb)
-		labPixel = m.labTransformer.Invert(xyz)
-		m.rgbLabCacheLock.Lock()
-		m.rgbLabCache[pixel] = labPixel
-		m.rgbLabCacheLock.Unlock()
+// and returns its name and the color distance to it
+func (m *beadMachine) findSimilarColor(cfgLab map[chromath.Lab]string, pixel color.Color) (string, float64) {
+	if m.cachePrecision < maxCachePrecision { // similar colors share the cache entry and the match
+		pixel = quantizeColor(pixel, m.cachePrecision)
 	}
+	match := m.colorCache.lookup(colorKey(pixel), func() colorMatch {
+		return m.matchColor(cfgLab, pixel)
+	})
+	return match.beadName, match.distance
+}
+
+// matchColor compares the pixel to every color of the bead palette and returns the closest bead
+func (m *beadMachine) matchColor(cfgLab map[chromath.Lab]string, pixel color.Color) colorMatch {
+	r, g, b, _ := pixel.RGBA()
+	rgb := chromath.RGB{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+	xyz := m.rgbTransformer.Convert(rgb)
+	labPixel := m.labTransformer.Invert(xyz)
 
 	var bestBeadMatch string
 	minDistance := -1.0 // < 0 is uninitialized marker
 	for lab, beadName := range cfgLab {
-		distance := deltae.CIE2000(lab, labPixel, &deltae.KLChDefault)
-		if minDistance < 0.0 || distance < minDistance {
+		distance := m.colorDistance.Distance(lab, labPixel)
+		// equal distances are decided by the bead name, as the iteration order of the palette is random
+		if minDistance < 0.0 || distance < minDistance || (distance == minDistance && beadName < bestBeadMatch) {
 			minDistance = distance
 			bestBeadMatch = beadName
 		}
@@ -128,26 +343,34 @@ func (m *beadMachine) findSimilarColor(cfgLab map[chromath.Lab]string, pixel col
 	}
 
 	m.logger.Debug("Best color match", zap.String("bead", bestBeadMatch), zap.Float64("distance", minDistance))
-	m.colorMatchCacheLock.Lock()
-	m.colorMatchCache[pixel] = bestBeadMatch
-	m.colorMatchCacheLock.Unlock()
-	return bestBeadMatch
+	return colorMatch{beadName: bestBeadMatch, distance: minDistance}
+}
+
+// beadSelected returns whether the bead is part of the selected colors, given by their full name or
+// their code that is the first part of the name, like H1
+func beadSelected(beadName string, colors []string) bool {
+	code := strings.Split(beadName, " ")[0]
+	for _, selected := range colors {
+		selected = strings.TrimSpace(selected)
+		if strings.EqualFold(selected, beadName) || strings.EqualFold(selected, code) {
+			return true
+		}
+	}
+	return false
 }
 
-// loadPalette loads a palette from a json file and returns a LAB color palette
+// loadPalette loads a palette from the palette provider and returns a LAB color palette
 func (m *beadMachine) loadPalette() (map[string]BeadConfig, map[chromath.Lab]string, error) {
-	cfgData, err := ioutil.ReadFile(m.paletteFileName)
+	provider, err := openPalette(m.palette)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "opening palette file")
+		return nil, nil, err
 	}
-
-	cfg := make(map[string]BeadConfig)
-	err = json.Unmarshal(cfgData, &cfg)
+	cfg, err := provider.Palette()
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "unmarshalling palette file")
+		return nil, nil, err
 	}
 
-	cfgLab := make(map[chromath.Lab]string)
+	var beadNames []string
 	for beadName, rgbOriginal := range cfg {
 		if m.greyScale && !rgbOriginal.GreyShade { // only process grey shades in greyscale mode
 			continue
@@ -158,11 +381,20 @@ func (m *beadMachine) loadPalette() (map[string]BeadConfig, map[chromath.Lab]str
 		if !m.flourescent && rgbOriginal.Flourescent { // only process flourescent in flourescent mode
 			continue
 		}
+		if len(m.colors) > 0 && !beadSelected(beadName, m.colors) { // only process the selected colors
+			continue
+		}
+		beadNames = append(beadNames, beadName)
+	}
+	sort.Strings(beadNames) // the first of duplicate beads is used
 
+	beadLabs := make(map[string]chromath.Lab, len(beadNames))
+	for _, beadName := range beadNames {
+		rgbOriginal := cfg[beadName]
 		rgb := chromath.RGB{float64(rgbOriginal.R), float64(rgbOriginal.G), float64(rgbOriginal.B)}
 		xyz := m.rgbTransformer.Convert(rgb)
 		lab := m.labTransformer.Invert(xyz)
-		cfgLab[lab] = beadName
+		beadLabs[beadName] = lab
 		m.logger.Debug("Bead loaded",
 			zap.String("bead", beadName),
 			zap.Any("RGB", rgb),
@@ -170,5 +402,35 @@ func (m *beadMachine) loadPalette() (map[string]BeadConfig, map[chromath.Lab]str
 		)
 	}
 
+	duplicates := findDuplicateBeads(beadNames, beadLabs, m.duplicateThreshold)
+	for _, duplicate := range duplicates {
+		if m.mergeDuplicates {
+			m.logger.Info("Palette duplicate merged",
+				zap.String("bead", duplicate.bead),
+				zap.String("merged", duplicate.duplicate),
+				zap.Float64("distance", duplicate.distance))
+			delete(beadLabs, duplicate.duplicate)
+			continue
+		}
+		m.logger.Warn("Palette contains duplicate bead colors",
+			zap.String("bead", duplicate.bead),
+			zap.String("duplicate", duplicate.duplicate),
+			zap.Float64("distance", duplicate.distance))
+	}
+
+	cfgLab := make(map[chromath.Lab]string)
+	for _, beadName := range beadNames {
+		lab, ok := beadLabs[beadName]
+		if !ok {
+			continue
+		}
+		if _, exists := cfgLab[lab]; !exists { // beads with identical colors can not be told apart
+			cfgLab[lab] = beadName
+		}
+	}
+
+	if len(cfgLab) == 0 {
+		return nil, nil, errors.New("no bead colors of the palette are selected")
+	}
 	return cfg, cfgLab, nil
 }
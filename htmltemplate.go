@@ -0,0 +1,118 @@
+package beadmachine
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// htmlTemplateData is the data model that custom HTML templates are executed with
+type htmlTemplateData struct {
+	Pattern     *Pattern           // the bead pattern with its dimensions and all cells
+	Stats       PatternStats       // the statistics like in the stats output
+	Rows        [][]htmlCell       // the cells row by row
+	Legend      []htmlLegendEntry  // the used beads, ordered by count
+	Fingerprint template.HTML      // the settings fingerprint that is checked by the verify command
+	Settings    conversionSettings // the settings of the conversion
+	CellSize    int                // size in pixel of the cells of --chart-cell-size, 0 for the default size
+}
+
+// htmlCell is a cell of a custom HTML template
+type htmlCell struct {
+	X, Y        int    // coordinates of the cell, counted from 0
+	Bead        string // name of the bead, empty for empty cells
+	Color       string // color of the bead like #FF0000, empty for empty cells
+	TextColor   string // contrasting color for text on the bead color
+	Symbol      string // symbol of the bead, if it is not distinguishable by color alone
+	Empty       bool
+	BoardRight  bool // whether the cell is at the right edge of a board
+	BoardBottom bool // whether the cell is at the bottom edge of a board
+	Shifted     bool // whether the row of the cell is shifted by half a cell on an offset grid
+}
+
+// htmlLegendEntry is a used bead of a custom HTML template
+type htmlLegendEntry struct {
+	Bead   string
+	Color  string
+	Symbol string
+	Count  int
+}
+
+// loadHTMLTemplate parses a custom HTML template file
+func loadHTMLTemplate(fileName string) (*template.Template, error) {
+	tmpl, err := template.ParseFiles(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing HTML template")
+	}
+	return tmpl, nil
+}
+
+// htmlTemplateData returns the data model of the pattern for custom HTML templates
+func (m *beadMachine) htmlTemplateData(pattern *Pattern) (htmlTemplateData, error) {
+	footer, err := m.htmlFingerprint(pattern)
+	if err != nil {
+		return htmlTemplateData{}, err
+	}
+	data := htmlTemplateData{
+		Pattern:     pattern,
+		Stats:       m.PatternStats(pattern),
+		Rows:        make([][]htmlCell, pattern.Height),
+		Fingerprint: template.HTML(footer),
+		Settings:    m.settings(),
+		CellSize:    m.chartCellSize,
+	}
+
+	for y := 0; y < pattern.Height; y++ {
+		data.Rows[y] = make([]htmlCell, pattern.Width)
+		for x := 0; x < pattern.Width; x++ {
+			cell := pattern.Cell(x, y)
+			c := htmlCell{
+				X:           x,
+				Y:           y,
+				Empty:       cell.Empty(),
+				BoardRight:  (x+1)%pattern.BoardDimension == 0 || x == pattern.Width-1,
+				BoardBottom: (y+1)%pattern.BoardDimension == 0 || y == pattern.Height-1,
+				Shifted:     pattern.rowShift(y) > 0,
+			}
+			if !c.Empty {
+				c.Bead = cell.Bead
+				c.Color = fmt.Sprintf("#%02X%02X%02X", cell.Color.R, cell.Color.G, cell.Color.B)
+				c.TextColor = "#000000"
+				if luminance([]uint8{cell.Color.R, cell.Color.G, cell.Color.B}) < 128 {
+					c.TextColor = "#FFFFFF"
+				}
+				c.Symbol = pattern.Symbols[cell.Bead]
+			}
+			data.Rows[y][x] = c
+		}
+	}
+
+	for bead, count := range data.Stats.BeadCounts {
+		c := pattern.Palette[bead]
+		data.Legend = append(data.Legend, htmlLegendEntry{
+			Bead:   bead,
+			Color:  fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B),
+			Symbol: pattern.Symbols[bead],
+			Count:  count,
+		})
+	}
+	sort.Slice(data.Legend, func(i, j int) bool {
+		if data.Legend[i].Count != data.Legend[j].Count {
+			return data.Legend[i].Count > data.Legend[j].Count
+		}
+		return data.Legend[i].Bead < data.Legend[j].Bead
+	})
+	return data, nil
+}
+
+// renderHTMLTemplate renders the pattern with the custom HTML template
+func (m *beadMachine) renderHTMLTemplate(pattern *Pattern, w io.Writer) error {
+	data, err := m.htmlTemplateData(pattern)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(m.htmlTemplate.Execute(w, data), "executing HTML template")
+}
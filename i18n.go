@@ -0,0 +1,176 @@
+package beadmachine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is the language of the outputs if none is given, its messages are the keys of the translations
+const defaultLanguage = "en"
+
+// locale contains the translated messages and the number format of an output language
+type locale struct {
+	decimalSeparator   string
+	thousandsSeparator string
+	messages           map[string]string // translations of the English messages, missing ones stay English
+}
+
+// locales contains the supported output languages
+var locales = map[string]locale{
+	"en": {decimalSeparator: ".", thousandsSeparator: ","},
+	"de": {
+		decimalSeparator:   ",",
+		thousandsSeparator: ".",
+		messages: map[string]string{
+			"empty":                                "leer",
+			"Board %s (columns %d-%d, rows %d-%d)": "Platte %s (Spalten %d-%d, Reihen %d-%d)",
+			"Row %d: empty":                        "Reihe %d: leer",
+			" (right to left)":                     " (von rechts nach links)",
+			" (shifted by half a bead)":            " (um eine halbe Perle versetzt)",
+			"Row %d%s: %s":                         "Reihe %d%s: %s",
+			"Panel %d of %d (column %d, row %d) - pattern columns %d-%d, rows %d-%d": "Teil %d von %d (Spalte %d, Reihe %d) - Musterspalten %d-%d, Reihen %d-%d",
+			"Symbols":                     "Symbole",
+			"Pattern size: %s":            "Mustergröße: %s",
+			"print at 100% scale":         "ohne Skalierung mit 100 % drucken",
+			"Bead placement":              "Perlen stecken",
+			"Board":                       "Platte",
+			"row":                         "Reihe",
+			"more in this row, step":      "weitere in dieser Reihe, Schritt",
+			"of":                          "von",
+			"space or arrow keys to move": "Leertaste oder Pfeiltasten zum Weitergehen",
+			"Bead patterns":               "Perlenmuster",
+			"%sx%s beads on %sx%s boards, %s beads in %s colors, mean error %s": "%sx%s Perlen auf %sx%s Platten, %s Perlen in %s Farben, mittlere Abweichung %s",
+			"Shopping list":                         "Einkaufsliste",
+			"%s beads in %s colors for %s patterns": "%s Perlen in %s Farben für %s Muster",
+			"Color by number":                       "Stecken nach Zahlen",
+			"Dark mode":                             "Dunkelmodus",
+			"column":                                "Spalte",
+			"wheel to zoom, drag to move, 0 to fit": "Mausrad zum Zoomen, ziehen zum Verschieben, 0 zum Einpassen",
+		},
+	},
+	"es": {
+		decimalSeparator:   ",",
+		thousandsSeparator: ".",
+		messages: map[string]string{
+			"empty":                                "vacío",
+			"Board %s (columns %d-%d, rows %d-%d)": "Placa %s (columnas %d-%d, filas %d-%d)",
+			"Row %d: empty":                        "Fila %d: vacía",
+			" (right to left)":                     " (de derecha a izquierda)",
+			" (shifted by half a bead)":            " (desplazada media cuenta)",
+			"Row %d%s: %s":                         "Fila %d%s: %s",
+			"Panel %d of %d (column %d, row %d) - pattern columns %d-%d, rows %d-%d": "Panel %d de %d (columna %d, fila %d) - columnas del patrón %d-%d, filas %d-%d",
+			"Symbols":                     "Símbolos",
+			"Pattern size: %s":            "Tamaño del patrón: %s",
+			"print at 100% scale":         "imprimir al 100 % sin escalar",
+			"Bead placement":              "Colocación de cuentas",
+			"Board":                       "Placa",
+			"row":                         "fila",
+			"more in this row, step":      "más en esta fila, paso",
+			"of":                          "de",
+			"space or arrow keys to move": "espacio o flechas para avanzar",
+			"Bead patterns":               "Patrones de cuentas",
+			"%sx%s beads on %sx%s boards, %s beads in %s colors, mean error %s": "%sx%s cuentas en %sx%s placas, %s cuentas en %s colores, error medio %s",
+			"Shopping list":                         "Lista de compras",
+			"%s beads in %s colors for %s patterns": "%s cuentas en %s colores para %s patrones",
+			"Color by number":                       "Colocar por números",
+			"Dark mode":                             "Modo oscuro",
+			"column":                                "columna",
+			"wheel to zoom, drag to move, 0 to fit": "rueda para ampliar, arrastrar para mover, 0 para ajustar",
+		},
+	},
+	"fr": {
+		decimalSeparator:   ",",
+		thousandsSeparator: "\u00a0", // no-break space
+		messages: map[string]string{
+			"empty":                                "vide",
+			"Board %s (columns %d-%d, rows %d-%d)": "Plaque %s (colonnes %d-%d, rangées %d-%d)",
+			"Row %d: empty":                        "Rangée %d : vide",
+			" (right to left)":                     " (de droite à gauche)",
+			" (shifted by half a bead)":            " (décalée d'une demi-perle)",
+			"Row %d%s: %s":                         "Rangée %d%s : %s",
+			"Panel %d of %d (column %d, row %d) - pattern columns %d-%d, rows %d-%d": "Panneau %d sur %d (colonne %d, rangée %d) - colonnes du modèle %d-%d, rangées %d-%d",
+			"Symbols":                     "Symboles",
+			"Pattern size: %s":            "Taille du modèle : %s",
+			"print at 100% scale":         "imprimer à 100 % sans mise à l'échelle",
+			"Bead placement":              "Placement des perles",
+			"Board":                       "Plaque",
+			"row":                         "rangée",
+			"more in this row, step":      "de plus dans cette rangée, étape",
+			"of":                          "sur",
+			"space or arrow keys to move": "espace ou flèches pour avancer",
+			"Bead patterns":               "Modèles de perles",
+			"%sx%s beads on %sx%s boards, %s beads in %s colors, mean error %s": "%sx%s perles sur %sx%s plaques, %s perles en %s couleurs, écart moyen %s",
+			"Shopping list":                         "Liste d'achats",
+			"%s beads in %s colors for %s patterns": "%s perles en %s couleurs pour %s modèles",
+			"Color by number":                       "Placement par numéros",
+			"Dark mode":                             "Mode sombre",
+			"column":                                "colonne",
+			"wheel to zoom, drag to move, 0 to fit": "molette pour zoomer, glisser pour déplacer, 0 pour ajuster",
+		},
+	},
+}
+
+// languageNames returns the sorted codes of all supported output languages
+func languageNames() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// locale returns the locale of the output language
+func (m *beadMachine) locale() locale {
+	if l, ok := locales[m.language]; ok {
+		return l
+	}
+	return locales[defaultLanguage]
+}
+
+// tr returns the translation of the English message in the output language, formatted with the arguments
+func (m *beadMachine) tr(message string, args ...interface{}) string {
+	if translation, ok := m.locale().messages[message]; ok {
+		message = translation
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// formatInt formats the number with the thousands separator of the output language
+func (m *beadMachine) formatInt(n int) string {
+	digits := strconv.Itoa(n)
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+
+	var groups []string
+	for len(digits) > 3 {
+		groups = append([]string{digits[len(digits)-3:]}, groups...)
+		digits = digits[:len(digits)-3]
+	}
+	formatted := strings.Join(append([]string{digits}, groups...), m.locale().thousandsSeparator)
+	if negative {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
+
+// formatFloat formats the number with the given decimals and the separators of the output language
+func (m *beadMachine) formatFloat(f float64, decimals int) string {
+	rounded := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	parts := strings.SplitN(rounded, ".", 2)
+	whole, _ := strconv.Atoi(parts[0])
+	formatted := m.formatInt(whole)
+	if len(parts) == 2 {
+		formatted += m.locale().decimalSeparator + parts[1]
+	}
+	if value, _ := strconv.ParseFloat(rounded, 64); f < 0 && value != 0 {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
@@ -1,25 +1,40 @@
-package main
+package beadmachine
 
 import (
 	"image"
 	"image/color"
-	"os"
-	"runtime"
-	"sync"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
 
 	"github.com/disintegration/imaging"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
-// readImageFile reads and decodes the given image file
-func readImageFile(FileName string) (image.Image, error) {
-	imageReader, err := os.Open(FileName)
+// chartGridMinCell is the smallest chart cell size in pixel that gets grid lines
+const chartGridMinCell = 8
+
+var chartGridColor = color.RGBA{160, 160, 160, 255}
+
+// readImageFile reads and decodes the given image file, SVG files are rasterized at their own size and
+// of PDF files the first page is rasterized at the default resolution. With autoOrient JPEG files are rotated
+// upright by their EXIF orientation, like photos of phones that store the sensor orientation.
+func readImageFile(FileName string, autoOrient bool) (image.Image, error) {
+	if isSVGFile(FileName) {
+		return rasterizeSVG(FileName, 0, 0, true)
+	}
+	if isPDFFile(FileName) {
+		return rasterizePDF(FileName, 1, defaultPDFDPI)
+	}
+
+	data, err := ioutil.ReadFile(FileName)
 	if err != nil {
 		return nil, errors.Wrap(err, "opening image file")
 	}
-	defer imageReader.Close()
 
-	inputImage, _, err := image.Decode(imageReader)
+	inputImage, err := decodeImage(data, autoOrient)
 	if err != nil {
 		return nil, errors.Wrap(err, "decoding image file")
 	}
@@ -27,76 +42,133 @@ func readImageFile(FileName string) (image.Image, error) {
 	return inputImage, nil
 }
 
-// processImage matches all pixel of the image to a matching bead
-func (m *beadMachine) processImage(imageBounds image.Rectangle, inputImage image.Image, outputImage *image.RGBA) error {
+// matchPattern matches all pixel of the image to a matching bead. A cancelled matching returns the partially
+// matched pattern with the error.
+func (m *beadMachine) matchPattern(inputImage image.Image) (*Pattern, error) {
+	if m.adaptiveDither { // the error diffusion needs the pixels to be matched in order
+		return m.ditherPattern(inputImage)
+	}
+
 	beadConfig, beadLab, err := m.loadPalette()
 	if err != nil {
-		return err
+		return nil, paletteError(err)
 	}
-
-	pixelCount := imageBounds.Dx() * imageBounds.Dy()
-	beadUsageChan := make(chan string, pixelCount)
-	workQueueChan := make(chan image.Point, runtime.NumCPU()*2)
-	workDone := make(chan struct{})
-
-	var outputImageBeadNames []string // TODO use pointer to bead config instead of string
-	if m.htmlFileName != "" {
-		outputImageBeadNames = make([]string, pixelCount)
+	if pattern, ok := m.matchIndexed(inputImage, beadConfig, beadLab); ok {
+		return pattern, nil
 	}
 
-	var pixelWaitGroup sync.WaitGroup
-	pixelWaitGroup.Add(pixelCount)
-
-	go func() { // pixel channel worker goroutine
-		for {
-			select {
-			case pixel := <-workQueueChan:
-				go func(pixel image.Point) { // pixel processing goroutine
-					defer pixelWaitGroup.Done()
-					oldPixel := inputImage.At(pixel.X, pixel.Y)
-					beadName := m.findSimilarColor(beadLab, oldPixel)
-					beadUsageChan <- beadName
-
-					if m.htmlFileName != "" {
-						outputImageBeadNames[pixel.X+pixel.Y*imageBounds.Max.X] = beadName
-					}
+	imageBounds := inputImage.Bounds()
+	pattern := newPattern(imageBounds.Dx(), imageBounds.Dy(), m.boardDimension)
+	pattern.Palette = beadConfig
+	pattern.Source = inputImage
 
-					matchRgb := beadConfig[beadName]
-					m.setOutputImagePixel(outputImage, pixel, matchRgb)
-				}(pixel)
-			case <-workDone:
-				return
+	lut, err := m.matchUniqueColors(inputImage, beadLab)
+	for y := imageBounds.Min.Y; y < imageBounds.Max.Y; y++ {
+		for x := imageBounds.Min.X; x < imageBounds.Max.X; x++ {
+			match := lut[colorKey(inputImage.At(x, y))]
+			if match.empty || !match.matched { // a cancelled matching leaves colors unmatched
+				continue
 			}
+
+			bead := beadConfig[match.bead]
+			cell := pattern.Cell(x-imageBounds.Min.X, y-imageBounds.Min.Y)
+			cell.Bead = match.bead
+			cell.Color = color.RGBA{bead.R, bead.G, bead.B, 255} // A 255 = no transparency
+			cell.Distance = match.distance
 		}
-	}()
+	}
+	return pattern, err
+}
 
-	go m.calculateBeadUsage(beadUsageChan)
+// unmatchedPattern returns a pattern that uses the original colors of the image
+func (m *beadMachine) unmatchedPattern(inputImage image.Image) *Pattern {
+	imageBounds := inputImage.Bounds()
+	pattern := newPattern(imageBounds.Dx(), imageBounds.Dy(), m.boardDimension)
+	pattern.Source = inputImage
 
 	for y := imageBounds.Min.Y; y < imageBounds.Max.Y; y++ {
 		for x := imageBounds.Min.X; x < imageBounds.Max.X; x++ {
-			workQueueChan <- image.Point{x, y}
+			r, g, b, a := inputImage.At(x, y).RGBA()
+			if a == 0 { // transparent pixels are empty cells
+				continue
+			}
+			cell := pattern.Cell(x-imageBounds.Min.X, y-imageBounds.Min.Y)
+			cell.Color = color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255} // A 255 = no transparency
 		}
 	}
+	return pattern
+}
+
+// resizeImage resizes the image to the given dimensions, if both dimensions are given the
+// configured fit strategy is used to handle a different aspect ratio
+func (m *beadMachine) resizeImage(inputImage image.Image, width, height int) image.Image {
+	if width == 0 || height == 0 {
+		return imaging.Resize(inputImage, width, height, m.resampleFilter())
+	}
+
+	switch m.fit {
+	case fitContain:
+		imageBounds := inputImage.Bounds()
+		scale := math.Min(float64(width)/float64(imageBounds.Dx()), float64(height)/float64(imageBounds.Dy()))
+		fittedWidth := int(math.Max(1, math.Round(float64(imageBounds.Dx())*scale)))
+		fittedHeight := int(math.Max(1, math.Round(float64(imageBounds.Dy())*scale)))
+		fitted := imaging.Resize(inputImage, fittedWidth, fittedHeight, m.resampleFilter())
+		return imaging.PasteCenter(imaging.New(width, height, color.NRGBA{}), fitted)
+	case fitCover:
+		return imaging.Fill(inputImage, width, height, imaging.Center, m.resampleFilter())
+	default:
+		return imaging.Resize(inputImage, width, height, m.resampleFilter())
+	}
+}
+
+// padImageToBoards pads the image with empty cells to a multiple of the board dimension including the
+// borders, the image is aligned by the configured pad alignment. A seam optimized image keeps its shift and is padded on the
+// right and bottom.
+func (m *beadMachine) padImageToBoards(inputImage image.Image) image.Image {
+	imageBounds := inputImage.Bounds()
+	border := 2 * m.borderWidth() // the borders are added after matching and have to fit on the boards
+	width := boardsNeeded(imageBounds.Dx()+border, m.boardDimension)*m.boardDimension - border
+	height := boardsNeeded(imageBounds.Dy()+border, m.boardDimension)*m.boardDimension - border
+	if width == imageBounds.Dx() && height == imageBounds.Dy() {
+		return inputImage
+	}
 
-	pixelWaitGroup.Wait() // wait for all pixel to be processed
-	workDone <- struct{}{}
-	close(workQueueChan)
-	close(beadUsageChan)
-	<-m.beadStatsDone
+	m.logger.Info("Image padded to full boards",
+		zap.Int("columns", width-imageBounds.Dx()),
+		zap.Int("rows", height-imageBounds.Dy()))
+	padded := imaging.New(width, height, color.NRGBA{})
+	if m.padAlign == padAlignTopLeft || m.optimizeSeams {
+		return imaging.Paste(padded, inputImage, image.Pt(0, 0))
+	}
+	return imaging.PasteCenter(padded, inputImage)
+}
 
-	if m.htmlFileName != "" {
-		return m.writeHTMLBeadInstructionFile(imageBounds, outputImage, outputImageBeadNames)
+// resampleFilter returns the imaging filter of the configured resampling filter
+func (m *beadMachine) resampleFilter() imaging.ResampleFilter {
+	switch m.resample {
+	case resampleLinear:
+		return imaging.Linear
+	case resampleBox:
+		return imaging.Box
+	case resampleNearest:
+		return imaging.NearestNeighbor
+	default:
+		return imaging.Lanczos
 	}
-	return nil
 }
 
 // applyfilters will apply all filters that were enabled to the input image
 func (m *beadMachine) applyFilters(inputImage image.Image) image.Image {
+	span := m.startSpan("filter")
+	defer span.finish(nil)
 	filteredImage := inputImage
 
 	if m.greyScale {
 		filteredImage = imaging.Grayscale(filteredImage)
 	}
+	filteredImage = m.applyLevels(filteredImage)
+	filteredImage = m.applyColorBalance(filteredImage)
+	filteredImage = m.applyAdjustments(filteredImage)
 	if m.blur != 0.0 {
 		filteredImage = imaging.Blur(filteredImage, m.blur)
 	}
@@ -112,30 +184,91 @@ func (m *beadMachine) applyFilters(inputImage image.Image) image.Image {
 	if m.brightness != 0.0 {
 		filteredImage = imaging.AdjustBrightness(filteredImage, m.brightness)
 	}
+	filteredImage = m.applySubjectFocus(filteredImage)
+	filteredImage = m.applyStylize(filteredImage)
 
 	return filteredImage
 }
 
-// setOutputImagePixel sets a pixel in the output image or draws a bead in beadStyle mode
-func (m *beadMachine) setOutputImagePixel(outputImage *image.RGBA, coordinates image.Point, bead BeadConfig) {
-	rgbaMatch := color.RGBA{
-		R: bead.R,
-		G: bead.G,
-		B: bead.B,
-		A: 255, // A 255 = no transparency
+// renderPatternImage renders the pattern as PNG image
+func (m *beadMachine) renderPatternImage(pattern *Pattern, w io.Writer) error {
+	return errors.Wrap(png.Encode(w, m.patternImage(pattern)), "encoding png file")
+}
+
+// patternImage renders the pattern as image, in beadStyle mode every bead is drawn as 8x8 pixel unless a chart
+// cell size is set. The cells of an offset grid are at least 2 pixel large, so that the shifted rows can be moved
+// by half a cell.
+func (m *beadMachine) patternImage(pattern *Pattern) *image.RGBA {
+	cellSize := m.cellPixels()
+	width := pattern.Width * cellSize
+	if pattern.Offset() {
+		cellSize = maxInt(cellSize, 2)
+		width = pattern.Width*cellSize + cellSize/2
 	}
-	if !m.beadStyle {
+	imageBounds := image.Rect(0, 0, width, pattern.Height*cellSize)
+	outputImage := image.NewRGBA(imageBounds)
+
+	for y := 0; y < pattern.Height; y++ {
+		shift := int(pattern.rowShift(y) * float64(cellSize))
+		for x := 0; x < pattern.Width; x++ {
+			cell := pattern.Cell(x, y)
+			if cell.Empty() {
+				continue
+			}
+			if pattern.Offset() {
+				m.drawOutputImageCell(outputImage, image.Point{x*cellSize + shift, y * cellSize}, cellSize, cell.Color)
+				continue
+			}
+			m.setOutputImagePixel(outputImage, image.Point{x, y}, cell.Color)
+		}
+	}
+
+	if m.coordinates {
+		return m.addImageCoordinates(outputImage, pattern, cellSize)
+	}
+	return outputImage
+}
+
+// cellPixels returns the width and height in pixel of a cell of the image output
+func (m *beadMachine) cellPixels() int {
+	switch {
+	case m.chartCellSize > 0:
+		return m.chartCellSize
+	case m.beadStyle:
+		return 8
+	default:
+		return 1
+	}
+}
+
+// setOutputImagePixel sets a pixel in the output image or draws a bead in beadStyle mode. Larger chart cells
+// without bead style get a grid line at their right and bottom edge.
+func (m *beadMachine) setOutputImagePixel(outputImage *image.RGBA, coordinates image.Point, rgbaMatch color.RGBA) {
+	size := m.cellPixels()
+	if size == 1 {
 		outputImage.SetRGBA(coordinates.X, coordinates.Y, rgbaMatch)
 		return
 	}
+	m.drawOutputImageCell(outputImage, image.Point{coordinates.X * size, coordinates.Y * size}, size, rgbaMatch)
+}
 
-	for y := 0; y < 8; y++ {
-		for x := 0; x < 8; x++ {
-			if (x%7 == 0 && y%7 == 0) || (x > 2 && x < 5 && y > 2 && y < 5) { // all corner pixel + 2x2 in center
-				outputImage.SetRGBA((coordinates.X*8)+x, (coordinates.Y*8)+y, m.beadFillPixel)
-			} else {
-				outputImage.SetRGBA((coordinates.X*8)+x, (coordinates.Y*8)+y, rgbaMatch)
+// drawOutputImageCell draws a cell of the given size in pixel with its top left corner at the origin
+func (m *beadMachine) drawOutputImageCell(outputImage *image.RGBA, origin image.Point, size int, rgbaMatch color.RGBA) {
+	center := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := rgbaMatch
+			if m.beadStyle {
+				// the corners and the hole in the center of the bead, for 8x8 pixel these are the corner pixel
+				// and the 2x2 pixel in the center
+				distance := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+				if distance > 0.6*float64(size) || distance < float64(size)/8 {
+					c = m.beadFillPixel
+				}
+			} else if size >= chartGridMinCell && (x == size-1 || y == size-1) {
+				c = chartGridColor
 			}
+			outputImage.SetRGBA(origin.X+x, origin.Y+y, c)
 		}
 	}
 }
@@ -0,0 +1,148 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"runtime"
+	"sync"
+
+	"github.com/jkl1337/go-chromath"
+	"go.uber.org/zap"
+)
+
+// indexedMatch is the bead match of a color of an indexed image or of a unique color of an image
+type indexedMatch struct {
+	matched  bool
+	empty    bool
+	bead     string
+	distance float64
+}
+
+// indexedImage returns the amount of colors of an image whose pixels index a small set of colors, like
+// paletted PNG files and grayscale images, the color of an index and the color index of a pixel. It returns
+// false for all other images.
+func indexedImage(img image.Image) (int, func(i int) color.Color, func(x, y int) int, bool) {
+	switch p := img.(type) {
+	case *image.Paletted:
+		return len(p.Palette),
+			func(i int) color.Color { return p.Palette[i] },
+			func(x, y int) int { return int(p.Pix[p.PixOffset(x, y)]) }, true
+
+	case *image.Gray:
+		return 256,
+			func(i int) color.Color { return color.Gray{Y: uint8(i)} },
+			func(x, y int) int { return int(p.Pix[p.PixOffset(x, y)]) }, true
+
+	case *image.NRGBA: // grayscale PNG files with alpha channel are decoded as NRGBA
+		for i := 0; i+3 < len(p.Pix); i += 4 {
+			if p.Pix[i] != p.Pix[i+1] || p.Pix[i] != p.Pix[i+2] {
+				return 0, nil, nil, false
+			}
+		}
+		return 256 * 256,
+			func(i int) color.Color { return color.NRGBA{uint8(i), uint8(i), uint8(i), uint8(i >> 8)} },
+			func(x, y int) int {
+				offset := p.PixOffset(x, y)
+				return int(p.Pix[offset]) | int(p.Pix[offset+3])<<8
+			}, true
+	}
+	return 0, nil, nil, false
+}
+
+// matchIndexed matches every color of an indexed image only once instead of every pixel, which makes the
+// conversion of pixel art instant and needs no lookup table for large indexed images. It returns false if the
+// image is not indexed.
+func (m *beadMachine) matchIndexed(inputImage image.Image, beadConfig map[string]BeadConfig,
+	beadLab map[chromath.Lab]string) (*Pattern, bool) {
+	colorCount, colorOf, indexAt, ok := indexedImage(inputImage)
+	if !ok {
+		return nil, false
+	}
+
+	imageBounds := inputImage.Bounds()
+	pattern := newPattern(imageBounds.Dx(), imageBounds.Dy(), m.boardDimension)
+	pattern.Palette = beadConfig
+	pattern.Source = inputImage
+
+	matches := make([]indexedMatch, colorCount)
+	matched := 0
+	for y := imageBounds.Min.Y; y < imageBounds.Max.Y; y++ {
+		for x := imageBounds.Min.X; x < imageBounds.Max.X; x++ {
+			i := indexAt(x, y)
+			match := &matches[i]
+			if !match.matched {
+				pixel := colorOf(i)
+				if _, _, _, a := pixel.RGBA(); a == 0 { // transparent pixels are empty cells
+					match.empty = true
+				} else {
+					match.bead, match.distance = m.findSimilarColor(beadLab, pixel)
+				}
+				match.matched = true
+				matched++
+			}
+			if match.empty {
+				continue
+			}
+
+			bead := beadConfig[match.bead]
+			cell := pattern.Cell(x-imageBounds.Min.X, y-imageBounds.Min.Y)
+			cell.Bead = match.bead
+			cell.Color = color.RGBA{bead.R, bead.G, bead.B, 255} // A 255 = no transparency
+			cell.Distance = match.distance
+		}
+	}
+
+	m.logger.Debug("Indexed colors matched", zap.Int("colors", matched))
+	return pattern, true
+}
+
+// matchUniqueColors collects the unique colors of the image and matches every one of them exactly once into a
+// lookup table of their color keys. The colors are matched concurrently on all CPU cores, which avoids the
+// locking of the color cache for every pixel of pixel art and posterized photos. If the conversion is cancelled
+// the colors that are not matched yet are left unmatched.
+func (m *beadMachine) matchUniqueColors(img image.Image, beadLab map[chromath.Lab]string) (map[uint64]indexedMatch, error) {
+	bounds := img.Bounds()
+	lut := make(map[uint64]indexedMatch)
+	var keys []uint64
+	var colors []color.Color
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := img.At(x, y)
+			key := colorKey(pixel)
+			if _, ok := lut[key]; ok {
+				continue
+			}
+			lut[key] = indexedMatch{}
+			keys = append(keys, key)
+			colors = append(colors, pixel)
+		}
+	}
+
+	matches := make([]indexedMatch, len(colors))
+	workers := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for worker := 0; worker < workers; worker++ {
+		go func(worker int) {
+			defer wg.Done()
+			for i := worker; i < len(colors); i += workers {
+				if i/workers%cancelCheckInterval == 0 && m.ctx.Err() != nil {
+					return
+				}
+				matches[i].matched = true
+				if _, _, _, a := colors[i].RGBA(); a == 0 { // transparent pixels are empty cells
+					matches[i].empty = true
+					continue
+				}
+				matches[i].bead, matches[i].distance = m.findSimilarColor(beadLab, colors[i])
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	for i, key := range keys {
+		lut[key] = matches[i]
+	}
+	m.logger.Debug("Unique colors matched", zap.Int("colors", len(colors)))
+	return lut, m.cancelled()
+}
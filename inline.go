@@ -0,0 +1,234 @@
+package beadmachine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// terminal graphics protocols of the inline preview
+const (
+	inlineAuto  = "auto" // detect the protocol of the terminal
+	inlineITerm = "iterm"
+	inlineKitty = "kitty"
+	inlineSixel = "sixel"
+)
+
+// inlinePreviewSize is the maximum width and height in pixel of the inline preview, small patterns are
+// enlarged to it by whole pixels per bead
+const inlinePreviewSize = 640
+
+// kittyChunkSize is the maximum amount of base64 bytes per escape sequence of the kitty graphics protocol
+const kittyChunkSize = 4096
+
+// inlineNames returns the names of the inline preview modes
+func inlineNames() []string {
+	return []string{inlineAuto, inlineITerm, inlineKitty, inlineSixel}
+}
+
+// inlineProtocol returns the graphics protocol of the inline preview mode, auto detects it from the environment
+// variables of the terminal and returns an empty string for terminals without a known graphics protocol
+func inlineProtocol(mode string) string {
+	if mode != inlineAuto {
+		return mode
+	}
+	term, program := os.Getenv("TERM"), os.Getenv("TERM_PROGRAM")
+	switch {
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2": // also set over ssh
+		return inlineITerm
+	case os.Getenv("KITTY_WINDOW_ID") != "" || term == "xterm-kitty" || program == "ghostty":
+		return inlineKitty
+	case strings.Contains(term, "sixel") || strings.HasPrefix(term, "foot") || strings.HasPrefix(term, "mlterm") ||
+		strings.HasPrefix(term, "contour"):
+		return inlineSixel
+	default:
+		return ""
+	}
+}
+
+// writeInlinePreview shows the rendered PNG pattern image in the terminal with its graphics protocol, terminals
+// without a known protocol get the block character preview instead
+func (m *beadMachine) writeInlinePreview(pattern *Pattern, w io.Writer) error {
+	return m.writeInlineImage(w, m.previewInline, inlinePreviewImage(m.patternImage(pattern)), pattern)
+}
+
+// writeInlineImage shows the image in the terminal with the graphics protocol of the inline preview mode, terminals
+// without a known protocol get the block character preview of the pattern instead
+func (m *beadMachine) writeInlineImage(w io.Writer, mode string, img image.Image, pattern *Pattern) error {
+	switch inlineProtocol(mode) {
+	case inlineITerm:
+		return writeITermImage(w, img)
+	case inlineKitty:
+		return writeKittyImage(w, img)
+	case inlineSixel:
+		return writeSixelImage(w, img)
+	default:
+		m.logger.Warn("The terminal supports no inline images, showing a block preview",
+			zap.String("term", os.Getenv("TERM")))
+		return writeTerminalPreview(w, pattern, terminalColumns(), terminalTrueColor())
+	}
+}
+
+// inlinePreviewImage enlarges small pattern images by whole pixels per bead and shrinks large ones to the size
+// of the inline preview
+func inlinePreviewImage(img image.Image) image.Image {
+	bounds := img.Bounds()
+	longest := maxInt(bounds.Dx(), bounds.Dy())
+	switch {
+	case longest == 0:
+		return img
+	case longest > inlinePreviewSize:
+		return imaging.Fit(img, inlinePreviewSize, inlinePreviewSize, imaging.Box)
+	case longest*2 <= inlinePreviewSize:
+		scale := inlinePreviewSize / longest
+		return imaging.Resize(img, bounds.Dx()*scale, bounds.Dy()*scale, imaging.NearestNeighbor)
+	default:
+		return img
+	}
+}
+
+// writeITermImage writes the image as PNG with the inline image protocol of iTerm2, which WezTerm supports as well
+func writeITermImage(writer io.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return errors.Wrap(err, "encoding inline preview")
+	}
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=%dpx;height=%dpx;preserveAspectRatio=1:%s\a\n",
+		buf.Len(), img.Bounds().Dx(), img.Bounds().Dy(), base64.StdEncoding.EncodeToString(buf.Bytes()))
+	return errors.Wrap(w.Flush(), "writing inline preview")
+}
+
+// writeKittyImage writes the image as PNG with the kitty graphics protocol, the base64 data is split into
+// chunks of which all but the last are marked with m=1
+func writeKittyImage(writer io.Writer, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return errors.Wrap(err, "encoding inline preview")
+	}
+	data := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	w := bufio.NewWriter(writer)
+	for first := true; first || data != ""; first = false {
+		chunk := data
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		data = data[len(chunk):]
+		more := 0
+		if data != "" {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(w, "\x1b_Gf=100,a=T,m=%d;%s\x1b\\", more, chunk)
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	w.WriteString("\n")
+	return errors.Wrap(w.Flush(), "writing inline preview")
+}
+
+// writeSixelImage writes the image as Sixel graphics. Every band of six pixel rows is written once per color
+// that it contains, transparent pixels keep the background of the terminal. Images with more than 256 colors
+// are dithered to a fixed palette.
+func writeSixelImage(writer io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	nrgba := imaging.Clone(img)
+	indices := make([]int, width*height) // palette index of every pixel, -1 for transparent pixels
+	var colors []color.NRGBA
+	colorIndex := make(map[color.NRGBA]int)
+	for i := range indices {
+		c := color.NRGBA{nrgba.Pix[4*i], nrgba.Pix[4*i+1], nrgba.Pix[4*i+2], 255}
+		if nrgba.Pix[4*i+3] < 128 {
+			indices[i] = -1
+			continue
+		}
+		index, ok := colorIndex[c]
+		if !ok {
+			index = len(colors)
+			colorIndex[c] = index
+			colors = append(colors, c)
+		}
+		indices[i] = index
+	}
+	if len(colors) > 256 {
+		paletted := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), nrgba, image.Point{})
+		colors = colors[:0]
+		for _, c := range palette.Plan9 {
+			colors = append(colors, color.NRGBAModel.Convert(c).(color.NRGBA))
+		}
+		for i := range indices {
+			if indices[i] >= 0 {
+				indices[i] = int(paletted.Pix[i])
+			}
+		}
+	}
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, "\x1bP0;1;0q\"1;1;%d;%d", width, height) // 1 = transparent background
+	for i, c := range colors {
+		fmt.Fprintf(w, "#%d;2;%d;%d;%d", i, (int(c.R)*100+127)/255, (int(c.G)*100+127)/255, (int(c.B)*100+127)/255)
+	}
+	sixels := make([][]byte, len(colors))
+	for y0 := 0; y0 < height; y0 += 6 {
+		var used []int
+		for y := y0; y < y0+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				index := indices[x+y*width]
+				if index < 0 {
+					continue
+				}
+				if sixels[index] == nil {
+					sixels[index] = bytes.Repeat([]byte{0}, width)
+					used = append(used, index)
+				}
+				sixels[index][x] |= 1 << uint(y-y0)
+			}
+		}
+		for _, index := range used {
+			fmt.Fprintf(w, "#%d", index)
+			writeSixelRun(w, sixels[index])
+			w.WriteByte('$') // the next color overprints the same band
+			sixels[index] = nil
+		}
+		w.WriteByte('-')
+	}
+	w.WriteString("\x1b\\\n")
+	return errors.Wrap(w.Flush(), "writing inline preview")
+}
+
+// writeSixelRun writes the sixels of a band of a color, repeated sixels are run length encoded
+func writeSixelRun(w *bufio.Writer, bits []byte) {
+	for x := 0; x < len(bits); {
+		run := 1
+		for x+run < len(bits) && bits[x+run] == bits[x] {
+			run++
+		}
+		char := 63 + bits[x]
+		if run > 3 {
+			fmt.Fprintf(w, "!%d%c", run, char)
+		} else {
+			for i := 0; i < run; i++ {
+				w.WriteByte(char)
+			}
+		}
+		x += run
+	}
+}
@@ -0,0 +1,39 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"os"
+)
+
+// checkInputFileSize returns an error if the image file exceeds the input limits. Only the header of the image is
+// read, so that a huge image is rejected before its pixels are decoded into memory.
+func (m *beadMachine) checkInputFileSize(fileName string) error {
+	if m.maxInputDimension == 0 && m.maxInputMegapixels == 0 {
+		return nil
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil // reading the image reports the error
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil // decoding the image reports the error
+	}
+	return m.checkInputSize(config.Width, config.Height)
+}
+
+// checkInputSize returns an error if the image size exceeds the maximum dimension or megapixels
+func (m *beadMachine) checkInputSize(width, height int) error {
+	if m.maxInputDimension > 0 && (width > m.maxInputDimension || height > m.maxInputDimension) {
+		return fmt.Errorf("the input image of %dx%d pixels exceeds the maximum dimension of %d pixels",
+			width, height, m.maxInputDimension)
+	}
+	megapixels := float64(width) * float64(height) / 1e6
+	if m.maxInputMegapixels > 0 && megapixels > m.maxInputMegapixels {
+		return fmt.Errorf("the input image of %dx%d pixels has %.1f megapixels, more than the maximum of %g",
+			width, height, megapixels, m.maxInputMegapixels)
+	}
+	return nil
+}
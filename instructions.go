@@ -0,0 +1,214 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// instruction layout of the PDF output in points
+const (
+	instructionsMargin       = 50.0
+	instructionsFontSize     = 10.0
+	instructionsHeadingSize  = 12.0
+	instructionsLineHeight   = 14.0
+	instructionsRowIndention = 15.0
+)
+
+// placementRun is a run of consecutive cells that use the same bead
+type placementRun struct {
+	bead  string
+	count int
+}
+
+// String returns the run in the format 3×H1 White
+func (r placementRun) String() string {
+	bead := r.bead
+	if bead == "" {
+		bead = "empty"
+	}
+	return fmt.Sprintf("%d×%s", r.count, bead)
+}
+
+// boardInstructions contains the row by row placement instructions of a single board
+type boardInstructions struct {
+	title string
+	rows  []string
+}
+
+// instructionsFormat returns the output format of the instructions based on the file extension
+func instructionsFormat(fileName string) string {
+	if strings.EqualFold(filepath.Ext(fileName), ".pdf") {
+		return "instructionspdf"
+	}
+	return "instructions"
+}
+
+// boardName returns the name of a board based on its column letter and row number, like A1
+func boardName(column, row int) string {
+	var letters string
+	for column++; column > 0; column = (column - 1) / 26 {
+		letters = string(rune('A'+(column-1)%26)) + letters
+	}
+	return fmt.Sprintf("%s%d", letters, row+1)
+}
+
+// rowRuns returns the runs of identical beads of the row cells from x0 to x1 (exclusive)
+func rowRuns(pattern *Pattern, y, x0, x1 int, reverse bool) []placementRun {
+	var runs []placementRun
+	for i := x0; i < x1; i++ {
+		x := i
+		if reverse {
+			x = x1 - 1 - (i - x0)
+		}
+		cell := pattern.Cell(x, y)
+		bead := cell.Bead
+		if cell.Empty() {
+			bead = ""
+		}
+		if len(runs) > 0 && runs[len(runs)-1].bead == bead {
+			runs[len(runs)-1].count++
+			continue
+		}
+		runs = append(runs, placementRun{bead: bead, count: 1})
+	}
+	return runs
+}
+
+// placementInstructions returns the run-length encoded placement instructions for every board
+func (m *beadMachine) placementInstructions(pattern *Pattern) []boardInstructions {
+	dimension := pattern.BoardDimension
+	var boards []boardInstructions
+
+	for boardY := 0; boardY*dimension < pattern.Height; boardY++ {
+		for boardX := 0; boardX*dimension < pattern.Width; boardX++ {
+			x0, y0 := boardX*dimension, boardY*dimension
+			x1, y1 := minInt(x0+dimension, pattern.Width), minInt(y0+dimension, pattern.Height)
+			board := boardInstructions{
+				title: m.tr("Board %s (columns %d-%d, rows %d-%d)", boardName(boardX, boardY), x0+1, x1, y0+1, y1),
+			}
+
+			for y := y0; y < y1; y++ {
+				reverse := m.serpentine && (y-y0)%2 == 1
+				runs := rowRuns(pattern, y, x0, x1, reverse)
+				if len(runs) == 1 && runs[0].bead == "" {
+					board.rows = append(board.rows, m.tr("Row %d: empty", y+1))
+					continue
+				}
+
+				parts := make([]string, len(runs))
+				column, step := x0+1, 1 // 1 based column of the first cell of the run
+				if reverse {
+					column, step = x1, -1
+				}
+				for i, run := range runs {
+					if run.bead == "" {
+						run.bead = m.tr("empty")
+					}
+					parts[i] = run.String()
+					if m.coordinates { // the columns of the run let the beads be checked against the chart
+						last := column + step*(run.count-1)
+						if run.count == 1 {
+							parts[i] += fmt.Sprintf(" (%d)", column)
+						} else {
+							parts[i] += fmt.Sprintf(" (%d-%d)", column, last)
+						}
+					}
+					column += step * run.count
+				}
+				direction := ""
+				if reverse {
+					direction = m.tr(" (right to left)")
+				}
+				if pattern.rowShift(y) > 0 { // the beads sit between the beads of the neighboring rows
+					direction += m.tr(" (shifted by half a bead)")
+				}
+				board.rows = append(board.rows, m.tr("Row %d%s: %s", y+1, direction, strings.Join(parts, ", ")))
+			}
+			boards = append(boards, board)
+		}
+	}
+	return boards
+}
+
+// renderInstructions renders the placement instructions as text file
+func (m *beadMachine) renderInstructions(pattern *Pattern, writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	for i, board := range m.placementInstructions(pattern) {
+		if i > 0 {
+			w.WriteString("\n")
+		}
+		w.WriteString(board.title + "\n")
+		for _, row := range board.rows {
+			w.WriteString(row + "\n")
+		}
+	}
+	return errors.Wrap(w.Flush(), "writing instructions")
+}
+
+// renderInstructionsPDF renders the placement instructions as PDF document with a page per board
+func (m *beadMachine) renderInstructionsPDF(pattern *Pattern, w io.Writer) error {
+	doc := &pdfDocument{}
+	textWidth := pdfA4Width - 2*instructionsMargin - instructionsRowIndention
+
+	for i, board := range m.placementInstructions(pattern) {
+		page := doc.addPage(pdfA4Width, pdfA4Height)
+		y := instructionsMargin + instructionsHeadingSize
+		page.text(instructionsMargin, y, pdfFontBold, instructionsHeadingSize, board.title)
+		y += instructionsLineHeight * 1.5
+		if i == 0 {
+			size := m.tr("Pattern size: %s", m.formatSize(pattern.Width, pattern.Height))
+			page.text(instructionsMargin, y, pdfFontRegular, instructionsFontSize, size)
+			y += instructionsLineHeight * 1.5
+		}
+
+		for _, row := range board.rows {
+			for i, line := range wrapText(row, ", ", textWidth, instructionsFontSize) {
+				if y > pdfA4Height-instructionsMargin {
+					page = doc.addPage(pdfA4Width, pdfA4Height)
+					y = instructionsMargin + instructionsFontSize
+				}
+				x := instructionsMargin
+				if i > 0 {
+					x += instructionsRowIndention
+				}
+				page.text(x, y, pdfFontRegular, instructionsFontSize, line)
+				y += instructionsLineHeight
+			}
+		}
+	}
+	if err := m.addPDFFingerprint(doc, pattern); err != nil {
+		return err
+	}
+	return doc.write(w)
+}
+
+// wrapText splits the text at the separator into lines that fit into the given width
+func wrapText(text, separator string, width, fontSize float64) []string {
+	parts := strings.SplitAfter(text, separator)
+	var lines []string
+	var line string
+	for _, part := range parts {
+		if line != "" && pdfTextWidth(line+part, fontSize) > width {
+			lines = append(lines, strings.TrimSpace(line))
+			line = ""
+		}
+		line += part
+	}
+	if line != "" {
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	return lines
+}
+
+// minInt returns the smaller of the two integers
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,73 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// writeLayers writes an image per bead color into the directory that shows only the cells of that color, to
+// place all beads of one color at a time. The images are numbered from the most to the least used color.
+func (m *beadMachine) writeLayers(dir string, pattern *Pattern) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating layer directory")
+	}
+
+	counts := pattern.Stats().BeadCounts
+	beads := make([]string, 0, len(counts))
+	for bead := range counts {
+		beads = append(beads, bead)
+	}
+	sort.Slice(beads, func(i, j int) bool {
+		if counts[beads[i]] != counts[beads[j]] {
+			return counts[beads[i]] > counts[beads[j]]
+		}
+		return beads[i] < beads[j]
+	})
+
+	layer := newPattern(pattern.Width, pattern.Height, pattern.BoardDimension)
+	layer.Palette = pattern.Palette
+	layer.Grid = pattern.Grid
+	for i, bead := range beads {
+		for j, cell := range pattern.Cells {
+			if cell.Bead == bead {
+				layer.Cells[j] = cell
+			} else {
+				layer.Cells[j] = Cell{}
+			}
+		}
+
+		fileName := filepath.Join(dir, layerFileName(i+1, bead))
+		file, err := os.Create(fileName)
+		if err != nil {
+			return errors.Wrap(err, "creating layer file")
+		}
+		if err = png.Encode(file, m.patternImage(layer)); err != nil {
+			file.Close()
+			return errors.Wrap(err, "encoding layer file")
+		}
+		if err = file.Close(); err != nil {
+			return errors.Wrap(err, "closing layer file")
+		}
+	}
+	m.logger.Info("Color layers written", zap.String("directory", dir), zap.Int("layers", len(beads)))
+	return nil
+}
+
+// layerFileName returns the filename of a color layer image, like 01_H1_White.png
+func layerFileName(index int, bead string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+		return '_'
+	}, bead)
+	return fmt.Sprintf("%02d_%s.png", index, name)
+}
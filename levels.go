@@ -0,0 +1,104 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// autoLevelsClip is the fraction of the darkest and brightest pixels that are ignored when stretching the
+// histogram, so that a few outliers do not prevent the stretching
+const autoLevelsClip = 0.005
+
+// applyLevels applies the black and white points and stretches the histogram of the image in auto levels
+// or auto contrast mode
+func (m *beadMachine) applyLevels(inputImage image.Image) image.Image {
+	filteredImage := inputImage
+	if m.blackPoint != 0 || m.whitePoint != 255 {
+		black := [3]int{m.blackPoint, m.blackPoint, m.blackPoint}
+		white := [3]int{m.whitePoint, m.whitePoint, m.whitePoint}
+		filteredImage = adjustLevels(filteredImage, black, white)
+	}
+
+	switch {
+	case m.autoLevels: // every channel on its own, this also corrects color casts
+		var black, white [3]int
+		histograms := channelHistograms(filteredImage)
+		for i, histogram := range histograms[:3] {
+			black[i], white[i] = histogramRange(histogram, autoLevelsClip)
+		}
+		m.logger.Debug("Auto levels", zap.Ints("black", black[:]), zap.Ints("white", white[:]))
+		filteredImage = adjustLevels(filteredImage, black, white)
+
+	case m.autoContrast: // all channels with the same values to keep the hues
+		histograms := channelHistograms(filteredImage)
+		black, white := histogramRange(histograms[3], autoLevelsClip)
+		m.logger.Debug("Auto contrast", zap.Int("black", black), zap.Int("white", white))
+		filteredImage = adjustLevels(filteredImage, [3]int{black, black, black}, [3]int{white, white, white})
+	}
+	return filteredImage
+}
+
+// channelHistograms returns the histograms of the red, green and blue channel and of the luminance of all
+// visible pixels of the image
+func channelHistograms(img image.Image) [4][256]int {
+	var histograms [4][256]int
+	nrgba := imaging.Clone(img)
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		pixel := nrgba.Pix[i : i+4]
+		if pixel[3] == 0 {
+			continue
+		}
+		histograms[0][pixel[0]]++
+		histograms[1][pixel[1]]++
+		histograms[2][pixel[2]]++
+		histograms[3][int(math.Round(luminance(pixel[:3])))]++
+	}
+	return histograms
+}
+
+// histogramRange returns the darkest and brightest value of the histogram, ignoring the given fraction of
+// pixels at both ends
+func histogramRange(histogram [256]int, clip float64) (int, int) {
+	var total int
+	for _, count := range histogram {
+		total += count
+	}
+	ignored := int(float64(total) * clip)
+
+	low, count := 0, 0
+	for ; low < 255; low++ {
+		if count += histogram[low]; count > ignored {
+			break
+		}
+	}
+	high, count := 255, 0
+	for ; high > 0; high-- {
+		if count += histogram[high]; count > ignored {
+			break
+		}
+	}
+	if high <= low { // images of a single color are not changed
+		return 0, 255
+	}
+	return low, high
+}
+
+// adjustLevels maps the per channel black points to 0 and the white points to 255 and stretches the values
+// in between linearly
+func adjustLevels(img image.Image, black, white [3]int) image.Image {
+	var lut [3][256]uint8
+	for channel := range lut {
+		scale := 255 / float64(maxInt(white[channel]-black[channel], 1))
+		for v := range lut[channel] {
+			level := float64(v-black[channel]) * scale
+			lut[channel][v] = uint8(math.Max(0, math.Min(255, math.Round(level))))
+		}
+	}
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		return color.NRGBA{lut[0][c.R], lut[1][c.G], lut[2][c.B], c.A}
+	})
+}
@@ -0,0 +1,119 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// crafts that the patterns are made for
+const (
+	craftPegboard = "pegboard"
+	craftLoom     = "loom"
+)
+
+// loomPalette is the palette of loom patterns if no palette is given, looms are woven with cylinder seed beads
+const loomPalette = "embedded:delica"
+
+// wordChartEmpty is the letter of the empty cells in a word chart
+const wordChartEmpty = "-"
+
+// wordChartColor is a bead of a word chart with the letter that it is referred to by in the rows
+type wordChartColor struct {
+	letter string
+	bead   string // bead name or #rrggbb for unmatched colors
+	count  int
+}
+
+// defaultWordChartFileName returns the word chart filename of the input file
+func defaultWordChartFileName(inputFileName string) string {
+	return strings.TrimSuffix(inputFileName, filepath.Ext(inputFileName)) + "_wordchart.txt"
+}
+
+// wordChartColors returns the beads of the pattern with their letters, the most used bead gets the letter A
+func wordChartColors(pattern *Pattern) []wordChartColor {
+	counts := make(map[string]int)
+	for _, cell := range pattern.Cells {
+		if bead := cellBead(cell); bead != "" {
+			counts[bead]++
+		}
+	}
+	colors := make([]wordChartColor, 0, len(counts))
+	for bead, count := range counts {
+		colors = append(colors, wordChartColor{bead: bead, count: count})
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		if colors[i].count != colors[j].count {
+			return colors[i].count > colors[j].count
+		}
+		return colors[i].bead < colors[j].bead
+	})
+	for i := range colors {
+		colors[i].letter = boardColumnName(i)
+	}
+	return colors
+}
+
+// renderWordChart renders the pattern as word chart like it is shared by bead looming communities: a legend of
+// letters for the bead colors and every row as sequence of counts and letters like 3xA, 2xB. Rows are read from
+// left to right, marked by (L), with --serpentine every second row is read from right to left, marked by (R).
+func (m *beadMachine) renderWordChart(pattern *Pattern, writer io.Writer) error {
+	colors := wordChartColors(pattern)
+	letters := make(map[string]string, len(colors))
+	beads := 0
+	for _, c := range colors {
+		letters[c.bead] = c.letter
+		beads += c.count
+	}
+
+	w := bufio.NewWriter(writer)
+	if m.inputFileName != "" {
+		fmt.Fprintf(w, "Word chart of %s\n", filepath.Base(m.inputFileName))
+	}
+	fmt.Fprintf(w, "%d columns x %d rows, %d beads in %d colors\n\n", pattern.Width, pattern.Height, beads, len(colors))
+	width := 0
+	for _, c := range colors {
+		width = maxInt(width, len(c.letter))
+	}
+	for _, c := range colors {
+		fmt.Fprintf(w, "%-*s = %s (%d)\n", width, c.letter, c.bead, c.count)
+	}
+	if empty := pattern.Width*pattern.Height - beads; empty > 0 {
+		fmt.Fprintf(w, "%-*s = empty (%d)\n", width, wordChartEmpty, empty)
+	}
+	w.WriteString("\n")
+
+	for y := 0; y < pattern.Height; y++ {
+		reverse := m.serpentine && y%2 == 1
+		direction := "L"
+		if reverse {
+			direction = "R"
+		}
+		var parts []string
+		count := 0
+		for i := 0; i < pattern.Width; i++ {
+			x, next := i, i+1
+			if reverse {
+				x, next = pattern.Width-1-i, pattern.Width-2-i
+			}
+			bead := cellBead(*pattern.Cell(x, y))
+			count++
+			if i+1 < pattern.Width && cellBead(*pattern.Cell(next, y)) == bead {
+				continue
+			}
+			letter := wordChartEmpty
+			if bead != "" {
+				letter = letters[bead]
+			}
+			parts = append(parts, fmt.Sprintf("%dx%s", count, letter))
+			count = 0
+		}
+		fmt.Fprintf(w, "Row %d (%s) (%d) %s\n", y+1, direction, pattern.Width, strings.Join(parts, ", "))
+	}
+	return errors.Wrap(w.Flush(), "writing word chart")
+}
@@ -1,30 +1,94 @@
-package main
+package beadmachine
 
 import (
+	"crypto/ed25519"
 	"fmt"
-	"image/color"
+	"html/template"
 	_ "image/gif"
 	_ "image/jpeg"
+	"strings"
+	texttemplate "text/template"
 
-	chromath "github.com/jkl1337/go-chromath"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
-func main() {
+// Execute runs the beadmachine command line with the arguments of the process and returns its exit code. Programs
+// that embed beadmachine register their color distance metrics, renderers, palette providers and output uploaders
+// before they call it.
+func Execute() int {
 	rootCmd := &cobra.Command{
-		Use:   "beadmachine file.jpg",
+		Use:   "beadmachine file.jpg...",
 		Short: "Bead pattern creator",
-		Run:   startBeadMachine,
+		Args:  cobra.ArbitraryArgs,
+		RunE:  startBeadMachine,
+
+		// errors of the commands are logged where they occur, usage is only shown for invalid arguments
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
 
-	rootCmd.Flags().BoolP("verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 
 	// files
-	rootCmd.Flags().StringP("input", "i", "", "image to process")
-	rootCmd.Flags().StringP("output", "o", "", "output filename for the converted PNG image")
+	rootCmd.Flags().StringP("input", "i", "", "image to process, can also be passed as argument")
+	rootCmd.Flags().BoolP("from-clipboard", "", false, "convert the image of the clipboard instead of an input file")
+	rootCmd.Flags().BoolP("to-clipboard", "", false, "copy the PNG bead pattern image to the clipboard")
+	rootCmd.Flags().BoolP("preview-terminal", "", false, "show a colored preview of the pattern in the terminal")
+	rootCmd.Flags().StringP("preview-inline", "", "", "show the rendered PNG pattern in the terminal with a graphics protocol: "+strings.Join(inlineNames(), ", "))
+	rootCmd.Flags().BoolP("watch", "", false, "convert again whenever the input or palette file changes and show the changed cells in the terminal")
+	rootCmd.Flags().DurationP("watch-interval", "", defaultWatchInterval, "interval in which --watch checks the files for changes")
+	rootCmd.Flags().IntP("preview-columns", "", 0, "width in characters of the terminal preview (0 = the COLUMNS of the shell or 80)")
+	rootCmd.Flags().IntP("page", "", 1, "page of a PDF input file to convert")
+	rootCmd.Flags().IntP("dpi", "", defaultPDFDPI, "resolution that a PDF input page is rasterized at")
+	rootCmd.Flags().StringP("notify-webhook", "", "", "webhook URL that gets a summary with a thumbnail, the bead counts and the duration when the run finishes, like a Discord webhook")
+	rootCmd.Flags().StringP("gallery", "", "", "output filename for a HTML gallery of all patterns of the run with thumbnails, statistics and a shopping list, like index.html")
+	rootCmd.Flags().BoolP("shared-palette", "", false, "select the colors of --max-colors across all input files and sprite sheet frames, so that all patterns use the same beads")
+	rootCmd.Flags().StringP("sprite-sheet", "", "", "slice a sprite sheet into frames of a grid like 4x4 or auto and write a pattern per frame")
+	rootCmd.Flags().BoolP("ignore-exif", "", false, "ignore the EXIF orientation of JPEG input files instead of rotating the image upright")
+	rootCmd.Flags().IntP("max-input-dimension", "", 0, "fail if the input image is wider or higher than the given amount of pixels, checked before it is decoded (0 = unlimited)")
+	rootCmd.Flags().Float64P("max-input-megapixels", "", 0, "fail if the input image has more than the given megapixels, checked before it is decoded (0 = unlimited)")
+	rootCmd.Flags().StringP("output", "o", "", "output filename for the converted PNG image, defaults to the input filename with a _beads.png suffix")
+	rootCmd.Flags().StringP("out-dir", "", "", "directory that all outputs are written to, it is created if needed")
+	rootCmd.Flags().StringP("name-template", "", "", "template of the output filenames without extension like {{.Stem}}_{{.Width}}w_{{.Palette}}, see the README for all fields")
 	rootCmd.Flags().StringP("html", "l", "", "output filename for a HTML based bead pattern file")
-	rootCmd.Flags().StringP("palette", "p", "colors_hama.json", "filename of the bead palette")
+	rootCmd.Flags().StringP("html-template", "", "", "Go html/template file that replaces the layout of the HTML output")
+	rootCmd.Flags().StringP("html-renderer", "", htmlRendererTable, "layout of the HTML output: table, or canvas for a zoomable viewer of huge patterns")
+	rootCmd.Flags().StringP("lang", "", defaultLanguage, "language of the text and numbers in the HTML and PDF outputs: "+strings.Join(languageNames(), ", "))
+	rootCmd.Flags().StringP("units", "", unitsMetric, "unit system of the physical dimensions in the logs and outputs: metric or imperial")
+	rootCmd.Flags().StringP("bead-size", "", defaultBeadSize, "bead size that sets the bead pitch: "+strings.Join(beadSizeNames(), ", "))
+	rootCmd.Flags().Float64P("bead-pitch", "", 0, "distance in mm between the centers of two neighboring beads, overrides the pitch of the bead size")
+	rootCmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette, a JSON file name or URI like embedded:hama, https://host/palette.json or sqlite:inventory.db")
+	rootCmd.Flags().IntSliceP("previews", "", nil, "write quick previews at the given bead widths like 32,48,64 and a side-by-side image instead of the pattern")
+	rootCmd.Flags().StringSliceP("compare-palettes", "", nil, "match the image to every given palette and write a side-by-side comparison, like hama,perler or palette files")
+	rootCmd.Flags().StringToStringP("bead-prices", "", nil, "price per bead of the compared palettes for the cost comparison, like hama=0.004")
+	rootCmd.Flags().StringP("gamut-map", "", "", "output filename for a PNG image highlighting colors outside of the palette gamut")
+	rootCmd.Flags().StringP("error-map", "", "", "output filename for a PNG heatmap of the color matching error per bead")
+	rootCmd.Flags().StringP("stats", "", "", "output filename for a JSON file with statistics about the bead pattern")
+	rootCmd.Flags().StringP("instructions", "", "", "output filename for row by row placement instructions per board, as text or .pdf file")
+	rootCmd.Flags().StringP("pdf", "", "", "output filename for a PDF chart of the pattern on a single page")
+	rootCmd.Flags().StringP("pdf-scale", "", pdfScaleFit, "scale of the PDF chart: fit to an A4 page or actual to print the beads in their real size")
+	rootCmd.Flags().StringP("color-by-number", "", "", "output filename for a color by number PDF with the bead number in every cell and a numbered legend")
+	rootCmd.Flags().StringP("regions", "", "", "output filename for the connected color regions as polygons with a layer per bead, as .svg or .geojson file")
+	rootCmd.Flags().BoolP("print-actual-size", "", false, "write the PNG output in the real size of the pattern at the print resolution, to tape it beneath a pegboard")
+	rootCmd.Flags().IntP("print-dpi", "", defaultPrintDPI, "print resolution of the PNG output in its real size")
+	rootCmd.Flags().StringP("embed", "", "", "output filename for a self-contained JS widget that shows the pattern zoomable in any webpage, like pattern.js")
+	rootCmd.Flags().StringP("placement-html", "", "", "output filename for an interactive HTML placement mode that steps through the runs of alternating rows with the keyboard")
+	rootCmd.Flags().BoolP("serpentine", "", false, "alternate the placement direction of every row in the instructions and word charts")
+	rootCmd.Flags().StringP("craft", "", craftPegboard, "craft of the pattern: pegboard, or loom to write a word chart with Delica beads unless a palette is given")
+	rootCmd.Flags().StringP("word-chart", "", "", "output filename for a text word chart of the rows as bead counts per color like 3xA, 2xB, for loom beadweaving")
+	rootCmd.Flags().StringP("pattern", "", "", "output filename for a JSON file of the bead pattern")
+	rootCmd.Flags().StringP("poster", "", "", "paper size of a multi-panel poster PDF with crop marks and overlap: A3, A4, A5, letter or legal")
+	rootCmd.Flags().StringP("poster-output", "", "", "output filename for the poster PDF, defaults to the input filename with a _poster.pdf suffix")
+	rootCmd.Flags().StringP("bundle", "", "", "output filename for a zip archive with the PNG, HTML, instructions PDF, statistics, pattern JSON and the used palette")
+	rootCmd.Flags().StringP("sign", "", "", "sign the manifest of the bundle with an Ed25519 private key from a PEM file, so that buyers can verify its authenticity")
+	rootCmd.Flags().StringP("tiles-out", "", "", "output directory for a zoomable deep zoom tile pyramid of the pattern with a HTML viewer")
+	rootCmd.Flags().StringP("layers", "", "", "output directory for an image per bead color that shows only the cells of that color")
+	rootCmd.Flags().StringArrayP("render", "", nil, "render the bead pattern with a built-in or registered renderer, in the format name=file")
+	rootCmd.Flags().StringArrayP("renderer-exec", "", nil, "register an external renderer executable that gets the pattern JSON on stdin, in the format name=command")
+	rootCmd.Flags().StringP("project-db", "", "", "filename of a SQLite project database that the conversion gets stored in")
+	rootCmd.Flags().BoolP("deduct-inventory", "", false, "deduct the used beads from the inventory table of the project database")
+	rootCmd.Flags().StringArrayP("renderer-plugin", "", nil, "register a Go plugin renderer, in the format name=plugin.so")
 
 	// dimensions
 	rootCmd.Flags().IntP("width", "w", 0, "resize image to width in pixel")
@@ -32,92 +96,788 @@ func main() {
 	rootCmd.Flags().IntP("boardswidth", "x", 0, "resize image to width in amount of boards")
 	rootCmd.Flags().IntP("boardsheight", "y", 0, "resize image to height in amount of boards")
 	rootCmd.Flags().IntP("boarddimension", "d", 20, "dimension of a board")
+	rootCmd.Flags().StringP("fit", "", fitStretch, "how to fit the image if width and height are given: contain, cover or stretch")
+	rootCmd.Flags().StringP("resample", "", resampleLanczos, "resampling filter for resizing the image: lanczos, linear, box or nearest")
+	rootCmd.Flags().BoolP("auto-orient", "", false, "rotate or mirror the image into the orientation that needs the fewest boards")
+	rootCmd.Flags().BoolP("optimize-seams", "", false, "shift the image within the free space of the last board so that the least detail lands on board boundaries")
+	rootCmd.Flags().BoolP("pad-to-boards", "", false, "pad the image with empty cells to a multiple of the board dimension")
+	rootCmd.Flags().StringP("pad-align", "", padAlignCenter, "alignment of the image when padding it to full boards: center or top-left")
+	rootCmd.Flags().StringP("grid", "", gridSquare, "bead grid of the pattern: square, or offset for peyote and brick stitch where every second row is shifted by half a bead")
+	rootCmd.Flags().StringP("tile", "", "", "repeat the converted motif in a grid of tiles like 3x2, for borders, coasters and wallpaper designs")
+	rootCmd.Flags().StringP("tile-mirror", "", tileMirrorNone, "mirror every second tile: none, horizontal, vertical or both")
+	rootCmd.Flags().StringArrayP("border", "", nil, "add a border of beads around the pattern like 2:H18, several beads like 1:H1,H18 alternate in a checkerboard")
+	rootCmd.Flags().StringP("fill-background", "", "", "fill the empty cells with a generated fill of beads: checker, stripes or gradient, like checker:H1,H47")
+	rootCmd.Flags().IntP("seam-margin", "", 5, "maximum amount of empty columns and rows that --optimize-seams adds")
+	rootCmd.Flags().IntP("max-beads", "", 0, "scale the pattern down to need at most the given amount of beads, like a classroom kit, fails with --strict instead (0 = unlimited)")
 
 	// bead types
 	rootCmd.Flags().BoolP("beadstyle", "b", false, "make output file look like a beads board")
+	rootCmd.Flags().IntP("chart-cell-size", "", 0, "size in pixel of every cell of the PNG and HTML outputs, for big readable charts on projectors (0 = default)")
+	rootCmd.Flags().BoolP("coordinates", "", false, "print board names and row and column numbers along the edges of the PNG, HTML, regions SVG and PDF charts and the columns of the bead runs in the placement instructions")
+	rootCmd.Flags().IntP("coordinates-interval", "", 5, "label every n-th row and column with its number")
+	rootCmd.Flags().StringP("simulate-cvd", "", "", "write a preview of the pattern as seen with a color vision deficiency: protanopia, deuteranopia or tritanopia")
+	rootCmd.Flags().BoolP("colorblind-safe", "", false, "add symbols for bead colors that are hard to distinguish with color vision deficiencies and write simulated previews")
 	rootCmd.Flags().BoolP("translucent", "t", false, "include translucent colors for the conversion")
 	rootCmd.Flags().BoolP("flourescent", "f", false, "include flourescent colors for the conversion")
+	rootCmd.Flags().BoolP("merge-duplicates", "", false, "merge palette beads with identical or nearly identical colors into the first bead instead of warning about them")
+	rootCmd.Flags().Float64P("duplicate-threshold", "", 1.0, "color distance (ΔE) up to which palette beads are reported as duplicates")
+	rootCmd.Flags().StringP("substitutions", "", "", "JSON file of bead substitutions that are applied after matching, like {\"H9\": \"H8\"}")
+	rootCmd.Flags().StringSliceP("colors", "", nil, "restrict the palette to the given bead colors, as comma separated codes or names like H1,H18")
+	rootCmd.Flags().IntP("max-colors", "", 0, "restrict the pattern to the given amount of the most used bead colors (0 = unlimited)")
+	rootCmd.Flags().BoolP("preserve-faces", "", false, "detect faces, keep their bead colors with --max-colors and dither them finely with --adaptive-dither")
+	rootCmd.Flags().BoolP("adaptive-dither", "", false, "dither detailed regions of the image and match smooth regions to flat colors")
+	rootCmd.Flags().BoolP("auto-tune", "", false, "search the dithering, contrast and max colors that convert the image most similar and use the best ones")
+	rootCmd.Flags().IntP("auto-tune-iterations", "", defaultTuneIterations, "maximum amount of conversions that --auto-tune tries")
 
 	// filters
 	rootCmd.Flags().BoolP("nocolormatching", "n", false, "skip the bead color matching")
 	rootCmd.Flags().BoolP("grey", "g", false, "convert the image to greyscale")
+	rootCmd.Flags().BoolP("auto-levels", "", false, "stretch the histogram of every color channel to the full range, this also removes color casts")
+	rootCmd.Flags().BoolP("auto-contrast", "", false, "stretch the histogram of the luminance to the full range while keeping the hues")
+	rootCmd.Flags().IntP("black-point", "", 0, "input level that becomes black, darker values are clipped (0 - 255)")
+	rootCmd.Flags().IntP("white-point", "", 255, "input level that becomes white, brighter values are clipped (0 - 255)")
+	rootCmd.Flags().Float64P("hue-shift", "", 0.0, "rotate the hues of the image by the given degrees (-180 - 180)")
+	rootCmd.Flags().Float64P("temperature", "", 0.0, "shift the color temperature, positive values are warmer and negative values cooler (-100 - 100)")
+	rootCmd.Flags().Float64P("tint", "", 0.0, "shift the tint, positive values toward magenta and negative values toward green (-100 - 100)")
+	rootCmd.Flags().StringArrayP("adjust", "", nil, "adjust the saturation, brightness or hue of a hue and lightness range, like hue=200-260:light=20-80:sat=+30")
 	rootCmd.Flags().Float64P("blur", "", 0.0, "apply blur filter (0.0 - 10.0)")
 	rootCmd.Flags().Float64P("sharpen", "", 0.0, "apply sharpen filter (0.0 - 10.0)")
 	rootCmd.Flags().Float64P("gamma", "", 0.0, "apply gamma correction (0.0 - 10.0)")
 	rootCmd.Flags().Float64P("contrast", "", 0.0, "apply contrast adjustment (-100 - 100)")
 	rootCmd.Flags().Float64P("brightness", "", 0.0, "apply brightness adjustment (-100 - 100)")
+	rootCmd.Flags().BoolP("subject-focus", "", false, "keep the details of the foreground subject and flatten the background to a few colors")
+	rootCmd.Flags().StringP("stylize", "", "", "simplify the image into flat colored regions before matching: comic, oil or mosaic")
+
+	rootCmd.Flags().StringP("preset", "", "", "apply a preset of flag values that are not set explicitly: pixelart, photo, portrait, poster or a saved user preset")
+	rootCmd.Flags().BoolP("strict", "", false, "fail with a non-zero exit code if any warning was logged")
+	rootCmd.Flags().StringP("golden", "", "", "compare the pattern to a golden file of a previous conversion for regression tests, fails if they differ")
+	rootCmd.Flags().IntP("golden-tolerance", "", 0, "amount of cells that may differ from the golden file")
+	rootCmd.Flags().BoolP("update-golden", "", false, "write the golden file from the pattern instead of comparing to it")
+	rootCmd.Flags().StringP("checkpoint", "", "", "record the converted inputs of a batch in the given file, so that an interrupted batch can be continued with --resume")
+	rootCmd.Flags().BoolP("resume", "", false, "skip the batch inputs that the --checkpoint file records as converted with the same file content and settings")
+	rootCmd.Flags().StringP("report", "", "", "write all warnings and errors like unmatched colors and skipped batch inputs as JSON report file")
+	rootCmd.Flags().StringP("trace", "", "", "export OpenTelemetry spans of the pipeline stages to an OTLP/HTTP endpoint like http://localhost:4318/v1/traces or into a JSON file, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT")
+	rootCmd.Flags().DurationP("timeout", "", 0, "cancel the conversion if it takes longer than the given duration like 30s, for servers and batches (0 = unlimited)")
+
+	// color matching
+	rootCmd.Flags().StringP("distance", "", distanceCIEDE2000, "color distance metric that picks the closest bead: "+strings.Join(colorDistanceNames(), ", "))
+	rootCmd.Flags().Float64P("gamut-threshold", "", 10.0, "color distance (ΔE) above which a matched color is reported as outside of the palette gamut, logged as warning if set (0 = disabled)")
+	rootCmd.Flags().IntP("cache-size", "", defaultColorCacheSize, "maximum amount of source colors whose bead match is cached (0 = disabled)")
+	rootCmd.Flags().IntP("cache-precision", "", maxCachePrecision, "bits per color channel that colors are quantized to before matching, lower values increase the cache hits (1 - 8)")
+
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		_ = cmd.Usage()
+		return err
+	})
+
+	registerFlagCompletions(rootCmd)
+
+	rootCmd.AddCommand(suggestCommand())
+	rootCmd.AddCommand(analyzeCommand())
+	rootCmd.AddCommand(benchCommand())
+	rootCmd.AddCommand(scoreCommand())
+	rootCmd.AddCommand(paletteCommand())
+	rootCmd.AddCommand(patternCommand())
+	rootCmd.AddCommand(projectsCommand())
+	rootCmd.AddCommand(wizardCommand())
+	rootCmd.AddCommand(presetCommand())
+	rootCmd.AddCommand(assistCommand())
+	rootCmd.AddCommand(verifyCommand())
+	rootCmd.AddCommand(completionCommand())
+	rootCmd.AddCommand(docsCommand())
+	rootCmd.AddCommand(guiCommand())
+	rootCmd.AddCommand(installShellIntegrationCommand())
+	rootCmd.AddCommand(composeCommand(rootCmd))
+	rootCmd.AddCommand(pipelineCommand(rootCmd))
+	rootCmd.AddCommand(serveCommand())
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Printf("ERROR: %v\n", err)
+		if _, logged := err.(*exitError); !logged { // errors of cobra like unknown flags
+			fmt.Printf("ERROR: %v\n", err)
+		}
+		return exitCode(err)
 	}
+	return exitSuccess
+}
+
+func startBeadMachine(cmd *cobra.Command, args []string) error {
+	return runBeadMachine(cmd, args, nil)
 }
 
-func startBeadMachine(cmd *cobra.Command, args []string) {
-	if len(args) == 0 {
-		_ = cmd.Help()
-		return
+// runBeadMachine converts the input files with the flags of the command, if a composition is given its images
+// are converted as a single input
+func runBeadMachine(cmd *cobra.Command, args []string, composition *composition) (err error) {
+	inputFileName, _ := cmd.Flags().GetString("input")
+	inputFileNames := args
+	if inputFileName != "" {
+		inputFileNames = append([]string{inputFileName}, args...)
+	} else if len(args) > 0 {
+		inputFileName = args[0]
+	}
+	batch := len(inputFileNames) > 1 && composition == nil
+	fromClipboard, _ := cmd.Flags().GetBool("from-clipboard")
+	inputGiven := inputFileName != ""
+	if !inputGiven && fromClipboard {
+		inputFileName = clipboardFileName
+	}
+	if inputFileName == "" {
+		return cmd.Help()
 	}
 
-	logger := logger(cmd)
+	warnings := &warningCounter{}
+	logger := warnings.logger(logger(cmd))
+	var collector *reportCollector
+	if reportFileName, _ := cmd.Flags().GetString("report"); reportFileName != "" {
+		reportInputs := inputFileNames
+		if len(reportInputs) == 0 {
+			reportInputs = []string{inputFileName}
+		}
+		collector = newReportCollector(reportInputs)
+		logger = collector.logger(logger)
+		defer func() {
+			if reportErr := collector.write(reportFileName, err); reportErr != nil {
+				logger.Error("Writing report failed", zap.Error(reportErr))
+				if err == nil {
+					err = outputError(reportErr)
+				}
+			}
+		}()
+	}
+	strict, _ := cmd.Flags().GetBool("strict")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	traceFlag, _ := cmd.Flags().GetString("trace")
+	checkpointFileName, _ := cmd.Flags().GetString("checkpoint")
+	resume, _ := cmd.Flags().GetBool("resume")
+	goldenFileName, _ := cmd.Flags().GetString("golden")
+	goldenTolerance, _ := cmd.Flags().GetInt("golden-tolerance")
+	updateGolden, _ := cmd.Flags().GetBool("update-golden")
 
-	inputFileName, _ := cmd.Flags().GetString("input")
+	if presetName, _ := cmd.Flags().GetString("preset"); presetName != "" {
+		p, err := findPreset(presetName)
+		if err == nil {
+			err = p.apply(cmd.Flags())
+		}
+		if err != nil {
+			logger.Error("Applying preset failed", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	if err := validateFlagRanges(cmd.Flags()); err != nil {
+		logger.Error("Invalid flag value", zap.Error(err))
+		return usageError(err)
+	}
+
+	toClipboard, _ := cmd.Flags().GetBool("to-clipboard")
+	previewTerminal, _ := cmd.Flags().GetBool("preview-terminal")
+	previewColumns, _ := cmd.Flags().GetInt("preview-columns")
+	previewInline, _ := cmd.Flags().GetString("preview-inline")
+	watch, _ := cmd.Flags().GetBool("watch")
+	watchInterval, _ := cmd.Flags().GetDuration("watch-interval")
+	pdfPage, _ := cmd.Flags().GetInt("page")
+	pdfDPI, _ := cmd.Flags().GetInt("dpi")
+	ignoreExif, _ := cmd.Flags().GetBool("ignore-exif")
+	maxInputDimension, _ := cmd.Flags().GetInt("max-input-dimension")
+	maxInputMegapixels, _ := cmd.Flags().GetFloat64("max-input-megapixels")
+	spriteSheet, _ := cmd.Flags().GetString("sprite-sheet")
+	var spriteColumns, spriteRows int
+	if spriteSheet != "" {
+		var err error
+		if spriteColumns, spriteRows, err = parseSpriteSheet(spriteSheet); err != nil {
+			logger.Error("Invalid sprite sheet", zap.Error(err))
+			return usageError(err)
+		}
+	}
 	outputFileName, _ := cmd.Flags().GetString("output")
+	if outputFileName == "" && !batch { // the outputs of batch inputs are named per input
+		outputFileName = defaultOutputFileName(inputFileName)
+	}
+	outDir, _ := cmd.Flags().GetString("out-dir")
+	nameTemplateText, _ := cmd.Flags().GetString("name-template")
+	var nameTemplate *texttemplate.Template
+	if nameTemplateText != "" {
+		var err error
+		if nameTemplate, err = parseNameTemplate(nameTemplateText); err != nil {
+			logger.Error("Invalid name template", zap.Error(err))
+			return usageError(err)
+		}
+	}
+	sharedPalette, _ := cmd.Flags().GetBool("shared-palette")
+	galleryFileName, _ := cmd.Flags().GetString("gallery")
+	notifyWebhook, _ := cmd.Flags().GetString("notify-webhook")
 	htmlFileName, _ := cmd.Flags().GetString("html")
-	paletteFileName, _ := cmd.Flags().GetString("palette")
+	htmlTemplateFileName, _ := cmd.Flags().GetString("html-template")
+	htmlRenderer, _ := cmd.Flags().GetString("html-renderer")
+	language, _ := cmd.Flags().GetString("lang")
+	units, _ := cmd.Flags().GetString("units")
+	beadSize, _ := cmd.Flags().GetString("bead-size")
+	beadPitch, _ := cmd.Flags().GetFloat64("bead-pitch")
+	palette, _ := cmd.Flags().GetString("palette")
+	comparisonPalettes, _ := cmd.Flags().GetStringSlice("compare-palettes")
+	previewWidths, _ := cmd.Flags().GetIntSlice("previews")
+	beadPriceDefinitions, _ := cmd.Flags().GetStringToString("bead-prices")
+	gamutFileName, _ := cmd.Flags().GetString("gamut-map")
+	errorMapFileName, _ := cmd.Flags().GetString("error-map")
+	statsFileName, _ := cmd.Flags().GetString("stats")
+	patternFileName, _ := cmd.Flags().GetString("pattern")
+	instructionsFileName, _ := cmd.Flags().GetString("instructions")
+	serpentine, _ := cmd.Flags().GetBool("serpentine")
+	craft, _ := cmd.Flags().GetString("craft")
+	wordChartFileName, _ := cmd.Flags().GetString("word-chart")
+	placementFileName, _ := cmd.Flags().GetString("placement-html")
+	embedFileName, _ := cmd.Flags().GetString("embed")
+	pdfFileName, _ := cmd.Flags().GetString("pdf")
+	pdfScale, _ := cmd.Flags().GetString("pdf-scale")
+	colorByNumberFileName, _ := cmd.Flags().GetString("color-by-number")
+	printActualSize, _ := cmd.Flags().GetBool("print-actual-size")
+	regionsFileName, _ := cmd.Flags().GetString("regions")
+	printDPI, _ := cmd.Flags().GetInt("print-dpi")
+	tilesDirectory, _ := cmd.Flags().GetString("tiles-out")
+	layersDirectory, _ := cmd.Flags().GetString("layers")
+	bundleFileName, _ := cmd.Flags().GetString("bundle")
+	signKeyFileName, _ := cmd.Flags().GetString("sign")
+	poster, _ := cmd.Flags().GetString("poster")
+	posterOutput, _ := cmd.Flags().GetString("poster-output")
+	renderOutputs, _ := cmd.Flags().GetStringArray("render")
+	rendererExecs, _ := cmd.Flags().GetStringArray("renderer-exec")
+	rendererPlugins, _ := cmd.Flags().GetStringArray("renderer-plugin")
+	projectDBFileName, _ := cmd.Flags().GetString("project-db")
+	deductInventory, _ := cmd.Flags().GetBool("deduct-inventory")
 
 	width, _ := cmd.Flags().GetInt("width")
 	height, _ := cmd.Flags().GetInt("height")
 	newWidthBoards, _ := cmd.Flags().GetInt("boardswidth")
 	newHeightBoards, _ := cmd.Flags().GetInt("boardsheight")
 	boardDimension, _ := cmd.Flags().GetInt("boarddimension")
+	fit, _ := cmd.Flags().GetString("fit")
+	resample, _ := cmd.Flags().GetString("resample")
+	autoOrient, _ := cmd.Flags().GetBool("auto-orient")
+	optimizeSeams, _ := cmd.Flags().GetBool("optimize-seams")
+	seamMargin, _ := cmd.Flags().GetInt("seam-margin")
+	padToBoards, _ := cmd.Flags().GetBool("pad-to-boards")
+	padAlign, _ := cmd.Flags().GetString("pad-align")
+	grid, _ := cmd.Flags().GetString("grid")
+	if composition != nil { // the grid flag of compose arranges the images
+		grid, _ = cmd.Flags().GetString("bead-grid")
+	}
+	tile, _ := cmd.Flags().GetString("tile")
+	tileMirror, _ := cmd.Flags().GetString("tile-mirror")
+	borderDefinitions, _ := cmd.Flags().GetStringArray("border")
+	borders, err := parseBorders(borderDefinitions)
+	if err != nil {
+		logger.Error("Invalid border", zap.Error(err))
+		return usageError(err)
+	}
+	fill, _ := cmd.Flags().GetString("fill-background")
+	maxBeads, _ := cmd.Flags().GetInt("max-beads")
+	var backgroundFill *backgroundFill
+	if fill != "" {
+		if backgroundFill, err = parseBackgroundFill(fill); err != nil {
+			logger.Error("Invalid background fill", zap.Error(err))
+			return usageError(err)
+		}
+	}
+	var tileColumns, tileRows int
+	if tile != "" {
+		var err error
+		if tileColumns, tileRows, err = parseTile(tile); err != nil {
+			logger.Error("Invalid tile grid", zap.Error(err))
+			return usageError(err)
+		}
+	}
 
 	beadStyle, _ := cmd.Flags().GetBool("beadstyle")
+	coordinates, _ := cmd.Flags().GetBool("coordinates")
+	coordinatesInterval, _ := cmd.Flags().GetInt("coordinates-interval")
+	chartCellSize, _ := cmd.Flags().GetInt("chart-cell-size")
+	colorblindSafe, _ := cmd.Flags().GetBool("colorblind-safe")
+	simulateCVD, _ := cmd.Flags().GetString("simulate-cvd")
 	useTranslucent, _ := cmd.Flags().GetBool("translucent")
 	useFlourescent, _ := cmd.Flags().GetBool("flourescent")
+	colors, _ := cmd.Flags().GetStringSlice("colors")
+	maxColors, _ := cmd.Flags().GetInt("max-colors")
+	preserveFaces, _ := cmd.Flags().GetBool("preserve-faces")
+	adaptiveDither, _ := cmd.Flags().GetBool("adaptive-dither")
+	autoTune, _ := cmd.Flags().GetBool("auto-tune")
+	tuneIterations, _ := cmd.Flags().GetInt("auto-tune-iterations")
+	mergeDuplicates, _ := cmd.Flags().GetBool("merge-duplicates")
+	substitutionsFileName, _ := cmd.Flags().GetString("substitutions")
+	duplicateThreshold, _ := cmd.Flags().GetFloat64("duplicate-threshold")
 
 	noColorMatching, _ := cmd.Flags().GetBool("nocolormatching")
 	greyScale, _ := cmd.Flags().GetBool("grey")
+	autoLevels, _ := cmd.Flags().GetBool("auto-levels")
+	autoContrast, _ := cmd.Flags().GetBool("auto-contrast")
+	blackPoint, _ := cmd.Flags().GetInt("black-point")
+	whitePoint, _ := cmd.Flags().GetInt("white-point")
+	hueShift, _ := cmd.Flags().GetFloat64("hue-shift")
+	temperature, _ := cmd.Flags().GetFloat64("temperature")
+	tint, _ := cmd.Flags().GetFloat64("tint")
+	adjust, _ := cmd.Flags().GetStringArray("adjust")
 	filterBlur, _ := cmd.Flags().GetFloat64("blur")
 	filterSharpen, _ := cmd.Flags().GetFloat64("sharpen")
 	filterGamma, _ := cmd.Flags().GetFloat64("gamma")
 	filterContrast, _ := cmd.Flags().GetFloat64("contrast")
 	filterBrightness, _ := cmd.Flags().GetFloat64("brightness")
+	stylize, _ := cmd.Flags().GetString("stylize")
+	subjectFocus, _ := cmd.Flags().GetBool("subject-focus")
+
+	distanceName, _ := cmd.Flags().GetString("distance")
+	gamutThreshold, _ := cmd.Flags().GetFloat64("gamut-threshold")
+	cacheSize, _ := cmd.Flags().GetInt("cache-size")
+	cachePrecision, _ := cmd.Flags().GetInt("cache-precision")
 
-	m := &beadMachine{
-		logger: logger,
-
-		colorMatchCache: make(map[color.Color]string),
-		rgbLabCache:     make(map[color.Color]chromath.Lab),
-		beadStatsDone:   make(chan struct{}),
-
-		labTransformer: chromath.NewLabTransformer(&chromath.IlluminantRefD50),
-		rgbTransformer: chromath.NewRGBTransformer(&chromath.SpaceSRGB, &chromath.AdaptationBradford, &chromath.IlluminantRefD50, &chromath.Scaler8bClamping, 1.0, nil),
-		beadFillPixel:  color.RGBA{225, 225, 225, 255}, // light grey
-
-		inputFileName:   inputFileName,
-		outputFileName:  outputFileName,
-		paletteFileName: paletteFileName,
-		htmlFileName:    htmlFileName,
-
-		boardDimension: boardDimension,
-		width:          width,
-		boardsWidth:    newWidthBoards,
-		height:         height,
-		boardsHeight:   newHeightBoards,
-
-		beadStyle:       beadStyle,
-		noColorMatching: noColorMatching,
-		greyScale:       greyScale,
-		translucent:     useTranslucent,
-		flourescent:     useFlourescent,
-
-		blur:       filterBlur,
-		sharpen:    filterSharpen,
-		gamma:      filterGamma,
-		contrast:   filterContrast,
-		brightness: filterBrightness,
-	}
-	m.process()
+	switch fit {
+	case fitContain, fitCover, fitStretch:
+	default:
+		logger.Error("Invalid fit strategy", zap.String("fit", fit))
+		return usageError(fmt.Errorf("invalid fit strategy '%s'", fit))
+	}
+
+	switch resample {
+	case resampleLanczos, resampleLinear, resampleBox, resampleNearest:
+	default:
+		logger.Error("Invalid resampling filter", zap.String("resample", resample))
+		return usageError(fmt.Errorf("invalid resampling filter '%s'", resample))
+	}
+
+	beadPrices, err := parseBeadPrices(beadPriceDefinitions)
+	if err != nil {
+		logger.Error("Invalid bead price", zap.Error(err))
+		return usageError(err)
+	}
+	if len(borders) > 0 && noColorMatching {
+		logger.Error("Border beads can not be added without color matching")
+		return usageError(fmt.Errorf("--border can not be used with --nocolormatching"))
+	}
+	if backgroundFill != nil && noColorMatching {
+		logger.Error("Background beads can not be filled in without color matching")
+		return usageError(fmt.Errorf("--fill-background can not be used with --nocolormatching"))
+	}
+	if len(comparisonPalettes) > 0 && noColorMatching {
+		logger.Error("Palettes can not be compared without color matching")
+		return usageError(fmt.Errorf("--compare-palettes can not be used with --nocolormatching"))
+	}
+
+	switch htmlRenderer {
+	case htmlRendererTable:
+	case htmlRendererCanvas:
+		if htmlTemplateFileName != "" {
+			logger.Error("A HTML template can not be used with the canvas renderer")
+			return usageError(fmt.Errorf("--html-template can not be used with --html-renderer canvas"))
+		}
+	default:
+		logger.Error("Invalid HTML renderer", zap.String("html-renderer", htmlRenderer))
+		return usageError(fmt.Errorf("invalid HTML renderer '%s', expected table or canvas", htmlRenderer))
+	}
+
+	var htmlTemplate *template.Template
+	if htmlTemplateFileName != "" {
+		if htmlTemplate, err = loadHTMLTemplate(htmlTemplateFileName); err != nil {
+			logger.Error("Loading HTML template failed", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	var signingKey ed25519.PrivateKey
+	if signKeyFileName != "" {
+		bundled := bundleFileName != ""
+		for _, output := range renderOutputs {
+			bundled = bundled || strings.HasPrefix(output, "bundle=")
+		}
+		if !bundled {
+			logger.Error("No bundle output to sign")
+			return usageError(fmt.Errorf("--sign needs --bundle or --render bundle=file"))
+		}
+		if signingKey, err = loadSigningKey(signKeyFileName); err != nil {
+			logger.Error("Loading signing key failed", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	var substitutions map[string]string
+	if substitutionsFileName != "" {
+		if substitutions, err = loadSubstitutions(substitutionsFileName); err != nil {
+			logger.Error("Loading substitutions failed", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	if fromClipboard && inputGiven {
+		logger.Error("The clipboard can not be used with an input file")
+		return usageError(fmt.Errorf("--from-clipboard can not be used with an input file"))
+	}
+	if fromClipboard && projectDBFileName != "" {
+		logger.Error("Clipboard images can not be stored in the project database")
+		return usageError(fmt.Errorf("--from-clipboard can not be used with --project-db"))
+	}
+	if batch && toClipboard {
+		logger.Error("Only a single pattern can be copied to the clipboard")
+		return usageError(fmt.Errorf("--to-clipboard can not be used with multiple input files"))
+	}
+	if sharedPalette && (maxColors == 0 || len(comparisonPalettes) > 0) {
+		logger.Error("A shared palette needs a color limit")
+		return usageError(fmt.Errorf("--shared-palette requires --max-colors and can not be used with --compare-palettes"))
+	}
+	if notifyWebhook != "" {
+		if err := validateWebhookURL(notifyWebhook); err != nil {
+			logger.Error("Invalid webhook URL", zap.Error(err))
+			return usageError(err)
+		}
+	}
+	if galleryFileName != "" && len(comparisonPalettes) > 0 {
+		logger.Error("Palette comparisons can not be added to a gallery")
+		return usageError(fmt.Errorf("--gallery can not be used with --compare-palettes"))
+	}
+	if spriteSheet != "" {
+		for _, name := range []string{"compare-palettes", "project-db", "to-clipboard"} {
+			if cmd.Flags().Changed(name) {
+				logger.Error("Sprite sheets can only be written to output files", zap.String("flag", name))
+				return usageError(fmt.Errorf("--sprite-sheet can not be used with --%s", name))
+			}
+		}
+	}
+	if autoOrient && spriteSheet != "" {
+		logger.Error("The frames of a sprite sheet must keep the same orientation")
+		return usageError(fmt.Errorf("--auto-orient can not be used with --sprite-sheet"))
+	}
+	if preserveFaces && maxColors == 0 && !adaptiveDither {
+		logger.Error("Faces can only be preserved when the colors are reduced or dithered")
+		return usageError(fmt.Errorf("--preserve-faces requires --max-colors or --adaptive-dither"))
+	}
+	for _, width := range previewWidths {
+		if width <= 0 {
+			logger.Error("Invalid preview width", zap.Int("width", width))
+			return usageError(fmt.Errorf("invalid preview width %d", width))
+		}
+	}
+	if len(previewWidths) > 0 && (len(comparisonPalettes) > 0 || spriteSheet != "" || autoTune || goldenFileName != "") {
+		logger.Error("Previews are written instead of the pattern")
+		return usageError(fmt.Errorf("--previews can not be used with --compare-palettes, --sprite-sheet, --auto-tune or --golden"))
+	}
+	if autoTune && (noColorMatching || sharedPalette || len(comparisonPalettes) > 0 || spriteSheet != "") {
+		logger.Error("Auto-tune needs a single pattern with color matching")
+		return usageError(fmt.Errorf("--auto-tune can not be used with --nocolormatching, --shared-palette, --compare-palettes or --sprite-sheet"))
+	}
+	if watch && (batch || composition != nil || fromClipboard || len(comparisonPalettes) > 0 || spriteSheet != "" || len(previewWidths) > 0) {
+		logger.Error("Watch mode needs a single input file and pattern")
+		return usageError(fmt.Errorf("--watch can not be used with multiple input files, compositions, --from-clipboard, --compare-palettes, --sprite-sheet or --previews"))
+	}
+	if watch && timeout > 0 {
+		logger.Error("Watch mode runs until Ctrl-C is pressed")
+		return usageError(fmt.Errorf("--watch can not be used with --timeout"))
+	}
+	if autoLevels && autoContrast {
+		logger.Error("Auto levels and auto contrast can not be combined")
+		return usageError(fmt.Errorf("--auto-levels can not be used with --auto-contrast"))
+	}
+	if blackPoint >= whitePoint {
+		logger.Error("Invalid levels", zap.Int("black-point", blackPoint), zap.Int("white-point", whitePoint))
+		return usageError(fmt.Errorf("black point %d has to be below the white point %d", blackPoint, whitePoint))
+	}
+
+	adjustments, err := parseAdjustments(adjust)
+	if err != nil {
+		logger.Error("Invalid adjustment", zap.Error(err))
+		return usageError(err)
+	}
+
+	switch padAlign {
+	case padAlignCenter, padAlignTopLeft:
+	default:
+		logger.Error("Invalid pad alignment", zap.String("pad-align", padAlign))
+		return usageError(fmt.Errorf("invalid pad alignment '%s'", padAlign))
+	}
+
+	switch craft {
+	case craftPegboard:
+	case craftLoom:
+		if !cmd.Flags().Changed("palette") { // looms are woven with cylinder seed beads
+			palette = loomPalette
+		}
+		if wordChartFileName == "" && batch {
+			wordChartFileName = batchWordChartFileName
+		} else if wordChartFileName == "" {
+			wordChartFileName = defaultWordChartFileName(inputFileName)
+		}
+	default:
+		logger.Error("Invalid craft", zap.String("craft", craft))
+		return usageError(fmt.Errorf("invalid craft '%s', expected pegboard or loom", craft))
+	}
+
+	switch grid {
+	case gridSquare:
+	case gridOffset:
+		// the shifted rows change their parity if rows are added above them
+		if tile != "" || len(borderDefinitions) > 0 {
+			logger.Error("An offset grid can not be tiled or framed")
+			return usageError(fmt.Errorf("--grid offset can not be used with --tile or --border"))
+		}
+		if htmlRenderer == htmlRendererCanvas {
+			logger.Error("An offset grid can not be drawn by the canvas renderer")
+			return usageError(fmt.Errorf("--grid offset can not be used with --html-renderer canvas"))
+		}
+	default:
+		logger.Error("Invalid grid", zap.String("grid", grid))
+		return usageError(fmt.Errorf("invalid grid '%s', expected square or offset", grid))
+	}
+
+	switch tileMirror {
+	case tileMirrorNone, tileMirrorHorizontal, tileMirrorVertical, tileMirrorBoth:
+	default:
+		logger.Error("Invalid tile mirroring", zap.String("tile-mirror", tileMirror))
+		return usageError(fmt.Errorf("invalid tile mirroring '%s'", tileMirror))
+	}
+
+	if _, ok := locales[language]; !ok {
+		logger.Error("Invalid output language", zap.String("lang", language))
+		return usageError(fmt.Errorf("invalid output language '%s', supported are %s", language, strings.Join(languageNames(), ", ")))
+	}
+
+	if units != unitsMetric && units != unitsImperial {
+		logger.Error("Invalid unit system", zap.String("units", units))
+		return usageError(fmt.Errorf("invalid unit system '%s', expected metric or imperial", units))
+	}
+
+	if stylize != "" && stylize != stylizeComic && stylize != stylizeOil && stylize != stylizeMosaic {
+		logger.Error("Invalid style", zap.String("stylize", stylize))
+		return usageError(fmt.Errorf("invalid style '%s', expected comic, oil or mosaic", stylize))
+	}
+
+	if pdfScale != pdfScaleFit && pdfScale != pdfScaleActual {
+		logger.Error("Invalid PDF scale", zap.String("pdf-scale", pdfScale))
+		return usageError(fmt.Errorf("invalid PDF scale '%s', expected fit or actual", pdfScale))
+	}
+
+	if beadPitch == 0 {
+		var err error
+		if beadPitch, err = beadSizePitch(beadSize); err != nil {
+			logger.Error("Invalid bead size", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	if goldenFileName != "" && (batch || cmd.Flags().Changed("sprite-sheet")) {
+		logger.Error("A golden file belongs to a single pattern")
+		return usageError(fmt.Errorf("--golden can not be used with several inputs or --sprite-sheet"))
+	}
+	if goldenFileName == "" && updateGolden {
+		logger.Error("No golden file given")
+		return usageError(fmt.Errorf("--update-golden needs --golden"))
+	}
+
+	if timeout < 0 {
+		logger.Error("Invalid timeout", zap.Duration("timeout", timeout))
+		return usageError(fmt.Errorf("invalid timeout '%s', expected a positive duration like 30s", timeout))
+	}
+	if resume && checkpointFileName == "" {
+		logger.Error("No checkpoint file given")
+		return usageError(fmt.Errorf("--resume needs --checkpoint"))
+	}
+	if checkpointFileName != "" && sharedPalette { // the colors of a shared palette depend on all inputs
+		logger.Error("A checkpoint can not be used with a shared palette")
+		return usageError(fmt.Errorf("--checkpoint can not be used with --shared-palette"))
+	}
+	if maxInputDimension < 0 || maxInputMegapixels < 0 {
+		logger.Error("Invalid input limit", zap.Int("max-input-dimension", maxInputDimension),
+			zap.Float64("max-input-megapixels", maxInputMegapixels))
+		return usageError(fmt.Errorf("--max-input-dimension and --max-input-megapixels can not be negative"))
+	}
+
+	if watchInterval <= 0 {
+		logger.Error("Invalid watch interval", zap.Duration("watch-interval", watchInterval))
+		return usageError(fmt.Errorf("invalid watch interval '%s', expected a positive duration like 500ms", watchInterval))
+	}
+
+	switch previewInline {
+	case "", inlineAuto, inlineITerm, inlineKitty, inlineSixel:
+	default:
+		logger.Error("Invalid inline preview", zap.String("preview-inline", previewInline))
+		return usageError(fmt.Errorf("invalid inline preview '%s', expected %s", previewInline, strings.Join(inlineNames(), ", ")))
+	}
+
+	colorDistance, ok := registeredColorDistance(distanceName)
+	if !ok {
+		logger.Error("Invalid color distance metric", zap.String("distance", distanceName))
+		return usageError(fmt.Errorf("invalid color distance metric '%s', expected %s", distanceName, strings.Join(colorDistanceNames(), ", ")))
+	}
+
+	if _, ok := cvdTypes[simulateCVD]; simulateCVD != "" && !ok {
+		logger.Error("Invalid color vision deficiency", zap.String("simulate-cvd", simulateCVD))
+		return usageError(fmt.Errorf("invalid color vision deficiency '%s'", simulateCVD))
+	}
+
+	if poster != "" {
+		if _, _, err := posterPaperSize(poster); err != nil {
+			logger.Error("Invalid poster paper size", zap.Error(err))
+			return usageError(err)
+		}
+		if posterOutput == "" && batch {
+			posterOutput = batchPosterFileName
+		} else if posterOutput == "" {
+			posterOutput = posterFileName(inputFileName)
+		}
+	}
+
+	if err := registerExternalRenderers(rendererExecs, rendererPlugins); err != nil {
+		logger.Error("Registering renderers failed", zap.Error(err))
+		return usageError(err)
+	}
+
+	m := newBeadMachine(logger)
+	m.inputFileName = inputFileName
+	m.inputFileNames = inputFileNames
+	m.composition = composition
+	m.sharedPalette = sharedPalette
+	m.galleryFileName = galleryFileName
+	m.notifyWebhook = notifyWebhook
+	m.fromClipboard = fromClipboard
+	m.toClipboard = toClipboard
+	m.previewTerminal = previewTerminal
+	m.previewColumns = previewColumns
+	m.previewInline = previewInline
+	m.watch = watch
+	m.watchInterval = watchInterval
+	m.pdfPage = pdfPage
+	m.pdfDPI = pdfDPI
+	m.ignoreExif = ignoreExif
+	m.maxInputDimension = maxInputDimension
+	m.maxInputMegapixels = maxInputMegapixels
+	m.checkpointFileName = checkpointFileName
+	m.resume = resume
+	if target := traceTarget(traceFlag); target != "" && !watch { // the conversions of a watch are not traced
+		m.tracer = newTracer(target)
+	}
+	m.spriteSheet = spriteSheet
+	m.spriteColumns = spriteColumns
+	m.spriteRows = spriteRows
+	m.outputFileName = outputFileName
+	m.palette = palette
+	m.comparisonPalettes = comparisonPalettes
+	m.previewWidths = previewWidths
+	m.outDir = outDir
+	m.nameTemplate = nameTemplate
+	m.beadPrices = beadPrices
+	m.htmlFileName = htmlFileName
+	m.htmlTemplate = htmlTemplate
+	m.htmlRenderer = htmlRenderer
+	m.language = language
+	m.units = units
+	m.beadPitch = beadPitch
+	m.gamutFileName = gamutFileName
+	m.errorMapFileName = errorMapFileName
+	m.statsFileName = statsFileName
+	m.patternFileName = patternFileName
+	m.instructionsFileName = instructionsFileName
+	m.serpentine = serpentine
+	m.wordChartFileName = wordChartFileName
+	m.placementFileName = placementFileName
+	m.embedFileName = embedFileName
+	m.pdfFileName = pdfFileName
+	m.pdfScale = pdfScale
+	m.colorByNumberFileName = colorByNumberFileName
+	m.printActualSize = printActualSize
+	m.regionsFileName = regionsFileName
+	m.printDPI = printDPI
+	m.tilesDirectory = tilesDirectory
+	m.layersDirectory = layersDirectory
+	m.bundleFileName = bundleFileName
+	m.signingKey = signingKey
+	m.posterFileName = posterOutput
+	if poster != "" {
+		m.posterPaper = poster
+	}
+	m.renderOutputs = renderOutputs
+	m.projectDBFileName = projectDBFileName
+	m.deductInventory = deductInventory
+
+	m.boardDimension = boardDimension
+	m.width = width
+	m.boardsWidth = newWidthBoards
+	m.height = height
+	m.boardsHeight = newHeightBoards
+	m.fit = fit
+	m.resample = resample
+	m.autoOrient = autoOrient
+	m.optimizeSeams = optimizeSeams
+	m.seamMargin = seamMargin
+	m.padToBoards = padToBoards
+	m.padAlign = padAlign
+	m.grid = grid
+	m.tile = tile
+	m.tileColumns = tileColumns
+	m.tileRows = tileRows
+	m.tileMirror = tileMirror
+	m.maxBeads = maxBeads
+	m.strict = strict
+	m.report = collector
+	m.goldenFileName = goldenFileName
+	m.goldenTolerance = goldenTolerance
+	m.updateGolden = updateGolden
+	m.border = borderDefinitions
+	m.borders = borders
+	m.fill = fill
+	m.backgroundFill = backgroundFill
+
+	m.beadStyle = beadStyle
+	m.coordinates = coordinates
+	m.coordinatesInterval = coordinatesInterval
+	m.chartCellSize = chartCellSize
+	m.colorblindSafe = colorblindSafe
+	m.simulateCVD = simulateCVD
+	m.noColorMatching = noColorMatching
+	m.greyScale = greyScale
+	m.autoLevels = autoLevels
+	m.autoContrast = autoContrast
+	m.blackPoint = blackPoint
+	m.whitePoint = whitePoint
+	m.hueShift = hueShift
+	m.temperature = temperature
+	m.tint = tint
+	m.adjust = adjust
+	m.adjustments = adjustments
+	m.translucent = useTranslucent
+	m.flourescent = useFlourescent
+	m.colors = colors
+	m.maxColors = maxColors
+	m.preserveFaces = preserveFaces
+	m.adaptiveDither = adaptiveDither
+	m.autoTune = autoTune
+	m.tuneIterations = tuneIterations
+	m.mergeDuplicates = mergeDuplicates
+	m.substitutions = substitutions
+	m.duplicateThreshold = duplicateThreshold
+
+	m.blur = filterBlur
+	m.sharpen = filterSharpen
+	m.gamma = filterGamma
+	m.contrast = filterContrast
+	m.brightness = filterBrightness
+	m.stylize = stylize
+	m.subjectFocus = subjectFocus
+
+	m.colorDistance = colorDistance
+	m.distanceName = distanceName
+	m.gamutThreshold = gamutThreshold
+	m.gamutWarnings = cmd.Flags().Changed("gamut-threshold")
+	m.colorCacheSize = cacheSize
+	m.colorCache = newColorCache(cacheSize)
+	m.cachePrecision = cachePrecision
+
+	ctx, cancel := interruptContext(timeout)
+	defer cancel()
+	m.ctx = ctx
+
+	if err := m.process(); err != nil {
+		return err
+	}
+	if strict {
+		if err := warnings.strictError(); err != nil {
+			logger.Error("Warnings logged in strict mode", zap.Error(err))
+			return err
+		}
+	}
+	return nil
 }
 
 func logger(cmd *cobra.Command) *zap.Logger {
@@ -0,0 +1,70 @@
+package beadmachine
+
+import (
+	"image"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// reduceColors restricts the patterns to the bead colors that are used most across all patterns and matches
+// the images again to them. If faces are preserved, the pixels of detected faces count more so that their
+// colors are kept.
+func (m *beadMachine) reduceColors(inputImages []image.Image, patterns []*Pattern) ([]*Pattern, error) {
+	weights := make(map[string]float64)
+	for i, inputImage := range inputImages {
+		var mask []bool
+		if m.preserveFaces {
+			faces := detectFaces(inputImage)
+			for _, face := range faces {
+				m.logger.Info("Face region detected",
+					zap.Int("x", face.Min.X), zap.Int("y", face.Min.Y),
+					zap.Int("width", face.Dx()), zap.Int("height", face.Dy()))
+			}
+			mask = faceMask(inputImage, faces)
+		}
+
+		for j, cell := range patterns[i].Cells {
+			if cell.Empty() {
+				continue
+			}
+			if mask != nil && mask[j] {
+				weights[cell.Bead] += faceColorWeight
+			} else {
+				weights[cell.Bead]++
+			}
+		}
+	}
+	if len(weights) <= m.maxColors {
+		return patterns, nil
+	}
+
+	beads := make([]string, 0, len(weights))
+	for bead := range weights {
+		beads = append(beads, bead)
+	}
+	sort.Slice(beads, func(i, j int) bool {
+		if weights[beads[i]] != weights[beads[j]] {
+			return weights[beads[i]] > weights[beads[j]]
+		}
+		return beads[i] < beads[j]
+	})
+
+	colors := m.colors
+	defer func() {
+		m.colors = colors
+		m.colorCache = newColorCache(m.colorCacheSize) // matches depend on the palette
+	}()
+	m.colors = beads[:m.maxColors]
+	m.colorCache = newColorCache(m.colorCacheSize)
+
+	reduced := make([]*Pattern, len(inputImages))
+	for i, inputImage := range inputImages {
+		var err error
+		if reduced[i], err = m.matchPattern(inputImage); err != nil {
+			return nil, err
+		}
+	}
+	m.logger.Info("Bead colors reduced", zap.Int("colors", len(beads)), zap.Int("max colors", m.maxColors))
+	return reduced, nil
+}
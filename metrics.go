@@ -0,0 +1,150 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metricsDurationBuckets are the upper bounds in seconds of the buckets of the conversion duration histogram
+var metricsDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// serverMetrics are the counters of the server that are exposed in the Prometheus text format at /metrics
+type serverMetrics struct {
+	lock        sync.Mutex
+	submitted   uint64
+	rejected    map[string]uint64 // submissions by the reason of their rejection
+	conversions map[string]uint64 // finished jobs by status
+	errors      map[int]uint64    // failed jobs by exit code
+
+	durationBuckets []uint64 // conversions per bucket of metricsDurationBuckets, not cumulative
+	durationSum     float64
+	durationCount   uint64
+
+	cache colorCacheStats // color cache lookups of all jobs
+}
+
+// newServerMetrics returns empty server metrics
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		rejected:        make(map[string]uint64),
+		conversions:     make(map[string]uint64),
+		errors:          make(map[int]uint64),
+		durationBuckets: make([]uint64, len(metricsDurationBuckets)+1),
+	}
+}
+
+// jobSubmitted counts a submitted job
+func (s *serverMetrics) jobSubmitted() {
+	s.lock.Lock()
+	s.submitted++
+	s.lock.Unlock()
+}
+
+// jobRejected counts a submission that was rejected for the reason
+func (s *serverMetrics) jobRejected(reason string) {
+	s.lock.Lock()
+	s.rejected[reason]++
+	s.lock.Unlock()
+}
+
+// jobFinished counts a finished job with its duration and the color cache lookups of its conversion
+func (s *serverMetrics) jobFinished(result pipelineResult, duration time.Duration) {
+	var stats struct {
+		ColorCache *colorCacheStats `json:"colorCache"`
+	}
+	if len(result.Stats) > 0 {
+		_ = json.Unmarshal(result.Stats, &stats)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.conversions[result.Status]++
+	if result.Status != jobSucceeded {
+		s.errors[result.ExitCode]++
+	}
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(metricsDurationBuckets, seconds)
+	s.durationBuckets[bucket]++
+	s.durationSum += seconds
+	s.durationCount++
+	if stats.ColorCache != nil {
+		s.cache.Hits += stats.ColorCache.Hits
+		s.cache.Shared += stats.ColorCache.Shared
+		s.cache.Computed += stats.ColorCache.Computed
+	}
+}
+
+// serveMetrics responds with the metrics and the current queue length in the Prometheus text format
+func (q *jobQueue) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	q.lock.Lock()
+	queued, running := len(q.queued), 0
+	for _, job := range q.jobs {
+		if job.Status == jobRunning {
+			running++
+		}
+	}
+	q.lock.Unlock()
+
+	s := q.metrics
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("beadmachine_jobs_submitted_total", "counter", "Jobs that were submitted to the queue.")
+	fmt.Fprintf(out, "beadmachine_jobs_submitted_total %d\n", s.submitted)
+	metric("beadmachine_jobs_rejected_total", "counter", "Submissions that were rejected by reason.")
+	for _, reason := range []string{"invalid", "queue_full", "rate_limit", "too_large"} {
+		fmt.Fprintf(out, "beadmachine_jobs_rejected_total{reason=%q} %d\n", reason, s.rejected[reason])
+	}
+	metric("beadmachine_jobs_queued", "gauge", "Jobs that wait for a worker.")
+	fmt.Fprintf(out, "beadmachine_jobs_queued %d\n", queued)
+	metric("beadmachine_jobs_running", "gauge", "Jobs that are converted right now.")
+	fmt.Fprintf(out, "beadmachine_jobs_running %d\n", running)
+
+	metric("beadmachine_conversions_total", "counter", "Finished conversions by status.")
+	for _, status := range []string{jobSucceeded, jobFailed} {
+		fmt.Fprintf(out, "beadmachine_conversions_total{status=%q} %d\n", status, s.conversions[status])
+	}
+	metric("beadmachine_conversion_errors_total", "counter", "Failed conversions by exit code.")
+	codes := make([]int, 0, len(s.errors))
+	for code := range s.errors {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(out, "beadmachine_conversion_errors_total{exit_code=\"%d\"} %d\n", code, s.errors[code])
+	}
+
+	metric("beadmachine_conversion_duration_seconds", "histogram", "Duration of the conversions of the jobs.")
+	var cumulative uint64
+	for i, bound := range metricsDurationBuckets {
+		cumulative += s.durationBuckets[i]
+		fmt.Fprintf(out, "beadmachine_conversion_duration_seconds_bucket{le=%q} %d\n",
+			strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(out, "beadmachine_conversion_duration_seconds_bucket{le=\"+Inf\"} %d\n", s.durationCount)
+	fmt.Fprintf(out, "beadmachine_conversion_duration_seconds_sum %s\n", strconv.FormatFloat(s.durationSum, 'f', -1, 64))
+	fmt.Fprintf(out, "beadmachine_conversion_duration_seconds_count %d\n", s.durationCount)
+
+	metric("beadmachine_color_cache_lookups_total", "counter", "Color cache lookups of the conversions by result.")
+	fmt.Fprintf(out, "beadmachine_color_cache_lookups_total{result=\"hit\"} %d\n", s.cache.Hits)
+	fmt.Fprintf(out, "beadmachine_color_cache_lookups_total{result=\"shared\"} %d\n", s.cache.Shared)
+	fmt.Fprintf(out, "beadmachine_color_cache_lookups_total{result=\"computed\"} %d\n", s.cache.Computed)
+	metric("beadmachine_color_cache_hit_ratio", "gauge", "Share of the color cache lookups that did not need a color match.")
+	ratio := 0.0
+	if lookups := s.cache.Hits + s.cache.Shared + s.cache.Computed; lookups > 0 {
+		ratio = float64(s.cache.Hits+s.cache.Shared) / float64(lookups)
+	}
+	fmt.Fprintf(out, "beadmachine_color_cache_hit_ratio %s\n", strconv.FormatFloat(ratio, 'f', -1, 64))
+	_ = out.Flush()
+}
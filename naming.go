@@ -0,0 +1,105 @@
+package beadmachine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// outputNameData is the data that the --name-template of the output filenames is executed with
+type outputNameData struct {
+	Stem    string // input filename without directory and extension, with the frame number for sprite sheets
+	Name    string // output filename without directory and extension
+	Format  string // output format like png or stats
+	Palette string // palette name like hama
+	Width   int    // pattern size in beads
+	Height  int
+}
+
+// parseNameTemplate parses a filename template like {{.Stem}}_{{.Width}}w_{{.Palette}}, unknown fields are
+// reported right away instead of after the conversion
+func parseNameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing name template")
+	}
+	var b strings.Builder
+	if err = tmpl.Execute(&b, outputNameData{}); err != nil {
+		return nil, errors.Wrap(err, "executing name template")
+	}
+	return tmpl, nil
+}
+
+// outputPath returns the filename of an output of the pattern. The name template replaces the filename without
+// the extension and the output directory replaces the directory of the filename, both keep the naming of batch
+// inputs and sprite sheet frames apart.
+func (m *beadMachine) outputPath(o output, pattern *Pattern) (string, error) {
+	fileName := m.outputName(o.fileName)
+	if m.outDir == "" && m.nameTemplate == nil {
+		return fileName, nil
+	}
+
+	dir, base := splitOutputPath(fileName)
+	if m.outDir != "" {
+		dir = m.outDir
+	}
+	if m.nameTemplate != nil {
+		extension := filepath.Ext(base)
+		if o.writeDirectory != nil { // directory outputs have no extension
+			extension = ""
+		}
+		stem := strings.TrimSuffix(filepath.Base(m.inputFileName), filepath.Ext(m.inputFileName))
+		palette, _ := comparisonPalette(m.palette)
+		data := outputNameData{
+			Stem:    stem + m.frameSuffix,
+			Name:    strings.TrimSuffix(base, extension),
+			Format:  o.format,
+			Palette: palette,
+		}
+		if pattern != nil {
+			data.Width, data.Height = pattern.Width, pattern.Height
+		}
+		var b strings.Builder
+		if err := m.nameTemplate.Execute(&b, data); err != nil {
+			return "", errors.Wrap(err, "executing name template")
+		}
+		if b.Len() == 0 {
+			return "", fmt.Errorf("the name template gives an empty filename for the %s output", o.format)
+		}
+		base = b.String() + extension
+	}
+
+	fileName = joinOutputPath(dir, base)
+	if _, _, remote := remoteOutput(fileName); remote {
+		return fileName, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return "", errors.Wrap(err, "creating output directory")
+	}
+	return fileName, nil
+}
+
+// outputPaths sets the filenames of the outputs of the pattern, outputs that would overwrite each other are
+// reported as error
+func (m *beadMachine) outputPaths(outputs []output, pattern *Pattern) error {
+	formats := make(map[string]string, len(outputs))
+	for i := range outputs {
+		fileName, err := m.outputPath(outputs[i], pattern)
+		if err != nil {
+			return err
+		}
+		if _, _, remote := remoteOutput(fileName); remote && outputs[i].writeDirectory != nil {
+			return fmt.Errorf("the %s output is a directory and can not be uploaded to '%s'", outputs[i].format, fileName)
+		}
+		if format, ok := formats[fileName]; ok {
+			return fmt.Errorf("the %s and %s outputs have the same filename '%s'", format, outputs[i].format, fileName)
+		}
+		formats[fileName] = outputs[i].format
+		outputs[i].fileName = fileName
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package beadmachine
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// orientation is a rotation and mirroring of the input image that is tried by the automatic orientation
+type orientation struct {
+	name      string
+	transform func(image.Image) *image.NRGBA
+}
+
+// orientations contains the orientations that are tried by the automatic orientation, on equal results the
+// first one wins so that the image is only changed if it helps
+var orientations = []orientation{
+	{"original", imaging.Clone},
+	{"rotated 90", imaging.Rotate90},
+	{"mirrored", imaging.FlipH},
+	{"rotated 90 and mirrored", func(img image.Image) *image.NRGBA { return imaging.FlipH(imaging.Rotate90(img)) }},
+}
+
+// orientImage rotates and mirrors the image into the orientation that needs the fewest boards. On equal boards
+// the orientation with the fewest unused board cells and then with the least detail at the board seams wins.
+func (m *beadMachine) orientImage(inputImage image.Image) image.Image {
+	newWidth, newHeight := m.targetSize()
+	var best image.Image
+	var bestName string
+	var bestBoards, bestUnused int
+	var bestSeams float64
+
+	for i, o := range orientations {
+		img := image.Image(o.transform(inputImage))
+		resized := img
+		if newWidth > 0 || newHeight > 0 {
+			resized = m.resizeImage(img, newWidth, newHeight)
+		}
+		bounds := resized.Bounds()
+		boardsX, boardsY := boardsNeeded(bounds.Dx(), m.boardDimension), boardsNeeded(bounds.Dy(), m.boardDimension)
+		boards := boardsX * boardsY
+		unused := boards*m.boardDimension*m.boardDimension - bounds.Dx()*bounds.Dy()
+		columns, rows := imageDetail(resized)
+		seams := seamCost(columns, m.boardDimension, 0) + seamCost(rows, m.boardDimension, 0)
+		m.logger.Debug("Orientation tried",
+			zap.String("orientation", o.name),
+			zap.Int("boards", boards),
+			zap.Int("unused cells", unused),
+			zap.Float64("seam detail", seams))
+
+		if i == 0 || boards < bestBoards ||
+			(boards == bestBoards && (unused < bestUnused || (unused == bestUnused && seams < bestSeams))) {
+			best, bestName, bestBoards, bestUnused, bestSeams = img, o.name, boards, unused, seams
+		}
+	}
+
+	m.logger.Info("Orientation selected", zap.String("orientation", bestName), zap.Int("boards", bestBoards),
+		zap.Int("unused cells", bestUnused))
+	return best
+}
@@ -0,0 +1,294 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// output is an output file that gets rendered from a pattern, directory outputs consist of
+// multiple files and are written by their writeDirectory function instead of a renderer
+type output struct {
+	format         string
+	fileName       string
+	renderer       Renderer
+	writeDirectory func(dir string, pattern *Pattern) error
+}
+
+// outputStatus is the result of writing an output, the stats JSON and the report list them so that the failed
+// outputs of a run can be told apart from the written ones
+type outputStatus struct {
+	Input  string `json:"input,omitempty"` // the input file of a batch, only set in the report
+	Format string `json:"format"`
+	File   string `json:"file"`
+	Status string `json:"status"` // written or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// builtinRenderers returns the renderers of all built-in output formats
+func (m *beadMachine) builtinRenderers() map[string]Renderer {
+	renderers := map[string]Renderer{
+		"png":      RendererFunc(m.renderPatternImage),
+		"html":     RendererFunc(m.renderHTML),
+		"json":     RendererFunc(renderPatternJSON),
+		"stats":    RendererFunc(m.renderStats),
+		"gamutmap": RendererFunc(m.renderGamutMap),
+		"errormap": RendererFunc(m.renderErrorMap),
+
+		"instructions":    RendererFunc(m.renderInstructions),
+		"instructionspdf": RendererFunc(m.renderInstructionsPDF),
+		"wordchart":       RendererFunc(m.renderWordChart),
+		"poster":          RendererFunc(m.renderPoster),
+		"pdf":             RendererFunc(m.renderPatternPDF),
+		"colorbynumber":   RendererFunc(m.renderColorByNumber),
+		"printpng":        RendererFunc(m.renderPrintImage),
+		"regionssvg":      RendererFunc(m.renderRegionsSVG),
+		"regionsgeojson":  RendererFunc(m.renderRegionsGeoJSON),
+		"placementhtml":   RendererFunc(m.renderPlacementHTML),
+		"canvashtml":      RendererFunc(m.renderCanvasHTML),
+		"embedjs":         RendererFunc(m.renderEmbedJS),
+		"bundle":          RendererFunc(m.renderBundle),
+	}
+	for _, cvd := range cvdTypeNames() {
+		renderers["cvd-"+cvd] = m.cvdPreviewRenderer(cvd)
+	}
+	if m.htmlTemplate != nil { // a custom template replaces the built-in HTML layout
+		renderers["html"] = RendererFunc(m.renderHTMLTemplate)
+	}
+	if m.htmlRenderer == htmlRendererCanvas {
+		renderers["html"] = renderers["canvashtml"]
+	}
+	return renderers
+}
+
+// renderer returns the renderer for the given output format name, built-in renderers
+// take precedence over registered ones
+func (m *beadMachine) renderer(format string) (Renderer, error) {
+	if renderer, ok := m.builtinRenderers()[format]; ok {
+		return renderer, nil
+	}
+	if renderer, ok := registeredRenderer(format); ok {
+		return renderer, nil
+	}
+	return nil, fmt.Errorf("unknown output format '%s'", format)
+}
+
+// outputs returns all outputs of the pattern that were requested
+func (m *beadMachine) outputs(pattern *Pattern) ([]output, error) {
+	imageFormat := "png"
+	if m.printActualSize {
+		imageFormat = "printpng"
+	}
+	requested := []output{
+		{format: imageFormat, fileName: m.outputFileName},
+		{format: "html", fileName: m.htmlFileName},
+		{format: "json", fileName: m.patternFileName},
+		{format: "stats", fileName: m.statsFileName},
+		{format: "gamutmap", fileName: m.gamutFileName},
+		{format: "errormap", fileName: m.errorMapFileName},
+		{format: instructionsFormat(m.instructionsFileName), fileName: m.instructionsFileName},
+		{format: "wordchart", fileName: m.wordChartFileName},
+		{format: "poster", fileName: m.posterFileName},
+		{format: "pdf", fileName: m.pdfFileName},
+		{format: "colorbynumber", fileName: m.colorByNumberFileName},
+		{format: regionsFormat(m.regionsFileName), fileName: m.regionsFileName},
+		{format: "placementhtml", fileName: m.placementFileName},
+		{format: "embedjs", fileName: m.embedFileName},
+		{format: "bundle", fileName: m.bundleFileName},
+	}
+	if m.colorblindSafe {
+		for _, cvd := range cvdTypeNames() {
+			requested = append(requested, output{format: "cvd-" + cvd, fileName: m.variantFileName(cvd)})
+		}
+	} else if m.simulateCVD != "" {
+		requested = append(requested, output{format: "cvd-" + m.simulateCVD, fileName: m.variantFileName(m.simulateCVD)})
+	}
+	for _, definition := range m.renderOutputs {
+		format, fileName, err := splitDefinition(definition)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing render output")
+		}
+		requested = append(requested, output{format: format, fileName: fileName})
+	}
+
+	var outputs []output
+	for _, o := range requested {
+		if o.fileName == "" {
+			continue
+		}
+		renderer, err := m.renderer(o.format)
+		if err != nil {
+			return nil, err
+		}
+		o.renderer = renderer
+		outputs = append(outputs, o)
+	}
+	if m.tilesDirectory != "" {
+		outputs = append(outputs, output{format: "tiles", fileName: m.tilesDirectory, writeDirectory: m.writeTiles})
+	}
+	if m.layersDirectory != "" {
+		outputs = append(outputs, output{format: "layers", fileName: m.layersDirectory, writeDirectory: m.writeLayers})
+	}
+	if err := m.outputPaths(outputs, pattern); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// writeOutputs renders all requested outputs concurrently from the pattern, a failing output does not
+// stop the other outputs from being written. The stats are rendered last, so that they contain the status of
+// the other outputs.
+func (m *beadMachine) writeOutputs(pattern *Pattern) error {
+	if err := m.cancelled(); err != nil {
+		m.logger.Error("Conversion cancelled before writing the outputs", zap.Error(err))
+		m.writePartialStats(pattern)
+		return err
+	}
+	outputs, err := m.outputs(pattern)
+	if err != nil {
+		m.logger.Error("Preparing outputs failed", zap.Error(err))
+		return usageError(err)
+	}
+	outputErrors := make([]error, len(outputs))
+	span := m.startSpan("render")
+	span.set("outputs", len(outputs))
+
+	var patternOutputs, statsOutputs []int
+	for i, o := range outputs {
+		if o.format == "stats" {
+			statsOutputs = append(statsOutputs, i)
+		} else {
+			patternOutputs = append(patternOutputs, i)
+		}
+	}
+	m.outputStatuses = nil
+	m.writeOutputGroup(outputs, patternOutputs, pattern, span, outputErrors)
+	for _, i := range patternOutputs {
+		m.outputStatuses = append(m.outputStatuses, newOutputStatus(outputs[i], outputErrors[i]))
+	}
+	m.writeOutputGroup(outputs, statsOutputs, pattern, span, outputErrors)
+	if m.galleryFileName != "" || m.notifyWebhook != "" {
+		m.addGalleryEntry(pattern, outputs)
+	}
+
+	failed := 0
+	statuses := make([]outputStatus, len(outputs))
+	for i, err := range outputErrors {
+		statuses[i] = newOutputStatus(outputs[i], err)
+		if err != nil {
+			m.logger.Error("Writing output failed",
+				zap.String("format", outputs[i].format),
+				zap.String("file", outputs[i].fileName),
+				zap.Error(err))
+			failed++
+		}
+	}
+	if m.report != nil {
+		m.report.addOutputs(statuses)
+	}
+	if failed > 0 {
+		err = outputError(fmt.Errorf("%d of %d outputs failed", failed, len(outputs)))
+	}
+	span.finish(err)
+	return err
+}
+
+// writeOutputGroup writes the outputs of the indices concurrently and sets their errors, a renderer that panics
+// fails only its own output
+func (m *beadMachine) writeOutputGroup(outputs []output, indices []int, pattern *Pattern, span *traceSpan, outputErrors []error) {
+	var outputWaitGroup sync.WaitGroup
+	outputWaitGroup.Add(len(indices))
+	for _, i := range indices {
+		go func(i int) {
+			defer outputWaitGroup.Done()
+			outputSpan := m.tracer.start("render "+outputs[i].format, span)
+			outputSpan.set("file", outputs[i].fileName)
+			outputErrors[i] = writeOutput(outputs[i], pattern)
+			outputSpan.finish(outputErrors[i])
+		}(i)
+	}
+	outputWaitGroup.Wait()
+}
+
+// newOutputStatus returns the status of the output that was written with the given error
+func newOutputStatus(o output, err error) outputStatus {
+	status := outputStatus{Format: o.format, File: o.fileName, Status: "written"}
+	if err != nil {
+		status.Status, status.Error = "failed", err.Error()
+	}
+	return status
+}
+
+// writeOutput renders the pattern into the output file or directory, or uploads it to an object storage. The
+// file of a failed or panicking render is removed, so that no truncated output is left behind.
+func writeOutput(o output, pattern *Pattern) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = renderPanicError(o, r)
+		}
+	}()
+	if o.writeDirectory != nil {
+		return o.writeDirectory(o.fileName, pattern)
+	}
+	if upload, location, ok := remoteOutput(o.fileName); ok {
+		return uploadOutput(o, pattern, upload, location)
+	}
+
+	outputFile, err := os.Create(o.fileName)
+	if err != nil {
+		return errors.Wrap(err, "creating output file")
+	}
+	info, statErr := outputFile.Stat() // before the render, a failed close would fail the stat as well
+	closed := false
+	defer func() {
+		if r := recover(); r != nil { // recovered here, so that the file of the panicking render is removed
+			err = renderPanicError(o, r)
+		}
+		if !closed {
+			_ = outputFile.Close()
+		}
+		if err != nil && statErr == nil && info.Mode().IsRegular() { // not devices like /dev/stdout
+			_ = os.Remove(o.fileName)
+		}
+	}()
+
+	w := bufio.NewWriter(outputFile)
+	if err = o.renderer.Render(pattern, w); err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return errors.Wrap(err, "writing output file")
+	}
+	closed = true
+	return errors.Wrap(outputFile.Close(), "closing output file")
+}
+
+// renderPanicError returns the error of a renderer that panicked
+func renderPanicError(o output, r interface{}) error {
+	return fmt.Errorf("rendering the %s output panicked: %v", o.format, r)
+}
+
+// renderStats renders the pattern statistics as JSON
+func (m *beadMachine) renderStats(pattern *Pattern, w io.Writer) error {
+	stats := m.PatternStats(pattern)
+	stats.Outputs = m.outputStatuses
+	return writeStats(stats, w)
+}
+
+// writeStats writes the statistics as JSON
+func writeStats(stats PatternStats, w io.Writer) error {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling stats")
+	}
+
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return errors.Wrap(err, "writing stats")
+}
@@ -0,0 +1,168 @@
+package beadmachine
+
+//go:generate go run palettes_generate.go
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jkl1337/go-chromath"
+	"github.com/jkl1337/go-chromath/deltae"
+	"github.com/pkg/errors"
+)
+
+// PaletteProvider provides the beads of a palette
+type PaletteProvider interface {
+	Palette() (map[string]BeadConfig, error)
+}
+
+// PaletteProviderFunc is an adapter to allow the use of ordinary functions as palette providers
+type PaletteProviderFunc func() (map[string]BeadConfig, error)
+
+// Palette calls f()
+func (f PaletteProviderFunc) Palette() (map[string]BeadConfig, error) {
+	return f()
+}
+
+// PaletteOpener returns a palette provider for the location part of a palette URI
+type PaletteOpener func(location string) (PaletteProvider, error)
+
+var (
+	paletteOpeners     = make(map[string]PaletteOpener)
+	paletteOpenersLock sync.RWMutex
+)
+
+func init() {
+	RegisterPaletteProvider("file", openFilePalette)
+	RegisterPaletteProvider("embedded", openEmbeddedPalette)
+	RegisterPaletteProvider("http", openHTTPPalette("http:"))
+	RegisterPaletteProvider("https", openHTTPPalette("https:"))
+}
+
+// RegisterPaletteProvider registers a palette opener for the given URI scheme, an already
+// registered opener for the same scheme gets replaced
+func RegisterPaletteProvider(scheme string, opener PaletteOpener) {
+	paletteOpenersLock.Lock()
+	paletteOpeners[scheme] = opener
+	paletteOpenersLock.Unlock()
+}
+
+// openPalette returns the palette provider for a palette URI in the format scheme:location,
+// locations without a registered scheme are handled as JSON file name
+func openPalette(uri string) (PaletteProvider, error) {
+	scheme, location := "file", uri
+	if parts := strings.SplitN(uri, ":", 2); len(parts) == 2 {
+		paletteOpenersLock.RLock()
+		_, ok := paletteOpeners[parts[0]]
+		paletteOpenersLock.RUnlock()
+		if ok {
+			scheme, location = parts[0], parts[1]
+		}
+	}
+
+	paletteOpenersLock.RLock()
+	opener := paletteOpeners[scheme]
+	paletteOpenersLock.RUnlock()
+	return opener(location)
+}
+
+// parsePaletteJSON parses the JSON data of a palette
+func parsePaletteJSON(data []byte) (map[string]BeadConfig, error) {
+	cfg := make(map[string]BeadConfig)
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling palette")
+	}
+	return cfg, nil
+}
+
+// openFilePalette returns a provider for a palette JSON file
+func openFilePalette(fileName string) (PaletteProvider, error) {
+	return PaletteProviderFunc(func() (map[string]BeadConfig, error) {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening palette file")
+		}
+		return parsePaletteJSON(data)
+	}), nil
+}
+
+// openEmbeddedPalette returns a provider for a palette that is shipped with beadmachine
+func openEmbeddedPalette(name string) (PaletteProvider, error) {
+	data, ok := embeddedPalettes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown embedded palette '%s', available: %s",
+			name, strings.Join(embeddedPaletteNames(), ", "))
+	}
+	return PaletteProviderFunc(func() (map[string]BeadConfig, error) {
+		return parsePaletteJSON([]byte(data))
+	}), nil
+}
+
+// embeddedPaletteNames returns the sorted names of all embedded palettes
+func embeddedPaletteNames() []string {
+	names := make([]string, 0, len(embeddedPalettes))
+	for name := range embeddedPalettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openHTTPPalette returns an opener for palette JSON files that are served by a HTTP endpoint
+func openHTTPPalette(scheme string) PaletteOpener {
+	return func(location string) (PaletteProvider, error) {
+		url := scheme + location
+		return PaletteProviderFunc(func() (map[string]BeadConfig, error) {
+			client := http.Client{Timeout: 30 * time.Second}
+			resp, err := client.Get(url)
+			if err != nil {
+				return nil, errors.Wrap(err, "downloading palette")
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("downloading palette returned status %s", resp.Status)
+			}
+			data, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return nil, errors.Wrap(err, "reading palette")
+			}
+			return parsePaletteJSON(data)
+		}), nil
+	}
+}
+
+// beadDuplicate is a bead whose color is identical or nearly identical to the color of another bead
+type beadDuplicate struct {
+	bead      string
+	duplicate string
+	distance  float64
+}
+
+// findDuplicateBeads returns all beads whose color distance to a previous bead of the sorted names is
+// below the threshold, a threshold of 0 only finds identical colors
+func findDuplicateBeads(beadNames []string, beadLabs map[string]chromath.Lab, threshold float64) []beadDuplicate {
+	var duplicates []beadDuplicate
+	var unique []string
+	for _, beadName := range beadNames {
+		duplicate := false
+		for _, previous := range unique {
+			distance := deltae.CIE2000(beadLabs[previous], beadLabs[beadName], &deltae.KLChDefault)
+			if distance <= threshold {
+				duplicates = append(duplicates, beadDuplicate{bead: previous, duplicate: beadName, distance: distance})
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, beadName)
+		}
+	}
+	return duplicates
+}
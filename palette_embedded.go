@@ -0,0 +1,522 @@
+// Code generated by palettes_generate.go; DO NOT EDIT.
+
+package beadmachine
+
+// embeddedPalettes contains the JSON data of all palettes that are shipped with beadmachine
+var embeddedPalettes = map[string]string{
+	"delica": `{
+  "DB-0001 Gunmetal": {
+    "r": 62,
+    "g": 64,
+    "b": 70,
+    "GreyShade": true
+  },
+  "DB-0010 Black": {
+    "r": 22,
+    "g": 22,
+    "b": 24,
+    "GreyShade": true
+  },
+  "DB-0031 24kt Gold Plated": {
+    "r": 196,
+    "g": 160,
+    "b": 74
+  },
+  "DB-0035 Galvanized Silver": {
+    "r": 178,
+    "g": 180,
+    "b": 183,
+    "GreyShade": true
+  },
+  "DB-0041 Silver Lined Crystal": {
+    "r": 214,
+    "g": 217,
+    "b": 221,
+    "GreyShade": true,
+    "Translucent": true
+  },
+  "DB-0043 Silver Lined Flame Red": {
+    "r": 196,
+    "g": 32,
+    "b": 38,
+    "Translucent": true
+  },
+  "DB-0200 Opaque White": {
+    "r": 245,
+    "g": 245,
+    "b": 241,
+    "GreyShade": true
+  },
+  "DB-0201 White Pearl Ceylon": {
+    "r": 238,
+    "g": 234,
+    "b": 224
+  },
+  "DB-0203 Cream Ceylon": {
+    "r": 236,
+    "g": 223,
+    "b": 189
+  },
+  "DB-0310 Matte Black": {
+    "r": 36,
+    "g": 36,
+    "b": 37,
+    "GreyShade": true
+  },
+  "DB-0351 Matte Opaque White": {
+    "r": 238,
+    "g": 238,
+    "b": 234,
+    "GreyShade": true
+  },
+  "DB-0651 Opaque Squash": {
+    "r": 234,
+    "g": 168,
+    "b": 42
+  },
+  "DB-0653 Opaque Pumpkin": {
+    "r": 224,
+    "g": 108,
+    "b": 32
+  },
+  "DB-0658 Opaque Turquoise": {
+    "r": 62,
+    "g": 172,
+    "b": 168
+  },
+  "DB-0721 Opaque Yellow": {
+    "r": 246,
+    "g": 204,
+    "b": 26
+  },
+  "DB-0722 Opaque Orange": {
+    "r": 238,
+    "g": 120,
+    "b": 28
+  },
+  "DB-0723 Opaque Red": {
+    "r": 186,
+    "g": 28,
+    "b": 34
+  },
+  "DB-0724 Opaque Green": {
+    "r": 28,
+    "g": 122,
+    "b": 66
+  },
+  "DB-0726 Opaque Cobalt": {
+    "r": 32,
+    "g": 72,
+    "b": 158
+  },
+  "DB-0727 Opaque Vermillion Red": {
+    "r": 214,
+    "g": 44,
+    "b": 36
+  },
+  "DB-0734 Opaque Chocolate Brown": {
+    "r": 84,
+    "g": 46,
+    "b": 30
+  },
+  "DB-1132 Opaque Canary": {
+    "r": 246,
+    "g": 222,
+    "b": 84
+  },
+  "DB-1490 Opaque Bisque White": {
+    "r": 236,
+    "g": 228,
+    "b": 210
+  }
+}
+`,
+	"hama": `{
+  "H1 White": {
+    "r": 255,
+    "g": 255,
+    "b": 255,
+    "GreyShade": true
+  },
+  "H2 Cream": {
+    "r": 246,
+    "g": 240,
+    "b": 192
+  },
+  "H3 Yellow": {
+    "r": 242,
+    "g": 203,
+    "b": 14
+  },
+  "H4 Orange": {
+    "r": 205,
+    "g": 74,
+    "b": 28
+  },
+  "H5 Red": {
+    "r": 162,
+    "g": 37,
+    "b": 35
+  },
+  "H6 Pink": {
+    "r": 214,
+    "g": 140,
+    "b": 155
+  },
+  "H7 Purple": {
+    "r": 88,
+    "g": 65,
+    "b": 137
+  },
+  "H8 Blue": {
+    "r": 33,
+    "g": 82,
+    "b": 148
+  },
+  "H9 Light Blue": {
+    "r": 11,
+    "g": 113,
+    "b": 185
+  },
+  "H10 Green": {
+    "r": 46,
+    "g": 120,
+    "b": 59
+  },
+  "H11 Light Green": {
+    "r": 117,
+    "g": 180,
+    "b": 137
+  },
+  "H12 Brown": {
+    "r": 67,
+    "g": 49,
+    "b": 37
+  },
+  "H13 Translucent Red": {
+    "r": 168,
+    "g": 18,
+    "b": 30,
+    "Translucent": true
+  },
+  "H14 Translucent Yellow": {
+    "r": 233,
+    "g": 201,
+    "b": 18,
+    "Translucent": true
+  },
+  "H15 Translucent Blue": {
+    "r": 2,
+    "g": 137,
+    "b": 201,
+    "Translucent": true
+  },
+  "H16 Translucent Green": {
+    "r": 102,
+    "g": 171,
+    "b": 126,
+    "Translucent": true
+  },
+  "H17 Grey": {
+    "r": 128,
+    "g": 128,
+    "b": 128,
+    "GreyShade": true
+  },
+  "H18 Black": {
+    "r": 0,
+    "g": 0,
+    "b": 0,
+    "GreyShade": true
+  },
+  "H20 Reddish Brown": {
+    "r": 121,
+    "g": 53,
+    "b": 32
+  },
+  "H21 Light Brown": {
+    "r": 176,
+    "g": 113,
+    "b": 59
+  },
+  "H22 Dark Red": {
+    "r": 152,
+    "g": 30,
+    "b": 45
+  },
+  "H23 Translucent Black": {
+    "r": 50,
+    "g": 50,
+    "b": 50,
+    "GreyShade": true,
+    "Translucent": true
+  },
+  "H24 Translucent Purple": {
+    "r": 104,
+    "g": 90,
+    "b": 141,
+    "Translucent": true
+  },
+  "H25 Translucent Brown": {
+    "r": 152,
+    "g": 120,
+    "b": 79,
+    "Translucent": true
+  },
+  "H26 Flesh": {
+    "r": 225,
+    "g": 190,
+    "b": 171
+  },
+  "H27 Beige": {
+    "r": 217,
+    "g": 184,
+    "b": 130
+  },
+  "H28 Dark Green": {
+    "r": 56,
+    "g": 69,
+    "b": 49
+  },
+  "H29 Claret": {
+    "r": 171,
+    "g": 24,
+    "b": 69
+  },
+  "H30 Burgundy": {
+    "r": 87,
+    "g": 56,
+    "b": 62
+  },
+  "H31 Turqoise": {
+    "r": 132,
+    "g": 174,
+    "b": 196
+  },
+  "H32 Neon Fuchsia": {
+    "r": 184,
+    "g": 28,
+    "b": 99
+  },
+  "H33 Flourescent Cerise": {
+    "r": 190,
+    "g": 24,
+    "b": 48,
+    "Flourescent": true
+  },
+  "H34 Neon yellow": {
+    "r": 226,
+    "g": 216,
+    "b": 69
+  },
+  "H35 Neon red": {
+    "r": 184,
+    "g": 36,
+    "b": 26
+  },
+  "H36 Neon blue": {
+    "r": 34,
+    "g": 133,
+    "b": 200
+  },
+  "H37 Neon green": {
+    "r": 132,
+    "g": 179,
+    "b": 77
+  },
+  "H38 Neon orange": {
+    "r": 217,
+    "g": 130,
+    "b": 25
+  },
+  "H39 Flourescent yellow": {
+    "r": 229,
+    "g": 224,
+    "b": 81,
+    "Flourescent": true
+  },
+  "H40 Flourescent orange": {
+    "r": 201,
+    "g": 68,
+    "b": 23,
+    "Flourescent": true
+  },
+  "H41 Flourescent blue": {
+    "r": 70,
+    "g": 154,
+    "b": 216,
+    "Flourescent": true
+  },
+  "H42 Flourescent green": { 
+    "r": 123,
+    "g": 176,
+    "b": 68,
+    "Flourescent": true
+  },
+  "H43 Pastel Yellow": {
+    "r": 241,
+    "g": 234,
+    "b": 101
+  },
+  "H44 Pastel Red": {
+    "r": 211,
+    "g": 97,
+    "b": 87
+  },
+  "H45 Pastel Purple": {
+    "r": 154,
+    "g": 141,
+    "b": 184
+  },
+  "H46 Pastel Blue": {
+    "r": 120,
+    "g": 183,
+    "b": 234
+  },
+  "H47 Pastel Green": {
+    "r": 160,
+    "g": 196,
+    "b": 109
+  },
+  "H48 Pastel Pink": {
+    "r": 206,
+    "g": 138,
+    "b": 179
+  },
+  "H49 Azure": {
+    "r": 113,
+    "g": 186,
+    "b": 205
+  },
+  "H60 Teddybear brown": {
+    "r": 222,
+    "g": 164,
+    "b": 39
+  },
+  "H61 Gold": {
+    "r": 216,
+    "g": 192,
+    "b": 144
+  },
+  "H62 Silver": {
+    "r": 200,
+    "g": 204,
+    "b": 205
+  },
+  "H63 Bronze": {
+    "r": 192,
+    "g": 183,
+    "b": 128
+  },
+  "H64 Pearl": {
+    "r": 216,
+    "g": 207,
+    "b": 200
+  },
+  "H70 Light Grey": {
+    "r": 174,
+    "g": 174,
+    "b": 174,
+    "GreyShade": true
+  },
+  "H71 Dark Grey": {
+    "r": 79,
+    "g": 79,
+    "b": 79,
+    "GreyShade": true
+  }
+}
+`,
+	"toho": `{
+  "TR-11-1 Transparent Crystal": {
+    "r": 226,
+    "g": 230,
+    "b": 232,
+    "GreyShade": true,
+    "Translucent": true
+  },
+  "TR-11-21 Silver Lined Crystal": {
+    "r": 212,
+    "g": 216,
+    "b": 220,
+    "GreyShade": true,
+    "Translucent": true
+  },
+  "TR-11-41 Opaque White": {
+    "r": 244,
+    "g": 244,
+    "b": 240,
+    "GreyShade": true
+  },
+  "TR-11-42B Opaque Dandelion": {
+    "r": 248,
+    "g": 196,
+    "b": 30
+  },
+  "TR-11-45 Opaque Pepper Red": {
+    "r": 196,
+    "g": 30,
+    "b": 36
+  },
+  "TR-11-45A Opaque Cherry": {
+    "r": 160,
+    "g": 22,
+    "b": 38
+  },
+  "TR-11-46L Opaque Terra Cotta": {
+    "r": 172,
+    "g": 72,
+    "b": 44
+  },
+  "TR-11-47 Opaque Mint Green": {
+    "r": 132,
+    "g": 196,
+    "b": 150
+  },
+  "TR-11-48 Opaque Navy Blue": {
+    "r": 28,
+    "g": 36,
+    "b": 84
+  },
+  "TR-11-49 Opaque Jet": {
+    "r": 20,
+    "g": 20,
+    "b": 22,
+    "GreyShade": true
+  },
+  "TR-11-51 Opaque Light Beige": {
+    "r": 230,
+    "g": 214,
+    "b": 180
+  },
+  "TR-11-55 Opaque Turquoise": {
+    "r": 56,
+    "g": 170,
+    "b": 176
+  },
+  "TR-11-221 Bronze": {
+    "r": 120,
+    "g": 84,
+    "b": 52
+  },
+  "TR-11-711 Nickel": {
+    "r": 120,
+    "g": 122,
+    "b": 126,
+    "GreyShade": true
+  },
+  "TR-11-PF557 Permafinish Galvanized Starlight": {
+    "r": 196,
+    "g": 198,
+    "b": 200,
+    "GreyShade": true
+  },
+  "TR-11-PF558 Permafinish Galvanized Aluminum": {
+    "r": 170,
+    "g": 172,
+    "b": 176,
+    "GreyShade": true
+  }
+}
+`,
+}
@@ -0,0 +1,12 @@
+//go:build !cgo
+// +build !cgo
+
+package beadmachine
+
+import "errors"
+
+func init() {
+	RegisterPaletteProvider("sqlite", func(string) (PaletteProvider, error) {
+		return nil, errors.New("sqlite palettes are not supported by builds without cgo")
+	})
+}
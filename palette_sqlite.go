@@ -0,0 +1,60 @@
+//go:build cgo
+// +build cgo
+
+package beadmachine
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3" // sqlite3 database driver
+	"github.com/pkg/errors"
+)
+
+// sqliteInventorySchema is the table of an inventory database, every bead color with a quantity
+// above zero is part of the palette
+const sqliteInventorySchema = `CREATE TABLE IF NOT EXISTS inventory (
+	name        TEXT PRIMARY KEY,
+	r           INTEGER NOT NULL,
+	g           INTEGER NOT NULL,
+	b           INTEGER NOT NULL,
+	grey_shade  INTEGER NOT NULL DEFAULT 0,
+	translucent INTEGER NOT NULL DEFAULT 0,
+	flourescent INTEGER NOT NULL DEFAULT 0,
+	quantity    INTEGER NOT NULL DEFAULT 0
+)`
+
+func init() {
+	RegisterPaletteProvider("sqlite", openSQLitePalette)
+}
+
+// openSQLitePalette returns a provider for the bead inventory of a SQLite database
+func openSQLitePalette(fileName string) (PaletteProvider, error) {
+	return PaletteProviderFunc(func() (map[string]BeadConfig, error) {
+		db, err := sql.Open("sqlite3", fileName)
+		if err != nil {
+			return nil, errors.Wrap(err, "opening inventory database")
+		}
+		defer db.Close()
+
+		if _, err = db.Exec(sqliteInventorySchema); err != nil {
+			return nil, errors.Wrap(err, "creating inventory table")
+		}
+
+		rows, err := db.Query("SELECT name, r, g, b, grey_shade, translucent, flourescent FROM inventory WHERE quantity > 0")
+		if err != nil {
+			return nil, errors.Wrap(err, "querying inventory")
+		}
+		defer rows.Close()
+
+		cfg := make(map[string]BeadConfig)
+		for rows.Next() {
+			var name string
+			var bead BeadConfig
+			if err = rows.Scan(&name, &bead.R, &bead.G, &bead.B, &bead.GreyShade, &bead.Translucent, &bead.Flourescent); err != nil {
+				return nil, errors.Wrap(err, "reading inventory")
+			}
+			cfg[name] = bead
+		}
+		return cfg, errors.Wrap(rows.Err(), "reading inventory")
+	}), nil
+}
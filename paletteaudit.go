@@ -0,0 +1,220 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	chromath "github.com/jkl1337/go-chromath"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// defaultAuditThreshold is the default color distance below which two palette colors are reported as too close
+const defaultAuditThreshold = 3.0
+
+// defaultAuditSamples is the default amount of sampled values per RGB channel, the audit matches the cube of them
+const defaultAuditSamples = 32
+
+// paletteAudit is the result of the palette audit command
+type paletteAudit struct {
+	Palette       string             `json:"palette"`
+	Distance      string             `json:"distance"`
+	Threshold     float64            `json:"threshold"`
+	SampledColors int                `json:"sampledColors"`
+	ClosePairs    []paletteClosePair `json:"closePairs"`
+	Beads         []paletteBeadAudit `json:"beads"`
+}
+
+// paletteClosePair is a pair of palette colors whose distance is at most the threshold
+type paletteClosePair struct {
+	Bead     string  `json:"bead"`
+	Neighbor string  `json:"neighbor"`
+	Distance float64 `json:"distance"`
+}
+
+// paletteBeadAudit is the nearest neighbor of a bead and the share of the sampled colors that select it
+type paletteBeadAudit struct {
+	Bead            string  `json:"bead"`
+	Nearest         string  `json:"nearest"`
+	NearestDistance float64 `json:"nearestDistance"`
+	Share           float64 `json:"share"`      // share of the sampled colors whose closest bead is this one
+	Selectable      bool    `json:"selectable"` // false if every sampled color has a closer bead
+}
+
+// paletteAuditCommand returns the command that reports palette colors that are too close to tell apart
+func paletteAuditCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Report palette colors that are too close to each other or never selected",
+		Long: `Report all pairs of palette colors whose color distance is at most the threshold, and the colors that
+are never selected because a closer neighbor wins every color of a sampled RGB cube. Colors that are
+identical to another bead are never selected either.`,
+		Args: cobra.NoArgs,
+		RunE: startPaletteAudit,
+	}
+	cmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette, a JSON file name or URI like embedded:hama")
+	cmd.Flags().StringP("output", "o", "", "output filename for a JSON file with the audit")
+	cmd.Flags().Float64P("threshold", "", defaultAuditThreshold, "color distance at or below which two palette colors are reported as too close")
+	cmd.Flags().StringP("distance", "", distanceCIEDE2000, "color distance metric that picks the closest bead: "+strings.Join(colorDistanceNames(), ", "))
+	cmd.Flags().IntP("samples", "", defaultAuditSamples, "amount of sampled values per RGB channel (2 - 256)")
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	_ = cmd.RegisterFlagCompletionFunc("distance", completeValues(colorDistanceNames()...))
+	return cmd
+}
+
+func startPaletteAudit(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	palette, _ := cmd.Flags().GetString("palette")
+	outputFileName, _ := cmd.Flags().GetString("output")
+	threshold, _ := cmd.Flags().GetFloat64("threshold")
+	distanceName, _ := cmd.Flags().GetString("distance")
+	samples, _ := cmd.Flags().GetInt("samples")
+
+	if err := validateFlagRanges(cmd.Flags()); err != nil {
+		logger.Error("Invalid flag value", zap.Error(err))
+		return usageError(err)
+	}
+	colorDistance, ok := registeredColorDistance(distanceName)
+	if !ok {
+		logger.Error("Invalid color distance metric", zap.String("distance", distanceName))
+		return usageError(fmt.Errorf("invalid color distance metric '%s', expected %s", distanceName, strings.Join(colorDistanceNames(), ", ")))
+	}
+
+	provider, err := openPalette(palette)
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+	beads, err := provider.Palette()
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+	if len(beads) < 2 {
+		logger.Error("The palette needs at least two colors to be audited", zap.Int("colors", len(beads)))
+		return paletteError(errors.New("the palette has less than two colors"))
+	}
+
+	m := newBeadMachine(zap.NewNop()) // every sampled color would be logged in verbose mode
+	m.colorDistance = colorDistance
+	m.distanceName = distanceName
+	audit := m.auditPalette(beads, threshold, samples)
+	audit.Palette = palette
+
+	for _, pair := range audit.ClosePairs {
+		logger.Warn("Palette colors are too close",
+			zap.String("bead", pair.Bead),
+			zap.String("neighbor", pair.Neighbor),
+			zap.Float64("distance", pair.Distance))
+	}
+	unselectable := 0
+	for _, bead := range audit.Beads {
+		if bead.Selectable {
+			continue
+		}
+		unselectable++
+		logger.Warn("Palette color is never selected",
+			zap.String("bead", bead.Bead),
+			zap.String("nearest", bead.Nearest),
+			zap.Float64("distance", bead.NearestDistance))
+	}
+	logger.Info("Palette audited",
+		zap.Int("colors", len(audit.Beads)),
+		zap.Int("close pairs", len(audit.ClosePairs)),
+		zap.Int("never selected", unselectable),
+		zap.Int("sampled colors", audit.SampledColors))
+
+	if outputFileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(audit, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(outputFileName, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Error("Writing audit failed", zap.Error(err))
+		return outputError(errors.Wrap(err, "writing audit file"))
+	}
+	return nil
+}
+
+// auditPalette finds the nearest neighbor of every bead and the pairs of beads within the threshold, and matches
+// a cube of sampled RGB colors to count how many colors select every bead
+func (m *beadMachine) auditPalette(beads map[string]BeadConfig, threshold float64, samples int) paletteAudit {
+	beadNames := make([]string, 0, len(beads))
+	for name := range beads {
+		beadNames = append(beadNames, name)
+	}
+	sort.Strings(beadNames) // the first of identical beads is selected, like in the conversion
+
+	beadLabs := make(map[string]chromath.Lab, len(beadNames))
+	cfgLab := make(map[chromath.Lab]string, len(beadNames))
+	for _, name := range beadNames {
+		bead := beads[name]
+		lab := m.labColor(color.RGBA{bead.R, bead.G, bead.B, 255})
+		beadLabs[name] = lab
+		if _, exists := cfgLab[lab]; !exists {
+			cfgLab[lab] = name
+		}
+	}
+
+	audit := paletteAudit{
+		Distance:      m.distanceName,
+		Threshold:     threshold,
+		SampledColors: samples * samples * samples,
+		ClosePairs:    []paletteClosePair{},
+		Beads:         make([]paletteBeadAudit, len(beadNames)),
+	}
+	index := make(map[string]int, len(beadNames))
+	for i, name := range beadNames {
+		index[name] = i
+		audit.Beads[i] = paletteBeadAudit{Bead: name, NearestDistance: -1}
+	}
+	for i, name := range beadNames {
+		for j := i + 1; j < len(beadNames); j++ {
+			neighbor := beadNames[j]
+			distance := m.colorDistance.Distance(beadLabs[name], beadLabs[neighbor])
+			if distance <= threshold {
+				audit.ClosePairs = append(audit.ClosePairs, paletteClosePair{Bead: name, Neighbor: neighbor, Distance: distance})
+			}
+			for _, k := range []int{i, j} {
+				other := neighbor
+				if k == j {
+					other = name
+				}
+				if audit.Beads[k].NearestDistance < 0 || distance < audit.Beads[k].NearestDistance {
+					audit.Beads[k].Nearest, audit.Beads[k].NearestDistance = other, distance
+				}
+			}
+		}
+	}
+	sort.SliceStable(audit.ClosePairs, func(i, j int) bool {
+		return audit.ClosePairs[i].Distance < audit.ClosePairs[j].Distance
+	})
+
+	wins := make([]int, len(beadNames))
+	for r := 0; r < samples; r++ {
+		for g := 0; g < samples; g++ {
+			for b := 0; b < samples; b++ {
+				c := color.RGBA{auditSample(r, samples), auditSample(g, samples), auditSample(b, samples), 255}
+				name, _ := m.findSimilarColor(cfgLab, c)
+				wins[index[name]]++
+			}
+		}
+	}
+	for i := range audit.Beads {
+		audit.Beads[i].Share = float64(wins[i]) / float64(audit.SampledColors)
+		audit.Beads[i].Selectable = wins[i] > 0
+	}
+	return audit
+}
+
+// auditSample returns the channel value of the sample index, the samples include 0 and 255
+func auditSample(index, samples int) uint8 {
+	return uint8((index*255 + (samples-1)/2) / (samples - 1))
+}
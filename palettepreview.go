@@ -0,0 +1,241 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// orders of the swatches of the palette preview
+const (
+	paletteSortHue       = "hue"       // hue ranges from red to pink, each from light to dark, the greys last
+	paletteSortLightness = "lightness" // from light to dark
+	paletteSortName      = "name"
+)
+
+// palette preview layout in pixel
+const (
+	paletteSwatchWidth  = 154 // room for 22 characters of the bead name
+	paletteSwatchHeight = 56
+	paletteSwatchGap    = 8
+	paletteBadgeSize    = 15
+)
+
+// paletteHueRange is the width in degrees of the hue ranges that the swatches are grouped by, and paletteGreyChroma
+// the chroma below which a color counts as grey
+const (
+	paletteHueRange   = 30.0
+	paletteGreyChroma = 8.0
+)
+
+// paletteSwatch is a bead color of the palette preview
+type paletteSwatch struct {
+	name      string
+	bead      BeadConfig
+	lightness float64
+	chroma    float64
+	hue       float64 // in degrees from 0 to 360
+}
+
+// grey returns whether the swatch is sorted with the greys
+func (s paletteSwatch) grey() bool {
+	return s.bead.GreyShade || s.chroma < paletteGreyChroma
+}
+
+// badges returns the letters of the categories of the bead
+func (s paletteSwatch) badges() []string {
+	var badges []string
+	if s.bead.Translucent {
+		badges = append(badges, "T")
+	}
+	if s.bead.Flourescent {
+		badges = append(badges, "F")
+	}
+	if s.bead.GreyShade {
+		badges = append(badges, "G")
+	}
+	return badges
+}
+
+// paletteCommand returns the command to inspect bead palettes
+func paletteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "palette",
+		Short: "Inspect bead palettes",
+	}
+
+	previewCmd := &cobra.Command{
+		Use:   "preview out.png",
+		Short: "Render all colors of a palette as labeled swatch grid",
+		Long: `Render all colors of a palette as a grid of swatches labeled with the bead name and RGB color, sorted by
+hue and lightness. Badges mark translucent (T), fluorescent (F) and grey shade (G) beads.`,
+		Args: cobra.ExactArgs(1),
+		RunE: startPalettePreview,
+	}
+	previewCmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette, a JSON file name or URI like embedded:hama")
+	previewCmd.Flags().StringP("sort", "", paletteSortHue, "order of the swatches: hue, lightness or name")
+	previewCmd.Flags().IntP("columns", "", 8, "amount of swatches per row")
+	_ = previewCmd.RegisterFlagCompletionFunc("palette", completePalette)
+	_ = previewCmd.RegisterFlagCompletionFunc("sort", completeValues(paletteSortHue, paletteSortLightness, paletteSortName))
+
+	cmd.AddCommand(previewCmd, paletteAuditCommand())
+	return cmd
+}
+
+func startPalettePreview(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	palette, _ := cmd.Flags().GetString("palette")
+	order, _ := cmd.Flags().GetString("sort")
+	columns, _ := cmd.Flags().GetInt("columns")
+
+	switch order {
+	case paletteSortHue, paletteSortLightness, paletteSortName:
+	default:
+		logger.Error("Invalid swatch order", zap.String("sort", order))
+		return usageError(fmt.Errorf("invalid swatch order '%s', expected hue, lightness or name", order))
+	}
+	if columns <= 0 {
+		logger.Error("Invalid amount of columns", zap.Int("columns", columns))
+		return usageError(fmt.Errorf("invalid amount of columns %d", columns))
+	}
+
+	provider, err := openPalette(palette)
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+	beads, err := provider.Palette()
+	if err != nil {
+		logger.Error("Loading palette failed", zap.Error(err))
+		return paletteError(err)
+	}
+
+	swatches := paletteSwatches(newBeadMachine(logger), beads)
+	sortSwatches(swatches, order)
+	name, _ := comparisonPalette(palette)
+	img := renderPalettePreview(fmt.Sprintf("%s, %d colors", name, len(swatches)), swatches, columns)
+
+	f, err := os.Create(args[0])
+	if err == nil {
+		err = png.Encode(f, img)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logger.Error("Writing palette preview failed", zap.Error(err))
+		return outputError(errors.Wrap(err, "writing palette preview"))
+	}
+	logger.Info("Palette preview written", zap.String("file", args[0]), zap.Int("colors", len(swatches)))
+	return nil
+}
+
+// paletteSwatches returns the swatches of all beads of the palette with their lightness, chroma and hue
+func paletteSwatches(m *beadMachine, beads map[string]BeadConfig) []paletteSwatch {
+	swatches := make([]paletteSwatch, 0, len(beads))
+	for name, bead := range beads {
+		lab := m.labColor(color.RGBA{bead.R, bead.G, bead.B, 255})
+		hue := math.Atan2(lab.B(), lab.A()) * 180 / math.Pi
+		if hue < 0 {
+			hue += 360
+		}
+		swatches = append(swatches, paletteSwatch{
+			name:      name,
+			bead:      bead,
+			lightness: lab.L(),
+			chroma:    math.Hypot(lab.A(), lab.B()),
+			hue:       hue,
+		})
+	}
+	return swatches
+}
+
+// sortSwatches sorts the swatches in the given order, equal swatches are sorted by name
+func sortSwatches(swatches []paletteSwatch, order string) {
+	sort.Slice(swatches, func(i, j int) bool {
+		a, b := swatches[i], swatches[j]
+		switch order {
+		case paletteSortHue:
+			if a.grey() != b.grey() {
+				return b.grey()
+			}
+			if rangeA, rangeB := int(a.hue/paletteHueRange), int(b.hue/paletteHueRange); !a.grey() && rangeA != rangeB {
+				return rangeA < rangeB
+			}
+			if a.lightness != b.lightness {
+				return a.lightness > b.lightness
+			}
+		case paletteSortLightness:
+			if a.lightness != b.lightness {
+				return a.lightness > b.lightness
+			}
+		}
+		return a.name < b.name
+	})
+}
+
+// renderPalettePreview draws the swatches in a grid below the title, every swatch is labeled with the bead name
+// and its hex color and gets badges for its categories
+func renderPalettePreview(title string, swatches []paletteSwatch, columns int) *image.RGBA {
+	face := basicfont.Face7x13
+	top := 2*face.Height + 2*coordinateLabelPadding
+	cellHeight := paletteSwatchHeight + 2*face.Height + coordinateLabelPadding
+	columns = maxInt(1, minInt(columns, len(swatches)))
+	rows := boardsNeeded(len(swatches), columns)
+
+	width := columns*(paletteSwatchWidth+paletteSwatchGap) + paletteSwatchGap
+	height := top + rows*(cellHeight+paletteSwatchGap) + paletteSwatchGap
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(coordinateBackground), image.Point{}, draw.Src)
+
+	text := func(x, y int, s string) {
+		d := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(coordinateTextColor),
+			Face: face,
+			Dot:  fixed.P(x, y+face.Height-face.Descent),
+		}
+		d.DrawString(s)
+	}
+	text(paletteSwatchGap, coordinateLabelPadding, title)
+	text(paletteSwatchGap, coordinateLabelPadding+face.Height, "T translucent, F fluorescent, G grey shade")
+
+	maxChars := paletteSwatchWidth / face.Advance
+	for i, swatch := range swatches {
+		x := paletteSwatchGap + (i%columns)*(paletteSwatchWidth+paletteSwatchGap)
+		y := top + paletteSwatchGap + (i/columns)*(cellHeight+paletteSwatchGap)
+		c := color.RGBA{swatch.bead.R, swatch.bead.G, swatch.bead.B, 255}
+		r := image.Rect(x, y, x+paletteSwatchWidth, y+paletteSwatchHeight)
+		draw.Draw(img, r, image.NewUniform(chartGridColor), image.Point{}, draw.Src) // frames light colors
+		draw.Draw(img, r.Inset(1), image.NewUniform(c), image.Point{}, draw.Src)
+
+		badgeX := x + paletteSwatchWidth - paletteBadgeSize - 2
+		for _, badge := range swatch.badges() {
+			r := image.Rect(badgeX, y+2, badgeX+paletteBadgeSize, y+2+paletteBadgeSize)
+			draw.Draw(img, r, image.NewUniform(coordinateTextColor), image.Point{}, draw.Src)
+			draw.Draw(img, r.Inset(1), image.NewUniform(coordinateBackground), image.Point{}, draw.Src)
+			text(r.Min.X+(paletteBadgeSize-face.Advance)/2, r.Min.Y+1, badge)
+			badgeX -= paletteBadgeSize + 2
+		}
+
+		name := []rune(swatch.name)
+		if len(name) > maxChars {
+			name = name[:maxChars]
+		}
+		text(x, y+paletteSwatchHeight+coordinateLabelPadding, string(name))
+		text(x, y+paletteSwatchHeight+coordinateLabelPadding+face.Height, fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B))
+	}
+	return img
+}
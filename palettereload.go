@@ -0,0 +1,193 @@
+package beadmachine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// paletteVersionLength is the amount of hex characters of the SHA-256 hash of a palette that are its version
+const paletteVersionLength = 16
+
+// paletteVersion returns the version of the palette, the hash of its beads
+func paletteVersion(palette map[string]BeadConfig) string {
+	data, err := json.Marshal(palette) // the keys of maps are sorted
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])[:paletteVersionLength]
+}
+
+// servedPalette is the current version of a palette of the server, jobs convert with an immutable snapshot file of
+// it so that a reload while a job runs does not change the palette of the job
+type servedPalette struct {
+	Name     string    `json:"name"`
+	URI      string    `json:"uri"`
+	Version  string    `json:"version"`
+	Beads    int       `json:"beads"`
+	Loaded   time.Time `json:"loaded"`
+	snapshot string
+}
+
+// paletteReloader polls the palettes of the server and swaps in a new snapshot whenever a palette changed
+type paletteReloader struct {
+	logger *zap.Logger
+	dir    string   // directory of the snapshot files
+	names  []string // palette names in the order of the flags, the first one is the default of the jobs
+
+	lock     sync.RWMutex
+	palettes map[string]*servedPalette
+}
+
+// parseServedPalettes parses the --palette values in the format name=uri
+func parseServedPalettes(values []string) ([]string, map[string]string, error) {
+	var names []string
+	uris := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, fmt.Errorf("invalid palette '%s', expected name=palette like hama=colors_hama.json", value)
+		}
+		if _, ok := uris[parts[0]]; ok {
+			return nil, nil, fmt.Errorf("the palette '%s' is given more than once", parts[0])
+		}
+		names = append(names, parts[0])
+		uris[parts[0]] = parts[1]
+	}
+	return names, uris, nil
+}
+
+// newPaletteReloader loads the palettes and writes their first snapshots into the directory
+func newPaletteReloader(logger *zap.Logger, dir string, names []string, uris map[string]string) (*paletteReloader, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating palette directory")
+	}
+	r := &paletteReloader{logger: logger, dir: dir, names: names, palettes: make(map[string]*servedPalette)}
+	for _, name := range names {
+		if _, err := r.reload(name, uris[name]); err != nil {
+			return nil, errors.Wrapf(err, "palette '%s'", name)
+		}
+	}
+	return r, nil
+}
+
+// reload loads the palette and swaps in a new snapshot if its version changed, it returns whether it changed
+func (r *paletteReloader) reload(name, uri string) (bool, error) {
+	provider, err := openPalette(uri)
+	if err != nil {
+		return false, err
+	}
+	palette, err := provider.Palette()
+	if err != nil {
+		return false, err
+	}
+	if len(palette) == 0 {
+		return false, errors.New("the palette contains no beads")
+	}
+	version := paletteVersion(palette)
+	r.lock.RLock()
+	current := r.palettes[name]
+	r.lock.RUnlock()
+	if current != nil && current.Version == version {
+		return false, nil
+	}
+
+	data, err := json.Marshal(palette)
+	if err != nil {
+		return false, errors.Wrap(err, "marshalling palette")
+	}
+	snapshot := filepath.Join(r.dir, name+"-"+version+".json")
+	if err = ioutil.WriteFile(snapshot+".tmp", data, 0644); err != nil {
+		return false, errors.Wrap(err, "writing palette snapshot")
+	}
+	if err = os.Rename(snapshot+".tmp", snapshot); err != nil {
+		return false, errors.Wrap(err, "writing palette snapshot")
+	}
+
+	r.lock.Lock()
+	r.palettes[name] = &servedPalette{
+		Name:     name,
+		URI:      uri,
+		Version:  version,
+		Beads:    len(palette),
+		Loaded:   time.Now().UTC(),
+		snapshot: snapshot,
+	}
+	r.lock.Unlock()
+	return true, nil
+}
+
+// watch reloads the palettes in the interval, a palette that can not be loaded keeps its current version. A failing
+// palette is logged once until its error changes.
+func (r *paletteReloader) watch(interval time.Duration) {
+	failures := make(map[string]string)
+	for range time.Tick(interval) {
+		for _, name := range r.names {
+			r.lock.RLock()
+			uri := r.palettes[name].URI
+			r.lock.RUnlock()
+			changed, err := r.reload(name, uri)
+			if err == nil {
+				delete(failures, name)
+			}
+			switch {
+			case err != nil && failures[name] != err.Error():
+				failures[name] = err.Error()
+				r.logger.Warn("Reloading palette failed, the current version is kept", zap.String("palette", name), zap.Error(err))
+			case changed:
+				r.logger.Info("Palette reloaded", zap.String("palette", name), zap.String("version", r.palette(name).Version))
+			}
+		}
+	}
+}
+
+// palette returns the current version of the palette, nil if the server has no palette of the name
+func (r *paletteReloader) palette(name string) *servedPalette {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.palettes[name]
+}
+
+// resolve replaces the palette option of a job by the snapshot of the current version of the served palette, jobs
+// without palette option get the first palette of the server
+func (r *paletteReloader) resolve(options map[string]interface{}) {
+	name, ok := options["palette"].(string)
+	if !ok {
+		if _, set := options["palette"]; set {
+			return // the conversion reports the invalid value
+		}
+		name = r.names[0]
+	}
+	if p := r.palette(name); p != nil {
+		options["palette"] = p.snapshot
+	}
+}
+
+// servePalettes responds with the current versions of the palettes of the server
+func (r *paletteReloader) servePalettes(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.lock.RLock()
+	palettes := make([]servedPalette, 0, len(r.palettes))
+	for _, p := range r.palettes {
+		palettes = append(palettes, *p)
+	}
+	r.lock.RUnlock()
+	sort.Slice(palettes, func(i, j int) bool { return palettes[i].Name < palettes[j].Name })
+	writeJSON(w, http.StatusOK, palettes)
+}
@@ -0,0 +1,49 @@
+//go:build ignore
+// +build ignore
+
+// palettes_generate generates palette_embedded.go which embeds all colors_*.json palette files
+// of the repository into the binary.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	fileNames, err := filepath.Glob("colors_*.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(fileNames)
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by palettes_generate.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package beadmachine\n\n")
+	buf.WriteString("// embeddedPalettes contains the JSON data of all palettes that are shipped with beadmachine\n")
+	buf.WriteString("var embeddedPalettes = map[string]string{\n")
+
+	for _, fileName := range fileNames {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(fileName, "colors_"), ".json")
+		fmt.Fprintf(&buf, "%q: `%s`,\n", name, data)
+	}
+	buf.WriteString("}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile("palette_embedded.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
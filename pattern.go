@@ -0,0 +1,198 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Pattern is the result of matching an image to bead colors, it is shared by all outputs
+type Pattern struct {
+	Version        int    `json:"version"` // schema version of the pattern JSON, see patternSchemaVersion
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	BoardDimension int    `json:"boardDimension"`
+	Grid           string `json:"grid,omitempty"` // offset if every second row is shifted by half a cell, empty for a square grid
+	Cells          []Cell `json:"cells"`          // all cells row by row
+
+	Symbols map[string]string `json:"symbols,omitempty"` // symbols of beads that are not distinguishable by color alone
+
+	Palette map[string]BeadConfig `json:"-"` // the complete loaded palette
+	Source  image.Image           `json:"-"` // the filtered and resized input image
+}
+
+// Cell is a single bead position of a pattern
+type Cell struct {
+	Bead     string     `json:"bead,omitempty"` // name of the matched bead, empty for empty cells or if color matching is disabled
+	Color    color.RGBA `json:"color"`          // color of the cell, fully transparent for empty cells
+	Distance float64    `json:"distance"`       // color distance between the source pixel and the matched bead
+}
+
+// newPattern returns a pattern of the given dimensions with all cells empty
+func newPattern(width, height, boardDimension int) *Pattern {
+	return &Pattern{
+		Version:        patternSchemaVersion,
+		Width:          width,
+		Height:         height,
+		BoardDimension: boardDimension,
+		Cells:          make([]Cell, width*height),
+	}
+}
+
+// loadPatternFile loads a pattern from a JSON file that was written by the json output format
+func loadPatternFile(fileName string) (*Pattern, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading pattern file")
+	}
+	return loadPatternData(data)
+}
+
+// loadPatternData loads a pattern from its JSON, patterns of older schema versions are migrated first
+func loadPatternData(data []byte) (*Pattern, error) {
+	data, _, _, err := migratePattern(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := &Pattern{}
+	if err = json.Unmarshal(data, pattern); err != nil {
+		return nil, errors.Wrap(err, "parsing pattern file")
+	}
+	if pattern.Width <= 0 || pattern.Height <= 0 || len(pattern.Cells) != pattern.Width*pattern.Height {
+		return nil, errors.New("pattern file has invalid dimensions")
+	}
+	if pattern.BoardDimension <= 0 {
+		return nil, errors.New("pattern file has an invalid board dimension")
+	}
+	if pattern.Grid != "" && pattern.Grid != gridOffset {
+		return nil, fmt.Errorf("pattern file has an unknown grid '%s'", pattern.Grid)
+	}
+	return pattern, nil
+}
+
+// Cell returns the cell at the given coordinates
+func (p *Pattern) Cell(x, y int) *Cell {
+	return &p.Cells[x+y*p.Width]
+}
+
+// Empty returns whether the cell needs no bead
+func (c Cell) Empty() bool {
+	return c.Color.A == 0
+}
+
+// PatternStats contains statistics about a pattern
+type PatternStats struct {
+	Width          int              `json:"width"`
+	Height         int              `json:"height"`
+	BoardsWidth    int              `json:"boardsWidth"`
+	BoardsHeight   int              `json:"boardsHeight"`
+	Beads          int              `json:"beads"`
+	Colors         int              `json:"colors"`
+	BeadCounts     map[string]int   `json:"beadCounts"`
+	MeanDistance   float64          `json:"meanDistance"`
+	MaxDistance    float64          `json:"maxDistance"`
+	Size           *physicalSize    `json:"size,omitempty"`           // physical size in the selected unit system
+	Partial        bool             `json:"partial,omitempty"`        // only a part of the cells is matched, the conversion was cancelled
+	ColorCache     *colorCacheStats `json:"colorCache,omitempty"`     // lookups of the color cache of the run so far
+	Outputs        []outputStatus   `json:"outputs,omitempty"`        // status of the other outputs of the pattern
+	PaletteVersion string           `json:"paletteVersion,omitempty"` // hash of the beads of the palette
+
+	Complexity complexityStats `json:"complexity"`
+}
+
+// complexityStats contains metrics to estimate how hard and slow a pattern is to place
+type complexityStats struct {
+	AverageRunLength   float64 `json:"averageRunLength"`   // average amount of consecutive beads of the same color in a row
+	ColorChangesPerRow float64 `json:"colorChangesPerRow"` // average amount of color changes in a row
+	Islands            int     `json:"islands"`            // beads without a horizontal or vertical neighbor of the same color
+}
+
+// Stats calculates the bead usage and matching statistics of the pattern
+func (p *Pattern) Stats() PatternStats {
+	stats := PatternStats{
+		Width:        p.Width,
+		Height:       p.Height,
+		BoardsWidth:  boardsNeeded(p.Width, p.BoardDimension),
+		BoardsHeight: boardsNeeded(p.Height, p.BoardDimension),
+		BeadCounts:   make(map[string]int),
+	}
+
+	var distanceSum float64
+	for _, cell := range p.Cells {
+		if cell.Empty() {
+			continue
+		}
+		stats.Beads++
+		if cell.Bead != "" {
+			stats.BeadCounts[cell.Bead]++
+		}
+		distanceSum += cell.Distance
+		stats.MaxDistance = math.Max(stats.MaxDistance, cell.Distance)
+	}
+
+	stats.Colors = len(stats.BeadCounts)
+	stats.Complexity = p.complexity()
+	if stats.Beads > 0 {
+		stats.MeanDistance = distanceSum / float64(stats.Beads)
+	}
+	return stats
+}
+
+// complexity calculates the run-length and region statistics of the pattern
+func (p *Pattern) complexity() complexityStats {
+	var stats complexityStats
+	var runs, runBeads, changes int
+
+	for y := 0; y < p.Height; y++ {
+		previous := ""
+		for x := 0; x < p.Width; x++ {
+			cell := p.Cell(x, y)
+			if cell.Empty() {
+				previous = ""
+				continue
+			}
+			runBeads++
+			if cell.Bead != previous {
+				if previous != "" {
+					changes++
+				}
+				runs++
+			}
+			previous = cell.Bead
+
+			if p.isIsland(x, y) {
+				stats.Islands++
+			}
+		}
+	}
+
+	if runs > 0 {
+		stats.AverageRunLength = float64(runBeads) / float64(runs)
+	}
+	if p.Height > 0 {
+		stats.ColorChangesPerRow = float64(changes) / float64(p.Height)
+	}
+	return stats
+}
+
+// isIsland returns whether the cell has no horizontal or vertical neighbor with the same bead
+func (p *Pattern) isIsland(x, y int) bool {
+	bead := p.Cell(x, y).Bead
+	neighbors := []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}}
+	for _, n := range neighbors {
+		if n.X < 0 || n.Y < 0 || n.X >= p.Width || n.Y >= p.Height {
+			continue
+		}
+		neighbor := p.Cell(n.X, n.Y)
+		if !neighbor.Empty() && neighbor.Bead == bead {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package beadmachine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// patternSchemaVersion is the version of the schema of the pattern JSON that is written by the json output format.
+// It is increased whenever a field of the pattern JSON is renamed, removed or changes its meaning, and a migration
+// from the previous version is appended to patternMigrations.
+const patternSchemaVersion = 1
+
+// patternMigrations upgrade the pattern JSON of the schema version of their index plus one to the next version.
+// Fields that beadmachine does not know are kept, so that data that third-party tools added survives the migration.
+var patternMigrations = []func(pattern map[string]interface{}) error{}
+
+// patternFileVersion returns the schema version of the pattern JSON, patterns without a version were written before
+// the schema was versioned and are of version 1
+func patternFileVersion(pattern map[string]interface{}) (int, error) {
+	value, ok := pattern["version"]
+	if !ok {
+		return 1, nil
+	}
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid pattern schema version %v", value)
+	}
+	version, err := number.Int64()
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid pattern schema version %s", number)
+	}
+	return int(version), nil
+}
+
+// migratePattern upgrades the pattern JSON to the current schema version, it returns the migrated JSON, the version
+// of the original JSON and whether it already had the current version. Patterns of a newer version than this
+// beadmachine supports are rejected.
+func migratePattern(data []byte) ([]byte, int, bool, error) {
+	var pattern map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // keeps the numbers of unknown fields as they are
+	if err := decoder.Decode(&pattern); err != nil {
+		return nil, 0, false, errors.Wrap(err, "parsing pattern file")
+	}
+	version, err := patternFileVersion(pattern)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	_, versioned := pattern["version"]
+	if version > patternSchemaVersion {
+		return nil, version, false, fmt.Errorf("the pattern has schema version %d, this beadmachine supports up to version %d",
+			version, patternSchemaVersion)
+	}
+
+	for v := version; v < patternSchemaVersion; v++ {
+		if err = patternMigrations[v-1](pattern); err != nil {
+			return nil, version, false, errors.Wrapf(err, "migrating pattern from schema version %d", v)
+		}
+	}
+	pattern["version"] = patternSchemaVersion
+	migrated, err := json.Marshal(pattern)
+	return migrated, version, versioned && version == patternSchemaVersion, errors.Wrap(err, "encoding pattern")
+}
+
+// patternCommand returns the command group to work with saved pattern files
+func patternCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pattern",
+		Short: "Work with saved bead patterns",
+	}
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate pattern.json...",
+		Short: "Upgrade saved patterns to the current schema version",
+		Long: `Upgrade pattern files that were written with --pattern or --render json by an older beadmachine to the
+current schema version of the pattern JSON. The files are replaced in place, fields that beadmachine does not know
+are kept. Patterns without a version are of version 1.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: startPatternMigrate,
+	}
+	migrateCmd.Flags().BoolP("dry-run", "", false, "only report the patterns that need a migration without changing them")
+
+	cmd.AddCommand(migrateCmd)
+	return cmd
+}
+
+func startPatternMigrate(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	var result error
+	for _, fileName := range args {
+		fileLogger := logger.With(zap.String("file", fileName))
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			fileLogger.Error("Reading pattern failed", zap.Error(err))
+			result = inputError(errors.Wrap(err, "reading pattern file"))
+			continue
+		}
+		migrated, version, current, err := migratePattern(data)
+		if err != nil {
+			fileLogger.Error("Migrating pattern failed", zap.Error(err))
+			result = inputError(err)
+			continue
+		}
+		if _, err = loadPatternData(migrated); err != nil {
+			fileLogger.Error("Migrating pattern failed", zap.Error(err))
+			result = inputError(err)
+			continue
+		}
+		if current {
+			fileLogger.Info("Pattern is up to date", zap.Int("version", version))
+			continue
+		}
+		if dryRun {
+			fileLogger.Info("Pattern needs a migration", zap.Int("from", version), zap.Int("to", patternSchemaVersion))
+			continue
+		}
+
+		if err = writePatternFile(fileName, migrated); err != nil {
+			fileLogger.Error("Writing pattern failed", zap.Error(err))
+			result = outputError(err)
+			continue
+		}
+		fileLogger.Info("Pattern migrated", zap.Int("from", version), zap.Int("to", patternSchemaVersion))
+	}
+	return result
+}
+
+// writePatternFile replaces the pattern file with the data, a failed write keeps the original file
+func writePatternFile(fileName string, data []byte) error {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return errors.Wrap(err, "reading pattern file")
+	}
+	if err = ioutil.WriteFile(fileName+".tmp", append(data, '\n'), info.Mode().Perm()); err != nil {
+		return errors.Wrap(err, "writing pattern file")
+	}
+	if err = os.Rename(fileName+".tmp", fileName); err != nil {
+		_ = os.Remove(fileName + ".tmp")
+		return errors.Wrap(err, "writing pattern file")
+	}
+	return nil
+}
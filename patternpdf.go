@@ -0,0 +1,56 @@
+package beadmachine
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// scales of the pattern PDF
+const (
+	pdfScaleFit    = "fit"
+	pdfScaleActual = "actual"
+)
+
+// renderPatternPDF renders the pattern as PDF chart on a single page. It is scaled to fit an A4 page or printed
+// in its real size, to lay the printout under a transparent pegboard as placement guide.
+func (m *beadMachine) renderPatternPDF(pattern *Pattern, w io.Writer) error {
+	if pattern.Width == 0 || pattern.Height == 0 {
+		return fmt.Errorf("the pattern is empty")
+	}
+
+	var pageWidth, pageHeight, cellSize float64
+	columns := float64(pattern.Width)
+	if pattern.Offset() { // the shifted rows stick out by half a cell
+		columns += 0.5
+	}
+	caption := m.tr("Pattern size: %s", m.formatSize(pattern.Width, pattern.Height))
+	if m.pdfScale == pdfScaleActual {
+		// the page has the size of the pattern, it has to be printed without scaling it to the paper
+		cellSize = m.beadPitch / mmPerPoint
+		pageWidth = columns*cellSize + 2*posterMargin
+		pageHeight = float64(pattern.Height)*cellSize + 2*posterMargin
+		caption += " - " + m.tr("print at 100% scale")
+		pageWidth = math.Max(pageWidth, pdfTextWidth(caption, posterFontSize)+2*posterMargin)
+	} else {
+		pageWidth, pageHeight = pdfA4Width, pdfA4Height
+		cellSize = math.Min((pageWidth-2*posterMargin)/columns, (pageHeight-2*posterMargin)/float64(pattern.Height))
+	}
+
+	doc := &pdfDocument{}
+	page := doc.addPage(pageWidth, pageHeight)
+	captionY := posterMargin - posterCropMarkGap
+	if m.coordinates { // the caption moves above the column labels
+		captionY = posterMargin - posterCropMark - posterCropMarkGap
+	}
+	page.setFillColor(posterMarkColor)
+	page.text(posterMargin, captionY, pdfFontBold, posterFontSize, caption)
+	m.drawPatternCells(page, pattern, 0, 0, pattern.Width, pattern.Height, cellSize)
+	if m.coordinates {
+		m.drawPDFCoordinates(page, pattern, 0, 0, pattern.Width, pattern.Height, posterMargin, posterMargin, cellSize)
+	}
+	if err := m.addPDFFingerprint(doc, pattern); err != nil {
+		return err
+	}
+	return doc.write(w)
+}
@@ -0,0 +1,217 @@
+package beadmachine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image/color"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// page sizes in points
+const (
+	pdfA4Width  = 595.28
+	pdfA4Height = 841.89
+)
+
+// footer text size and distance to the bottom right page corner in points
+const (
+	pdfFooterSize   = 7
+	pdfFooterMargin = 12
+)
+
+// pdf fonts of the standard font set that do not need to be embedded
+const (
+	pdfFontRegular = "F1" // Helvetica
+	pdfFontBold    = "F2" // Helvetica-Bold
+)
+
+// helveticaWidths contains the glyph widths of the printable ASCII characters of the Helvetica font
+// in 1/1000 of the font size, starting at the space character
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfDocument is a minimal PDF writer that supports vector graphics and text in the standard fonts
+type pdfDocument struct {
+	pages []*pdfPage
+	info  map[string]string // entries of the document information dictionary like Subject
+}
+
+// pdfPage is a page of a PDF document, all coordinates are in points with the origin in the top left corner
+type pdfPage struct {
+	width   float64
+	height  float64
+	content bytes.Buffer
+}
+
+// addPage adds a new page of the given size in points to the document
+func (d *pdfDocument) addPage(width, height float64) *pdfPage {
+	page := &pdfPage{width: width, height: height}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// setFillColor sets the color used for filling shapes and text
+func (p *pdfPage) setFillColor(c color.RGBA) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f rg\n", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// setStrokeColor sets the color used for lines and shape outlines
+func (p *pdfPage) setStrokeColor(c color.RGBA) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f RG\n", float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// setLineWidth sets the width of lines and shape outlines
+func (p *pdfPage) setLineWidth(width float64) {
+	fmt.Fprintf(&p.content, "%.2f w\n", width)
+}
+
+// rect draws a rectangle that is filled and/or outlined
+func (p *pdfPage) rect(x, y, width, height float64, fill, stroke bool) {
+	fmt.Fprintf(&p.content, "%.2f %.2f %.2f %.2f re ", x, p.height-y-height, width, height)
+	switch {
+	case fill && stroke:
+		p.content.WriteString("B\n")
+	case fill:
+		p.content.WriteString("f\n")
+	default:
+		p.content.WriteString("S\n")
+	}
+}
+
+// line draws a line
+func (p *pdfPage) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "%.2f %.2f m %.2f %.2f l S\n", x1, p.height-y1, x2, p.height-y2)
+}
+
+// text draws a single line of text with its baseline at y
+func (p *pdfPage) text(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, p.height-y, pdfEscape(s))
+}
+
+// pdfTextWidth returns the width in points of the text in the given font size, bold text is
+// approximated by the regular glyph widths
+func pdfTextWidth(s string, size float64) float64 {
+	var width int
+	for _, r := range s {
+		if r >= ' ' && int(r-' ') < len(helveticaWidths) {
+			width += helveticaWidths[r-' ']
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// pdfEscape converts the text to the Latin-1 based WinAnsi encoding of the standard fonts and
+// escapes the special characters of PDF strings
+func pdfEscape(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(byte(r))
+		case r < ' ':
+			buf.WriteByte(' ')
+		case r <= 0xFF:
+			buf.WriteByte(byte(r))
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
+
+// write writes the document in PDF format
+func (d *pdfDocument) write(writer io.Writer) error {
+	w := &pdfWriter{w: bufio.NewWriter(writer)}
+	w.printf("%%PDF-1.4\n%%\xE2\xE3\xCF\xD3\n")
+
+	// object numbers: 1 catalog, 2 page tree, 3 and 4 fonts, then a page and a content object per page
+	pageObject := func(i int) int { return 5 + i*2 }
+
+	w.object(1, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids bytes.Buffer
+	for i := range d.pages {
+		fmt.Fprintf(&kids, "%d 0 R ", pageObject(i))
+	}
+	w.object(2, fmt.Sprintf("<< /Type /Pages /Kids [ %s] /Count %d >>", kids.String(), len(d.pages)))
+	w.object(3, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	w.object(4, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range d.pages {
+		w.object(pageObject(i), fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			page.width, page.height, pdfFontRegular, pdfFontBold, pageObject(i)+1))
+		w.object(pageObject(i)+1, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.content.Len(), page.content.String()))
+	}
+
+	infoReference := ""
+	if len(d.info) > 0 {
+		keys := make([]string, 0, len(d.info))
+		for key := range d.info {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var info bytes.Buffer
+		info.WriteString("<< /Producer (beadmachine)")
+		for _, key := range keys { // hex strings need no escaping
+			fmt.Fprintf(&info, " /%s <%s>", key, hex.EncodeToString([]byte(d.info[key])))
+		}
+		info.WriteString(" >>")
+		infoObject := pageObject(len(d.pages))
+		w.object(infoObject, info.String())
+		infoReference = fmt.Sprintf(" /Info %d 0 R", infoObject)
+	}
+
+	xrefOffset := w.offset
+	objects := len(w.offsets)
+	w.printf("xref\n0 %d\n0000000000 65535 f \n", objects+1)
+	for i := 1; i <= objects; i++ {
+		w.printf("%010d 00000 n \n", w.offsets[i])
+	}
+	w.printf("trailer\n<< /Size %d /Root 1 0 R%s >>\nstartxref\n%d\n%%%%EOF\n", objects+1, infoReference, xrefOffset)
+
+	if w.err != nil {
+		return errors.Wrap(w.err, "writing pdf")
+	}
+	return errors.Wrap(w.w.Flush(), "writing pdf")
+}
+
+// pdfWriter keeps track of the object offsets while writing a PDF document
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets map[int]int
+	err     error
+}
+
+func (w *pdfWriter) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.offset += n
+	w.err = err
+}
+
+func (w *pdfWriter) object(number int, content string) {
+	if w.offsets == nil {
+		w.offsets = make(map[int]int)
+	}
+	w.offsets[number] = w.offset
+	w.printf("%d 0 obj\n%s\nendobj\n", number, content)
+}
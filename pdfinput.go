@@ -0,0 +1,54 @@
+package beadmachine
+
+import (
+	"image"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPDFDPI is the resolution that PDF pages are rasterized at by default
+const defaultPDFDPI = 150
+
+// pdfRasterizer is an external program that converts a PDF page to a PNG image
+type pdfRasterizer struct {
+	command string
+	args    func(fileName string, page, dpi int) []string
+}
+
+// pdfRasterizers contains the supported rasterizers in the order of preference
+var pdfRasterizers = []pdfRasterizer{
+	{
+		command: "pdftoppm",
+		args: func(fileName string, page, dpi int) []string {
+			return []string{"-png", "-singlefile", "-f", strconv.Itoa(page), "-l", strconv.Itoa(page),
+				"-r", strconv.Itoa(dpi), fileName}
+		},
+	},
+	{
+		command: "mutool",
+		args: func(fileName string, page, dpi int) []string {
+			return []string{"draw", "-q", "-F", "png", "-o", "-", "-r", strconv.Itoa(dpi), fileName, strconv.Itoa(page)}
+		},
+	},
+}
+
+// isPDFFile returns whether the file is a PDF file by its extension
+func isPDFFile(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".pdf")
+}
+
+// rasterizePDF rasterizes the page of the PDF file, counted from 1, at the given resolution with the first
+// installed rasterizer
+func rasterizePDF(fileName string, page, dpi int) (image.Image, error) {
+	for _, rasterizer := range pdfRasterizers {
+		if path, err := exec.LookPath(rasterizer.command); err == nil {
+			img, err := runRasterizer(rasterizer.command, path, rasterizer.args(fileName, page, dpi))
+			return img, errors.Wrapf(err, "rasterizing page %d", page)
+		}
+	}
+	return nil, errors.New("rasterizing PDF files requires pdftoppm or mutool to be installed")
+}
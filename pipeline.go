@@ -0,0 +1,275 @@
+package beadmachine
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// pipelineOptions are the flags that can be used as options in the pipeline, the flags that change how the image is
+// converted and rendered. Flags with file names, directories, URLs, commands or plugins are not options, because
+// the pipeline also runs the jobs of the server: the input and the outputs are given by the request fields and every
+// other file or network access of a request would act with the permissions of the server.
+var pipelineOptions = map[string]bool{
+	"page": true, "dpi": true, "ignore-exif": true, "max-input-dimension": true, "max-input-megapixels": true,
+	"width": true, "height": true, "boardswidth": true, "boardsheight": true, "boarddimension": true, "fit": true,
+	"resample": true, "auto-orient": true, "optimize-seams": true, "seam-margin": true, "pad-to-boards": true,
+	"pad-align": true, "grid": true, "craft": true, "tile": true, "tile-mirror": true, "border": true,
+	"fill-background": true, "max-beads": true, "palette": true, "colors": true, "max-colors": true,
+	"translucent": true, "flourescent": true, "merge-duplicates": true, "duplicate-threshold": true,
+	"nocolormatching": true, "distance": true, "cache-size": true, "cache-precision": true, "preserve-faces": true,
+	"adaptive-dither": true, "auto-tune": true, "auto-tune-iterations": true, "grey": true, "auto-levels": true,
+	"auto-contrast": true, "black-point": true, "white-point": true, "adjust": true, "hue-shift": true,
+	"temperature": true, "tint": true, "blur": true, "sharpen": true, "gamma": true, "contrast": true,
+	"brightness": true, "subject-focus": true, "stylize": true, "preset": true, "beadstyle": true,
+	"chart-cell-size": true, "coordinates": true, "coordinates-interval": true, "simulate-cvd": true,
+	"colorblind-safe": true, "html-renderer": true, "lang": true, "units": true, "bead-size": true,
+	"bead-pitch": true, "pdf-scale": true, "print-actual-size": true, "print-dpi": true, "serpentine": true,
+	"poster": true, "gamut-threshold": true, "strict": true, "timeout": true,
+}
+
+// pipelineRequest is the options JSON that the pipeline command reads from stdin
+type pipelineRequest struct {
+	Input     string                 `json:"input"`     // filename of the input image
+	InputData string                 `json:"inputData"` // base64 encoded input image instead of a file
+	InputName string                 `json:"inputName"` // filename of the input data, its extension selects the input format
+	Options   map[string]interface{} `json:"options"`   // values of the conversion flags by name, like "width": 30
+	Outputs   []pipelineOutput       `json:"outputs"`
+}
+
+// pipelineOutput is a requested output of the pipeline and its result
+type pipelineOutput struct {
+	Format string `json:"format"`
+	File   string `json:"file,omitempty"`   // filename or object storage URI, outputs without it are returned as data
+	Data   string `json:"data,omitempty"`   // base64 encoded output
+	Status string `json:"status,omitempty"` // written or failed, missing if the conversion failed before
+	Error  string `json:"error,omitempty"`
+}
+
+// pipelineResult is the result JSON that the pipeline command writes to stdout
+type pipelineResult struct {
+	Status   string           `json:"status"` // succeeded or failed
+	ExitCode int              `json:"exitCode"`
+	Error    string           `json:"error,omitempty"`
+	Duration float64          `json:"duration"` // in seconds
+	Stats    json.RawMessage  `json:"stats,omitempty"`
+	Outputs  []pipelineOutput `json:"outputs"`
+}
+
+// pipelineCommand returns the command that converts an image in a single pass with the options of a JSON request
+func pipelineCommand(rootCmd *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:   "pipeline",
+		Short: "Convert an image with the options of a JSON request from stdin and write a JSON result",
+		Long: `Convert an image with the options of a JSON request read from stdin and write the result as JSON to
+stdout, for stateless containers and for calling beadmachine from other languages without building flags.
+The options are the flags of the conversion by name. Outputs without a file are returned base64 encoded.
+The result is written for failed conversions as well, the exit code is the same as of the conversion.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return startPipeline(cmd, rootCmd, os.Stdin)
+		},
+	}
+}
+
+func startPipeline(cmd *cobra.Command, rootCmd *cobra.Command, stdin io.Reader) error {
+	start := time.Now()
+	result := pipelineResult{Outputs: []pipelineOutput{}}
+	err := runPipeline(cmd, rootCmd, stdin, &result)
+
+	result.Duration = time.Since(start).Seconds()
+	result.Status = "succeeded"
+	if err != nil {
+		result.Status = "failed"
+		result.ExitCode = exitCode(err)
+		result.Error = err.Error()
+	}
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(result); encodeErr != nil && err == nil {
+		err = outputError(errors.Wrap(encodeErr, "writing pipeline result"))
+	}
+	return err
+}
+
+// runPipeline reads the request, converts the image with its options and fills in the result
+func runPipeline(cmd *cobra.Command, rootCmd *cobra.Command, stdin io.Reader, result *pipelineResult) error {
+	logger := logger(cmd)
+	var request pipelineRequest
+	decoder := json.NewDecoder(stdin)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		logger.Error("Reading pipeline request failed", zap.Error(err))
+		return usageError(errors.Wrap(err, "reading pipeline request"))
+	}
+
+	dir, err := ioutil.TempDir("", "beadmachine-pipeline")
+	if err != nil {
+		logger.Error("Creating pipeline directory failed", zap.Error(err))
+		return failureError(errors.Wrap(err, "creating pipeline directory"))
+	}
+	defer os.RemoveAll(dir)
+
+	conversion := &cobra.Command{Use: rootCmd.Use}
+	conversion.Flags().AddFlagSet(rootCmd.Flags())
+	conversion.Flags().AddFlagSet(cmd.InheritedFlags())
+	if err = applyPipelineOptions(conversion, request, dir); err != nil {
+		logger.Error("Invalid pipeline request", zap.Error(err))
+		return usageError(err)
+	}
+
+	statsFileName := filepath.Join(dir, "stats.json")
+	renders := []string{"stats=" + statsFileName}
+	outputs := make([]pipelineOutput, len(request.Outputs))
+	for i, o := range request.Outputs {
+		outputs[i] = pipelineOutput{Format: o.Format, File: o.File}
+		fileName := o.File
+		if fileName == "" {
+			fileName = filepath.Join(dir, fmt.Sprintf("output%d", i))
+		}
+		renders = append(renders, o.Format+"="+fileName)
+	}
+	for _, render := range renders {
+		if err = conversion.Flags().Set("render", render); err != nil {
+			return usageError(errors.Wrap(err, "setting pipeline outputs"))
+		}
+	}
+
+	processErr := runBeadMachine(conversion, nil, nil)
+	var stats PatternStats
+	if data, err := ioutil.ReadFile(statsFileName); err == nil {
+		result.Stats = json.RawMessage(data)
+		_ = json.Unmarshal(data, &stats)
+	}
+	for i, o := range request.Outputs {
+		fileName := o.File
+		if fileName == "" {
+			fileName = filepath.Join(dir, fmt.Sprintf("output%d", i))
+		}
+		for _, status := range stats.Outputs {
+			if status.File == fileName && status.Format == o.Format {
+				outputs[i].Status, outputs[i].Error = status.Status, status.Error
+			}
+		}
+		if o.File != "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil { // outputs of failed conversions are missing
+			continue
+		}
+		outputs[i].Data = base64.StdEncoding.EncodeToString(data)
+	}
+	result.Outputs = outputs
+	return processErr
+}
+
+// applyPipelineOptions sets the input and the option values of the request as flags of the conversion command, the
+// input data is written into the directory
+func applyPipelineOptions(conversion *cobra.Command, request pipelineRequest, dir string) error {
+	switch {
+	case request.Input != "" && request.InputData != "":
+		return errors.New("the request can not contain both input and inputData")
+	case request.Input == "" && request.InputData == "":
+		return errors.New("the request contains no input or inputData")
+	}
+	input := request.Input
+	if request.InputData != "" {
+		data, err := base64.StdEncoding.DecodeString(request.InputData)
+		if err != nil {
+			return errors.Wrap(err, "decoding inputData")
+		}
+		name := filepath.Base(request.InputName)
+		if request.InputName == "" {
+			name = "input"
+		}
+		input = filepath.Join(dir, name)
+		if err = ioutil.WriteFile(input, data, 0644); err != nil {
+			return errors.Wrap(err, "writing input data")
+		}
+	}
+	if err := conversion.Flags().Set("input", input); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(request.Options))
+	for name := range request.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := checkPipelineOption(conversion, name); err != nil {
+			return err
+		}
+		values, err := pipelineOptionValues(request.Options[name])
+		if err != nil {
+			return errors.Wrapf(err, "option '%s'", name)
+		}
+		for _, value := range values {
+			if err = conversion.Flags().Set(name, value); err != nil {
+				return errors.Wrapf(err, "option '%s'", name)
+			}
+		}
+	}
+
+	// the PNG image is always written, it is discarded if not requested
+	if err := conversion.Flags().Set("output", filepath.Join(dir, "pattern.png")); err != nil {
+		return err
+	}
+	for _, o := range request.Outputs {
+		if o.Format == "" {
+			return errors.New("an output has no format")
+		}
+	}
+	return nil
+}
+
+// checkPipelineOption returns an error if the flag can not be used as option in the pipeline
+func checkPipelineOption(conversion *cobra.Command, name string) error {
+	if conversion.Flags().Lookup(name) == nil {
+		return fmt.Errorf("unknown option '%s'", name)
+	}
+	if !pipelineOptions[name] {
+		return fmt.Errorf("the option '%s' can not be used in the pipeline", name)
+	}
+	return nil
+}
+
+// pipelineOptionValues returns the flag values of a JSON option value, arrays set a flag once per element
+func pipelineOptionValues(value interface{}) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, element := range v {
+			if _, nested := element.([]interface{}); nested {
+				return nil, errors.New("arrays can not be nested")
+			}
+			elementValues, err := pipelineOptionValues(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, elementValues...)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %s, expected a string, number, boolean or array", strings.TrimSpace(fmt.Sprint(value)))
+	}
+}
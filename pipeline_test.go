@@ -0,0 +1,68 @@
+package beadmachine
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCheckPipelineOption(t *testing.T) {
+	conversion := &cobra.Command{}
+	conversion.Flags().IntP("width", "", 0, "")
+	conversion.Flags().StringP("palette", "p", "", "")
+	conversion.Flags().StringP("output", "o", "", "")
+	conversion.Flags().StringP("renderer-exec", "", "", "")
+	conversion.Flags().StringP("notify-webhook", "", "", "")
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"width", ""},
+		{"palette", ""},
+		{"output", "the option 'output' can not be used in the pipeline"},
+		{"renderer-exec", "the option 'renderer-exec' can not be used in the pipeline"},
+		{"notify-webhook", "the option 'notify-webhook' can not be used in the pipeline"},
+		{"unknown", "unknown option 'unknown'"},
+		{"p", "unknown option 'p'"},
+	}
+	for _, test := range tests {
+		err := checkPipelineOption(conversion, test.name)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("checkPipelineOption(%q) = %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestPipelineOptionValues(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected []string
+		err      string
+	}{
+		{"hama", []string{"hama"}, ""},
+		{"", []string{""}, ""},
+		{true, []string{"true"}, ""},
+		{false, []string{"false"}, ""},
+		{30.0, []string{"30"}, ""},
+		{0.25, []string{"0.25"}, ""},
+		{1e21, []string{"1000000000000000000000"}, ""},
+		{[]interface{}{}, []string{}, ""},
+		{[]interface{}{"H1", 2.0, true}, []string{"H1", "2", "true"}, ""},
+		{[]interface{}{[]interface{}{"H1"}}, nil, "arrays can not be nested"},
+		{nil, nil, "unsupported value <nil>, expected a string, number, boolean or array"},
+		{map[string]interface{}{"a": 1.0}, nil, "unsupported value map[a:1], expected a string, number, boolean or array"},
+		{[]interface{}{nil}, nil, "unsupported value <nil>, expected a string, number, boolean or array"},
+	}
+	for _, test := range tests {
+		values, err := pipelineOptionValues(test.value)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("pipelineOptionValues(%#v) error = %v, expected %q", test.value, err, test.err)
+			continue
+		}
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("pipelineOptionValues(%#v) = %#v, expected %#v", test.value, values, test.expected)
+		}
+	}
+}
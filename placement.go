@@ -0,0 +1,178 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// placementStep is a run of beads of the HTML placement mode
+type placementStep struct {
+	Board     string   `json:"board"`
+	Row       int      `json:"row"`
+	Reverse   bool     `json:"reverse"`
+	Bead      string   `json:"bead"`
+	Count     int      `json:"count"`
+	Cells     [][2]int `json:"cells"`
+	Remaining int      `json:"remaining"` // runs left in the row after this one
+}
+
+// placementHTMLHeader contains the styles of the HTML placement mode
+const placementHTMLHeader = `<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style type="text/css">
+body { font-family: sans-serif; margin: 0; }
+#status { position: sticky; top: 0; background-color: #FFFFFF; padding: 8px; border-bottom: 2px solid black; font-size: x-large; }
+#status small { font-size: small; color: #606060; }
+table { border-spacing: 0px; margin: 8px; }
+td { width: 16px; height: 16px; border: 1px solid #E0E0E0; text-align: center; font-size: x-small; }
+td.cur { outline: 3px solid #FF00FF; outline-offset: -2px; }
+td.done { opacity: 0.35; }
+.lb { border-left: 2px solid black !important; }
+.tb { border-top: 2px solid black !important; }
+</style>
+</head>
+<body>
+<div id="status"></div>
+<table>
+`
+
+// placementHTMLScript contains the keyboard handling of the HTML placement mode
+const placementHTMLScript = `<script>
+var current = 0;
+function cell(c) { return document.getElementById("c" + c[0] + "_" + c[1]); }
+function show() {
+  steps.forEach(function(step, i) {
+    step.cells.forEach(function(c) {
+      cell(c).classList.toggle("cur", i === current);
+      cell(c).classList.toggle("done", i < current);
+    });
+  });
+  var step = steps[current];
+  var bead = step.bead === "" ? text.empty : step.bead;
+  document.getElementById("status").innerHTML = text.board + " " + step.board + ", " + text.row + " " + step.row + " " +
+    (step.reverse ? "&larr;" : "&rarr;") + " <b>" + step.count + "&times; " + bead + "</b>" +
+    " <small>" + step.remaining + " " + text.more + " " + (current + 1) + " " + text.of + " " + steps.length +
+    " - " + text.move + "</small>";
+  cell(step.cells[0]).scrollIntoView({block: "nearest", inline: "nearest"});
+}
+document.addEventListener("keydown", function(e) {
+  if (e.key === " " || e.key === "ArrowRight" || e.key === "ArrowDown" || e.key === "Enter") {
+    current = Math.min(current + 1, steps.length - 1);
+  } else if (e.key === "ArrowLeft" || e.key === "ArrowUp" || e.key === "Backspace") {
+    current = Math.max(current - 1, 0);
+  } else {
+    return;
+  }
+  e.preventDefault();
+  show();
+});
+if (steps.length > 0) { show(); }
+</script>
+</body>
+</html>
+`
+
+// placementSteps returns all runs of the pattern board by board, the rows of a board alternate between
+// left to right and right to left
+func placementSteps(pattern *Pattern) []placementStep {
+	dimension := pattern.BoardDimension
+	var steps []placementStep
+
+	for boardY := 0; boardY*dimension < pattern.Height; boardY++ {
+		for boardX := 0; boardX*dimension < pattern.Width; boardX++ {
+			x0, y0 := boardX*dimension, boardY*dimension
+			x1, y1 := minInt(x0+dimension, pattern.Width), minInt(y0+dimension, pattern.Height)
+
+			for y := y0; y < y1; y++ {
+				reverse := (y-y0)%2 == 1
+				runs := rowRuns(pattern, y, x0, x1, reverse)
+				x, direction := x0, 1
+				if reverse {
+					x, direction = x1-1, -1
+				}
+
+				var rowSteps []placementStep
+				for _, run := range runs {
+					step := placementStep{
+						Board:   boardName(boardX, boardY),
+						Row:     y + 1,
+						Reverse: reverse,
+						Bead:    run.bead,
+						Count:   run.count,
+					}
+					for j := 0; j < run.count; j++ {
+						step.Cells = append(step.Cells, [2]int{x, y})
+						x += direction
+					}
+					if run.bead != "" { // empty runs need no placement
+						rowSteps = append(rowSteps, step)
+					}
+				}
+				for i := range rowSteps {
+					rowSteps[i].Remaining = len(rowSteps) - 1 - i
+				}
+				steps = append(steps, rowSteps...)
+			}
+		}
+	}
+	return steps
+}
+
+// renderPlacementHTML renders an interactive HTML page that highlights the current run of beads
+// to place, it is advanced with the keyboard
+func (m *beadMachine) renderPlacementHTML(pattern *Pattern, writer io.Writer) error {
+	steps, err := json.Marshal(placementSteps(pattern))
+	if err != nil {
+		return errors.Wrap(err, "marshalling placement steps")
+	}
+	text, err := json.Marshal(map[string]string{
+		"empty": m.tr("empty"),
+		"board": m.tr("Board"),
+		"row":   m.tr("row"),
+		"more":  m.tr("more in this row, step"),
+		"of":    m.tr("of"),
+		"move":  m.tr("space or arrow keys to move"),
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshalling placement texts")
+	}
+
+	w := bufio.NewWriter(writer)
+	fmt.Fprintf(w, placementHTMLHeader, html.EscapeString(m.tr("Bead placement")))
+	for y := 0; y < pattern.Height; y++ {
+		w.WriteString("<tr>")
+		for x := 0; x < pattern.Width; x++ {
+			cell := pattern.Cell(x, y)
+			fmt.Fprintf(w, "<td id=\"c%d_%d\"", x, y)
+			if !cell.Empty() {
+				fmt.Fprintf(w, " bgcolor=\"#%02X%02X%02X\" title=\"%s\"", cell.Color.R, cell.Color.G, cell.Color.B, html.EscapeString(cell.Bead))
+			}
+			boardLeft := x%pattern.BoardDimension == 0
+			boardTop := y%pattern.BoardDimension == 0
+			switch {
+			case boardLeft && boardTop:
+				w.WriteString(" class=\"lb tb\"")
+			case boardLeft:
+				w.WriteString(" class=\"lb\"")
+			case boardTop:
+				w.WriteString(" class=\"tb\"")
+			}
+			w.WriteString(">" + htmlCellSymbol(pattern, cell) + "</td>")
+		}
+		w.WriteString("</tr>\n")
+	}
+	w.WriteString("</table>\n<script>\nvar steps = ")
+	w.Write(steps)
+	w.WriteString(";\nvar text = ")
+	w.Write(text)
+	w.WriteString(";\n</script>\n")
+	w.WriteString(placementHTMLScript)
+	return errors.Wrap(w.Flush(), "writing HTML placement file")
+}
@@ -0,0 +1,219 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// poster layout in points
+const (
+	posterMargin       = 36.0 // unprinted page border that contains the crop marks and the panel index
+	posterOverlapCells = 2    // cells that are repeated on the next panel to tape the panels together
+	posterCropMark     = 12.0
+	posterCropMarkGap  = 4.0
+	posterFontSize     = 9.0
+)
+
+var (
+	posterGridColor    = color.RGBA{200, 200, 200, 255}
+	posterBoardColor   = color.RGBA{64, 64, 64, 255}
+	posterOverlapColor = color.RGBA{230, 230, 230, 255}
+	posterMarkColor    = color.RGBA{0, 0, 0, 255}
+)
+
+// posterPaperSizes contains the supported poster paper sizes in points in portrait orientation
+var posterPaperSizes = map[string][2]float64{
+	"a3":     {841.89, 1190.55},
+	"a4":     {pdfA4Width, pdfA4Height},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+	"legal":  {612, 1008},
+}
+
+// posterPaperSize returns the width and height in points of the named paper size
+func posterPaperSize(name string) (float64, float64, error) {
+	size, ok := posterPaperSizes[strings.ToLower(name)]
+	if !ok {
+		return 0, 0, fmt.Errorf("unknown poster paper size '%s'", name)
+	}
+	return size[0], size[1], nil
+}
+
+// posterPaperNames returns the sorted names of the supported poster paper sizes
+func posterPaperNames() []string {
+	var names []string
+	for name := range posterPaperSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// posterFileName returns the default poster output filename that is based on the input filename
+func posterFileName(inputFileName string) string {
+	return strings.TrimSuffix(inputFileName, filepath.Ext(inputFileName)) + "_poster.pdf"
+}
+
+// renderPoster renders the pattern as PDF that is split into printer page sized panels, every panel repeats
+// the last cells of its neighbor panel as overlap and has crop marks at the corners of the area to cut out
+func (m *beadMachine) renderPoster(pattern *Pattern, w io.Writer) error {
+	pageWidth, pageHeight, err := posterPaperSize(m.posterPaper)
+	if err != nil {
+		return err
+	}
+
+	posterCellSize := m.beadPitch / mmPerPoint // every bead is printed in its real size
+	printableWidth := pageWidth - 2*posterMargin
+	if pattern.Offset() { // the shifted rows stick out by half a cell
+		printableWidth -= posterCellSize / 2
+	}
+	columns := int(printableWidth / posterCellSize)
+	rows := int((pageHeight - 2*posterMargin) / posterCellSize)
+	if columns <= posterOverlapCells || rows <= posterOverlapCells {
+		return fmt.Errorf("poster paper size '%s' is too small", m.posterPaper)
+	}
+	stepX, stepY := columns-posterOverlapCells, rows-posterOverlapCells
+	panelsX := maxInt(1, boardsNeeded(pattern.Width-posterOverlapCells, stepX))
+	panelsY := maxInt(1, boardsNeeded(pattern.Height-posterOverlapCells, stepY))
+
+	doc := &pdfDocument{}
+	for panelY := 0; panelY < panelsY; panelY++ {
+		for panelX := 0; panelX < panelsX; panelX++ {
+			x0, y0 := panelX*stepX, panelY*stepY
+			x1, y1 := minInt(x0+columns, pattern.Width), minInt(y0+rows, pattern.Height)
+
+			page := doc.addPage(pageWidth, pageHeight)
+			page.setFillColor(posterMarkColor)
+			page.text(posterMargin, posterMargin-posterCropMark-posterCropMarkGap, pdfFontBold, posterFontSize,
+				m.tr("Panel %d of %d (column %d, row %d) - pattern columns %d-%d, rows %d-%d",
+					panelY*panelsX+panelX+1, panelsX*panelsY, panelX+1, panelY+1, x0+1, x1, y0+1, y1))
+
+			// the overlap is cut off on all panels except the last panel of a row or column
+			trimX1, trimY1 := x1, y1
+			if panelX < panelsX-1 {
+				trimX1 = x1 - posterOverlapCells
+				page.setFillColor(posterOverlapColor)
+				page.rect(posterMargin+float64(trimX1-x0)*posterCellSize, posterMargin,
+					float64(x1-trimX1)*posterCellSize, float64(y1-y0)*posterCellSize, true, false)
+			}
+			if panelY < panelsY-1 {
+				trimY1 = y1 - posterOverlapCells
+				page.setFillColor(posterOverlapColor)
+				page.rect(posterMargin, posterMargin+float64(trimY1-y0)*posterCellSize,
+					float64(x1-x0)*posterCellSize, float64(y1-trimY1)*posterCellSize, true, false)
+			}
+
+			m.drawPatternCells(page, pattern, x0, y0, x1, y1, posterCellSize)
+			if m.coordinates {
+				m.drawPDFCoordinates(page, pattern, x0, y0, x1, y1, posterMargin, posterMargin, posterCellSize)
+			}
+			drawCropMarks(page, posterMargin, posterMargin,
+				posterMargin+float64(trimX1-x0)*posterCellSize, posterMargin+float64(trimY1-y0)*posterCellSize)
+		}
+	}
+	if err = m.addPDFFingerprint(doc, pattern); err != nil {
+		return err
+	}
+	return doc.write(w)
+}
+
+// drawPatternCells draws the pattern cells of the area with the given cell size inside of the page margin and a
+// grid that highlights the board borders
+func (m *beadMachine) drawPatternCells(page *pdfPage, pattern *Pattern, x0, y0, x1, y1 int, cellSize float64) {
+	if pattern.Offset() {
+		drawOffsetPatternCells(page, pattern, x0, y0, x1, y1, cellSize)
+		return
+	}
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			cell := pattern.Cell(x, y)
+			if cell.Empty() {
+				continue
+			}
+			page.setFillColor(cell.Color)
+			page.rect(posterMargin+float64(x-x0)*cellSize, posterMargin+float64(y-y0)*cellSize,
+				cellSize, cellSize, true, false)
+		}
+	}
+
+	width := float64(x1-x0) * cellSize
+	height := float64(y1-y0) * cellSize
+	for _, board := range []bool{false, true} {
+		if board {
+			page.setStrokeColor(posterBoardColor)
+			page.setLineWidth(1)
+		} else {
+			page.setStrokeColor(posterGridColor)
+			page.setLineWidth(0.25)
+		}
+		for x := x0; x <= x1; x++ {
+			if (x%pattern.BoardDimension == 0) == board {
+				page.line(posterMargin+float64(x-x0)*cellSize, posterMargin, posterMargin+float64(x-x0)*cellSize, posterMargin+height)
+			}
+		}
+		for y := y0; y <= y1; y++ {
+			if (y%pattern.BoardDimension == 0) == board {
+				page.line(posterMargin, posterMargin+float64(y-y0)*cellSize, posterMargin+width, posterMargin+float64(y-y0)*cellSize)
+			}
+		}
+	}
+}
+
+// drawOffsetPatternCells draws the cells of an offset grid with every second row shifted by half a cell. The grid
+// lines do not run through the shifted rows, so every cell gets its own outline and only the rows of the board
+// borders are highlighted.
+func drawOffsetPatternCells(page *pdfPage, pattern *Pattern, x0, y0, x1, y1 int, cellSize float64) {
+	page.setStrokeColor(posterGridColor)
+	page.setLineWidth(0.25)
+	for y := y0; y < y1; y++ {
+		shift := pattern.rowShift(y) * cellSize
+		for x := x0; x < x1; x++ {
+			cell := pattern.Cell(x, y)
+			left, top := posterMargin+float64(x-x0)*cellSize+shift, posterMargin+float64(y-y0)*cellSize
+			if !cell.Empty() {
+				page.setFillColor(cell.Color)
+			}
+			page.rect(left, top, cellSize, cellSize, !cell.Empty(), true)
+		}
+	}
+
+	width := (float64(x1-x0) + 0.5) * cellSize
+	page.setStrokeColor(posterBoardColor)
+	page.setLineWidth(1)
+	for y := y0; y <= y1; y++ {
+		if y%pattern.BoardDimension == 0 {
+			page.line(posterMargin, posterMargin+float64(y-y0)*cellSize, posterMargin+width, posterMargin+float64(y-y0)*cellSize)
+		}
+	}
+}
+
+// drawCropMarks draws crop marks outside of the corners of the given rectangle
+func drawCropMarks(page *pdfPage, left, top, right, bottom float64) {
+	page.setStrokeColor(posterMarkColor)
+	page.setLineWidth(0.5)
+	for _, x := range []float64{left, right} {
+		for _, y := range []float64{top, bottom} {
+			dx, dy := -1.0, -1.0
+			if x == right {
+				dx = 1
+			}
+			if y == bottom {
+				dy = 1
+			}
+			page.line(x+dx*posterCropMarkGap, y, x+dx*(posterCropMarkGap+posterCropMark), y)
+			page.line(x, y+dy*posterCropMarkGap, x, y+dy*(posterCropMarkGap+posterCropMark))
+		}
+	}
+}
+
+// maxInt returns the larger of the two integers
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,229 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+// preset is a named set of flag values that is applied to all flags that are not set explicitly
+type preset map[string]string
+
+// builtinPresets contains the curated presets that are shipped with beadmachine
+var builtinPresets = map[string]preset{
+	"pixelart": {
+		"resample": resampleNearest,
+		"fit":      fitContain,
+	},
+	"photo": {
+		"sharpen":  "1",
+		"contrast": "10",
+		"fit":      fitCover,
+	},
+	"portrait": {
+		"blur":       "0.5",
+		"contrast":   "5",
+		"brightness": "5",
+		"fit":        fitCover,
+	},
+	"poster": {
+		"blur":     "1",
+		"sharpen":  "2",
+		"contrast": "30",
+		"fit":      fitContain,
+	},
+}
+
+// userPresetsFileName returns the filename of the user presets in the config directory
+func userPresetsFileName() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "getting config directory")
+	}
+	return filepath.Join(dir, "beadmachine", "presets.json"), nil
+}
+
+// loadUserPresets loads the user presets, a missing presets file contains no presets
+func loadUserPresets() (map[string]preset, error) {
+	fileName, err := userPresetsFileName()
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return map[string]preset{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading presets file")
+	}
+
+	presets := make(map[string]preset)
+	if err = json.Unmarshal(data, &presets); err != nil {
+		return nil, errors.Wrap(err, "parsing presets file")
+	}
+	return presets, nil
+}
+
+// saveUserPresets stores the user presets in the config directory
+func saveUserPresets(presets map[string]preset) error {
+	fileName, err := userPresetsFileName()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return errors.Wrap(err, "creating config directory")
+	}
+
+	data, err := json.MarshalIndent(presets, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling presets")
+	}
+	return errors.Wrap(ioutil.WriteFile(fileName, append(data, '\n'), 0644), "writing presets file")
+}
+
+// findPreset returns the named preset, user presets take precedence over the built-in ones
+func findPreset(name string) (preset, error) {
+	userPresets, err := loadUserPresets()
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := userPresets[name]; ok {
+		return p, nil
+	}
+	if p, ok := builtinPresets[name]; ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("unknown preset '%s'", name)
+}
+
+// presetNames returns the sorted names of all built-in and user presets
+func presetNames() []string {
+	names := make(map[string]bool)
+	for name := range builtinPresets {
+		names[name] = true
+	}
+	userPresets, _ := loadUserPresets()
+	for name := range userPresets {
+		names[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// apply sets the preset values of all flags that were not set on the command line
+func (p preset) apply(flags *pflag.FlagSet) error {
+	for name, value := range p {
+		if flags.Changed(name) {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return errors.Wrapf(err, "applying preset value of flag --%s", name)
+		}
+	}
+	return nil
+}
+
+// String returns the preset values in the format of command line flags
+func (p preset) String() string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := make([]string, len(names))
+	for i, name := range names {
+		flags[i] = fmt.Sprintf("--%s=%s", name, p[name])
+	}
+	return strings.Join(flags, " ")
+}
+
+// presetCommand returns the command to manage the user presets
+func presetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preset",
+		Short: "Manage the presets that are applied with --preset",
+	}
+
+	saveCmd := &cobra.Command{
+		Use:   "save name flag=value...",
+		Short: "Save a user preset of flag values, like: preset save soft blur=2 contrast=10",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  savePreset,
+	}
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all presets",
+		Args:  cobra.NoArgs,
+		RunE:  listPresets,
+	}
+
+	cmd.AddCommand(saveCmd, listCmd)
+	return cmd
+}
+
+func savePreset(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	name := args[0]
+	rootFlags := cmd.Root().Flags()
+
+	p := make(preset)
+	for _, definition := range args[1:] {
+		flagName, value, err := splitDefinition(definition)
+		if err == nil && (flagName == "preset" || rootFlags.Lookup(flagName) == nil) {
+			err = fmt.Errorf("unknown flag '%s'", flagName)
+		}
+		if err == nil { // validate the value by setting it on the unused flag of the root command
+			err = rootFlags.Set(flagName, value)
+		}
+		if err != nil {
+			logger.Error("Invalid preset value", zap.Error(err))
+			return usageError(err)
+		}
+		p[flagName] = value
+	}
+
+	presets, err := loadUserPresets()
+	if err == nil {
+		presets[name] = p
+		err = saveUserPresets(presets)
+	}
+	if err != nil {
+		logger.Error("Saving preset failed", zap.Error(err))
+		return failureError(err)
+	}
+	logger.Info("Preset saved", zap.String("name", name), zap.String("flags", p.String()))
+	return nil
+}
+
+func listPresets(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	userPresets, err := loadUserPresets()
+	if err != nil {
+		logger.Error("Loading presets failed", zap.Error(err))
+		return failureError(err)
+	}
+
+	for _, name := range presetNames() {
+		if p, ok := userPresets[name]; ok {
+			logger.Info("User preset", zap.String("name", name), zap.String("flags", p.String()))
+			continue
+		}
+		logger.Info("Built-in preset", zap.String("name", name), zap.String("flags", builtinPresets[name].String()))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package beadmachine
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+// processPreviews converts the input image to every preview width and writes a PNG per width and a side-by-side
+// image of all previews. The image is read and filtered once, only resizing and matching run per width.
+func (m *beadMachine) processPreviews() error {
+	widest := 0
+	for _, width := range m.previewWidths {
+		widest = maxInt(widest, width)
+	}
+	inputImage, err := m.readInput(widest, 0)
+	if err != nil {
+		return err
+	}
+	inputImage = m.applyFilters(inputImage)
+
+	width, height, boardsWidth, boardsHeight := m.width, m.height, m.boardsWidth, m.boardsHeight
+	defer func() {
+		m.width, m.height, m.boardsWidth, m.boardsHeight = width, height, boardsWidth, boardsHeight
+	}()
+	m.height, m.boardsWidth, m.boardsHeight = 0, 0, 0
+
+	names := make([]string, 0, len(m.previewWidths))
+	patterns := make([]*Pattern, 0, len(m.previewWidths))
+	for _, previewWidth := range m.previewWidths {
+		if err = m.cancelled(); err != nil {
+			m.logger.Error("Previews cancelled", zap.Error(err))
+			return err
+		}
+		m.width = previewWidth
+		fitted, err := m.fitImage(inputImage)
+		if err != nil {
+			return err
+		}
+		pattern, err := m.matchImage(fitted)
+		if err != nil {
+			return err
+		}
+		stats := pattern.Stats()
+		m.logger.Info("Preview",
+			zap.Int("width", pattern.Width),
+			zap.Int("height", pattern.Height),
+			zap.Int("beads", stats.Beads),
+			zap.Int("colors", stats.Colors),
+			zap.Float64("mean ΔE", stats.MeanDistance),
+			zap.Int("boards width", boardsNeeded(pattern.Width, m.boardDimension)),
+			zap.Int("boards height", boardsNeeded(pattern.Height, m.boardDimension)))
+		names = append(names, fmt.Sprintf("%dx%d", pattern.Width, pattern.Height))
+		patterns = append(patterns, pattern)
+	}
+
+	pngRenderer, _ := m.renderer("png")
+	outputs := []output{
+		{
+			format:   "previews",
+			fileName: m.variantFileName("previews"),
+			renderer: RendererFunc(func(_ *Pattern, w io.Writer) error {
+				return m.renderComparison(names, patterns, w)
+			}),
+		},
+	}
+	for i, previewWidth := range m.previewWidths {
+		pattern := patterns[i]
+		outputs = append(outputs, output{
+			format:   "png",
+			fileName: m.variantFileName("preview" + strconv.Itoa(previewWidth)),
+			renderer: RendererFunc(func(_ *Pattern, w io.Writer) error {
+				return pngRenderer.Render(pattern, w)
+			}),
+		})
+	}
+
+	failed := 0
+	for i, o := range outputs {
+		var pattern *Pattern // the size of every preview is available to the name template
+		if i > 0 {
+			pattern = patterns[i-1]
+		}
+		if o.fileName, err = m.outputPath(o, pattern); err != nil {
+			m.logger.Error("Preparing output failed", zap.String("format", o.format), zap.Error(err))
+			return usageError(err)
+		}
+		if err = writeOutput(o, nil); err != nil {
+			m.logger.Error("Writing output failed",
+				zap.String("format", o.format),
+				zap.String("file", o.fileName),
+				zap.Error(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return outputError(fmt.Errorf("%d of %d outputs failed", failed, len(outputs)))
+	}
+	return nil
+}
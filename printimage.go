@@ -0,0 +1,95 @@
+package beadmachine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPrintDPI is the resolution of the print sized PNG output if none is given
+const defaultPrintDPI = 300
+
+// renderPrintImage renders the pattern as PNG whose size matches the real size of the pattern at the print
+// resolution, so that a printout can be taped beneath a transparent pegboard. The resolution is stored in the
+// file, so that printing it at 100% scale keeps the size.
+func (m *beadMachine) renderPrintImage(pattern *Pattern, w io.Writer) error {
+	pixelPerMM := float64(m.printDPI) / 25.4
+	width := int(math.Round(float64(pattern.Width) * m.beadPitch * pixelPerMM))
+	height := int(math.Round(float64(pattern.Height) * m.beadPitch * pixelPerMM))
+	if width == 0 || height == 0 {
+		return errors.New("the pattern is empty")
+	}
+
+	// the cell borders are rounded to whole pixels, so that the image size is exact for every bead pitch
+	columns := make([]int, pattern.Width+1)
+	for x := range columns {
+		columns[x] = x * width / pattern.Width
+	}
+	rows := make([]int, pattern.Height+1)
+	for y := range rows {
+		rows[y] = y * height / pattern.Height
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			cell := pattern.Cell(x, y)
+			if cell.Empty() {
+				continue
+			}
+			rect := image.Rect(columns[x], rows[y], columns[x+1], rows[y+1])
+			draw.Draw(img, rect, image.NewUniform(cell.Color), image.Point{}, draw.Src)
+		}
+	}
+
+	for x, left := range columns {
+		c := posterGridColor
+		if x%pattern.BoardDimension == 0 || x == pattern.Width {
+			c = posterBoardColor
+		}
+		draw.Draw(img, image.Rect(left-1, 0, left+1, height), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+	for y, top := range rows {
+		c := posterGridColor
+		if y%pattern.BoardDimension == 0 || y == pattern.Height {
+			c = posterBoardColor
+		}
+		draw.Draw(img, image.Rect(0, top-1, width, top+1), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return errors.Wrap(err, "encoding png file")
+	}
+	_, err := w.Write(pngWithDPI(buf.Bytes(), m.printDPI))
+	return errors.Wrap(err, "writing png file")
+}
+
+// pngWithDPI inserts a pHYs chunk with the resolution after the IHDR chunk of the encoded PNG image, the
+// encoder of the standard library does not write it
+func pngWithDPI(data []byte, dpi int) []byte {
+	const headerEnd = 8 + 4 + 4 + 13 + 4 // signature and length, type, data and CRC of the IHDR chunk
+
+	pixelPerMeter := uint32(math.Round(float64(dpi) / 0.0254))
+	chunk := make([]byte, 4+4+9+4)
+	binary.BigEndian.PutUint32(chunk[0:], 9)
+	copy(chunk[4:], "pHYs")
+	binary.BigEndian.PutUint32(chunk[8:], pixelPerMeter)
+	binary.BigEndian.PutUint32(chunk[12:], pixelPerMeter)
+	chunk[16] = 1 // the unit is meter
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+
+	result := make([]byte, 0, len(data)+len(chunk))
+	result = append(result, data[:headerEnd]...)
+	result = append(result, chunk...)
+	return append(result, data[headerEnd:]...)
+}
@@ -0,0 +1,358 @@
+package beadmachine
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// projectSchema contains the tables of a project database, the inventory table of the
+// sqlite palette provider can be part of the same database
+const projectSchema = `CREATE TABLE IF NOT EXISTS projects (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	created    TEXT NOT NULL,
+	input_file TEXT NOT NULL,
+	input_hash TEXT NOT NULL,
+	settings   TEXT NOT NULL,
+	stats      TEXT NOT NULL,
+	pattern    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS deductions (
+	project_id INTEGER NOT NULL REFERENCES projects(id),
+	name       TEXT NOT NULL,
+	quantity   INTEGER NOT NULL
+)`
+
+// project is a conversion that is stored in the project database
+type project struct {
+	ID         int64           `json:"id"`
+	Created    time.Time       `json:"created"`
+	InputFile  string          `json:"inputFile"`
+	InputHash  string          `json:"inputHash"`
+	Settings   json.RawMessage `json:"settings"`
+	Stats      json.RawMessage `json:"stats"`
+	Pattern    json.RawMessage `json:"pattern,omitempty"`
+	Deductions map[string]int  `json:"deductions,omitempty"`
+}
+
+// openProjectDB opens the project database and creates the tables if needed
+func openProjectDB(fileName string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening project database")
+	}
+	if _, err = db.Exec(projectSchema); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "creating project tables")
+	}
+	return db, nil
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file content
+func hashFile(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", errors.Wrap(err, "opening file")
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", errors.Wrap(err, "hashing file")
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// saveProject stores the conversion in the project database and optionally deducts the used beads
+// from the inventory
+func (m *beadMachine) saveProject(pattern *Pattern) error {
+	inputHash, err := hashFile(m.inputFileName)
+	if err != nil {
+		return err
+	}
+	settings, err := json.Marshal(m.settings())
+	if err != nil {
+		return errors.Wrap(err, "marshalling settings")
+	}
+	stats := pattern.Stats()
+	statsData, err := json.Marshal(stats)
+	if err != nil {
+		return errors.Wrap(err, "marshalling stats")
+	}
+	patternData, err := json.Marshal(pattern)
+	if err != nil {
+		return errors.Wrap(err, "marshalling pattern")
+	}
+
+	db, err := openProjectDB(m.projectDBFileName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO projects (created, input_file, input_hash, settings, stats, pattern) VALUES (?, ?, ?, ?, ?, ?)",
+		time.Now().UTC().Format(time.RFC3339), m.inputFileName, inputHash, string(settings), string(statsData), string(patternData))
+	if err != nil {
+		return errors.Wrap(err, "inserting project")
+	}
+	projectID, err := result.LastInsertId()
+	if err != nil {
+		return errors.Wrap(err, "getting project id")
+	}
+
+	if m.deductInventory {
+		if err = m.deductInventoryBeads(tx, projectID, stats.BeadCounts); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return errors.Wrap(err, "committing project")
+	}
+	m.logger.Info("Project saved", zap.Int64("id", projectID), zap.String("database", m.projectDBFileName))
+	return nil
+}
+
+// deductInventoryBeads deducts the used beads from the inventory table if the database contains one
+func (m *beadMachine) deductInventoryBeads(tx *sql.Tx, projectID int64, beadCounts map[string]int) error {
+	var tables int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'inventory'").Scan(&tables); err != nil {
+		return errors.Wrap(err, "looking up inventory table")
+	}
+	if tables == 0 {
+		m.logger.Warn("Project database contains no inventory to deduct beads from")
+		return nil
+	}
+
+	for name, count := range beadCounts {
+		var quantity int
+		err := tx.QueryRow("SELECT quantity FROM inventory WHERE name = ?", name).Scan(&quantity)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "querying inventory")
+		}
+
+		deducted := count
+		if quantity < count {
+			m.logger.Warn("Not enough beads in inventory",
+				zap.String("color", name),
+				zap.Int("needed", count),
+				zap.Int("available", quantity))
+			deducted = quantity
+		}
+		if _, err = tx.Exec("UPDATE inventory SET quantity = ? WHERE name = ?", quantity-deducted, name); err != nil {
+			return errors.Wrap(err, "updating inventory")
+		}
+		if _, err = tx.Exec("INSERT INTO deductions (project_id, name, quantity) VALUES (?, ?, ?)", projectID, name, deducted); err != nil {
+			return errors.Wrap(err, "inserting deduction")
+		}
+	}
+	return nil
+}
+
+// loadProject loads a project including its pattern and inventory deductions
+func loadProject(db *sql.DB, id int64) (*project, error) {
+	p := &project{ID: id}
+	var created, settings, stats, pattern string
+	err := db.QueryRow("SELECT created, input_file, input_hash, settings, stats, pattern FROM projects WHERE id = ?", id).
+		Scan(&created, &p.InputFile, &p.InputHash, &settings, &stats, &pattern)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project %d not found", id)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "querying project")
+	}
+	p.Created, _ = time.Parse(time.RFC3339, created)
+	p.Settings = json.RawMessage(settings)
+	p.Stats = json.RawMessage(stats)
+	p.Pattern = json.RawMessage(pattern)
+
+	rows, err := db.Query("SELECT name, quantity FROM deductions WHERE project_id = ?", id)
+	if err != nil {
+		return nil, errors.Wrap(err, "querying deductions")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var quantity int
+		if err = rows.Scan(&name, &quantity); err != nil {
+			return nil, errors.Wrap(err, "reading deductions")
+		}
+		if p.Deductions == nil {
+			p.Deductions = make(map[string]int)
+		}
+		p.Deductions[name] = quantity
+	}
+	return p, errors.Wrap(rows.Err(), "reading deductions")
+}
+
+// projectsCommand returns the command to manage the conversions stored in a project database
+func projectsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "projects",
+		Short: "Manage the conversions stored in a project database",
+	}
+	cmd.PersistentFlags().StringP("project-db", "", "beads.db", "filename of the SQLite project database")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List all projects",
+		Args:  cobra.NoArgs,
+		RunE:  listProjects,
+	}
+	showCmd := &cobra.Command{
+		Use:   "show id",
+		Short: "Show the details of a project",
+		Args:  cobra.ExactArgs(1),
+		RunE:  showProject,
+	}
+	exportCmd := &cobra.Command{
+		Use:   "export id",
+		Short: "Export a project including its pattern as JSON",
+		Args:  cobra.ExactArgs(1),
+		RunE:  exportProject,
+	}
+	exportCmd.Flags().StringP("output", "o", "", "output filename for the JSON export, defaults to stdout")
+
+	cmd.AddCommand(listCmd, showCmd, exportCmd)
+	return cmd
+}
+
+func listProjects(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	fileName, _ := cmd.Flags().GetString("project-db")
+
+	db, err := openProjectDB(fileName)
+	if err != nil {
+		logger.Error("Opening project database failed", zap.Error(err))
+		return failureError(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, created, input_file, stats FROM projects ORDER BY id")
+	if err != nil {
+		logger.Error("Querying projects failed", zap.Error(err))
+		return failureError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var created, inputFile, statsData string
+		if err = rows.Scan(&id, &created, &inputFile, &statsData); err != nil {
+			logger.Error("Reading project failed", zap.Error(err))
+			return failureError(err)
+		}
+		var stats PatternStats
+		_ = json.Unmarshal([]byte(statsData), &stats)
+		logger.Info("Project",
+			zap.Int64("id", id),
+			zap.String("created", created),
+			zap.String("input", inputFile),
+			zap.Int("width", stats.Width),
+			zap.Int("height", stats.Height),
+			zap.Int("colors", stats.Colors),
+			zap.Int("beads", stats.Beads))
+	}
+	if err = rows.Err(); err != nil {
+		logger.Error("Reading projects failed", zap.Error(err))
+		return failureError(err)
+	}
+	return nil
+}
+
+func showProject(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	p, err := loadProjectArgument(cmd, args)
+	if err != nil {
+		logger.Error("Loading project failed", zap.Error(err))
+		return failureError(err)
+	}
+
+	var stats PatternStats
+	_ = json.Unmarshal(p.Stats, &stats)
+	logger.Info("Project",
+		zap.Int64("id", p.ID),
+		zap.Time("created", p.Created),
+		zap.String("input", p.InputFile),
+		zap.String("input hash", p.InputHash),
+		zap.String("settings", string(p.Settings)))
+	logger.Info("Pattern",
+		zap.Int("width", stats.Width),
+		zap.Int("height", stats.Height),
+		zap.Int("boards width", stats.BoardsWidth),
+		zap.Int("boards height", stats.BoardsHeight),
+		zap.Int("beads", stats.Beads))
+	for usedColor, count := range stats.BeadCounts {
+		logger.Info("Beads used", zap.String("color", usedColor), zap.Int("count", count))
+	}
+	for name, quantity := range p.Deductions {
+		logger.Info("Beads deducted from inventory", zap.String("color", name), zap.Int("count", quantity))
+	}
+	return nil
+}
+
+func exportProject(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	outputFileName, _ := cmd.Flags().GetString("output")
+
+	p, err := loadProjectArgument(cmd, args)
+	if err != nil {
+		logger.Error("Loading project failed", zap.Error(err))
+		return failureError(err)
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		logger.Error("Marshalling project failed", zap.Error(err))
+		return failureError(err)
+	}
+	data = append(data, '\n')
+
+	if outputFileName == "" {
+		if _, err = os.Stdout.Write(data); err != nil {
+			return outputError(err)
+		}
+		return nil
+	}
+	if err = ioutil.WriteFile(outputFileName, data, 0644); err != nil {
+		logger.Error("Writing project export failed", zap.Error(err))
+		return outputError(err)
+	}
+	return nil
+}
+
+// loadProjectArgument loads the project whose id is passed as argument
+func loadProjectArgument(cmd *cobra.Command, args []string) (*project, error) {
+	fileName, _ := cmd.Flags().GetString("project-db")
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing project id")
+	}
+
+	db, err := openProjectDB(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return loadProject(db, id)
+}
@@ -0,0 +1,286 @@
+package beadmachine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html"
+	"image"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// colorRegion is a connected region of cells with the same bead, as polygon rings around the cell edges. The first
+// ring is the outline, the other rings are holes. The coordinates are cell corners.
+type colorRegion struct {
+	bead  string
+	beads int
+	rings [][]image.Point
+}
+
+// regionsFormat returns the output format of the region export, GeoJSON for .geojson and .json files and SVG
+// for all others
+func regionsFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".geojson", ".json":
+		return "regionsgeojson"
+	}
+	return "regionssvg"
+}
+
+// colorRegions returns the connected regions of all beads of the pattern, sorted by bead name and position
+func colorRegions(pattern *Pattern) []colorRegion {
+	width, height := pattern.Width, pattern.Height
+	visited := make([]bool, width*height)
+	inRegion := make([]bool, width*height)
+	var regions []colorRegion
+
+	for start := range visited {
+		cell := pattern.Cell(start%width, start/width)
+		if visited[start] || cell.Empty() {
+			continue
+		}
+
+		// collect the 4-connected cells of the same bead with a flood fill
+		var cells []int
+		stack := []int{start}
+		visited[start] = true
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			cells = append(cells, i)
+			inRegion[i] = true
+			x, y := i%width, i/width
+			for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+					continue
+				}
+				j := n.X + n.Y*width
+				if neighbor := pattern.Cell(n.X, n.Y); !visited[j] && !neighbor.Empty() && neighbor.Bead == cell.Bead {
+					visited[j] = true
+					stack = append(stack, j)
+				}
+			}
+		}
+
+		regions = append(regions, colorRegion{bead: cell.Bead, beads: len(cells), rings: traceRings(cells, inRegion, width, height)})
+		for _, i := range cells {
+			inRegion[i] = false
+		}
+	}
+
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].bead < regions[j].bead })
+	return regions
+}
+
+// traceRings returns the closed rings around the cells of a region, the outline first. The edges are directed
+// clockwise around the cells, so the outline runs clockwise and the holes counterclockwise in image coordinates.
+func traceRings(cells []int, inRegion []bool, width, height int) [][]image.Point {
+	inside := func(x, y int) bool {
+		return x >= 0 && y >= 0 && x < width && y < height && inRegion[x+y*width]
+	}
+
+	type edge struct{ from, to image.Point }
+	outgoing := make(map[image.Point][]edge)
+	count := 0
+	for _, i := range cells {
+		x, y := i%width, i/width
+		corners := [4]image.Point{{x, y}, {x + 1, y}, {x + 1, y + 1}, {x, y + 1}}
+		neighbors := [4]bool{inside(x, y-1), inside(x+1, y), inside(x, y+1), inside(x-1, y)}
+		for side, neighbor := range neighbors {
+			if !neighbor {
+				e := edge{corners[side], corners[(side+1)%4]}
+				outgoing[e.from] = append(outgoing[e.from], e)
+				count++
+			}
+		}
+	}
+
+	var rings [][]image.Point
+	for count > 0 {
+		// start at the top left corner of the remaining edges, which is always on the outline of the region
+		var start image.Point
+		first := true
+		for p, edges := range outgoing {
+			if len(edges) > 0 && (first || p.Y < start.Y || (p.Y == start.Y && p.X < start.X)) {
+				start, first = p, false
+			}
+		}
+
+		var ring []image.Point
+		var firstDirection image.Point
+		p, direction := start, image.Point{}
+		for {
+			edges := outgoing[p]
+			// at corners where two cells of the region touch diagonally, turning right keeps the rings separate
+			best := 0
+			for i, e := range edges {
+				if turnRank(direction, e.to.Sub(e.from)) < turnRank(direction, edges[best].to.Sub(edges[best].from)) {
+					best = i
+				}
+			}
+			e := edges[best]
+			outgoing[p] = append(edges[:best], edges[best+1:]...)
+			count--
+
+			next := e.to.Sub(e.from)
+			if next != direction { // only the corners of the ring are kept
+				ring = append(ring, p)
+			}
+			if len(ring) == 1 && direction == (image.Point{}) {
+				firstDirection = next
+			}
+			p, direction = e.to, next
+			if p == start {
+				break
+			}
+		}
+		if direction == firstDirection {
+			ring = ring[1:] // the start is not a corner if the ring ends in the direction it started with
+		}
+		rings = append(rings, ring)
+	}
+
+	// the outline has the largest area, it is clockwise and has a positive area in image coordinates
+	sort.SliceStable(rings, func(i, j int) bool { return ringArea(rings[i]) > ringArea(rings[j]) })
+	return rings
+}
+
+// turnRank ranks the direction change between two edges, right turns first, then straight and left turns
+func turnRank(from, to image.Point) int {
+	if from == (image.Point{}) {
+		return 0
+	}
+	switch cross := from.X*to.Y - from.Y*to.X; {
+	case cross > 0: // clockwise in image coordinates
+		return 0
+	case cross == 0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// ringArea returns the signed area of the ring, positive for clockwise rings in image coordinates
+func ringArea(ring []image.Point) int {
+	area := 0
+	for i, p := range ring {
+		q := ring[(i+1)%len(ring)]
+		area += p.X*q.Y - q.X*p.Y
+	}
+	return area / 2
+}
+
+// renderRegionsSVG renders the color regions as SVG with a layer per bead, the size is the physical size of
+// the pattern so that the layers can be used by cutting machines. The coordinate labels get a layer of their own.
+func (m *beadMachine) renderRegionsSVG(pattern *Pattern, writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	var left, top float64 // the coordinate labels are drawn outside of the pattern
+	if m.coordinates {
+		left, top = svgCoordinatesMargin(pattern)
+	}
+	width, height := float64(pattern.Width)+left, float64(pattern.Height)+top
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" "+
+		"width=\"%gmm\" height=\"%gmm\" viewBox=\"%g %g %g %g\">\n",
+		width*m.beadPitch, height*m.beadPitch, -left, -top, width, height)
+
+	regions := colorRegions(pattern)
+	layer := 0
+	for i, region := range regions {
+		if i == 0 || region.bead != regions[i-1].bead {
+			if i > 0 {
+				w.WriteString("</g>\n")
+			}
+			layer++
+			c := pattern.Palette[region.bead]
+			fmt.Fprintf(w, "<g id=\"layer%d\" inkscape:groupmode=\"layer\" inkscape:label=\"%s\" fill=\"#%02X%02X%02X\">\n",
+				layer, html.EscapeString(region.bead), c.R, c.G, c.B)
+		}
+		var path strings.Builder
+		for _, ring := range region.rings {
+			for j, p := range ring {
+				if j == 0 {
+					fmt.Fprintf(&path, "M%d %d", p.X, p.Y)
+				} else {
+					fmt.Fprintf(&path, "L%d %d", p.X, p.Y)
+				}
+			}
+			path.WriteString("Z")
+		}
+		fmt.Fprintf(w, "<path fill-rule=\"evenodd\" data-beads=\"%d\" d=\"%s\"/>\n", region.beads, path.String())
+	}
+	if layer > 0 {
+		w.WriteString("</g>\n")
+	}
+	if m.coordinates {
+		m.writeSVGCoordinates(w, pattern)
+	}
+	w.WriteString("</svg>\n")
+	return errors.Wrap(w.Flush(), "writing regions SVG")
+}
+
+// regionFeature is a GeoJSON feature of a color region
+type regionFeature struct {
+	Type       string `json:"type"`
+	Properties struct {
+		Bead   string `json:"bead"`
+		Color  string `json:"color"`
+		Layer  int    `json:"layer"`
+		Region int    `json:"region"`
+		Beads  int    `json:"beads"`
+	} `json:"properties"`
+	Geometry struct {
+		Type        string         `json:"type"`
+		Coordinates [][][2]float64 `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// renderRegionsGeoJSON renders the color regions as GeoJSON feature collection with a polygon per region. The
+// coordinates are in mm with the origin at the bottom left corner of the pattern, the outlines run
+// counterclockwise and the holes clockwise like required by GeoJSON.
+func (m *beadMachine) renderRegionsGeoJSON(pattern *Pattern, w io.Writer) error {
+	collection := struct {
+		Type     string          `json:"type"`
+		Features []regionFeature `json:"features"`
+	}{Type: "FeatureCollection", Features: []regionFeature{}}
+
+	layer := 0
+	regions := colorRegions(pattern)
+	for i, region := range regions {
+		if i == 0 || region.bead != regions[i-1].bead {
+			layer++
+		}
+		var feature regionFeature
+		feature.Type = "Feature"
+		c := pattern.Palette[region.bead]
+		feature.Properties.Bead = region.bead
+		feature.Properties.Color = fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+		feature.Properties.Layer = layer
+		feature.Properties.Region = i + 1
+		feature.Properties.Beads = region.beads
+		feature.Geometry.Type = "Polygon"
+		for _, ring := range region.rings {
+			coordinates := make([][2]float64, 0, len(ring)+1)
+			// the rings are reversed, as flipping the y axis keeps their orientation. GeoJSON rings repeat the
+			// first position at the end.
+			for j := len(ring); j >= 0; j-- {
+				p := ring[j%len(ring)]
+				coordinates = append(coordinates, [2]float64{float64(p.X) * m.beadPitch, float64(pattern.Height-p.Y) * m.beadPitch})
+			}
+			feature.Geometry.Coordinates = append(feature.Geometry.Coordinates, coordinates)
+		}
+		collection.Features = append(collection.Features, feature)
+	}
+
+	data, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling regions")
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return errors.Wrap(err, "writing regions GeoJSON")
+}
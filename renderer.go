@@ -0,0 +1,152 @@
+package beadmachine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Renderer renders a pattern into an output format
+type Renderer interface {
+	Render(pattern *Pattern, w io.Writer) error
+}
+
+// RendererFunc is an adapter to allow the use of ordinary functions as renderers
+type RendererFunc func(pattern *Pattern, w io.Writer) error
+
+// Render calls f(pattern, w)
+func (f RendererFunc) Render(pattern *Pattern, w io.Writer) error {
+	return f(pattern, w)
+}
+
+var (
+	renderers     = make(map[string]Renderer)
+	renderersLock sync.RWMutex
+)
+
+// RegisterRenderer registers a renderer for the given output format name, an already registered
+// renderer with the same name gets replaced
+func RegisterRenderer(name string, renderer Renderer) {
+	renderersLock.Lock()
+	renderers[name] = renderer
+	renderersLock.Unlock()
+}
+
+// registeredRenderer returns the registered renderer for the given output format name
+func registeredRenderer(name string) (Renderer, bool) {
+	renderersLock.RLock()
+	renderer, ok := renderers[name]
+	renderersLock.RUnlock()
+	return renderer, ok
+}
+
+// registeredRendererNames returns the sorted names of all registered renderers
+func registeredRendererNames() []string {
+	renderersLock.RLock()
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	renderersLock.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// renderPatternJSON renders the pattern as JSON, it is also the format that is passed to
+// external and plugin renderers
+func renderPatternJSON(pattern *Pattern, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	return errors.Wrap(encoder.Encode(pattern), "encoding pattern")
+}
+
+// execRenderer renders a pattern by running an external executable that gets the pattern JSON
+// passed on stdin and writes the rendered output to stdout
+type execRenderer struct {
+	command string
+	args    []string
+}
+
+// Render runs the external executable
+func (r execRenderer) Render(pattern *Pattern, w io.Writer) error {
+	var input bytes.Buffer
+	if err := renderPatternJSON(pattern, &input); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(r.command, r.args...)
+	cmd.Stdin = &input
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return errors.Wrapf(cmd.Run(), "running renderer %s", r.command)
+}
+
+// pluginRenderFunc is the signature of the Render function that a Go plugin renderer has to export,
+// it gets passed the pattern JSON
+type pluginRenderFunc = func(patternJSON []byte, w io.Writer) error
+
+// loadPluginRenderer opens a Go plugin and returns a renderer that calls its exported Render function
+func loadPluginRenderer(fileName string) (Renderer, error) {
+	p, err := plugin.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening renderer plugin")
+	}
+	symbol, err := p.Lookup("Render")
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up Render function of renderer plugin")
+	}
+	render, ok := symbol.(pluginRenderFunc)
+	if !ok {
+		return nil, fmt.Errorf("renderer plugin Render function has type %T instead of %T", symbol, render)
+	}
+
+	return RendererFunc(func(pattern *Pattern, w io.Writer) error {
+		var input bytes.Buffer
+		if err := renderPatternJSON(pattern, &input); err != nil {
+			return err
+		}
+		return render(input.Bytes(), w)
+	}), nil
+}
+
+// registerExternalRenderers registers all renderers of the given name=command and name=plugin.so definitions
+func registerExternalRenderers(execs, plugins []string) error {
+	for _, definition := range execs {
+		name, command, err := splitDefinition(definition)
+		if err != nil {
+			return errors.Wrap(err, "parsing external renderer")
+		}
+		fields := strings.Fields(command)
+		RegisterRenderer(name, execRenderer{command: fields[0], args: fields[1:]})
+	}
+
+	for _, definition := range plugins {
+		name, fileName, err := splitDefinition(definition)
+		if err != nil {
+			return errors.Wrap(err, "parsing renderer plugin")
+		}
+		renderer, err := loadPluginRenderer(fileName)
+		if err != nil {
+			return err
+		}
+		RegisterRenderer(name, renderer)
+	}
+	return nil
+}
+
+// splitDefinition splits a name=value definition
+func splitDefinition(definition string) (string, string, error) {
+	parts := strings.SplitN(definition, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.TrimSpace(parts[1]) == "" {
+		return "", "", fmt.Errorf("definition '%s' is not in the format name=value", definition)
+	}
+	return parts[0], parts[1], nil
+}
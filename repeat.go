@@ -0,0 +1,85 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// mirroring of every second tile of a repeated motif
+const (
+	tileMirrorNone       = "none"
+	tileMirrorHorizontal = "horizontal"
+	tileMirrorVertical   = "vertical"
+	tileMirrorBoth       = "both"
+)
+
+// parseTile parses the tile grid like 3x2 into the columns and rows
+func parseTile(value string) (int, int, error) {
+	if columns, rows, ok := parseGrid(value); ok {
+		return columns, rows, nil
+	}
+	return 0, 0, fmt.Errorf("invalid tile grid '%s', expected columns x rows like 3x2", value)
+}
+
+// tilePattern repeats the matched motif in a grid of tiles, for borders, coasters and wallpaper designs. With
+// mirroring every second column of tiles is flipped horizontally and every second row vertically, so that the
+// edges of neighboring tiles meet seamlessly.
+func (m *beadMachine) tilePattern(motif *Pattern) *Pattern {
+	width, height := motif.Width*m.tileColumns, motif.Height*m.tileRows
+	pattern := newPattern(width, height, motif.BoardDimension)
+	pattern.Symbols = motif.Symbols
+	pattern.Palette = motif.Palette
+
+	mirrorX := m.tileMirror == tileMirrorHorizontal || m.tileMirror == tileMirrorBoth
+	mirrorY := m.tileMirror == tileMirrorVertical || m.tileMirror == tileMirrorBoth
+	var source *image.NRGBA
+	if motif.Source != nil {
+		source = image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+	for row := 0; row < m.tileRows; row++ {
+		for column := 0; column < m.tileColumns; column++ {
+			flipX, flipY := mirrorX && column%2 == 1, mirrorY && row%2 == 1
+			for y := 0; y < motif.Height; y++ {
+				for x := 0; x < motif.Width; x++ {
+					sx, sy := x, y
+					if flipX {
+						sx = motif.Width - 1 - x
+					}
+					if flipY {
+						sy = motif.Height - 1 - y
+					}
+					*pattern.Cell(column*motif.Width+x, row*motif.Height+y) = *motif.Cell(sx, sy)
+				}
+			}
+
+			if source != nil {
+				tile := imaging.Clone(motif.Source)
+				if flipX {
+					tile = imaging.FlipH(tile)
+				}
+				if flipY {
+					tile = imaging.FlipV(tile)
+				}
+				min := image.Pt(column*motif.Width, row*motif.Height)
+				draw.Draw(source, image.Rectangle{Min: min, Max: min.Add(tile.Bounds().Size())}, tile, image.Point{}, draw.Src)
+			}
+		}
+	}
+	if source != nil {
+		pattern.Source = source
+	}
+
+	m.logger.Info("Motif tiled",
+		zap.Int("columns", m.tileColumns),
+		zap.Int("rows", m.tileRows),
+		zap.String("mirror", m.tileMirror),
+		zap.Int("width", width),
+		zap.Int("height", height),
+		zap.Int("boards width", boardsNeeded(width, m.boardDimension)),
+		zap.Int("boards height", boardsNeeded(height, m.boardDimension)))
+	return pattern
+}
@@ -0,0 +1,147 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// report is the machine-readable report of all warnings and errors of a run, for pipelines that surface the
+// problems of a conversion to their users
+type report struct {
+	Inputs   []string       `json:"inputs"`
+	ExitCode int            `json:"exitCode"`
+	Error    string         `json:"error,omitempty"` // the error that the run failed with
+	Warnings int            `json:"warnings"`
+	Errors   int            `json:"errors"`
+	Entries  []reportEntry  `json:"entries"`
+	Outputs  []outputStatus `json:"outputs"` // status of every output of every pattern
+}
+
+// reportEntry is a logged warning or error of the report
+type reportEntry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	Input   string                 `json:"input,omitempty"` // the input file of a batch that was converted
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// reportCollector collects the logged warnings and errors of a run
+type reportCollector struct {
+	mu     sync.Mutex
+	report report
+	input  string
+}
+
+// newReportCollector returns a report collector for the input files of the run
+func newReportCollector(inputFileNames []string) *reportCollector {
+	return &reportCollector{report: report{Inputs: inputFileNames, Entries: []reportEntry{}, Outputs: []outputStatus{}}}
+}
+
+// addOutputs adds the status of the written outputs to the report
+func (c *reportCollector) addOutputs(statuses []outputStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, status := range statuses {
+		status.Input = c.input
+		c.report.Outputs = append(c.report.Outputs, status)
+	}
+}
+
+// logger returns a logger that adds all logged warnings and errors to the report
+func (c *reportCollector) logger(logger *zap.Logger) *zap.Logger {
+	return logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, &reportCore{collector: c})
+	}))
+}
+
+// setInput sets the input file of a batch that the following entries belong to
+func (c *reportCollector) setInput(inputFileName string) {
+	c.mu.Lock()
+	c.input = inputFileName
+	c.mu.Unlock()
+}
+
+// add adds a logged entry with its fields to the report
+func (c *reportCollector) add(entry zapcore.Entry, fields []zapcore.Field) {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+	for key := range encoder.Fields {
+		if strings.HasSuffix(key, "Verbose") { // the stack traces of wrapped errors
+			delete(encoder.Fields, key)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := reportEntry{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Input:   c.input,
+	}
+	if len(encoder.Fields) > 0 {
+		e.Fields = encoder.Fields
+	}
+	c.report.Entries = append(c.report.Entries, e)
+	if entry.Level == zapcore.WarnLevel {
+		c.report.Warnings++
+	} else {
+		c.report.Errors++
+	}
+}
+
+// write writes the report with the result of the run to the file
+func (c *reportCollector) write(fileName string, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.report.ExitCode = exitCode(err)
+		c.report.Error = err.Error()
+	}
+	data, marshalErr := json.MarshalIndent(c.report, "", "  ")
+	if marshalErr != nil {
+		return errors.Wrap(marshalErr, "marshalling report")
+	}
+	data = append(data, '\n')
+	return errors.Wrap(ioutil.WriteFile(fileName, data, 0644), "writing report")
+}
+
+// reportCore is a logger core that passes the warnings and errors to the report collector
+type reportCore struct {
+	collector *reportCollector
+	fields    []zapcore.Field
+}
+
+func (r *reportCore) Enabled(level zapcore.Level) bool {
+	return level >= zapcore.WarnLevel
+}
+
+func (r *reportCore) With(fields []zapcore.Field) zapcore.Core {
+	return &reportCore{collector: r.collector, fields: append(append([]zapcore.Field{}, r.fields...), fields...)}
+}
+
+func (r *reportCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(entry.Level) {
+		return checked.AddCore(entry, r)
+	}
+	return checked
+}
+
+func (r *reportCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	r.collector.add(entry, append(append([]zapcore.Field{}, r.fields...), fields...))
+	return nil
+}
+
+func (r *reportCore) Sync() error {
+	return nil
+}
@@ -0,0 +1,214 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/jkl1337/go-chromath/deltae"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// scoreWindow is the width and height in beads of the windows that the structural similarity is computed in
+const scoreWindow = 7
+
+// structural similarity constants for 8 bit luminance, they stabilize the division for flat windows
+const (
+	ssimC1 = (0.01 * 255) * (0.01 * 255)
+	ssimC2 = (0.03 * 255) * (0.03 * 255)
+)
+
+// patternScore is the similarity of a rendered bead pattern to its source image at bead resolution
+type patternScore struct {
+	Result     string  `json:"result"`
+	Width      int     `json:"width"` // in beads
+	Height     int     `json:"height"`
+	Beads      int     `json:"beads"`      // cells that are not empty and were compared
+	SSIM       float64 `json:"ssim"`       // mean structural similarity of the luminance, 1 is identical
+	MeanDeltaE float64 `json:"meanDeltaE"` // mean CIEDE2000 color distance of the beads to the source
+	MaxDeltaE  float64 `json:"maxDeltaE"`
+}
+
+// scoreCommand returns the command that scores the similarity of rendered bead patterns to their source image
+func scoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "score source.jpg result.png [result.png...]",
+		Short: "Score the similarity of bead patterns to their source image",
+		Long: `Score the similarity of rendered PNG bead patterns to their source image, to compare settings and
+palettes objectively. The source image is resized to the bead resolution of every pattern and compared bead by
+bead with the structural similarity (SSIM) of the luminance and the mean color distance (ΔE).`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: startScore,
+	}
+	cmd.Flags().IntP("cell-size", "", 1, "width and height in pixel of a bead of the rendered patterns, 8 for --beadstyle")
+	cmd.Flags().StringP("output", "o", "", "output filename for a JSON file with the scores")
+	return cmd
+}
+
+func startScore(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	cellSize, _ := cmd.Flags().GetInt("cell-size")
+	outputFileName, _ := cmd.Flags().GetString("output")
+	if cellSize < 1 {
+		logger.Error("Invalid cell size", zap.Int("cell-size", cellSize))
+		return usageError(fmt.Errorf("invalid cell size %d", cellSize))
+	}
+
+	source, err := readImageFile(args[0], true)
+	if err != nil {
+		logger.Error("Reading source image failed", zap.Error(err))
+		return inputError(err)
+	}
+
+	m := newBeadMachine(logger)
+	scores := make([]patternScore, 0, len(args)-1)
+	for _, fileName := range args[1:] {
+		result, err := readImageFile(fileName, false)
+		if err != nil {
+			logger.Error("Reading pattern image failed", zap.String("result", fileName), zap.Error(err))
+			return inputError(err)
+		}
+		beads := patternCells(result, cellSize)
+		bounds := beads.Bounds()
+		if bounds.Empty() {
+			logger.Error("Pattern image is smaller than a bead", zap.String("result", fileName))
+			return inputError(fmt.Errorf("pattern image '%s' is smaller than a bead of %d pixel", fileName, cellSize))
+		}
+
+		sourceBounds := source.Bounds()
+		sourceRatio := float64(sourceBounds.Dx()) / float64(sourceBounds.Dy())
+		patternRatio := float64(bounds.Dx()) / float64(bounds.Dy())
+		if math.Abs(sourceRatio-patternRatio)*float64(bounds.Dy()) > 1 {
+			logger.Warn("Aspect ratio of the pattern differs from the source image, the source is stretched",
+				zap.String("result", fileName),
+				zap.Float64("source ratio", sourceRatio),
+				zap.Float64("pattern ratio", patternRatio))
+		}
+		resized := imaging.Resize(source, bounds.Dx(), bounds.Dy(), imaging.Lanczos)
+
+		score := m.scorePattern(resized, beads)
+		score.Result = fileName
+		scores = append(scores, score)
+		logger.Info("Pattern score",
+			zap.String("result", fileName),
+			zap.Int("width", score.Width),
+			zap.Int("height", score.Height),
+			zap.Int("beads", score.Beads),
+			zap.Float64("ssim", score.SSIM),
+			zap.Float64("mean ΔE", score.MeanDeltaE),
+			zap.Float64("max ΔE", score.MaxDeltaE))
+	}
+
+	if outputFileName == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(scores, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(outputFileName, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		logger.Error("Writing scores failed", zap.Error(err))
+		return outputError(errors.Wrap(err, "writing score file"))
+	}
+	return nil
+}
+
+// patternCells returns an image with a pixel per bead of a rendered pattern. Every bead is sampled a quarter cell
+// from its top left corner, which misses the hole and the corners of bead style drawing and the chart grid lines.
+func patternCells(result image.Image, cellSize int) *image.NRGBA {
+	rendered := imaging.Clone(result)
+	bounds := rendered.Bounds()
+	cells := image.NewNRGBA(image.Rect(0, 0, bounds.Dx()/cellSize, bounds.Dy()/cellSize))
+	offset := cellSize / 4
+	for y := 0; y < cells.Rect.Dy(); y++ {
+		for x := 0; x < cells.Rect.Dx(); x++ {
+			cells.SetNRGBA(x, y, rendered.NRGBAAt(x*cellSize+offset, y*cellSize+offset))
+		}
+	}
+	return cells
+}
+
+// scorePattern compares the beads of the pattern to the source image of the same size. Empty cells of the
+// pattern are not compared, transparent pixels of the source count as black.
+func (m *beadMachine) scorePattern(source, beads *image.NRGBA) patternScore {
+	width, height := beads.Rect.Dx(), beads.Rect.Dy()
+	score := patternScore{Width: width, Height: height}
+	sourceLuminance := make([]float64, width*height)
+	beadLuminance := make([]float64, width*height)
+	compared := make([]bool, width*height)
+
+	totalDeltaE := 0.0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			bead := beads.NRGBAAt(x, y)
+			if bead.A < 128 { // empty cell
+				continue
+			}
+			pixel := source.NRGBAAt(x, y)
+			sourceColor := color.RGBAModel.Convert(pixel).(color.RGBA)
+			beadColor := color.RGBAModel.Convert(bead).(color.RGBA)
+			distance := deltae.CIE2000(m.labColor(sourceColor), m.labColor(beadColor), &deltae.KLChDefault)
+			totalDeltaE += distance
+			score.MaxDeltaE = math.Max(score.MaxDeltaE, distance)
+			score.Beads++
+
+			i := x + y*width
+			compared[i] = true
+			sourceLuminance[i] = luminance([]uint8{sourceColor.R, sourceColor.G, sourceColor.B})
+			beadLuminance[i] = luminance([]uint8{beadColor.R, beadColor.G, beadColor.B})
+		}
+	}
+	if score.Beads == 0 {
+		return score
+	}
+	score.MeanDeltaE = totalDeltaE / float64(score.Beads)
+	score.SSIM = structuralSimilarity(sourceLuminance, beadLuminance, compared, width, height)
+	return score
+}
+
+// structuralSimilarity returns the mean structural similarity of two luminance images over all windows of
+// scoreWindow beads, smaller images are compared in a single window. Only the compared pixels are part of the
+// windows.
+func structuralSimilarity(a, b []float64, compared []bool, width, height int) float64 {
+	windowWidth, windowHeight := minInt(scoreWindow, width), minInt(scoreWindow, height)
+	total, windows := 0.0, 0
+	for y0 := 0; y0+windowHeight <= height; y0++ {
+		for x0 := 0; x0+windowWidth <= width; x0++ {
+			var n, sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+windowHeight; y++ {
+				for x := x0; x < x0+windowWidth; x++ {
+					i := x + y*width
+					if !compared[i] {
+						continue
+					}
+					n++
+					sumA += a[i]
+					sumB += b[i]
+					sumAA += a[i] * a[i]
+					sumBB += b[i] * b[i]
+					sumAB += a[i] * b[i]
+				}
+			}
+			if n < 2 {
+				continue
+			}
+			meanA, meanB := sumA/n, sumB/n
+			varianceA := sumAA/n - meanA*meanA
+			varianceB := sumBB/n - meanB*meanB
+			covariance := sumAB/n - meanA*meanB
+			total += (2*meanA*meanB + ssimC1) * (2*covariance + ssimC2) /
+				((meanA*meanA + meanB*meanB + ssimC1) * (varianceA + varianceB + ssimC2))
+			windows++
+		}
+	}
+	if windows == 0 {
+		return 0
+	}
+	return total / float64(windows)
+}
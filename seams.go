@@ -0,0 +1,91 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// shiftSeams shifts the image by adding empty columns on the left and empty rows on the top so that
+// the least image detail lands on the board boundaries, where alignment errors between boards are most
+// visible. The shift is limited by the seam margin and the free space of the last board, so no
+// additional boards are needed.
+func (m *beadMachine) shiftSeams(inputImage image.Image) image.Image {
+	imageBounds := inputImage.Bounds()
+	width, height := imageBounds.Dx(), imageBounds.Dy()
+	columnDetail, rowDetail := imageDetail(inputImage)
+
+	shiftX := seamShift(columnDetail, m.boardDimension, m.seamMargin)
+	shiftY := seamShift(rowDetail, m.boardDimension, m.seamMargin)
+	m.logger.Info("Board seams optimized", zap.Int("shift x", shiftX), zap.Int("shift y", shiftY))
+	if shiftX == 0 && shiftY == 0 {
+		return inputImage
+	}
+
+	shifted := imaging.New(width+shiftX, height+shiftY, color.NRGBA{})
+	return imaging.Paste(shifted, inputImage, image.Pt(shiftX, shiftY))
+}
+
+// imageDetail returns the summed luminance gradient of every column and row of the image
+func imageDetail(inputImage image.Image) (columns, rows []float64) {
+	imageBounds := inputImage.Bounds()
+	width, height := imageBounds.Dx(), imageBounds.Dy()
+	luminance := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			grey := color.Gray16Model.Convert(inputImage.At(imageBounds.Min.X+x, imageBounds.Min.Y+y)).(color.Gray16)
+			luminance[x+y*width] = float64(grey.Y) / 0xffff
+		}
+	}
+
+	columns = make([]float64, width)
+	rows = make([]float64, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var gradient float64
+			if x > 0 {
+				gradient += math.Abs(luminance[x+y*width] - luminance[x-1+y*width])
+			}
+			if y > 0 {
+				gradient += math.Abs(luminance[x+y*width] - luminance[x+(y-1)*width])
+			}
+			columns[x] += gradient
+			rows[y] += gradient
+		}
+	}
+	return columns, rows
+}
+
+// seamShift returns the amount of empty cells to insert before the image that results in the least
+// detail next to the board boundaries. Only shifts that fit into the free space of the last board and
+// the margin are considered, on equal detail the smallest shift wins.
+func seamShift(detail []float64, boardDimension, margin int) int {
+	size := len(detail)
+	free := boardsNeeded(size, boardDimension)*boardDimension - size
+	bestShift, bestCost := 0, math.Inf(1)
+
+	for shift := 0; shift <= minInt(margin, free); shift++ {
+		if cost := seamCost(detail, boardDimension, shift); cost < bestCost {
+			bestShift, bestCost = shift, cost
+		}
+	}
+	return bestShift
+}
+
+// seamCost returns the detail next to the board boundaries when the given amount of empty cells is inserted
+// before the image
+func seamCost(detail []float64, boardDimension, shift int) float64 {
+	size := len(detail)
+	var cost float64
+	for boundary := boardDimension; boundary < size+shift; boundary += boardDimension {
+		for _, i := range []int{boundary - shift - 1, boundary - shift} { // the cells on both sides of the boundary
+			if i >= 0 && i < size {
+				cost += detail[i]
+			}
+		}
+	}
+	return cost
+}
@@ -0,0 +1,822 @@
+package beadmachine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// serverJobGrace is the time that a job process gets after its timeout to write the result of the cancelled
+// conversion, before it is killed
+const serverJobGrace = 30 * time.Second
+
+// job states of the server queue
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+)
+
+// serverHeaderTimeout bounds how long a client may take to send the headers of a request and to keep an idle
+// connection open
+const serverHeaderTimeout = 10 * time.Second
+
+// jobPruneInterval is the interval in which finished jobs that are older than the retention are removed
+const jobPruneInterval = time.Minute
+
+// errQueueFull is returned by submit while the maximum amount of jobs is queued
+var errQueueFull = errors.New("the queue is full")
+
+// rateLimiterCleanup is the amount of tracked clients above which the clients with a full bucket are forgotten
+const rateLimiterCleanup = 10000
+
+// serverJob is the status of a submitted job, it is stored as job.json in the directory of the job
+type serverJob struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"` // queued, running, succeeded or failed
+	Position  int        `json:"position,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	ExitCode  int        `json:"exitCode,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// jobLimits are the resource limits that apply to every job of the server
+type jobLimits struct {
+	timeout            time.Duration
+	maxBeads           int
+	maxInputDimension  int
+	maxInputMegapixels float64
+	maxRequest         int64
+	maxQueued          int
+	retention          time.Duration // finished jobs are removed after this duration, 0 keeps them
+	outputPrefixes     []string      // object storage URI prefixes that the outputs of jobs can be uploaded to
+	verboseJobs        bool
+}
+
+// jobQueue is the persistent queue of the server, jobs are processed in the order of submission by the workers
+type jobQueue struct {
+	logger     *zap.Logger
+	dir        string
+	executable string
+	limits     jobLimits
+	trace      string // OTLP endpoint of the job traces, empty if tracing is disabled
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	jobs   map[string]*serverJob
+	queued []string
+
+	limiter  *rateLimiter
+	metrics  *serverMetrics
+	palettes *paletteReloader // palettes that are reloaded while the server runs, nil without --palette
+}
+
+// rateLimiter limits the submissions of every client with a token bucket that allows bursts of the rate per minute
+type rateLimiter struct {
+	rate    float64 // tokens per second
+	burst   float64
+	lock    sync.Mutex
+	clients map[string]*rateBucket
+}
+
+// rateBucket are the tokens of a client at the time of its last request
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// serveCommand returns the command that runs a server with a job queue for conversions
+func serveCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a server that converts images of submitted jobs with a persistent queue",
+		Long: `Run an HTTP server with a persistent job queue. Jobs are pipeline requests that are posted to /jobs,
+their status is polled at /jobs/<id>, the pipeline result is fetched from /jobs/<id>/result and the written
+files from /jobs/<id>/files/<name>. The jobs are
+converted by a configurable amount of workers, every job runs in its own process with the limits of the server.
+The queue is stored in the jobs directory, queued and interrupted jobs are continued after a restart. Finished
+jobs and their files are removed after the job retention.`,
+		Args: cobra.NoArgs,
+		RunE: startServer,
+	}
+	cmd.Flags().StringP("listen", "", "127.0.0.1:8080", "address that the server listens on")
+	cmd.Flags().StringP("jobs-dir", "", "beadmachine-jobs", "directory that stores the queued jobs and their results")
+	cmd.Flags().IntP("workers", "", 2, "amount of jobs that are converted at the same time")
+	cmd.Flags().DurationP("job-timeout", "", 10*time.Minute, "cancel a job that takes longer than the given duration, also limits the timeout option of the jobs (0 = unlimited)")
+	cmd.Flags().IntP("max-job-beads", "", 0, "scale the patterns of a job down to need at most the given amount of beads, also limits the max-beads option of the jobs (0 = unlimited)")
+	cmd.Flags().IntP("max-input-dimension", "", 0, "reject the input images of jobs that are wider or higher than the given amount of pixels, also limits the option of the jobs (0 = unlimited)")
+	cmd.Flags().Float64P("max-input-megapixels", "", 50, "reject the input images of jobs that have more megapixels, also limits the option of the jobs (0 = unlimited)")
+	cmd.Flags().IntP("rate-limit", "", 30, "maximum amount of jobs that a client can submit per minute (0 = unlimited)")
+	cmd.Flags().DurationP("request-timeout", "", time.Minute, "maximum duration of reading a request and writing its response")
+	cmd.Flags().StringArrayP("palette", "", nil, "palette that jobs select by name in the format name=palette like hama=colors_hama.json, it is reloaded when it changes, the first one is the default")
+	cmd.Flags().DurationP("palette-interval", "", 10*time.Second, "interval in which the palettes are checked for changes")
+	cmd.Flags().StringP("trace", "", "", "export OpenTelemetry spans of the jobs and their pipeline stages to an OTLP/HTTP endpoint like http://localhost:4318/v1/traces, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT")
+	cmd.Flags().Int64P("max-request-size", "", 64<<20, "maximum size in bytes of a submitted job request")
+	cmd.Flags().IntP("max-queued", "", 100, "maximum amount of queued jobs, further submissions are rejected until jobs are finished (0 = unlimited)")
+	cmd.Flags().StringArrayP("output-prefix", "", nil, "object storage URI prefix like s3://bucket/patterns/ that the outputs of jobs can be uploaded to, with the credentials of the server")
+	cmd.Flags().DurationP("job-retention", "", 7*24*time.Hour, "remove finished jobs with their files after the given duration (0 = keep them)")
+	return cmd
+}
+
+func startServer(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	listen, _ := cmd.Flags().GetString("listen")
+	jobsDir, _ := cmd.Flags().GetString("jobs-dir")
+	workers, _ := cmd.Flags().GetInt("workers")
+	var limits jobLimits
+	limits.timeout, _ = cmd.Flags().GetDuration("job-timeout")
+	limits.maxBeads, _ = cmd.Flags().GetInt("max-job-beads")
+	limits.maxInputDimension, _ = cmd.Flags().GetInt("max-input-dimension")
+	limits.maxInputMegapixels, _ = cmd.Flags().GetFloat64("max-input-megapixels")
+	limits.maxRequest, _ = cmd.Flags().GetInt64("max-request-size")
+	limits.maxQueued, _ = cmd.Flags().GetInt("max-queued")
+	limits.retention, _ = cmd.Flags().GetDuration("job-retention")
+	limits.outputPrefixes, _ = cmd.Flags().GetStringArray("output-prefix")
+	limits.verboseJobs, _ = cmd.Flags().GetBool("verbose")
+	rateLimit, _ := cmd.Flags().GetInt("rate-limit")
+	requestTimeout, _ := cmd.Flags().GetDuration("request-timeout")
+	traceFlag, _ := cmd.Flags().GetString("trace")
+	trace := traceTarget(traceFlag)
+	paletteValues, _ := cmd.Flags().GetStringArray("palette")
+	paletteInterval, _ := cmd.Flags().GetDuration("palette-interval")
+	paletteNames, paletteURIs, err := parseServedPalettes(paletteValues)
+	if err != nil {
+		logger.Error("Invalid palette", zap.Error(err))
+		return usageError(err)
+	}
+
+	switch {
+	case workers < 1:
+		logger.Error("Invalid amount of workers", zap.Int("workers", workers))
+		return usageError(fmt.Errorf("invalid amount of workers %d, expected at least 1", workers))
+	case limits.timeout < 0:
+		logger.Error("Invalid job timeout", zap.Duration("timeout", limits.timeout))
+		return usageError(fmt.Errorf("invalid job timeout '%s', expected a positive duration like 5m", limits.timeout))
+	case limits.retention < 0:
+		logger.Error("Invalid job retention", zap.Duration("job-retention", limits.retention))
+		return usageError(fmt.Errorf("invalid job retention '%s', expected a positive duration like 24h", limits.retention))
+	case limits.maxBeads < 0 || limits.maxInputDimension < 0 || limits.maxInputMegapixels < 0 || limits.maxQueued < 0 || rateLimit < 0:
+		logger.Error("Invalid job limits")
+		return usageError(errors.New("--max-job-beads, --max-input-dimension, --max-input-megapixels, --max-queued and --rate-limit can not be negative"))
+	case limits.maxRequest < 1 || requestTimeout <= 0:
+		logger.Error("Invalid request limits")
+		return usageError(errors.New("--max-request-size and --request-timeout must be positive"))
+	case paletteInterval <= 0:
+		logger.Error("Invalid palette interval", zap.Duration("palette-interval", paletteInterval))
+		return usageError(fmt.Errorf("invalid palette interval '%s', expected a positive duration like 10s", paletteInterval))
+	}
+	for i, prefix := range limits.outputPrefixes {
+		if _, location, ok := remoteOutput(prefix); !ok || strings.Split(location, "/")[0] == "" {
+			logger.Error("Invalid output prefix", zap.String("output-prefix", prefix))
+			return usageError(fmt.Errorf("invalid output prefix '%s', expected an object storage URI like s3://bucket/patterns/", prefix))
+		}
+		if !strings.HasSuffix(prefix, "/") { // the prefix is a directory, not the start of a name
+			limits.outputPrefixes[i] = prefix + "/"
+		}
+	}
+	if trace != "" && validateWebhookURL(trace) != nil { // the job processes can not share a trace file
+		logger.Error("Invalid trace endpoint", zap.String("trace", trace))
+		return usageError(fmt.Errorf("invalid trace endpoint '%s', the server exports to a http or https URL", trace))
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		logger.Error("Finding executable failed", zap.Error(err))
+		return failureError(errors.Wrap(err, "finding executable"))
+	}
+	queue, err := openJobQueue(logger, jobsDir, executable, limits)
+	if err != nil {
+		logger.Error("Opening job queue failed", zap.String("dir", jobsDir), zap.Error(err))
+		return failureError(err)
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		logger.Error("Starting server failed", zap.Error(err))
+		return usageError(errors.Wrap(err, "listening"))
+	}
+	queue.trace = trace
+	if len(paletteNames) > 0 {
+		if queue.palettes, err = newPaletteReloader(logger, filepath.Join(jobsDir, "palettes"), paletteNames, paletteURIs); err != nil {
+			logger.Error("Loading palettes failed", zap.Error(err))
+			return paletteError(err)
+		}
+		go queue.palettes.watch(paletteInterval)
+	}
+	if rateLimit > 0 {
+		queue.limiter = newRateLimiter(rateLimit)
+	}
+	for i := 0; i < workers; i++ {
+		go queue.work()
+	}
+	if limits.retention > 0 {
+		go queue.pruneEvery(jobPruneInterval)
+	}
+	logger.Info("Server started", zap.String("url", "http://"+listener.Addr().String()+"/jobs"),
+		zap.Int("workers", workers), zap.Int("queued", len(queue.queued)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", queue.serveJobs)
+	mux.HandleFunc("/jobs/", queue.serveJob)
+	mux.HandleFunc("/metrics", queue.serveMetrics)
+	if queue.palettes != nil {
+		mux.HandleFunc("/palettes", queue.palettes.servePalettes)
+	}
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: serverHeaderTimeout,
+		ReadTimeout:       requestTimeout,
+		WriteTimeout:      requestTimeout,
+		IdleTimeout:       serverHeaderTimeout,
+	}
+	return failureError(server.Serve(listener))
+}
+
+// newRateLimiter returns a rate limiter that allows the given amount of requests per minute and client
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(perMinute),
+		clients: make(map[string]*rateBucket),
+	}
+}
+
+// allow takes a token of the client and returns whether it had one left, otherwise it returns the duration after
+// which the next token is available
+func (l *rateLimiter) allow(client string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	if len(l.clients) > rateLimiterCleanup {
+		for name, bucket := range l.clients {
+			if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+				delete(l.clients, name)
+			}
+		}
+	}
+
+	bucket, ok := l.clients[client]
+	if !ok {
+		bucket = &rateBucket{tokens: l.burst, last: now}
+		l.clients[client] = bucket
+	}
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// clientAddress returns the IP address of the client of the request
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// openJobQueue loads the jobs of the directory, jobs that were running when the server stopped are queued again
+func openJobQueue(logger *zap.Logger, dir, executable string, limits jobLimits) (*jobQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "creating jobs directory")
+	}
+	q := &jobQueue{
+		logger:     logger,
+		dir:        dir,
+		executable: executable,
+		limits:     limits,
+		jobs:       make(map[string]*serverJob),
+		metrics:    newServerMetrics(),
+	}
+	q.cond = sync.NewCond(&q.lock)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading jobs directory")
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name(), "job.json"))
+		if err != nil {
+			continue // the submission was interrupted before the job was stored
+		}
+		job := &serverJob{}
+		if err = json.Unmarshal(data, job); err != nil || job.ID != entry.Name() {
+			logger.Warn("Skipping invalid job", zap.String("job", entry.Name()), zap.Error(err))
+			continue
+		}
+		if job.Status == jobRunning {
+			job.Status, job.Started = jobQueued, nil
+			if err = q.store(job); err != nil {
+				return nil, err
+			}
+		}
+		q.jobs[job.ID] = job
+		if job.Status == jobQueued {
+			q.queued = append(q.queued, job.ID)
+		}
+	}
+	sort.Slice(q.queued, func(i, j int) bool {
+		return q.jobs[q.queued[i]].Submitted.Before(q.jobs[q.queued[j]].Submitted)
+	})
+	q.prune()
+	return q, nil
+}
+
+// prune removes the finished jobs that are older than the retention together with their directories
+func (q *jobQueue) prune() {
+	if q.limits.retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-q.limits.retention)
+	var expired []string
+	q.lock.Lock()
+	for id, job := range q.jobs {
+		if job.Status != jobSucceeded && job.Status != jobFailed {
+			continue
+		}
+		finished := job.Submitted
+		if job.Finished != nil {
+			finished = *job.Finished
+		}
+		if finished.Before(cutoff) {
+			delete(q.jobs, id)
+			expired = append(expired, id)
+		}
+	}
+	q.lock.Unlock()
+
+	for _, id := range expired {
+		if err := os.RemoveAll(filepath.Join(q.dir, id)); err != nil {
+			q.logger.Warn("Removing expired job failed", zap.String("job", id), zap.Error(err))
+			continue
+		}
+		q.logger.Debug("Expired job removed", zap.String("job", id))
+	}
+}
+
+// pruneEvery removes the expired jobs in the given interval
+func (q *jobQueue) pruneEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		q.prune()
+	}
+}
+
+// store writes the status of the job, the file is replaced at once so that a crash leaves no partial status
+func (q *jobQueue) store(job *serverJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling job")
+	}
+	fileName := filepath.Join(q.dir, job.ID, "job.json")
+	if err = ioutil.WriteFile(fileName+".tmp", data, 0644); err != nil {
+		return errors.Wrap(err, "writing job")
+	}
+	return errors.Wrap(os.Rename(fileName+".tmp", fileName), "writing job")
+}
+
+// submit stores the request as a new queued job, it returns errQueueFull without storing the job while the
+// maximum amount of jobs is queued
+func (q *jobQueue) submit(request []byte) (serverJob, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return serverJob{}, errors.Wrap(err, "creating job id")
+	}
+	job := &serverJob{ID: hex.EncodeToString(id), Status: jobQueued, Submitted: time.Now().UTC()}
+	jobDir := filepath.Join(q.dir, job.ID)
+	if err := os.Mkdir(jobDir, 0755); err != nil {
+		return serverJob{}, errors.Wrap(err, "creating job directory")
+	}
+	if err := ioutil.WriteFile(filepath.Join(jobDir, "request.json"), request, 0644); err != nil {
+		return serverJob{}, errors.Wrap(err, "writing job request")
+	}
+	if err := q.store(job); err != nil {
+		return serverJob{}, err
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.limits.maxQueued > 0 && len(q.queued) >= q.limits.maxQueued {
+		_ = os.RemoveAll(jobDir)
+		return serverJob{}, errQueueFull
+	}
+	q.jobs[job.ID] = job
+	q.queued = append(q.queued, job.ID)
+	q.cond.Signal()
+	job.Position = len(q.queued)
+	return *job, nil
+}
+
+// status returns a copy of the job with its position in the queue
+func (q *jobQueue) status(id string) (serverJob, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return serverJob{}, false
+	}
+	status := *job
+	status.Position = 0
+	for i, queued := range q.queued {
+		if queued == id {
+			status.Position = i + 1
+		}
+	}
+	return status, true
+}
+
+// work converts the queued jobs one after the other
+func (q *jobQueue) work() {
+	for {
+		q.lock.Lock()
+		for len(q.queued) == 0 {
+			q.cond.Wait()
+		}
+		job := q.jobs[q.queued[0]]
+		q.queued = q.queued[1:]
+		started := time.Now().UTC()
+		job.Status, job.Started = jobRunning, &started
+		status := *job
+		q.lock.Unlock()
+
+		if err := q.store(&status); err != nil {
+			q.logger.Warn("Storing job status failed", zap.String("job", job.ID), zap.Error(err))
+		}
+		q.logger.Info("Job started", zap.String("job", job.ID))
+		var span *traceSpan
+		if q.trace != "" {
+			span = newTracer(q.trace).start("job", nil) // every job is a trace of its own
+			span.set("job.id", job.ID)
+			span.set("job.wait", started.Sub(job.Submitted).Seconds())
+		}
+		result := q.run(job.ID, span)
+		if span != nil {
+			var err error
+			if result.Error != "" {
+				err = errors.New(result.Error)
+			}
+			span.set("exit.code", result.ExitCode)
+			span.finish(err)
+			if err = span.tracer.flush(); err != nil {
+				q.logger.Warn("Exporting job trace failed", zap.String("job", job.ID), zap.Error(err))
+			}
+		}
+
+		q.lock.Lock()
+		finished := time.Now().UTC()
+		job.Status, job.Finished, job.ExitCode, job.Error = result.Status, &finished, result.ExitCode, result.Error
+		status = *job
+		q.lock.Unlock()
+
+		if err := q.store(&status); err != nil {
+			q.logger.Warn("Storing job status failed", zap.String("job", job.ID), zap.Error(err))
+		}
+		q.metrics.jobFinished(result, finished.Sub(started))
+		q.logger.Info("Job finished", zap.String("job", job.ID), zap.String("status", result.Status),
+			zap.Duration("duration", finished.Sub(started)))
+	}
+}
+
+// run converts the request of the job with the pipeline command in its own process and stores the result. The
+// process is killed if it does not stop after the job timeout and its grace period. The spans of the process are
+// children of the span of the job.
+func (q *jobQueue) run(id string, span *traceSpan) pipelineResult {
+	jobDir := filepath.Join(q.dir, id)
+	result := pipelineResult{Status: jobFailed, ExitCode: exitFailure, Outputs: []pipelineOutput{}}
+	fail := func(err error) pipelineResult {
+		result.Error = err.Error()
+		if data, marshalErr := json.MarshalIndent(result, "", "  "); marshalErr == nil {
+			_ = ioutil.WriteFile(filepath.Join(jobDir, "result.json"), data, 0644)
+		}
+		return result
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(jobDir, "request.json"))
+	if err != nil {
+		return fail(errors.Wrap(err, "reading job request"))
+	}
+	request, files, err := q.prepareRequest(data, jobDir)
+	if err != nil {
+		result.ExitCode = exitUsage
+		return fail(err)
+	}
+	log, err := os.Create(filepath.Join(jobDir, "log.txt"))
+	if err != nil {
+		return fail(errors.Wrap(err, "creating job log"))
+	}
+	defer log.Close()
+
+	ctx := context.Background()
+	if q.limits.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.limits.timeout+serverJobGrace)
+		defer cancel()
+	}
+	args := []string{"pipeline"}
+	if q.limits.verboseJobs {
+		args = append(args, "--verbose")
+	}
+	var stdout bytes.Buffer
+	process := exec.CommandContext(ctx, q.executable, args...)
+	process.Stdin = bytes.NewReader(request)
+	process.Stdout = &stdout
+	if span != nil {
+		process.Env = append(os.Environ(), "TRACEPARENT="+span.traceparent(), "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT="+q.trace)
+	}
+	process.Stderr = log
+	processErr := process.Run()
+
+	if err = json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			result.ExitCode = exitCancelled
+			return fail(errors.New("the job was killed after its timeout"))
+		}
+		if processErr != nil {
+			return fail(errors.Wrap(processErr, "running job"))
+		}
+		return fail(errors.Wrap(err, "reading job result"))
+	}
+	for i := range result.Outputs { // the result names the files as they were requested, not by their path
+		if i < len(files) {
+			result.Outputs[i].File = files[i]
+		}
+	}
+	data, err = json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fail(errors.Wrap(err, "marshalling job result"))
+	}
+	if err = ioutil.WriteFile(filepath.Join(jobDir, "result.json"), data, 0644); err != nil {
+		return fail(errors.Wrap(err, "writing job result"))
+	}
+	return result
+}
+
+// prepareRequest checks the request of the job and returns it with its files placed in the job directory, the options
+// limited to the limits of the server and the palette option replaced by the current version of the served palette.
+// It also returns the requested files of the outputs. Requests are checked again when their job starts, because the
+// jobs of the queue may have been submitted to a server with other limits and palettes before a restart.
+func (q *jobQueue) prepareRequest(data []byte, jobDir string) ([]byte, []string, error) {
+	var request pipelineRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, nil, errors.Wrap(err, "reading job request")
+	}
+	if err := q.checkRequest(request); err != nil {
+		return nil, nil, err
+	}
+	if request.Options == nil {
+		request.Options = make(map[string]interface{})
+	}
+	if request.Input != "" {
+		request.Input = filepath.Join(jobDir, request.Input)
+	}
+	files := make([]string, len(request.Outputs))
+	for i, o := range request.Outputs {
+		files[i] = o.File
+		if _, _, remote := remoteOutput(o.File); !remote && o.File != "" {
+			request.Outputs[i].File = filepath.Join(jobDir, o.File)
+		}
+	}
+
+	if q.limits.timeout > 0 {
+		timeout := q.limits.timeout
+		if value, ok := request.Options["timeout"].(string); ok {
+			requested, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "option 'timeout'")
+			}
+			if requested > 0 && requested < timeout {
+				timeout = requested
+			}
+		}
+		request.Options["timeout"] = timeout.String()
+	}
+	limitOption(request.Options, "max-beads", float64(q.limits.maxBeads))
+	limitOption(request.Options, "max-input-dimension", float64(q.limits.maxInputDimension))
+	limitOption(request.Options, "max-input-megapixels", q.limits.maxInputMegapixels)
+	if q.palettes != nil {
+		q.palettes.resolve(request.Options)
+	}
+	prepared, err := json.Marshal(request)
+	return prepared, files, errors.Wrap(err, "marshalling job request")
+}
+
+// checkRequest returns an error if the request of a job uses an option that is no pipeline option, a palette that
+// is neither served nor embedded, a file outside of its job directory or an object storage URI outside of the output
+// prefixes of the server. Options like renderer-exec, project-db
+// or notify-webhook would otherwise run commands, write files or send requests with the permissions of the server.
+func (q *jobQueue) checkRequest(request pipelineRequest) error {
+	names := make([]string, 0, len(request.Options))
+	for name := range request.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !pipelineOptions[name] {
+			return fmt.Errorf("the option '%s' can not be used in jobs", name)
+		}
+	}
+	if value, ok := request.Options["palette"]; ok {
+		name, _ := value.(string)
+		served := q.palettes != nil && q.palettes.palette(name) != nil
+		if !served && !strings.HasPrefix(name, "embedded:") {
+			return fmt.Errorf("invalid palette '%v', jobs use a palette of the server or an embedded palette", value)
+		}
+	}
+	if request.Input != "" {
+		if err := checkJobFileName(request.Input); err != nil {
+			return errors.Wrap(err, "input")
+		}
+	}
+	for _, o := range request.Outputs {
+		if o.File == "" {
+			continue
+		}
+		err := checkJobFileName(o.File)
+		if _, _, remote := remoteOutput(o.File); remote {
+			err = q.checkOutputURI(o.File)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s output", o.Format)
+		}
+	}
+	return nil
+}
+
+// jobFiles are the files of a job directory that the server writes, the input and the outputs of a job can not use
+// their names
+var jobFiles = map[string]bool{"request.json": true, "job.json": true, "job.json.tmp": true, "result.json": true, "log.txt": true}
+
+// checkJobFileName returns an error unless the name is a plain file name in the job directory
+func checkJobFileName(name string) error {
+	if name != filepath.Base(name) || name == "." || name == ".." || strings.ContainsAny(name, `/\:`) || jobFiles[name] {
+		return fmt.Errorf("invalid file '%s', the files of a job are file names in its job directory", name)
+	}
+	return nil
+}
+
+// checkOutputURI returns an error unless the object storage URI is below one of the output prefixes of the server
+func (q *jobQueue) checkOutputURI(uri string) error {
+	_, location, _ := remoteOutput(uri)
+	if path.Clean("/"+location) == "/"+location {
+		for _, prefix := range q.limits.outputPrefixes {
+			if strings.HasPrefix(uri, prefix) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid file '%s', jobs upload outputs only below the output prefixes of the server", uri)
+}
+
+// limitOption sets the numeric option to the limit unless it is set to a lower value, a limit of 0 is unlimited
+func limitOption(options map[string]interface{}, name string, limit float64) {
+	if limit <= 0 {
+		return
+	}
+	if requested, ok := options[name].(float64); ok && requested > 0 && requested < limit {
+		return
+	}
+	options[name] = limit
+}
+
+// serveJobs submits the posted job request. The jobs are not listed: the id that is only returned to the submitter
+// is the access to the status, the result and the files of a job.
+func (q *jobQueue) serveJobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if q.limiter != nil {
+			if ok, retry := q.limiter.allow(clientAddress(r)); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+				q.metrics.jobRejected("rate_limit")
+				http.Error(w, "too many submitted jobs, retry later", http.StatusTooManyRequests)
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, q.limits.maxRequest)
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			q.metrics.jobRejected("too_large")
+			http.Error(w, "the request is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var request pipelineRequest
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&request); err == nil {
+			err = q.checkRequest(request)
+		}
+		if err != nil {
+			q.metrics.jobRejected("invalid")
+			http.Error(w, "invalid job request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		job, err := q.submit(data)
+		if err == errQueueFull {
+			w.Header().Set("Retry-After", "60")
+			q.metrics.jobRejected("queue_full")
+			http.Error(w, "the queue is full, retry later", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			q.logger.Error("Submitting job failed", zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		q.metrics.jobSubmitted()
+		q.logger.Info("Job submitted", zap.String("job", job.ID), zap.Int("position", job.Position))
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveJob responds with the status of a job at /jobs/<id>, with its pipeline result at /jobs/<id>/result and with
+// the files that it wrote to its job directory at /jobs/<id>/files/<name>
+func (q *jobQueue) serveJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
+	switch {
+	case len(parts) == 2 && parts[1] == "result":
+	case len(parts) == 3 && parts[1] == "files" && checkJobFileName(parts[2]) == nil:
+	case len(parts) != 1:
+		http.NotFound(w, r)
+		return
+	}
+	job, ok := q.status(parts[0])
+	if !ok {
+		http.Error(w, "unknown job", http.StatusNotFound)
+		return
+	}
+	if len(parts) == 1 {
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	if job.Status == jobQueued || job.Status == jobRunning {
+		http.Error(w, "the job is "+job.Status, http.StatusConflict)
+		return
+	}
+	if len(parts) == 3 {
+		q.serveJobFile(w, r, filepath.Join(q.dir, job.ID, parts[2]))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, filepath.Join(q.dir, job.ID, "result.json"))
+}
+
+// serveJobFile responds with the file of a job directory, directories are not listed
+func (q *jobQueue) serveJobFile(w http.ResponseWriter, r *http.Request, fileName string) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		http.Error(w, "unknown file", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "unknown file", http.StatusNotFound)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// writeJSON responds with the value as JSON
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(data, '\n'))
+}
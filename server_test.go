@@ -0,0 +1,57 @@
+package beadmachine
+
+import "testing"
+
+func TestCheckJobFileName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"image.png", true},
+		{"pattern.html", true},
+		{"..pattern.png", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../image.png", false},
+		{"dir/image.png", false},
+		{"/etc/passwd", false},
+		{`dir\image.png`, false},
+		{"c:image.png", false},
+		{"s3://bucket/image.png", false},
+		{"request.json", false},
+		{"job.json", false},
+		{"job.json.tmp", false},
+		{"result.json", false},
+		{"log.txt", false},
+	}
+	for _, test := range tests {
+		if err := checkJobFileName(test.name); (err == nil) != test.valid {
+			t.Errorf("checkJobFileName(%q) = %v, expected valid %t", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestCheckOutputURI(t *testing.T) {
+	q := &jobQueue{limits: jobLimits{outputPrefixes: []string{"s3://bucket/jobs/", "gs://patterns/"}}}
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{"s3://bucket/jobs/image.png", true},
+		{"s3://bucket/jobs/user/image.png", true},
+		{"gs://patterns/image.png", true},
+		{"s3://bucket/jobs-other/image.png", false},
+		{"s3://bucket/jobs/../image.png", false},
+		{"s3://bucket/jobs//image.png", false},
+		{"s3://bucket/jobs/./image.png", false},
+		{"s3://bucket/image.png", false},
+		{"az://bucket/jobs/image.png", false},
+		{"gs://patterns/dir/", false},
+	}
+	for _, test := range tests {
+		if err := q.checkOutputURI(test.uri); (err == nil) != test.valid {
+			t.Errorf("checkOutputURI(%q) = %v, expected valid %t", test.uri, err, test.valid)
+		}
+	}
+}
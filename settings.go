@@ -0,0 +1,132 @@
+package beadmachine
+
+// conversionSettings contains all settings that influence the generated bead pattern
+type conversionSettings struct {
+	Palette        string   `json:"palette"`
+	Width          int      `json:"width,omitempty"`
+	Height         int      `json:"height,omitempty"`
+	BoardsWidth    int      `json:"boardsWidth,omitempty"`
+	BoardsHeight   int      `json:"boardsHeight,omitempty"`
+	BoardDimension int      `json:"boardDimension"`
+	Fit            string   `json:"fit"`
+	Resample       string   `json:"resample"`
+	AutoOrient     bool     `json:"autoOrient,omitempty"`
+	OptimizeSeams  bool     `json:"optimizeSeams,omitempty"`
+	SeamMargin     int      `json:"seamMargin,omitempty"` // only set if seams are optimized
+	PadToBoards    bool     `json:"padToBoards,omitempty"`
+	PadAlign       string   `json:"padAlign,omitempty"` // only set if padded to full boards
+	Tile           string   `json:"tile,omitempty"`
+	TileMirror     string   `json:"tileMirror,omitempty"` // only set if tiled
+	Border         []string `json:"border,omitempty"`
+	FillBackground string   `json:"fillBackground,omitempty"`
+	MaxBeads       int      `json:"maxBeads,omitempty"`
+	SpriteSheet    string   `json:"spriteSheet,omitempty"`
+	Grid           string   `json:"grid,omitempty"` // only set for an offset grid
+
+	BeadStyle          bool              `json:"beadStyle,omitempty"`
+	Translucent        bool              `json:"translucent,omitempty"`
+	Flourescent        bool              `json:"flourescent,omitempty"`
+	NoColorMatching    bool              `json:"noColorMatching,omitempty"`
+	Colors             []string          `json:"colors,omitempty"`
+	MergeDuplicates    bool              `json:"mergeDuplicates,omitempty"`
+	DuplicateThreshold float64           `json:"duplicateThreshold,omitempty"` // only set if duplicates are merged
+	Substitutions      map[string]string `json:"substitutions,omitempty"`
+	ColorblindSafe     bool              `json:"colorblindSafe,omitempty"`
+	MaxColors          int               `json:"maxColors,omitempty"`
+	PreserveFaces      bool              `json:"preserveFaces,omitempty"`
+	AdaptiveDither     bool              `json:"adaptiveDither,omitempty"`
+	SharedPalette      bool              `json:"sharedPalette,omitempty"`
+	CachePrecision     int               `json:"cachePrecision,omitempty"` // only set if colors are quantized
+	Distance           string            `json:"distance,omitempty"`       // only set if not the default CIEDE2000
+
+	GreyScale    bool     `json:"greyScale,omitempty"`
+	AutoLevels   bool     `json:"autoLevels,omitempty"`
+	AutoContrast bool     `json:"autoContrast,omitempty"`
+	BlackPoint   int      `json:"blackPoint,omitempty"`
+	WhitePoint   int      `json:"whitePoint,omitempty"` // only set if not 255
+	HueShift     float64  `json:"hueShift,omitempty"`
+	Temperature  float64  `json:"temperature,omitempty"`
+	Tint         float64  `json:"tint,omitempty"`
+	Adjustments  []string `json:"adjustments,omitempty"`
+	Blur         float64  `json:"blur,omitempty"`
+	Sharpen      float64  `json:"sharpen,omitempty"`
+	Gamma        float64  `json:"gamma,omitempty"`
+	Contrast     float64  `json:"contrast,omitempty"`
+	Brightness   float64  `json:"brightness,omitempty"`
+	Stylize      string   `json:"stylize,omitempty"`
+	SubjectFocus bool     `json:"subjectFocus,omitempty"`
+}
+
+// settings returns the conversion settings of the bead machine
+func (m *beadMachine) settings() conversionSettings {
+	settings := conversionSettings{
+		Palette:        m.palette,
+		Width:          m.width,
+		Height:         m.height,
+		BoardsWidth:    m.boardsWidth,
+		BoardsHeight:   m.boardsHeight,
+		BoardDimension: m.boardDimension,
+		Fit:            m.fit,
+		Resample:       m.resample,
+		AutoOrient:     m.autoOrient,
+		OptimizeSeams:  m.optimizeSeams,
+		PadToBoards:    m.padToBoards,
+		Tile:           m.tile,
+		Border:         m.border,
+		FillBackground: m.fill,
+		MaxBeads:       m.maxBeads,
+		SpriteSheet:    m.spriteSheet,
+		Grid:           m.patternGrid(),
+		SharedPalette:  m.sharedPalette,
+
+		BeadStyle:       m.beadStyle,
+		Translucent:     m.translucent,
+		Flourescent:     m.flourescent,
+		NoColorMatching: m.noColorMatching,
+		Colors:          m.colors,
+		MergeDuplicates: m.mergeDuplicates,
+		Substitutions:   m.substitutions,
+		ColorblindSafe:  m.colorblindSafe,
+		MaxColors:       m.maxColors,
+		PreserveFaces:   m.preserveFaces,
+		AdaptiveDither:  m.adaptiveDither,
+
+		GreyScale:    m.greyScale,
+		AutoLevels:   m.autoLevels,
+		AutoContrast: m.autoContrast,
+		BlackPoint:   m.blackPoint,
+		HueShift:     m.hueShift,
+		Temperature:  m.temperature,
+		Tint:         m.tint,
+		Adjustments:  m.adjust,
+		Blur:         m.blur,
+		Sharpen:      m.sharpen,
+		Gamma:        m.gamma,
+		Contrast:     m.contrast,
+		Brightness:   m.brightness,
+		Stylize:      m.stylize,
+		SubjectFocus: m.subjectFocus,
+	}
+	if m.optimizeSeams {
+		settings.SeamMargin = m.seamMargin
+	}
+	if m.padToBoards {
+		settings.PadAlign = m.padAlign
+	}
+	if m.tile != "" {
+		settings.TileMirror = m.tileMirror
+	}
+	if m.mergeDuplicates {
+		settings.DuplicateThreshold = m.duplicateThreshold
+	}
+	if m.whitePoint != 255 {
+		settings.WhitePoint = m.whitePoint
+	}
+	if m.distanceName != distanceCIEDE2000 {
+		settings.Distance = m.distanceName
+	}
+	if m.cachePrecision < maxCachePrecision {
+		settings.CachePrecision = m.cachePrecision
+	}
+	return settings
+}
@@ -0,0 +1,340 @@
+package beadmachine
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// shellIntegrationName is the name of the context menu entry
+const shellIntegrationName = "Convert to bead pattern"
+
+// shellIntegrationKey is the registry key of the Windows context menu entry for images
+const shellIntegrationKey = `HKCU\Software\Classes\SystemFileAssociations\image\shell\beadmachine`
+
+// shellIntegrationMimeTypes contains the file types that the Linux desktop entry is offered for
+var shellIntegrationMimeTypes = []string{"image/png", "image/jpeg", "image/gif", "image/bmp", "image/tiff", "image/svg+xml", "application/pdf"}
+
+// installShellIntegrationCommand returns the command that adds the context menu entry of the file manager
+func installShellIntegrationCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "install-shell-integration",
+		Short: "Add a \"" + shellIntegrationName + "\" entry to the context menu of the file manager",
+		Long: `Add a "` + shellIntegrationName + `" entry to the context menu of images in the file manager, that
+converts the image with a preset and writes the pattern next to it. On Windows the entry is added to the
+context menu and to "Send to", on Linux a desktop entry is installed that is listed under "Open with" and on
+macOS a quick action is installed.`,
+		Args: cobra.NoArgs,
+		RunE: installShellIntegration,
+	}
+	cmd.Flags().StringP("preset", "", "photo", "preset that the images are converted with")
+	cmd.Flags().BoolP("uninstall", "", false, "remove the context menu entry")
+	_ = cmd.RegisterFlagCompletionFunc("preset", completePreset)
+	return cmd
+}
+
+func installShellIntegration(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	presetName, _ := cmd.Flags().GetString("preset")
+	uninstall, _ := cmd.Flags().GetBool("uninstall")
+
+	if uninstall {
+		if err := uninstallShellIntegration(); err != nil {
+			logger.Error("Removing shell integration failed", zap.Error(err))
+			return failureError(err)
+		}
+		logger.Info("Shell integration removed")
+		return nil
+	}
+
+	if _, err := findPreset(presetName); err != nil {
+		logger.Error("Invalid preset", zap.Error(err))
+		return usageError(err)
+	}
+	executable, err := os.Executable()
+	if err == nil {
+		executable, err = filepath.EvalSymlinks(executable)
+	}
+	if err != nil {
+		logger.Error("Finding executable failed", zap.Error(err))
+		return failureError(err)
+	}
+
+	var installed []string
+	switch runtime.GOOS {
+	case "windows":
+		installed, err = installWindowsShellIntegration(executable, presetName)
+	case "darwin":
+		installed, err = installMacShellIntegration(executable, presetName)
+	default:
+		installed, err = installLinuxShellIntegration(executable, presetName)
+	}
+	if err != nil {
+		logger.Error("Installing shell integration failed", zap.Error(err))
+		return failureError(err)
+	}
+	logger.Info("Shell integration installed", zap.String("preset", presetName), zap.Strings("installed", installed))
+	return nil
+}
+
+// sendToFileName returns the filename of the Windows "Send to" script
+func sendToFileName() string {
+	return filepath.Join(os.Getenv("APPDATA"), "Microsoft", "Windows", "SendTo", shellIntegrationName+".cmd")
+}
+
+// installWindowsShellIntegration adds the context menu entry to the registry of the user and the script to
+// the "Send to" folder
+func installWindowsShellIntegration(executable, presetName string) ([]string, error) {
+	command := fmt.Sprintf(`"%s" --preset "%s" "%%1"`, executable, presetName)
+	for _, args := range [][]string{
+		{"add", shellIntegrationKey, "/ve", "/d", shellIntegrationName, "/f"},
+		{"add", shellIntegrationKey, "/v", "Icon", "/d", executable, "/f"},
+		{"add", shellIntegrationKey + `\command`, "/ve", "/d", command, "/f"},
+	} {
+		if output, err := exec.Command("reg", args...).CombinedOutput(); err != nil {
+			return nil, errors.Wrapf(err, "writing registry: %s", strings.TrimSpace(string(output)))
+		}
+	}
+
+	script := fmt.Sprintf("@echo off\r\nfor %%%%f in (%%*) do \"%s\" --preset \"%s\" %%%%f\r\n", executable, presetName)
+	if err := ioutil.WriteFile(sendToFileName(), []byte(script), 0644); err != nil {
+		return nil, errors.Wrap(err, "writing send to script")
+	}
+	return []string{shellIntegrationKey, sendToFileName()}, nil
+}
+
+// desktopEntryFileName returns the filename of the Linux desktop entry
+func desktopEntryFileName() (string, error) {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", errors.Wrap(err, "getting home directory")
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "applications", "beadmachine-convert.desktop"), nil
+}
+
+// installLinuxShellIntegration installs a desktop entry that file managers list under "Open with" for images
+func installLinuxShellIntegration(executable, presetName string) ([]string, error) {
+	fileName, err := desktopEntryFileName()
+	if err != nil {
+		return nil, err
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=%s
+Exec="%s" --preset "%s" %%f
+MimeType=%s;
+Terminal=false
+NoDisplay=true
+`, shellIntegrationName, executable, presetName, strings.Join(shellIntegrationMimeTypes, ";"))
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating applications directory")
+	}
+	if err = ioutil.WriteFile(fileName, []byte(entry), 0644); err != nil {
+		return nil, errors.Wrap(err, "writing desktop entry")
+	}
+	// the desktop database caches the MIME types of the entries, it is not installed on every system
+	if path, err := exec.LookPath("update-desktop-database"); err == nil {
+		_ = exec.Command(path, filepath.Dir(fileName)).Run()
+	}
+	return []string{fileName}, nil
+}
+
+// quickActionDirectory returns the directory of the macOS quick action workflow
+func quickActionDirectory() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "getting home directory")
+	}
+	return filepath.Join(home, "Library", "Services", shellIntegrationName+".workflow"), nil
+}
+
+// installMacShellIntegration installs an Automator quick action for images that runs a shell script
+func installMacShellIntegration(executable, presetName string) ([]string, error) {
+	dir, err := quickActionDirectory()
+	if err != nil {
+		return nil, err
+	}
+	script := fmt.Sprintf(`for f in "$@"; do "%s" --preset "%s" "$f"; done`, executable, presetName)
+	files := map[string]string{
+		"Info.plist":     fmt.Sprintf(quickActionInfoPlist, html.EscapeString(shellIntegrationName)),
+		"document.wflow": fmt.Sprintf(quickActionWorkflow, html.EscapeString(script)),
+	}
+
+	if err = os.MkdirAll(filepath.Join(dir, "Contents"), 0755); err != nil {
+		return nil, errors.Wrap(err, "creating quick action directory")
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, "Contents", name), []byte(content), 0644); err != nil {
+			return nil, errors.Wrap(err, "writing quick action")
+		}
+	}
+	return []string{dir}, nil
+}
+
+// uninstallShellIntegration removes the context menu entry of the current system
+func uninstallShellIntegration() error {
+	switch runtime.GOOS {
+	case "windows":
+		if output, err := exec.Command("reg", "delete", shellIntegrationKey, "/f").CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "deleting registry key: %s", strings.TrimSpace(string(output)))
+		}
+		if err := os.Remove(sendToFileName()); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing send to script")
+		}
+	case "darwin":
+		dir, err := quickActionDirectory()
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(os.RemoveAll(dir), "removing quick action")
+	default:
+		fileName, err := desktopEntryFileName()
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "removing desktop entry")
+		}
+	}
+	return nil
+}
+
+// quickActionInfoPlist is the bundle description of the quick action, %s is replaced by the menu name
+const quickActionInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSServices</key>
+	<array>
+		<dict>
+			<key>NSMenuItem</key>
+			<dict>
+				<key>default</key>
+				<string>%s</string>
+			</dict>
+			<key>NSMessage</key>
+			<string>runWorkflowAsService</string>
+			<key>NSRequiredContext</key>
+			<dict>
+				<key>NSApplicationIdentifier</key>
+				<string>com.apple.finder</string>
+			</dict>
+			<key>NSSendFileTypes</key>
+			<array>
+				<string>public.image</string>
+				<string>com.adobe.pdf</string>
+			</array>
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+// quickActionWorkflow is the Automator workflow of the quick action with a single shell script action that
+// gets the selected files as arguments, %s is replaced by the script
+const quickActionWorkflow = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AMApplicationBuild</key>
+	<string>523</string>
+	<key>AMApplicationVersion</key>
+	<string>2.10</string>
+	<key>AMDocumentVersion</key>
+	<string>2</string>
+	<key>actions</key>
+	<array>
+		<dict>
+			<key>action</key>
+			<dict>
+				<key>AMAccepts</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Optional</key>
+					<true/>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>AMActionVersion</key>
+				<string>2.0.3</string>
+				<key>AMParameterProperties</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<dict/>
+					<key>inputMethod</key>
+					<dict/>
+					<key>shell</key>
+					<dict/>
+				</dict>
+				<key>AMProvides</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>ActionBundlePath</key>
+				<string>/System/Library/Automator/Run Shell Script.action</string>
+				<key>ActionName</key>
+				<string>Run Shell Script</string>
+				<key>ActionParameters</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<string>%s</string>
+					<key>CheckedForUserDefaultShell</key>
+					<true/>
+					<key>inputMethod</key>
+					<integer>1</integer>
+					<key>shell</key>
+					<string>/bin/sh</string>
+					<key>source</key>
+					<string></string>
+				</dict>
+				<key>BundleIdentifier</key>
+				<string>com.apple.RunShellScript</string>
+				<key>CFBundleVersion</key>
+				<string>2.0.3</string>
+				<key>Class Name</key>
+				<string>RunShellScriptAction</string>
+				<key>InputUUID</key>
+				<string>6C3F4E43-8A5B-4C0B-9D4E-2E8B1D93A001</string>
+				<key>OutputUUID</key>
+				<string>6C3F4E43-8A5B-4C0B-9D4E-2E8B1D93A002</string>
+				<key>UUID</key>
+				<string>6C3F4E43-8A5B-4C0B-9D4E-2E8B1D93A003</string>
+			</dict>
+		</dict>
+	</array>
+	<key>workflowMetaData</key>
+	<dict>
+		<key>serviceApplicationBundleID</key>
+		<string>com.apple.finder</string>
+		<key>serviceInputTypeIdentifier</key>
+		<string>com.apple.Automator.fileSystemObject.image</string>
+		<key>serviceOutputTypeIdentifier</key>
+		<string>com.apple.Automator.nothing</string>
+		<key>workflowTypeIdentifier</key>
+		<string>com.apple.Automator.servicesMenu</string>
+	</dict>
+</dict>
+</plist>
+`
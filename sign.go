@@ -0,0 +1,286 @@
+package beadmachine
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	bundleManifestName  = "manifest.json"  // checksums of all other entries of a bundle
+	bundleSignatureName = "signature.json" // signature of the manifest of a signed bundle
+	signatureAlgorithm  = "ed25519"
+	keyIDLength         = 16 // hex characters of the SHA-256 hash of a public key that are its id
+)
+
+// bundleManifest lists the entries of a bundle with their checksums, the signature of a signed bundle covers the
+// manifest, so that any changed, added or removed entry breaks the signature
+type bundleManifest struct {
+	Files []bundleManifestFile `json:"files"`
+}
+
+// bundleManifestFile is an entry of the bundle manifest
+type bundleManifestFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// bundleSignature is the signature of the manifest of a bundle with the public key that verifies it
+type bundleSignature struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"keyId"`
+	PublicKey string `json:"publicKey"` // base64 encoded PKIX public key
+	Signature string `json:"signature"` // base64 encoded signature of the manifest.json entry
+}
+
+// loadSigningKey loads an Ed25519 private key from a PEM file in the PKCS #8 format, as written by
+// openssl genpkey -algorithm ed25519
+func loadSigningKey(fileName string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading signing key")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("the signing key is not a PEM encoded PKCS #8 private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing signing key")
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("the signing key is a %T, expected an Ed25519 key", key)
+	}
+	return privateKey, nil
+}
+
+// loadVerifyKey loads an Ed25519 public key from a PEM file in the PKIX format, as written by
+// openssl pkey -pubout
+func loadVerifyKey(fileName string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading public key")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("the public key is not a PEM encoded PKIX public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing public key")
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the public key is a %T, expected an Ed25519 key", key)
+	}
+	return publicKey, nil
+}
+
+// keyID returns the id of a public key, the start of the hash of its PKIX encoding
+func keyID(publicKeyData []byte) string {
+	hash := sha256.Sum256(publicKeyData)
+	return hex.EncodeToString(hash[:])[:keyIDLength]
+}
+
+// signManifest returns the signature of the manifest data
+func signManifest(key ed25519.PrivateKey, manifest []byte) (*bundleSignature, error) {
+	publicKeyData, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "encoding public key")
+	}
+	return &bundleSignature{
+		Algorithm: signatureAlgorithm,
+		KeyID:     keyID(publicKeyData),
+		PublicKey: base64.StdEncoding.EncodeToString(publicKeyData),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest)),
+	}, nil
+}
+
+// isBundle returns whether the file is a zip archive
+func isBundle(fileName string) bool {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 4)
+	_, err = io.ReadFull(f, header)
+	return err == nil && bytes.Equal(header, []byte("PK\x03\x04"))
+}
+
+// bundleVerification is the result of verifying a bundle
+type bundleVerification struct {
+	files  int
+	signed bool
+	keyID  string
+}
+
+// verifyBundle checks the entries of the bundle against the checksums of its manifest and the signature of the
+// manifest. With a public key the bundle has to be signed by its private key, without one the signature is only
+// checked against the public key that the bundle contains, which proves that it was not changed but not by whom it
+// was signed.
+func verifyBundle(fileName string, publicKey ed25519.PublicKey) (bundleVerification, error) {
+	var result bundleVerification
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return result, inputError(errors.Wrap(err, "opening bundle"))
+	}
+	defer archive.Close()
+
+	entries := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		if _, ok := entries[file.Name]; ok {
+			return result, failureError(fmt.Errorf("the bundle contains the entry %s more than once", file.Name))
+		}
+		entries[file.Name] = file
+	}
+	manifestEntry, ok := entries[bundleManifestName]
+	if !ok {
+		return result, inputError(errors.New("the bundle contains no manifest, it was created by an older beadmachine"))
+	}
+	manifestData, err := readBundleEntry(manifestEntry)
+	if err != nil {
+		return result, inputError(err)
+	}
+	var manifest bundleManifest
+	if err = json.Unmarshal(manifestData, &manifest); err != nil {
+		return result, failureError(errors.Wrap(err, "parsing bundle manifest"))
+	}
+
+	if signatureEntry, ok := entries[bundleSignatureName]; ok {
+		if result.keyID, err = verifyManifestSignature(signatureEntry, manifestData, publicKey); err != nil {
+			return result, failureError(err)
+		}
+		result.signed = true
+	} else if publicKey != nil {
+		return result, failureError(errors.New("the bundle is not signed"))
+	}
+
+	listed := make(map[string]bool)
+	for _, file := range manifest.Files {
+		entry, ok := entries[file.Name]
+		if !ok || file.Name == bundleManifestName || file.Name == bundleSignatureName {
+			return result, failureError(fmt.Errorf("the bundle entry %s of the manifest is missing", file.Name))
+		}
+		data, err := readBundleEntry(entry)
+		if err != nil {
+			return result, inputError(err)
+		}
+		hash := sha256.Sum256(data)
+		if int64(len(data)) != file.Size || hex.EncodeToString(hash[:]) != file.SHA256 {
+			return result, failureError(fmt.Errorf("the bundle entry %s was changed", file.Name))
+		}
+		listed[file.Name] = true
+	}
+	for name := range entries {
+		if !listed[name] && name != bundleManifestName && name != bundleSignatureName {
+			return result, failureError(fmt.Errorf("the bundle entry %s is not part of the manifest", name))
+		}
+	}
+	result.files = len(manifest.Files)
+	return result, nil
+}
+
+// verifyManifestSignature verifies the signature entry of a bundle and returns the id of the key that signed it
+func verifyManifestSignature(entry *zip.File, manifest []byte, publicKey ed25519.PublicKey) (string, error) {
+	data, err := readBundleEntry(entry)
+	if err != nil {
+		return "", err
+	}
+	var signature bundleSignature
+	if err = json.Unmarshal(data, &signature); err != nil {
+		return "", errors.Wrap(err, "parsing bundle signature")
+	}
+	if signature.Algorithm != signatureAlgorithm {
+		return "", fmt.Errorf("unsupported signature algorithm '%s'", signature.Algorithm)
+	}
+	signatureData, err := base64.StdEncoding.DecodeString(signature.Signature)
+	if err != nil {
+		return "", errors.Wrap(err, "decoding bundle signature")
+	}
+
+	if publicKey == nil { // only proves that the bundle matches the key that it contains
+		if publicKey, err = bundlePublicKey(signature); err != nil {
+			return "", err
+		}
+	}
+	if !ed25519.Verify(publicKey, manifest, signatureData) {
+		return "", errors.New("the signature of the bundle does not match, the bundle was changed or signed with another key")
+	}
+	publicKeyData, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", errors.Wrap(err, "encoding public key")
+	}
+	return keyID(publicKeyData), nil
+}
+
+// bundlePublicKey returns the public key that the signature of a bundle contains
+func bundlePublicKey(signature bundleSignature) (ed25519.PublicKey, error) {
+	publicKeyData, err := base64.StdEncoding.DecodeString(signature.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding public key of the bundle")
+	}
+	key, err := x509.ParsePKIXPublicKey(publicKeyData)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing public key of the bundle")
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the public key of the bundle is a %T, expected an Ed25519 key", key)
+	}
+	return publicKey, nil
+}
+
+// readBundleEntry returns the content of the bundle entry
+func readBundleEntry(entry *zip.File) ([]byte, error) {
+	r, err := entry.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening bundle entry %s", entry.Name)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	return data, errors.Wrapf(err, "reading bundle entry %s", entry.Name)
+}
+
+// startVerifyBundle verifies the checksums and the signature of a bundle for the verify command
+func startVerifyBundle(logger *zap.Logger, fileName, keyFileName string) error {
+	var publicKey ed25519.PublicKey
+	if keyFileName != "" {
+		var err error
+		if publicKey, err = loadVerifyKey(keyFileName); err != nil {
+			logger.Error("Loading public key failed", zap.Error(err))
+			return usageError(err)
+		}
+	}
+
+	result, err := verifyBundle(fileName, publicKey)
+	if err != nil {
+		logger.Error("Verifying bundle failed", zap.String("file", fileName), zap.Error(err))
+		return err
+	}
+	switch {
+	case !result.signed:
+		logger.Warn("Bundle is not signed, only the checksums were verified", zap.String("file", fileName))
+	case publicKey == nil:
+		logger.Warn("Signer of the bundle was not checked, pass the public key of the seller with --key",
+			zap.String("keyId", result.keyID))
+	}
+	logger.Info("Bundle verified", zap.String("file", fileName), zap.Int("files", result.files),
+		zap.Bool("signed", result.signed), zap.String("keyId", result.keyID))
+	return nil
+}
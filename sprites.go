@@ -0,0 +1,155 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// spriteSheetAuto is the --sprite-sheet value that detects the grid of the frames
+const spriteSheetAuto = "auto"
+
+// parseSpriteSheet parses a sprite sheet grid like 4x2 into the columns and rows, for auto 0 is returned for both
+func parseSpriteSheet(value string) (int, int, error) {
+	if value == spriteSheetAuto {
+		return 0, 0, nil
+	}
+	if columns, rows, ok := parseGrid(value); ok {
+		return columns, rows, nil
+	}
+	return 0, 0, fmt.Errorf("invalid sprite sheet grid '%s', expected columns x rows like 4x4 or auto", value)
+}
+
+// detectSpriteGrid detects the columns and rows of frames of a sprite sheet, that are separated by rows and
+// columns of the background color. The background is the color of the top left pixel.
+func detectSpriteGrid(img image.Image) (int, int, error) {
+	bounds := img.Bounds()
+	background := color.NRGBAModel.Convert(img.At(bounds.Min.X, bounds.Min.Y)).(color.NRGBA)
+	isBackground := func(x, y int) bool {
+		c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+		return c == background || (c.A == 0 && background.A == 0)
+	}
+
+	columnFilled := make([]bool, bounds.Dx())
+	rowFilled := make([]bool, bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !isBackground(x, y) {
+				columnFilled[x-bounds.Min.X] = true
+				rowFilled[y-bounds.Min.Y] = true
+			}
+		}
+	}
+
+	columns, rows := countRuns(columnFilled), countRuns(rowFilled)
+	if columns*rows <= 1 {
+		return 0, 0, errors.New("no sprite grid detected, set the grid like --sprite-sheet 4x4")
+	}
+	return columns, rows, nil
+}
+
+// countRuns returns the number of runs of consecutive true values
+func countRuns(values []bool) int {
+	runs := 0
+	for i, value := range values {
+		if value && (i == 0 || !values[i-1]) {
+			runs++
+		}
+	}
+	return runs
+}
+
+// sliceSpriteSheet splits the sprite sheet into equally sized frames, ordered by rows from the top left
+func sliceSpriteSheet(img image.Image, columns, rows int) ([]image.Image, error) {
+	bounds := img.Bounds()
+	frameWidth, frameHeight := bounds.Dx()/columns, bounds.Dy()/rows
+	if frameWidth == 0 || frameHeight == 0 {
+		return nil, fmt.Errorf("the sprite sheet of %dx%d pixel can not be split into %dx%d frames",
+			bounds.Dx(), bounds.Dy(), columns, rows)
+	}
+
+	frames := make([]image.Image, 0, columns*rows)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			min := bounds.Min.Add(image.Pt(column*frameWidth, row*frameHeight))
+			frames = append(frames, imaging.Crop(img, image.Rectangle{Min: min, Max: min.Add(image.Pt(frameWidth, frameHeight))}))
+		}
+	}
+	return frames, nil
+}
+
+// frameFileName returns the filename of an output of a sprite sheet frame, the frame suffix is inserted
+// before the extension
+func frameFileName(fileName, suffix string) string {
+	extension := filepath.Ext(fileName)
+	return strings.TrimSuffix(fileName, extension) + suffix + extension
+}
+
+// processSpriteSheet slices the input image into its frames and writes a pattern for every frame. The colors
+// are selected across all frames, so that the frames of an animation match.
+func (m *beadMachine) processSpriteSheet() error {
+	frames, err := m.spriteFrames()
+	if err != nil {
+		return err
+	}
+	patterns, err := m.matchImages(frames)
+	if err != nil {
+		return err
+	}
+	return m.writeFrames(patterns)
+}
+
+// spriteFrames reads the sprite sheet and returns its prepared frames, the filters are applied to the whole
+// sheet so that they change all frames the same way
+func (m *beadMachine) spriteFrames() ([]image.Image, error) {
+	sheet, err := m.readInput(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	sheet = m.applyFilters(sheet)
+
+	columns, rows := m.spriteColumns, m.spriteRows
+	if m.spriteSheet == spriteSheetAuto {
+		if columns, rows, err = detectSpriteGrid(sheet); err != nil {
+			m.logger.Error("Detecting sprite grid failed", zap.Error(err))
+			return nil, inputError(err)
+		}
+	}
+	frames, err := sliceSpriteSheet(sheet, columns, rows)
+	if err != nil {
+		m.logger.Error("Slicing sprite sheet failed", zap.Error(err))
+		return nil, inputError(err)
+	}
+	m.logger.Info("Sprite sheet sliced",
+		zap.Int("columns", columns),
+		zap.Int("rows", rows),
+		zap.Int("frame width", frames[0].Bounds().Dx()),
+		zap.Int("frame height", frames[0].Bounds().Dy()))
+
+	for i := range frames {
+		if frames[i], err = m.fitImage(frames[i]); err != nil {
+			return nil, err
+		}
+	}
+	return frames, nil
+}
+
+// writeFrames writes the outputs of the patterns of all sprite sheet frames
+func (m *beadMachine) writeFrames(patterns []*Pattern) error {
+	var outputErr error
+	defer func() { m.frameSuffix = "" }()
+	for i, pattern := range patterns {
+		m.frameSuffix = fmt.Sprintf("_frame%02d", i+1)
+		if err := m.writeOutputs(pattern); err != nil && outputErr == nil {
+			outputErr = err
+		}
+	}
+	m.logger.Info("Sprite sheet patterns written", zap.Int("frames", len(patterns)))
+	return outputErr
+}
@@ -0,0 +1,256 @@
+package beadmachine
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// uploadTimeout is the timeout of uploading an output to an object storage
+const uploadTimeout = 5 * time.Minute
+
+// OutputUploader uploads the rendered data of an output to the location of an object storage URI without the
+// scheme, like bucket/patterns/image.png of s3://bucket/patterns/image.png
+type OutputUploader func(location string, data []byte, contentType string) error
+
+var (
+	outputUploaders     = make(map[string]OutputUploader)
+	outputUploadersLock sync.RWMutex
+)
+
+func init() {
+	RegisterOutputUploader("s3", uploadS3)
+	RegisterOutputUploader("gs", uploadGCS)
+	RegisterOutputUploader("az", uploadAzure)
+}
+
+// RegisterOutputUploader registers an uploader for output filenames like scheme://bucket/key, an already registered
+// uploader for the same scheme gets replaced
+func RegisterOutputUploader(scheme string, uploader OutputUploader) {
+	outputUploadersLock.Lock()
+	outputUploaders[scheme] = uploader
+	outputUploadersLock.Unlock()
+}
+
+// remoteOutput returns the uploader and the location of an output filename that is an object storage URI
+func remoteOutput(fileName string) (OutputUploader, string, bool) {
+	parts := strings.SplitN(fileName, "://", 2)
+	if len(parts) != 2 {
+		return nil, "", false
+	}
+	outputUploadersLock.RLock()
+	uploader, ok := outputUploaders[parts[0]]
+	outputUploadersLock.RUnlock()
+	return uploader, parts[1], ok
+}
+
+// splitOutputPath splits an output filename or object storage URI into its directory and base name
+func splitOutputPath(fileName string) (string, string) {
+	if _, location, ok := remoteOutput(fileName); ok {
+		dir, base := path.Split(location)
+		return strings.TrimSuffix(fileName, location) + strings.TrimSuffix(dir, "/"), base
+	}
+	return filepath.Dir(fileName), filepath.Base(fileName)
+}
+
+// joinOutputPath joins an output directory or object storage URI with a base name
+func joinOutputPath(dir, base string) string {
+	if _, location, ok := remoteOutput(dir); ok {
+		return strings.TrimSuffix(dir, location) + path.Join(location, base)
+	}
+	return filepath.Join(dir, base)
+}
+
+// uploadOutput renders the output into memory and uploads it to the object storage of its URI
+func uploadOutput(o output, pattern *Pattern, upload OutputUploader, location string) error {
+	var buf bytes.Buffer
+	if err := o.renderer.Render(pattern, &buf); err != nil {
+		return err
+	}
+	contentType := mime.TypeByExtension(path.Ext(location))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return errors.Wrap(upload(location, buf.Bytes(), contentType), "uploading output")
+}
+
+// splitBucket splits an object storage location into the bucket and the key of the object
+func splitBucket(location string) (string, string, error) {
+	parts := strings.SplitN(location, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid object location '%s', expected bucket/key", location)
+	}
+	return parts[0], parts[1], nil
+}
+
+// sendUpload sends the upload request and returns an error with the response body if it failed
+func sendUpload(req *http.Request) error {
+	client := http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("upload returned status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// uploadS3 uploads an object to Amazon S3 or a compatible storage like MinIO. The credentials are read from the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables, the region from
+// AWS_REGION or AWS_DEFAULT_REGION. AWS_ENDPOINT_URL selects another endpoint that is accessed path style.
+func uploadS3(location string, data []byte, contentType string) error {
+	bucket, key, err := splitBucket(location)
+	if err != nil {
+		return err
+	}
+	accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return errors.New("the environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	objectURL := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucket, region, escapeObjectKey(key))
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		objectURL = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/" + escapeObjectKey(key)
+	}
+	req, err := http.NewRequest(http.MethodPut, objectURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "creating upload request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	payloadHash := sha256.Sum256(data)
+	signS3Request(req, hex.EncodeToString(payloadHash[:]), accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"), region, time.Now())
+	return sendUpload(req)
+}
+
+// escapeObjectKey escapes every segment of an object key, like the canonical URI of the S3 signature
+func escapeObjectKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.Replace(url.QueryEscape(segment), "+", "%20", -1)
+	}
+	return strings.Join(segments, "/")
+}
+
+// signS3Request signs the request with the AWS signature version 4, the signature covers the host, the payload
+// hash, the date and the session token
+func signS3Request(req *http.Request, payloadHash, accessKey, secretKey, sessionToken, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	signingKey := hmacSHA256(hmacSHA256(hmacSHA256(hmacSHA256([]byte("AWS4"+secretKey), date), region), "s3"), "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// uploadGCS uploads an object to Google Cloud Storage with the OAuth access token of the GOOGLE_OAUTH_ACCESS_TOKEN
+// environment variable, like the one printed by gcloud auth print-access-token
+func uploadGCS(location string, data []byte, contentType string) error {
+	bucket, object, err := splitBucket(location)
+	if err != nil {
+		return err
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return errors.New("the environment variable GOOGLE_OAUTH_ACCESS_TOKEN is not set")
+	}
+
+	uploadURL := fmt.Sprintf("https://storage.googleapis.com/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		url.PathEscape(bucket), url.QueryEscape(object))
+	req, err := http.NewRequest(http.MethodPost, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "creating upload request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	return sendUpload(req)
+}
+
+// uploadAzure uploads a block blob to Azure Blob Storage, the location is container/blob of the storage account of
+// the AZURE_STORAGE_ACCOUNT environment variable that is authorized by the SAS token of AZURE_STORAGE_SAS_TOKEN
+func uploadAzure(location string, data []byte, contentType string) error {
+	container, blob, err := splitBucket(location)
+	if err != nil {
+		return err
+	}
+	account, token := os.Getenv("AZURE_STORAGE_ACCOUNT"), strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if account == "" || token == "" {
+		return errors.New("the environment variables AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_SAS_TOKEN are not set")
+	}
+
+	blobURL := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s?%s", account, url.PathEscape(container), escapeObjectKey(blob), token)
+	req, err := http.NewRequest(http.MethodPut, blobURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "creating upload request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	req.Header.Set("X-Ms-Version", "2020-10-02")
+	return sendUpload(req)
+}
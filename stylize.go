@@ -0,0 +1,193 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// artistic styles that simplify photos into flat colored regions
+const (
+	stylizeComic  = "comic"
+	stylizeOil    = "oil"
+	stylizeMosaic = "mosaic"
+)
+
+// stylize settings
+const (
+	stylizeOversampling = 8   // pixel per bead of the image that the style is applied to
+	comicLevels         = 5   // lightness values of the comic style
+	comicEdgeThreshold  = 320 // gradient magnitude of the luminance that is drawn as outline
+)
+
+// stylizeNames returns the names of all styles
+func stylizeNames() []string {
+	return []string{stylizeComic, stylizeOil, stylizeMosaic}
+}
+
+// applyStylize simplifies the image into flat colored regions of the selected style, they convert to beads
+// far better than the fine details and noise of photos
+func (m *beadMachine) applyStylize(inputImage image.Image) image.Image {
+	if m.stylize == "" {
+		return inputImage
+	}
+	img, pixelPerBead := m.stylizeImage(inputImage)
+	radius := maxInt(1, pixelPerBead/2)
+
+	switch m.stylize {
+	case stylizeComic:
+		smoothed := kuwahara(img, radius)
+		return outline(posterize(smoothed, comicLevels), smoothed, radius/2)
+	case stylizeOil:
+		return kuwahara(img, radius)
+	default:
+		return pixelate(img, 2*pixelPerBead)
+	}
+}
+
+// stylizeImage returns the image that the style is applied to and its amount of pixel per bead. Images that
+// are much larger than the pattern are downscaled first, as their details get lost anyway and the filters
+// would be slow on them.
+func (m *beadMachine) stylizeImage(inputImage image.Image) (*image.NRGBA, int) {
+	bounds := inputImage.Bounds()
+	newWidth, newHeight := m.targetSize()
+	if m.spriteSheet != "" || (newWidth == 0 && newHeight == 0) {
+		// the filters of sprite sheets are applied to the whole sheet, its size is not the size of a pattern
+		return imaging.Clone(inputImage), 1
+	}
+
+	scale := math.Max(float64(newWidth)/float64(bounds.Dx()), float64(newHeight)/float64(bounds.Dy()))
+	scale *= stylizeOversampling
+	if scale >= 1 {
+		return imaging.Clone(inputImage), maxInt(1, int(stylizeOversampling/scale))
+	}
+	width := maxInt(1, int(math.Round(float64(bounds.Dx())*scale)))
+	return imaging.Resize(inputImage, width, 0, imaging.Lanczos), stylizeOversampling
+}
+
+// kuwahara smooths the image while keeping its edges, like an oil painting. Every pixel gets the mean color
+// of the one of its four neighbor quadrants with the smallest luminance variance.
+func kuwahara(img *image.NRGBA, radius int) *image.NRGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	stride := width + 1
+
+	// summed area tables of the color channels, the luminance and the squared luminance
+	var sums [5][]float64
+	for i := range sums {
+		sums[i] = make([]float64, stride*(height+1))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			p := img.Pix[y*img.Stride+x*4:]
+			lum := luminance([]uint8{p[0], p[1], p[2]})
+			values := [5]float64{float64(p[0]), float64(p[1]), float64(p[2]), lum, lum * lum}
+			i := (y+1)*stride + x + 1
+			for c, v := range values {
+				sums[c][i] = v + sums[c][i-1] + sums[c][i-stride] - sums[c][i-stride-1]
+			}
+		}
+	}
+	area := func(c, x0, y0, x1, y1 int) float64 { // sum of the rectangle with exclusive bottom right corner
+		return sums[c][y1*stride+x1] - sums[c][y0*stride+x1] - sums[c][y1*stride+x0] + sums[c][y0*stride+x0]
+	}
+
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			best := math.Inf(1)
+			var mean [3]float64
+			for _, q := range [4][2]int{{-radius, -radius}, {0, -radius}, {-radius, 0}, {0, 0}} {
+				x0, y0 := maxInt(0, x+q[0]), maxInt(0, y+q[1])
+				x1, y1 := minInt(width, x+q[0]+radius+1), minInt(height, y+q[1]+radius+1)
+				n := float64((x1 - x0) * (y1 - y0))
+				lum := area(3, x0, y0, x1, y1) / n
+				variance := area(4, x0, y0, x1, y1)/n - lum*lum
+				if variance < best {
+					best = variance
+					for c := range mean {
+						mean[c] = area(c, x0, y0, x1, y1) / n
+					}
+				}
+			}
+			i := y*result.Stride + x*4
+			result.Pix[i] = clampChannel(mean[0])
+			result.Pix[i+1] = clampChannel(mean[1])
+			result.Pix[i+2] = clampChannel(mean[2])
+			result.Pix[i+3] = img.Pix[y*img.Stride+x*4+3]
+		}
+	}
+	return result
+}
+
+// posterize reduces the lightness of the image to the given amount of values, the hues are kept
+func posterize(img *image.NRGBA, levels int) *image.NRGBA {
+	step := 1 / float64(levels-1)
+	return imaging.AdjustFunc(img, func(c color.NRGBA) color.NRGBA {
+		h, s, l := rgbToHSL(float64(c.R), float64(c.G), float64(c.B))
+		r, g, b := hslToRGB(h, s, math.Round(l/step)*step)
+		return color.NRGBA{clampChannel(r), clampChannel(g), clampChannel(b), c.A}
+	})
+}
+
+// outline draws black lines with the given thickness around the pixel in the image where the luminance of the
+// edge image changes strongly
+func outline(img, edges *image.NRGBA, thickness int) *image.NRGBA {
+	width, height := edges.Bounds().Dx(), edges.Bounds().Dy()
+	lum := func(x, y int) float64 {
+		p := edges.Pix[minInt(maxInt(y, 0), height-1)*edges.Stride+minInt(maxInt(x, 0), width-1)*4:]
+		return luminance([]uint8{p[0], p[1], p[2]})
+	}
+
+	result := imaging.Clone(img)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// sobel operator of the luminance
+			gx := lum(x+1, y-1) + 2*lum(x+1, y) + lum(x+1, y+1) - lum(x-1, y-1) - 2*lum(x-1, y) - lum(x-1, y+1)
+			gy := lum(x-1, y+1) + 2*lum(x, y+1) + lum(x+1, y+1) - lum(x-1, y-1) - 2*lum(x, y-1) - lum(x+1, y-1)
+			if math.Hypot(gx, gy) < comicEdgeThreshold {
+				continue
+			}
+			for dy := -thickness; dy <= thickness; dy++ {
+				for dx := -thickness; dx <= thickness; dx++ {
+					px, py := x+dx, y+dy
+					if px < 0 || py < 0 || px >= width || py >= height {
+						continue
+					}
+					i := py*result.Stride + px*4
+					result.Pix[i], result.Pix[i+1], result.Pix[i+2] = 0, 0, 0
+				}
+			}
+		}
+	}
+	return result
+}
+
+// pixelate fills every square block of the given size with its mean color
+func pixelate(img *image.NRGBA, block int) *image.NRGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for by := 0; by < height; by += block {
+		for bx := 0; bx < width; bx += block {
+			x1, y1 := minInt(bx+block, width), minInt(by+block, height)
+			var sum [4]float64
+			for y := by; y < y1; y++ {
+				for x := bx; x < x1; x++ {
+					for c := range sum {
+						sum[c] += float64(img.Pix[y*img.Stride+x*4+c])
+					}
+				}
+			}
+			n := float64((x1 - bx) * (y1 - by))
+			for y := by; y < y1; y++ {
+				for x := bx; x < x1; x++ {
+					for c := range sum {
+						result.Pix[y*result.Stride+x*4+c] = clampChannel(sum[c] / n)
+					}
+				}
+			}
+		}
+	}
+	return result
+}
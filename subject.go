@@ -0,0 +1,275 @@
+package beadmachine
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// subject focus settings
+const (
+	subjectMaskSize         = 160  // maximum width and height in pixel of the image that the subject is detected in
+	subjectBorder           = 0.06 // fraction of the image width and height at the borders that is sampled as background
+	subjectBackgroundColors = 4    // colors of the flattened background
+	subjectCenterSigma      = 0.35 // spread of the center prior, relative to the image size
+	kmeansIterations        = 10
+)
+
+// applySubjectFocus detects the foreground subject of the image, keeps its details and flattens the background
+// to a few colors, so that the beads of the background do not distract from the subject
+func (m *beadMachine) applySubjectFocus(inputImage image.Image) image.Image {
+	if !m.subjectFocus {
+		return inputImage
+	}
+	img := imaging.Clone(inputImage)
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	small := imaging.Fit(img, subjectMaskSize, subjectMaskSize, imaging.Box)
+	mask := imaging.Resize(subjectMask(small), width, height, imaging.Linear)
+	subject := make([]float64, width*height)
+	var area float64
+	for i := range subject {
+		subject[i] = float64(mask.Pix[i*4]) / 255
+		area += subject[i]
+	}
+
+	// the background is blurred and matched to its dominant colors
+	blurred := imaging.Blur(img, math.Max(1, float64(maxInt(width, height))/100))
+	var samples [][3]float64
+	step := maxInt(1, width*height/4096)
+	for i := 0; i < width*height; i += step {
+		if subject[i] < 0.5 {
+			p := blurred.Pix[i*4:]
+			samples = append(samples, [3]float64{float64(p[0]), float64(p[1]), float64(p[2])})
+		}
+	}
+	if len(samples) == 0 {
+		m.logger.Warn("No background found for the subject focus")
+		return img
+	}
+	colors := kmeansColors(samples, subjectBackgroundColors)
+
+	for i, weight := range subject {
+		p, b := img.Pix[i*4:], blurred.Pix[i*4:]
+		flat := colors[nearestColor(colors, [3]float64{float64(b[0]), float64(b[1]), float64(b[2])})]
+		for c := 0; c < 3; c++ {
+			p[c] = clampChannel(weight*float64(p[c]) + (1-weight)*flat[c])
+		}
+	}
+	m.logger.Info("Subject focused", zap.Float64("subject area %", math.Round(area/float64(width*height)*1000)/10))
+	return img
+}
+
+// subjectMask returns a mask of the image that is white for the foreground subject. The subject is the
+// largest region near the center whose colors differ from the colors at the image borders, skin colored faces
+// always belong to it.
+func subjectMask(img *image.NRGBA) *image.NRGBA {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	pixel := func(i int) [3]float64 {
+		p := img.Pix[i*4:]
+		return [3]float64{float64(p[0]), float64(p[1]), float64(p[2])}
+	}
+
+	borderX, borderY := maxInt(1, int(float64(width)*subjectBorder)), maxInt(1, int(float64(height)*subjectBorder))
+	var samples [][3]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// the bottom border and the bottom of the sides are not sampled, as subjects like the body of a
+			// portrait are often cut off there
+			if y < borderY || ((x < borderX || x >= width-borderX) && y < height/2) {
+				samples = append(samples, pixel(x+y*width))
+			}
+		}
+	}
+	background := kmeansColors(samples, subjectBackgroundColors)
+
+	// the score is the color distance to the nearest background color, weighted by the distance to the center
+	score := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := x + y*width
+			c := pixel(i)
+			dx, dy := (float64(x)+0.5)/float64(width)-0.5, (float64(y)+0.5)/float64(height)-0.5
+			prior := math.Exp(-(dx*dx + dy*dy) / (2 * subjectCenterSigma * subjectCenterSigma))
+			score[i] = colorDistance(c, background[nearestColor(background, c)]) * prior
+		}
+	}
+	threshold := otsuThreshold(score)
+	foreground := make([]bool, width*height)
+	for i, s := range score {
+		foreground[i] = s > threshold
+	}
+	for i, face := range faceMask(img, detectFaces(img)) {
+		foreground[i] = foreground[i] || face
+	}
+	foreground = largestRegion(foreground, width, height)
+	fillHoles(foreground, width, height)
+
+	mask := image.NewGray(image.Rect(0, 0, width, height))
+	for i, f := range foreground {
+		if f {
+			mask.Pix[i] = 255
+		}
+	}
+	return imaging.Blur(mask, 1.5) // soft edges blend the subject into the background
+}
+
+// kmeansColors returns the given amount of dominant colors of the samples, found by k-means clustering
+func kmeansColors(samples [][3]float64, k int) [][3]float64 {
+	k = minInt(k, len(samples))
+	centers := make([][3]float64, k)
+	for i := range centers {
+		centers[i] = samples[i*len(samples)/k]
+	}
+	for iteration := 0; iteration < kmeansIterations; iteration++ {
+		sums := make([][3]float64, k)
+		counts := make([]int, k)
+		for _, s := range samples {
+			j := nearestColor(centers, s)
+			for c := range s {
+				sums[j][c] += s[c]
+			}
+			counts[j]++
+		}
+		for j := range centers {
+			if counts[j] == 0 {
+				continue
+			}
+			for c := range centers[j] {
+				centers[j][c] = sums[j][c] / float64(counts[j])
+			}
+		}
+	}
+	return centers
+}
+
+// nearestColor returns the index of the color that is nearest to the given color
+func nearestColor(colors [][3]float64, c [3]float64) int {
+	best, bestDistance := 0, math.Inf(1)
+	for i, candidate := range colors {
+		if d := colorDistance(candidate, c); d < bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
+
+// colorDistance returns the euclidean distance of the RGB colors
+func colorDistance(a, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
+
+// otsuThreshold returns the threshold that separates the values into two classes with the largest variance
+// between the classes
+func otsuThreshold(values []float64) float64 {
+	const bins = 256
+	var max float64
+	for _, v := range values {
+		max = math.Max(max, v)
+	}
+	if max == 0 {
+		return 0
+	}
+	var histogram [bins]float64
+	for _, v := range values {
+		histogram[minInt(int(v/max*bins), bins-1)]++
+	}
+
+	var total, sum float64
+	for i, count := range histogram {
+		total += count
+		sum += float64(i) * count
+	}
+	var backgroundCount, backgroundSum, bestVariance float64
+	best := 0
+	for i, count := range histogram {
+		backgroundCount += count
+		backgroundSum += float64(i) * count
+		foregroundCount := total - backgroundCount
+		if backgroundCount == 0 || foregroundCount == 0 {
+			continue
+		}
+		meanBackground := backgroundSum / backgroundCount
+		meanForeground := (sum - backgroundSum) / foregroundCount
+		variance := backgroundCount * foregroundCount * (meanBackground - meanForeground) * (meanBackground - meanForeground)
+		if variance > bestVariance {
+			best, bestVariance = i, variance
+		}
+	}
+	return (float64(best) + 1) / bins * max
+}
+
+// largestRegion returns the largest connected region of the set pixel
+func largestRegion(set []bool, width, height int) []bool {
+	labels := make([]int, len(set))
+	var sizes []int
+	for start := range set {
+		if !set[start] || labels[start] != 0 {
+			continue
+		}
+		sizes = append(sizes, 0)
+		label := len(sizes)
+		labels[start] = label
+		stack := []int{start}
+		for len(stack) > 0 {
+			i := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			sizes[label-1]++
+			x, y := i%width, i/width
+			for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+					continue
+				}
+				if j := n.X + n.Y*width; set[j] && labels[j] == 0 {
+					labels[j] = label
+					stack = append(stack, j)
+				}
+			}
+		}
+	}
+
+	largest := 0
+	for label, size := range sizes {
+		if largest == 0 || size > sizes[largest-1] {
+			largest = label + 1
+		}
+	}
+	region := make([]bool, len(set))
+	for i, label := range labels {
+		region[i] = largest != 0 && label == largest
+	}
+	return region
+}
+
+// fillHoles sets all pixel that are enclosed by set pixel and not connected to the image border
+func fillHoles(set []bool, width, height int) {
+	outside := make([]bool, len(set))
+	var stack []int
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if i := x + y*width; (x == 0 || y == 0 || x == width-1 || y == height-1) && !set[i] {
+				outside[i] = true
+				stack = append(stack, i)
+			}
+		}
+	}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		x, y := i%width, i/width
+		for _, n := range []image.Point{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+			if n.X < 0 || n.Y < 0 || n.X >= width || n.Y >= height {
+				continue
+			}
+			if j := n.X + n.Y*width; !set[j] && !outside[j] {
+				outside[j] = true
+				stack = append(stack, j)
+			}
+		}
+	}
+	for i := range set {
+		set[i] = set[i] || !outside[i]
+	}
+}
@@ -0,0 +1,86 @@
+package beadmachine
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"sort"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// loadSubstitutions loads a substitutions file that maps bead codes or names to the bead that is
+// used instead, like {"H9": "H8 Blue"}
+func loadSubstitutions(fileName string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading substitutions file")
+	}
+	substitutions := make(map[string]string)
+	if err = json.Unmarshal(data, &substitutions); err != nil {
+		return nil, errors.Wrap(err, "parsing substitutions file")
+	}
+	return substitutions, nil
+}
+
+// findBead returns the name of the palette bead that matches the code or name
+func findBead(palette map[string]BeadConfig, codeOrName string) (string, bool) {
+	names := make([]string, 0, len(palette))
+	for name := range palette {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if beadSelected(name, []string{codeOrName}) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// substituteBeads replaces the matched beads of the pattern by the beads of the substitution rules,
+// substitutions are applied once and are not chained
+func (m *beadMachine) substituteBeads(pattern *Pattern) error {
+	replacements := make(map[string]string) // palette bead name to substituted palette bead name
+	for from, to := range m.substitutions {
+		target, ok := findBead(pattern.Palette, to)
+		if !ok {
+			return fmt.Errorf("substitution bead '%s' is not part of the palette", to)
+		}
+		for name := range pattern.Palette {
+			if beadSelected(name, []string{from}) {
+				replacements[name] = target
+			}
+		}
+	}
+
+	sourceBounds := pattern.Source.Bounds()
+	counts := make(map[string]int)
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			cell := pattern.Cell(x, y)
+			target, ok := replacements[cell.Bead]
+			if !ok || cell.Empty() {
+				continue
+			}
+			counts[cell.Bead]++
+
+			bead := pattern.Palette[target]
+			source := color.RGBAModel.Convert(pattern.Source.At(sourceBounds.Min.X+x, sourceBounds.Min.Y+y)).(color.RGBA)
+			beadColor := color.RGBA{bead.R, bead.G, bead.B, 255}
+			cell.Bead = target
+			cell.Color = beadColor
+			cell.Distance = m.colorDistance.Distance(m.labColor(source), m.labColor(beadColor))
+		}
+	}
+
+	for from, count := range counts {
+		m.logger.Info("Beads substituted",
+			zap.String("bead", from),
+			zap.String("substitute", replacements[from]),
+			zap.Int("count", count))
+	}
+	return nil
+}
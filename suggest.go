@@ -0,0 +1,281 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// suggestReferenceWidth is the maximum width of the image that the detail analysis is done on
+const suggestReferenceWidth = 400
+
+// suggestMaxBoardsWide is the maximum amount of boards in a row that sizes are suggested for
+const suggestMaxBoardsWide = 12
+
+// sizeSuggestion is a suggested output size for an image
+type sizeSuggestion struct {
+	name   string
+	width  int
+	height int
+	detail float64 // share of detail retained compared to the largest candidate size
+}
+
+// suggestCommand returns the command that suggests output dimensions for an image
+func suggestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "suggest file.jpg",
+		Short: "Suggest output dimensions for an image",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  startSuggest,
+	}
+
+	cmd.Flags().StringP("input", "i", "", "image to analyze")
+	cmd.Flags().StringP("palette", "p", "colors_hama.json", "bead palette used for the previews, a JSON file name or URI")
+	cmd.Flags().StringP("preview", "", "", "filename prefix for PNG previews of the suggested sizes")
+	cmd.Flags().IntP("boarddimension", "d", 20, "dimension of a board")
+	cmd.Flags().IntP("max-boards", "", 0, "maximum amount of boards to use (0 = unlimited)")
+	cmd.Flags().IntP("max-beads", "", 0, "maximum amount of beads to use (0 = unlimited)")
+	_ = cmd.RegisterFlagCompletionFunc("palette", completePalette)
+	return cmd
+}
+
+func startSuggest(cmd *cobra.Command, args []string) error {
+	inputFileName, _ := cmd.Flags().GetString("input")
+	if inputFileName == "" && len(args) > 0 {
+		inputFileName = args[0]
+	}
+	if inputFileName == "" {
+		return cmd.Help()
+	}
+
+	logger := logger(cmd)
+	palette, _ := cmd.Flags().GetString("palette")
+	previewPrefix, _ := cmd.Flags().GetString("preview")
+	boardDimension, _ := cmd.Flags().GetInt("boarddimension")
+	maxBoards, _ := cmd.Flags().GetInt("max-boards")
+	maxBeads, _ := cmd.Flags().GetInt("max-beads")
+
+	inputImage, err := readImageFile(inputFileName, true)
+	if err != nil {
+		logger.Error("Reading image file failed", zap.Error(err))
+		return inputError(err)
+	}
+
+	imageBounds := inputImage.Bounds()
+	logger.Info("Image pixels",
+		zap.Int("width", imageBounds.Dx()),
+		zap.Int("height", imageBounds.Dy()),
+		zap.Float64("aspect ratio", float64(imageBounds.Dx())/float64(imageBounds.Dy())))
+
+	var suggestions []sizeSuggestion
+	if grid := detectPixelArtGrid(inputImage); grid > 1 {
+		width, height := imageBounds.Dx()/grid, imageBounds.Dy()/grid
+		logger.Info("Pixel art grid detected", zap.Int("cell size", grid))
+		if withinBudget(width, height, boardDimension, maxBoards, maxBeads) {
+			suggestions = append(suggestions, sizeSuggestion{
+				name:   "native pixel art",
+				width:  width,
+				height: height,
+				detail: 1.0,
+			})
+		} else {
+			logger.Info("Native pixel art size exceeds the budget", zap.Int("width", width), zap.Int("height", height))
+		}
+	}
+	if len(suggestions) == 0 {
+		suggestions = suggestSizes(logger, inputImage, boardDimension, maxBoards, maxBeads)
+	}
+
+	for _, suggestion := range suggestions {
+		logger.Info("Suggested size",
+			zap.String("name", suggestion.name),
+			zap.Int("width", suggestion.width),
+			zap.Int("height", suggestion.height),
+			zap.Int("boards width", boardsNeeded(suggestion.width, boardDimension)),
+			zap.Int("boards height", boardsNeeded(suggestion.height, boardDimension)),
+			zap.Int("beads", suggestion.width*suggestion.height),
+			zap.Float64("detail", suggestion.detail))
+
+		if previewPrefix == "" {
+			continue
+		}
+		m := newBeadMachine(logger)
+		m.inputFileName = inputFileName
+		m.palette = palette
+		m.outputFileName = fmt.Sprintf("%s_%dx%d.png", previewPrefix, suggestion.width, suggestion.height)
+		m.boardDimension = boardDimension
+		m.width = suggestion.width
+		m.height = suggestion.height
+		if err = m.process(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suggestSizes returns a compact, a balanced and a detailed size suggestion based on how much image
+// detail is retained at widths that are a multiple of the board dimension
+func suggestSizes(logger *zap.Logger, inputImage image.Image, boardDimension, maxBoards, maxBeads int) []sizeSuggestion {
+	imageBounds := inputImage.Bounds()
+	aspectRatio := float64(imageBounds.Dy()) / float64(imageBounds.Dx())
+
+	var candidates []int
+	for boards := 1; boards <= suggestMaxBoardsWide; boards++ {
+		width := boards * boardDimension
+		if width > imageBounds.Dx() {
+			break
+		}
+		height := int(math.Round(float64(width) * aspectRatio))
+		if !withinBudget(width, height, boardDimension, maxBoards, maxBeads) {
+			break
+		}
+		candidates = append(candidates, width)
+	}
+	if len(candidates) == 0 { // image is smaller than a board or the budget is too small
+		width := imageBounds.Dx()
+		if maxBeads > 0 && imageBounds.Dx()*imageBounds.Dy() > maxBeads {
+			width = int(math.Sqrt(float64(maxBeads) / aspectRatio))
+		}
+		return []sizeSuggestion{{
+			name:   "compact",
+			width:  width,
+			height: int(math.Round(float64(width) * aspectRatio)),
+			detail: 1.0,
+		}}
+	}
+
+	reference := imaging.Clone(inputImage)
+	if imageBounds.Dx() > suggestReferenceWidth {
+		reference = imaging.Resize(inputImage, suggestReferenceWidth, 0, imaging.Lanczos)
+	}
+
+	losses := make([]float64, len(candidates))
+	for i, width := range candidates {
+		losses[i] = detailLoss(reference, width)
+		logger.Debug("Detail loss", zap.Int("width", width), zap.Float64("loss", losses[i]))
+	}
+
+	minLoss, maxLoss := losses[len(losses)-1], losses[0]
+	var suggestions []sizeSuggestion
+	levels := []struct {
+		name   string
+		detail float64
+	}{
+		{"compact", 0.5},
+		{"balanced", 0.75},
+		{"detailed", 0.9},
+	}
+
+	for _, level := range levels {
+		for i, width := range candidates {
+			detail := 1.0
+			if maxLoss > minLoss {
+				detail = (maxLoss - losses[i]) / (maxLoss - minLoss)
+			}
+			if detail < level.detail {
+				continue
+			}
+			if len(suggestions) == 0 || suggestions[len(suggestions)-1].width != width {
+				suggestions = append(suggestions, sizeSuggestion{
+					name:   level.name,
+					width:  width,
+					height: int(math.Round(float64(width) * aspectRatio)),
+					detail: detail,
+				})
+			}
+			break
+		}
+	}
+	return suggestions
+}
+
+// withinBudget returns whether a pattern of the given size needs at most the maximum amount of boards and beads,
+// a maximum of 0 is unlimited
+func withinBudget(width, height, boardDimension, maxBoards, maxBeads int) bool {
+	if maxBoards > 0 && boardsNeeded(width, boardDimension)*boardsNeeded(height, boardDimension) > maxBoards {
+		return false
+	}
+	return maxBeads <= 0 || width*height <= maxBeads
+}
+
+// detectPixelArtGrid returns the cell size of an upscaled pixel art image by finding the
+// greatest common divisor of all runs of identical colors, 1 is returned for non pixel art images
+func detectPixelArtGrid(img image.Image) int {
+	bounds := img.Bounds()
+	grid := 0
+
+	sameColor := func(x1, y1, x2, y2 int) bool {
+		r1, g1, b1, a1 := img.At(x1, y1).RGBA()
+		r2, g2, b2, a2 := img.At(x2, y2).RGBA()
+		return r1 == r2 && g1 == g2 && b1 == b2 && a1 == a2
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		run := 1
+		for x := bounds.Min.X + 1; x <= bounds.Max.X; x++ {
+			if x < bounds.Max.X && sameColor(x, y, x-1, y) {
+				run++
+				continue
+			}
+			if grid = gcd(grid, run); grid == 1 {
+				return 1
+			}
+			run = 1
+		}
+	}
+
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		run := 1
+		for y := bounds.Min.Y + 1; y <= bounds.Max.Y; y++ {
+			if y < bounds.Max.Y && sameColor(x, y, x, y-1) {
+				run++
+				continue
+			}
+			if grid = gcd(grid, run); grid == 1 {
+				return 1
+			}
+			run = 1
+		}
+	}
+
+	if grid == 0 {
+		return 1
+	}
+	return grid
+}
+
+// detailLoss returns the mean luminance difference between the reference image and the
+// reference image downscaled to the given width and scaled back up like beads would look
+func detailLoss(reference *image.NRGBA, width int) float64 {
+	bounds := reference.Bounds()
+	small := imaging.Resize(reference, width, 0, imaging.Lanczos)
+	restored := imaging.Resize(small, bounds.Dx(), bounds.Dy(), imaging.NearestNeighbor)
+
+	var sum float64
+	for i := 0; i+3 < len(reference.Pix); i += 4 {
+		sum += math.Abs(luminance(reference.Pix[i:i+3]) - luminance(restored.Pix[i:i+3]))
+	}
+	return sum / float64(len(reference.Pix)/4)
+}
+
+// luminance returns the relative luminance of the given RGB values
+func luminance(rgb []uint8) float64 {
+	return 0.299*float64(rgb[0]) + 0.587*float64(rgb[1]) + 0.114*float64(rgb[2])
+}
+
+// boardsNeeded returns the amount of boards needed to cover the given amount of beads
+func boardsNeeded(beads, boardDimension int) int {
+	return (beads + boardDimension - 1) / boardDimension
+}
+
+// gcd returns the greatest common divisor of a and b
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
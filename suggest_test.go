@@ -0,0 +1,46 @@
+package beadmachine
+
+import "testing"
+
+func TestBoardsNeeded(t *testing.T) {
+	tests := []struct {
+		beads, boardDimension, expected int
+	}{
+		{0, 20, 0},
+		{1, 20, 1},
+		{19, 20, 1},
+		{20, 20, 1},
+		{21, 20, 2},
+		{40, 20, 2},
+		{41, 20, 3},
+		{58, 29, 2},
+		{59, 29, 3},
+		{5, 1, 5},
+	}
+	for _, test := range tests {
+		if boards := boardsNeeded(test.beads, test.boardDimension); boards != test.expected {
+			t.Errorf("boardsNeeded(%d, %d) = %d, expected %d", test.beads, test.boardDimension, boards, test.expected)
+		}
+	}
+}
+
+func TestWithinBudget(t *testing.T) {
+	tests := []struct {
+		width, height, maxBoards, maxBeads int
+		expected                           bool
+	}{
+		{100, 100, 0, 0, true},
+		{40, 40, 4, 0, true},
+		{41, 40, 4, 0, false},
+		{40, 40, 0, 1600, true},
+		{40, 41, 0, 1600, false},
+		{40, 40, 4, 1599, false},
+	}
+	for _, test := range tests {
+		within := withinBudget(test.width, test.height, 20, test.maxBoards, test.maxBeads)
+		if within != test.expected {
+			t.Errorf("withinBudget(%d, %d, 20, %d, %d) = %t, expected %t",
+				test.width, test.height, test.maxBoards, test.maxBeads, within, test.expected)
+		}
+	}
+}
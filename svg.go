@@ -0,0 +1,85 @@
+package beadmachine
+
+import (
+	"bytes"
+	"image"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// svgRasterizer is an external program that converts SVG files to PNG images
+type svgRasterizer struct {
+	command string
+	args    func(fileName string, width, height int, keepAspect bool) []string
+}
+
+// svgRasterizers contains the supported rasterizers in the order of preference
+var svgRasterizers = []svgRasterizer{
+	{
+		command: "rsvg-convert",
+		args: func(fileName string, width, height int, keepAspect bool) []string {
+			args := []string{"--format", "png"}
+			if width > 0 {
+				args = append(args, "--width", strconv.Itoa(width))
+			}
+			if height > 0 {
+				args = append(args, "--height", strconv.Itoa(height))
+			}
+			if keepAspect {
+				args = append(args, "--keep-aspect-ratio")
+			}
+			return append(args, fileName)
+		},
+	},
+	{
+		command: "inkscape",
+		args: func(fileName string, width, height int, keepAspect bool) []string {
+			args := []string{"--export-type=png", "--export-filename=-"}
+			if width > 0 && (!keepAspect || height == 0) { // inkscape keeps the aspect ratio only for a single dimension
+				args = append(args, "--export-width="+strconv.Itoa(width))
+			}
+			if height > 0 && (!keepAspect || width == 0) {
+				args = append(args, "--export-height="+strconv.Itoa(height))
+			}
+			return append(args, fileName)
+		},
+	},
+}
+
+// isSVGFile returns whether the file is an SVG file by its extension
+func isSVGFile(fileName string) bool {
+	extension := strings.ToLower(filepath.Ext(fileName))
+	return extension == ".svg" || extension == ".svgz"
+}
+
+// rasterizeSVG rasterizes the SVG file to an image of the given dimensions with the first installed
+// rasterizer, a dimension of 0 is calculated from the aspect ratio of the SVG. Rasterizing at the target size
+// avoids the blurring of scaling a bitmap down.
+func rasterizeSVG(fileName string, width, height int, keepAspect bool) (image.Image, error) {
+	for _, rasterizer := range svgRasterizers {
+		if path, err := exec.LookPath(rasterizer.command); err == nil {
+			return runRasterizer(rasterizer.command, path, rasterizer.args(fileName, width, height, keepAspect))
+		}
+	}
+	return nil, errors.New("rasterizing SVG files requires rsvg-convert or inkscape to be installed")
+}
+
+// runRasterizer runs an external rasterizer that writes an image to stdout and decodes the image
+func runRasterizer(command, path string, args []string) (image.Image, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "rasterizing with %s: %s", command, strings.TrimSpace(stderr.String()))
+	}
+	img, _, err := image.Decode(&stdout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decoding image rasterized by %s", command)
+	}
+	return img, nil
+}
@@ -0,0 +1,94 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTerminalColumns is the width of the terminal preview if neither a width is given nor the shell
+// exports the width of the terminal
+const defaultTerminalColumns = 80
+
+// terminalColumns returns the width of the terminal that the shell exports as COLUMNS variable
+func terminalColumns() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	return defaultTerminalColumns
+}
+
+// terminalTrueColor returns whether the terminal announces truecolor support, other terminals get the colors
+// of the xterm 256 color palette
+func terminalTrueColor() bool {
+	colorTerm := os.Getenv("COLORTERM")
+	return colorTerm == "truecolor" || colorTerm == "24bit"
+}
+
+// terminalColor returns the parameters of an ANSI color escape sequence after the 38 or 48 selector, either as
+// 24 bit color or as closest color of the xterm 256 color palette
+func terminalColor(c color.RGBA, trueColor bool) string {
+	if trueColor {
+		return fmt.Sprintf("2;%d;%d;%d", c.R, c.G, c.B)
+	}
+	if c.R == c.G && c.G == c.B { // the grey ramp has finer steps than the color cube
+		switch {
+		case c.R < 4:
+			return "5;16"
+		case c.R > 246:
+			return "5;231"
+		default:
+			return "5;" + strconv.Itoa(232+minInt((int(c.R)-3)/10, 23))
+		}
+	}
+	cube := func(v uint8) int { // the levels of the color cube are 0, 95, 135, 175, 215 and 255
+		switch {
+		case v < 48:
+			return 0
+		case v < 115:
+			return 1
+		default:
+			return (int(v) - 35) / 40
+		}
+	}
+	return "5;" + strconv.Itoa(16+36*cube(c.R)+6*cube(c.G)+cube(c.B))
+}
+
+// writeTerminalPreview writes the pattern as ANSI block characters, every character shows two cells above each
+// other, the pattern is downscaled to fit into the given amount of columns. Without truecolor the cells are
+// shown in the closest colors of the 256 color palette.
+func writeTerminalPreview(writer io.Writer, pattern *Pattern, columns int, trueColor bool) error {
+	step := 1
+	if pattern.Width > columns {
+		step = boardsNeeded(pattern.Width, columns)
+	}
+
+	w := bufio.NewWriter(writer)
+	for y := 0; y < pattern.Height; y += 2 * step {
+		for x := 0; x < pattern.Width; x += step {
+			top := pattern.Cell(x, y)
+			bottom := &Cell{} // the last line of patterns with an odd height has no bottom cells
+			if y+step < pattern.Height {
+				bottom = pattern.Cell(x, y+step)
+			}
+
+			switch {
+			case top.Empty() && bottom.Empty():
+				w.WriteString("\x1b[0m ")
+			case top.Empty():
+				fmt.Fprintf(w, "\x1b[0;38;%sm▄", terminalColor(bottom.Color, trueColor))
+			case bottom.Empty():
+				fmt.Fprintf(w, "\x1b[0;38;%sm▀", terminalColor(top.Color, trueColor))
+			default:
+				fmt.Fprintf(w, "\x1b[38;%s;48;%sm▀", terminalColor(top.Color, trueColor), terminalColor(bottom.Color, trueColor))
+			}
+		}
+		w.WriteString("\x1b[0m\n")
+	}
+	return errors.Wrap(w.Flush(), "writing terminal preview")
+}
@@ -0,0 +1,128 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+)
+
+// deep zoom tile pyramid settings
+const (
+	tileSize     = 256
+	tileCellSize = 8 // pixel per bead at the highest zoom level
+)
+
+// tilesViewerHTML is the viewer page of the tile pyramid, it uses OpenSeadragon from a CDN
+const tilesViewerHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Bead pattern</title>
+<style type="text/css">
+html, body { margin: 0; height: 100%; background-color: #303030; }
+#viewer { width: 100%; height: 100%; }
+</style>
+<script src="https://cdnjs.cloudflare.com/ajax/libs/openseadragon/4.1.0/openseadragon.min.js"></script>
+</head>
+<body>
+<div id="viewer"></div>
+<script>
+OpenSeadragon({
+  id: "viewer",
+  prefixUrl: "https://cdnjs.cloudflare.com/ajax/libs/openseadragon/4.1.0/images/",
+  tileSources: "pattern.dzi",
+  maxZoomPixelRatio: 4,
+  imageSmoothingEnabled: false
+});
+</script>
+</body>
+</html>
+`
+
+// tilesDZI is the Deep Zoom Image descriptor of the tile pyramid
+const tilesDZI = `<?xml version="1.0" encoding="UTF-8"?>
+<Image xmlns="http://schemas.microsoft.com/deepzoom/2008" Format="png" Overlap="0" TileSize="%d">
+  <Size Width="%d" Height="%d"/>
+</Image>
+`
+
+// writeTiles writes a Deep Zoom tile pyramid of the pattern in bead style and a HTML viewer into the directory
+func (m *beadMachine) writeTiles(dir string, pattern *Pattern) error {
+	fullImage := image.NewRGBA(image.Rect(0, 0, pattern.Width*tileCellSize, pattern.Height*tileCellSize))
+	beadStyle := &beadMachine{beadStyle: true, beadFillPixel: m.beadFillPixel}
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			if cell := pattern.Cell(x, y); !cell.Empty() {
+				beadStyle.setOutputImagePixel(fullImage, image.Point{x, y}, cell.Color)
+			}
+		}
+	}
+
+	bounds := fullImage.Bounds()
+	maxLevel := int(math.Ceil(math.Log2(math.Max(float64(bounds.Dx()), float64(bounds.Dy())))))
+	tilesDir := filepath.Join(dir, "pattern_files")
+
+	var levelImage image.Image = fullImage
+	for level := maxLevel; level >= 0; level-- {
+		if level < maxLevel { // every level has half the size of the next higher level
+			scale := math.Pow(2, float64(maxLevel-level))
+			width := int(math.Max(1, math.Ceil(float64(bounds.Dx())/scale)))
+			height := int(math.Max(1, math.Ceil(float64(bounds.Dy())/scale)))
+			levelImage = imaging.Resize(levelImage, width, height, imaging.Box)
+		}
+		if err := writeTileLevel(filepath.Join(tilesDir, fmt.Sprint(level)), levelImage); err != nil {
+			return err
+		}
+	}
+
+	descriptor := fmt.Sprintf(tilesDZI, tileSize, bounds.Dx(), bounds.Dy())
+	if err := ioutil.WriteFile(filepath.Join(dir, "pattern.dzi"), []byte(descriptor), 0644); err != nil {
+		return errors.Wrap(err, "writing tile descriptor")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(tilesViewerHTML), 0644); err != nil {
+		return errors.Wrap(err, "writing tile viewer")
+	}
+	return nil
+}
+
+// writeTileLevel splits the image of a zoom level into tiles named column_row.png
+func writeTileLevel(dir string, levelImage image.Image) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "creating tile directory")
+	}
+
+	bounds := levelImage.Bounds()
+	for row := 0; row*tileSize < bounds.Dy(); row++ {
+		for column := 0; column*tileSize < bounds.Dx(); column++ {
+			tileBounds := image.Rect(column*tileSize, row*tileSize, (column+1)*tileSize, (row+1)*tileSize).Intersect(bounds)
+			tile := imaging.Crop(levelImage, tileBounds)
+
+			fileName := filepath.Join(dir, fmt.Sprintf("%d_%d.png", column, row))
+			if err := writeTile(fileName, tile); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeTile writes a single tile image
+func writeTile(fileName string, tile image.Image) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrap(err, "creating tile file")
+	}
+	defer f.Close()
+
+	if err = png.Encode(f, tile); err != nil {
+		return errors.Wrap(err, "encoding tile")
+	}
+	return errors.Wrap(f.Close(), "closing tile file")
+}
@@ -0,0 +1,255 @@
+package beadmachine
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// traceExportTimeout is the timeout of sending the spans to the OTLP endpoint
+const traceExportTimeout = 10 * time.Second
+
+// traceparentPattern matches a W3C trace context header like 00-<trace id>-<parent span id>-01
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// tracer collects the spans of the pipeline stages of a run and exports them as OpenTelemetry traces in the OTLP
+// JSON encoding, either to an OTLP/HTTP endpoint or into a file
+type tracer struct {
+	target  string // endpoint URL or filename
+	service string
+	headers map[string]string
+
+	traceID  string
+	parentID string // span id of the TRACEPARENT environment variable, the root span becomes its child
+
+	lock  sync.Mutex
+	spans []*traceSpan
+}
+
+// traceSpan is a timed stage of the run, a nil span is a disabled span whose methods do nothing
+type traceSpan struct {
+	tracer     *tracer
+	id         string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+// traceTarget returns the endpoint or filename of the --trace flag or, if it is not set, the traces endpoint of
+// the standard OpenTelemetry environment variables. OTEL_SDK_DISABLED=true disables the tracing.
+func traceTarget(flag string) string {
+	if flag != "" {
+		return flag
+	}
+	if disabled, _ := strconv.ParseBool(os.Getenv("OTEL_SDK_DISABLED")); disabled {
+		return ""
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// newTracer returns a tracer that exports to the endpoint URL or file. The service name and the headers are read
+// from OTEL_SERVICE_NAME and OTEL_EXPORTER_OTLP_HEADERS, a TRACEPARENT environment variable continues its trace.
+func newTracer(target string) *tracer {
+	t := &tracer{
+		target:  target,
+		service: os.Getenv("OTEL_SERVICE_NAME"),
+		headers: make(map[string]string),
+		traceID: randomTraceID(16),
+	}
+	if t.service == "" {
+		t.service = "beadmachine"
+	}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) == 2 {
+			value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+			if err != nil {
+				value = strings.TrimSpace(parts[1])
+			}
+			t.headers[strings.TrimSpace(parts[0])] = value
+		}
+	}
+	if match := traceparentPattern.FindStringSubmatch(strings.ToLower(os.Getenv("TRACEPARENT"))); match != nil {
+		t.traceID, t.parentID = match[1], match[2]
+	}
+	return t
+}
+
+// randomTraceID returns a random hex encoded id of the given amount of bytes
+func randomTraceID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// start starts a span that is a child of the parent span, without a parent it is a root span of the trace
+func (t *tracer) start(name string, parent *traceSpan) *traceSpan {
+	if t == nil {
+		return nil
+	}
+	span := &traceSpan{
+		tracer:     t,
+		id:         randomTraceID(8),
+		parentID:   t.parentID,
+		name:       name,
+		start:      time.Now(),
+		attributes: make(map[string]interface{}),
+	}
+	if parent != nil {
+		span.parentID = parent.id
+	}
+	return span
+}
+
+// traceparent returns the W3C trace context of the span, that continues the trace in another process
+func (s *traceSpan) traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.tracer.traceID + "-" + s.id + "-01"
+}
+
+// set sets an attribute of the span, the value is a string, bool, int or float64
+func (s *traceSpan) set(key string, value interface{}) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// finish ends the span, an error marks the span as failed
+func (s *traceSpan) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.tracer.lock.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.lock.Unlock()
+}
+
+// startSpan starts a span of a pipeline stage as child of the current span of the run
+func (m *beadMachine) startSpan(name string) *traceSpan {
+	return m.tracer.start(name, m.span)
+}
+
+// flush exports the finished spans and removes them from the tracer
+func (t *tracer) flush() error {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.lock.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(t.export(spans))
+	if err != nil {
+		return errors.Wrap(err, "marshalling spans")
+	}
+	if u, err := url.Parse(t.target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.Wrap(ioutil.WriteFile(t.target, append(data, '\n'), 0644), "writing trace file")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.target, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "creating trace request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	client := http.Client{Timeout: traceExportTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "exporting spans")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("exporting spans returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// export returns the OTLP JSON request of the spans, the ids are hex encoded and the times are nanoseconds since
+// the Unix epoch as strings
+func (t *tracer) export(spans []*traceSpan) map[string]interface{} {
+	otlpSpans := make([]map[string]interface{}, len(spans))
+	for i, s := range spans {
+		status := map[string]interface{}{"code": 1} // ok
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		span := map[string]interface{}{
+			"traceId":           t.traceID,
+			"spanId":            s.id,
+			"name":              s.name,
+			"kind":              1, // internal
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+			"status":            status,
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		otlpSpans[i] = span
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": t.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "beadmachine"},
+				"spans": otlpSpans,
+			}},
+		}},
+	}
+}
+
+// otlpAttributes returns the attributes as OTLP key values
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	keyValues := make([]map[string]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		keyValues = append(keyValues, map[string]interface{}{"key": key, "value": v})
+	}
+	return keyValues
+}
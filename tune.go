@@ -0,0 +1,177 @@
+package beadmachine
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/disintegration/imaging"
+	"go.uber.org/zap"
+)
+
+// auto-tune loss weights, the structural similarity ranges from 0 to 1 and is scaled to the range of the mean
+// ΔE of usual patterns. Every bead color adds a small penalty so that a color limit wins if it looks about the
+// same, as fewer colors are easier to buy and to place.
+const (
+	tuneSSIMWeight   = 100.0
+	tuneColorPenalty = 0.1
+)
+
+// defaultTuneIterations is the default amount of conversions that auto-tune tries
+const defaultTuneIterations = 12
+
+// auto-tune candidates of the settings, the color limits are only tried up to a given --max-colors
+var (
+	tuneContrasts = []float64{0, 10, 20, 30, -10}
+	tuneMaxColors = []int{0, 32, 24, 16, 12, 8}
+)
+
+// tuneSettings are the settings that auto-tune searches over
+type tuneSettings struct {
+	adaptiveDither bool
+	contrast       float64
+	maxColors      int
+}
+
+// tuneResult is the score of a conversion with the tuned settings
+type tuneResult struct {
+	settings tuneSettings
+	score    patternScore
+	colors   int
+	loss     float64
+}
+
+// currentTuneSettings returns the current values of the settings that auto-tune searches over
+func (m *beadMachine) currentTuneSettings() tuneSettings {
+	return tuneSettings{
+		adaptiveDither: m.adaptiveDither,
+		contrast:       m.contrast,
+		maxColors:      m.maxColors,
+	}
+}
+
+// applyTuneSettings sets the settings that auto-tune searches over
+func (m *beadMachine) applyTuneSettings(settings tuneSettings) {
+	m.adaptiveDither = settings.adaptiveDither
+	m.contrast = settings.contrast
+	m.maxColors = settings.maxColors
+}
+
+// tuneConversion searches for the dithering, contrast and color limit that convert the input most similar to the
+// image prepared with the given settings, and keeps the best ones for the conversion. Every setting is varied in
+// turn while the others keep their best value so far, until the iterations are used up or nothing improves.
+func (m *beadMachine) tuneConversion() error {
+	initial := m.currentTuneSettings()
+	inputImage, err := m.readInput(m.targetSize())
+	if err != nil {
+		return err
+	}
+	reference, err := m.fitImage(m.applyFilters(inputImage))
+	if err != nil {
+		return err
+	}
+	referenceImage := imaging.Clone(reference)
+
+	// the candidates are converted quietly and without the additions that do not depend on the tuned settings
+	logger, borders, tile, backgroundFill := m.logger, m.borders, m.tile, m.backgroundFill
+	m.logger, m.borders, m.tile, m.backgroundFill = zap.NewNop(), nil, "", nil
+	defer func() {
+		m.logger, m.borders, m.tile, m.backgroundFill = logger, borders, tile, backgroundFill
+	}()
+
+	tried := make(map[tuneSettings]bool)
+	var best *tuneResult
+	try := func(settings tuneSettings) error {
+		if tried[settings] || len(tried) >= m.tuneIterations {
+			return nil
+		}
+		tried[settings] = true
+		result, err := m.tuneCandidate(inputImage, referenceImage, settings)
+		if err != nil {
+			return err
+		}
+		logger.Info("Auto-tune candidate",
+			zap.Bool("adaptive dither", settings.adaptiveDither),
+			zap.Float64("contrast", settings.contrast),
+			zap.Int("max colors", settings.maxColors),
+			zap.Float64("ssim", result.score.SSIM),
+			zap.Float64("mean ΔE", result.score.MeanDeltaE),
+			zap.Int("colors", result.colors),
+			zap.Float64("loss", result.loss))
+		if best == nil || result.loss < best.loss {
+			best = result
+		}
+		return nil
+	}
+
+	if err = try(initial); err != nil {
+		return err
+	}
+	for improved := true; improved && len(tried) < m.tuneIterations; {
+		previous := best.settings
+		for _, maxColors := range tuneMaxColors {
+			if initial.maxColors == 0 || (maxColors > 0 && maxColors <= initial.maxColors) {
+				settings := best.settings
+				settings.maxColors = maxColors
+				if err = try(settings); err != nil {
+					return err
+				}
+			}
+		}
+		for _, adaptiveDither := range []bool{false, true} {
+			settings := best.settings
+			settings.adaptiveDither = adaptiveDither
+			if err = try(settings); err != nil {
+				return err
+			}
+		}
+		for _, contrast := range tuneContrasts {
+			settings := best.settings
+			settings.contrast = contrast
+			if err = try(settings); err != nil {
+				return err
+			}
+		}
+		improved = best.settings != previous
+	}
+
+	m.applyTuneSettings(best.settings)
+	logger.Info("Auto-tuned settings",
+		zap.Bool("adaptive dither", best.settings.adaptiveDither),
+		zap.Float64("contrast", best.settings.contrast),
+		zap.Int("max colors", best.settings.maxColors),
+		zap.Float64("ssim", best.score.SSIM),
+		zap.Float64("mean ΔE", best.score.MeanDeltaE),
+		zap.Int("colors", best.colors),
+		zap.Int("iterations", len(tried)))
+	return nil
+}
+
+// tuneCandidate converts the input image with the candidate settings and scores the pattern against the
+// reference image
+func (m *beadMachine) tuneCandidate(inputImage image.Image, reference *image.NRGBA, settings tuneSettings) (*tuneResult, error) {
+	m.applyTuneSettings(settings)
+	fitted, err := m.fitImage(m.applyFilters(inputImage))
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := m.matchImage(fitted)
+	if err != nil {
+		return nil, err
+	}
+
+	beads := image.NewNRGBA(image.Rect(0, 0, pattern.Width, pattern.Height))
+	for y := 0; y < pattern.Height; y++ {
+		for x := 0; x < pattern.Width; x++ {
+			if cell := pattern.Cell(x, y); !cell.Empty() {
+				beads.SetNRGBA(x, y, color.NRGBA{cell.Color.R, cell.Color.G, cell.Color.B, 255})
+			}
+		}
+	}
+	result := &tuneResult{
+		settings: settings,
+		score:    m.scorePattern(reference, beads),
+		colors:   len(pattern.Stats().BeadCounts),
+	}
+	result.loss = (1-result.score.SSIM)*tuneSSIMWeight + result.score.MeanDeltaE + float64(result.colors)*tuneColorPenalty
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package beadmachine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// unit systems of the physical dimensions
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+// defaultBeadSize is the bead size whose pitch is used if no bead pitch is given
+const defaultBeadSize = "midi"
+
+// mmPerPoint is the length of a PDF point in mm
+const mmPerPoint = 25.4 / 72
+
+// beadSizes contains the distance in mm between the centers of two neighboring beads on a board by bead size
+var beadSizes = map[string]float64{
+	"mini":        2.5,
+	"artkal-mini": 2.6,
+	"midi":        5.0,
+	"maxi":        10.0,
+}
+
+// beadSizeNames returns the sorted names of all bead sizes
+func beadSizeNames() []string {
+	names := make([]string, 0, len(beadSizes))
+	for name := range beadSizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// beadSizePitch returns the bead pitch in mm of the named bead size
+func beadSizePitch(name string) (float64, error) {
+	pitch, ok := beadSizes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("invalid bead size '%s', supported are %s", name, strings.Join(beadSizeNames(), ", "))
+	}
+	return pitch, nil
+}
+
+// physicalSize is the size of a pattern when it is placed on the boards
+type physicalSize struct {
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Unit   string  `json:"unit"`
+}
+
+// lengthUnit returns the unit of physical lengths and the amount of mm per unit
+func (m *beadMachine) lengthUnit() (string, float64) {
+	if m.units == unitsImperial {
+		return "in", 25.4
+	}
+	return "cm", 10
+}
+
+// physicalSize returns the size of the given amount of beads in the selected unit system
+func (m *beadMachine) physicalSize(width, height int) physicalSize {
+	unit, mmPerUnit := m.lengthUnit()
+	return physicalSize{
+		Width:  float64(width) * m.beadPitch / mmPerUnit,
+		Height: float64(height) * m.beadPitch / mmPerUnit,
+		Unit:   unit,
+	}
+}
+
+// formatSize formats the physical size of the given amount of beads like 14 x 16 cm
+func (m *beadMachine) formatSize(width, height int) string {
+	size := m.physicalSize(width, height)
+	return fmt.Sprintf("%s x %s %s", m.formatFloat(size.Width, 1), m.formatFloat(size.Height, 1), size.Unit)
+}
+
+// PatternStats returns the statistics of the pattern with its physical size in the selected unit system
+func (m *beadMachine) PatternStats(pattern *Pattern) PatternStats {
+	stats := pattern.Stats()
+	size := m.physicalSize(pattern.Width, pattern.Height)
+	stats.Size = &size
+	if pattern.Palette != nil {
+		stats.PaletteVersion = paletteVersion(pattern.Palette)
+	}
+	if m.colorCache != nil {
+		cache := m.colorCache.stats()
+		stats.ColorCache = &cache
+	}
+	return stats
+}
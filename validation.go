@@ -0,0 +1,85 @@
+package beadmachine
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// flagRange is the valid range of a numeric flag
+type flagRange struct {
+	name string
+	min  float64
+	max  float64
+}
+
+// flagRanges contains the valid ranges of all numeric flags of the root command
+var flagRanges = []flagRange{
+	{"page", 1, math.Inf(1)},
+	{"dpi", 1, math.Inf(1)},
+	{"width", 0, math.Inf(1)},
+	{"height", 0, math.Inf(1)},
+	{"boardswidth", 0, math.Inf(1)},
+	{"boardsheight", 0, math.Inf(1)},
+	{"boarddimension", 1, math.Inf(1)},
+	{"seam-margin", 0, math.Inf(1)},
+	{"max-beads", 0, math.Inf(1)},
+	{"golden-tolerance", 0, math.Inf(1)},
+	{"dominant-colors", 0, math.Inf(1)},
+	{"coordinates-interval", 1, math.Inf(1)},
+	{"black-point", 0, 255},
+	{"white-point", 0, 255},
+	{"hue-shift", -180, 180},
+	{"temperature", -100, 100},
+	{"tint", -100, 100},
+	{"blur", 0, 10},
+	{"sharpen", 0, 10},
+	{"gamma", 0, 10},
+	{"contrast", -100, 100},
+	{"brightness", -100, 100},
+	{"gamut-threshold", 0, math.Inf(1)},
+	{"duplicate-threshold", 0, math.Inf(1)},
+	{"max-colors", 0, math.Inf(1)},
+	{"auto-tune-iterations", 1, math.Inf(1)},
+	{"cache-size", 0, math.Inf(1)},
+	{"cache-precision", 1, maxCachePrecision},
+	{"bead-pitch", 0, 100},
+	{"print-dpi", 1, 2400},
+	{"gap", 0, math.Inf(1)},
+	{"chart-cell-size", 0, 256},
+	{"preview-columns", 0, math.Inf(1)},
+	{"threshold", 0, math.Inf(1)},
+	{"samples", 2, 256},
+}
+
+// validateFlagRanges returns an error for the first numeric flag whose value is outside of its valid range
+func validateFlagRanges(flags *pflag.FlagSet) error {
+	for _, r := range flagRanges {
+		flag := flags.Lookup(r.name)
+		if flag == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(flag.Value.String(), 64)
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' for flag --%s", flag.Value.String(), r.name)
+		}
+		if value >= r.min && value <= r.max {
+			continue
+		}
+		if math.IsInf(r.max, 1) {
+			return fmt.Errorf("flag --%s has to be at least %g but is %g", r.name, r.min, value)
+		}
+		return fmt.Errorf("flag --%s has to be between %g and %g but is %g", r.name, r.min, r.max, value)
+	}
+	return nil
+}
+
+// defaultOutputFileName returns the PNG output filename that is used if none is given, it is based on
+// the input filename, like input_beads.png
+func defaultOutputFileName(inputFileName string) string {
+	return strings.TrimSuffix(inputFileName, filepath.Ext(inputFileName)) + "_beads.png"
+}
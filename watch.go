@@ -0,0 +1,241 @@
+package beadmachine
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultWatchInterval is the default interval in which the watched files are checked for changes
+const defaultWatchInterval = 500 * time.Millisecond
+
+// watchFadedCells is the amount that the unchanged cells of the changes panel are faded toward the background
+const watchFadedCells = 0.75
+
+// watchRemovedCell is the color of cells in the changes panel that became empty
+var watchRemovedCell = color.RGBA{255, 0, 255, 255}
+
+// watchedFile is the state of a watched file, a change of the modification time or size starts a conversion
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFiles returns the files that a watched conversion depends on, the input image and a palette file
+func (m *beadMachine) watchedFiles() []string {
+	files := []string{m.inputFileName}
+	if fileName, ok := paletteFileName(m.palette); ok {
+		files = append(files, fileName)
+	}
+	return files
+}
+
+// paletteFileName returns the file name of a palette URI that is read from a local file
+func paletteFileName(uri string) (string, bool) {
+	if parts := strings.SplitN(uri, ":", 2); len(parts) == 2 {
+		paletteOpenersLock.RLock()
+		_, ok := paletteOpeners[parts[0]]
+		paletteOpenersLock.RUnlock()
+		if ok {
+			return parts[1], parts[0] == "file"
+		}
+	}
+	return uri, true
+}
+
+// watchState returns the current state of the watched files, missing files have the zero state so that their
+// creation counts as change
+func watchState(files []string) []watchedFile {
+	state := make([]watchedFile, len(files))
+	for i, fileName := range files {
+		if info, err := os.Stat(fileName); err == nil {
+			state[i] = watchedFile{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return state
+}
+
+// changedFile returns the first file whose state differs between the two states
+func changedFile(files []string, previous, current []watchedFile) (string, bool) {
+	for i := range files {
+		if previous[i] != current[i] {
+			return files[i], true
+		}
+	}
+	return "", false
+}
+
+// watchInput converts the input image and converts it again whenever the input or palette file changes, until
+// Ctrl-C is pressed. A change is only converted once the file stops changing for an interval, so that images that
+// are still being saved are not read half written.
+func (m *beadMachine) watchInput() error {
+	files := m.watchedFiles()
+	state := watchState(files)
+	m.watchConvert()
+	m.logger.Info("Watching for changes, press Ctrl-C to stop", zap.Strings("files", files))
+
+	ticker := time.NewTicker(m.watchInterval)
+	defer ticker.Stop()
+	var changed string
+	for {
+		select {
+		case <-m.ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		current := watchState(files)
+		if fileName, ok := changedFile(files, state, current); ok {
+			state, changed = current, fileName
+			continue
+		}
+		if changed == "" {
+			continue
+		}
+
+		if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			fmt.Print("\x1b[H\x1b[2J") // the previews of the last conversion are replaced
+		}
+		m.logger.Info("File changed, converting again", zap.String("file", changed))
+		changed = ""
+		m.colorCache = newColorCache(m.colorCacheSize) // the matches are stale if the palette changed
+		m.watchConvert()
+	}
+}
+
+// watchConvert converts the input image once, failed conversions keep the watch running
+func (m *beadMachine) watchConvert() {
+	if err := m.processInput(); err != nil && m.ctx.Err() == nil {
+		m.logger.Warn("Conversion failed, waiting for the next change", zap.Error(err))
+	}
+}
+
+// writeWatchPreview shows the pattern next to the pattern of the previous conversion of the watch and the cells
+// that changed between them. The first conversion shows the pattern alone.
+func (m *beadMachine) writeWatchPreview(pattern *Pattern, w io.Writer) error {
+	previous := m.watchPrevious
+	m.watchPrevious = pattern
+	mode := m.previewInline
+	if mode == "" {
+		mode = inlineAuto
+	}
+	if previous == nil {
+		return m.writeInlineImage(w, mode, inlinePreviewImage(m.patternImage(pattern)), pattern)
+	}
+
+	changes := changedCells(previous, pattern)
+	if changes < 0 {
+		m.logger.Info("Pattern size changed",
+			zap.String("before", fmt.Sprintf("%dx%d", previous.Width, previous.Height)),
+			zap.String("after", fmt.Sprintf("%dx%d", pattern.Width, pattern.Height)))
+	} else {
+		m.logger.Info("Pattern changed",
+			zap.Int("cells", changes),
+			zap.Float64("percent", 100*float64(changes)/float64(len(pattern.Cells))))
+	}
+	return m.writeInlineImage(w, mode, watchDiffImage(previous, pattern, changes), pattern)
+}
+
+// changedCells returns the amount of cells that differ between the patterns, or -1 if their sizes differ
+func changedCells(previous, current *Pattern) int {
+	if previous.Width != current.Width || previous.Height != current.Height {
+		return -1
+	}
+	changes := 0
+	for i, cell := range current.Cells {
+		if cell.Bead != previous.Cells[i].Bead || cell.Color != previous.Cells[i].Color {
+			changes++
+		}
+	}
+	return changes
+}
+
+// watchDiffImage draws the previous and the current pattern side by side with a panel of the changed cells, in
+// which the unchanged cells are faded. Patterns of different sizes get no changes panel. The cells are enlarged
+// by whole pixels to fit the panels into twice the size of the inline preview.
+func watchDiffImage(previous, current *Pattern, changes int) *image.RGBA {
+	face := basicfont.Face7x13
+	top := face.Height + coordinateLabelPadding
+
+	names := []string{"before", "after"}
+	patterns := []*Pattern{previous, current}
+	if changes >= 0 {
+		names = append(names, fmt.Sprintf("changes (%d)", changes))
+		patterns = append(patterns, current)
+	}
+	beadsWidth, beadsHeight := 0, 0
+	for _, pattern := range patterns {
+		beadsWidth += pattern.Width
+		beadsHeight = maxInt(beadsHeight, pattern.Height)
+	}
+	gaps := (len(patterns) - 1) * comparisonGap
+	cellSize := maxInt(1, minInt(inlinePreviewSize/maxInt(beadsHeight, 1), (2*inlinePreviewSize-gaps)/maxInt(beadsWidth, 1)))
+
+	columns := make([]int, len(patterns)) // widths of the panel and its label
+	width := -comparisonGap
+	for i, pattern := range patterns {
+		columns[i] = maxInt(pattern.Width*cellSize, len(names[i])*face.Advance)
+		width += columns[i] + comparisonGap
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, top+beadsHeight*cellSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(coordinateBackground), image.Point{}, draw.Src)
+	x := 0
+	for i, pattern := range patterns {
+		for cy := 0; cy < pattern.Height; cy++ {
+			for cx := 0; cx < pattern.Width; cx++ {
+				cell := pattern.Cell(cx, cy)
+				c := cell.Color
+				if i == 2 {
+					old := previous.Cell(cx, cy)
+					switch {
+					case cell.Bead == old.Bead && cell.Color == old.Color:
+						c = fadeColor(c, watchFadedCells)
+					case cell.Empty():
+						c = watchRemovedCell
+					}
+				}
+				if c.A == 0 {
+					continue
+				}
+				r := image.Rect(x+cx*cellSize, top+cy*cellSize, x+(cx+1)*cellSize, top+(cy+1)*cellSize)
+				draw.Draw(img, r, image.NewUniform(c), image.Point{}, draw.Over)
+			}
+		}
+		d := &font.Drawer{
+			Dst:  img,
+			Src:  image.NewUniform(coordinateTextColor),
+			Face: face,
+			Dot:  fixed.P(x, face.Height-face.Descent),
+		}
+		d.DrawString(names[i])
+		x += columns[i] + comparisonGap
+	}
+	return img
+}
+
+// fadeColor blends the color toward the background by the given amount, empty cells stay empty
+func fadeColor(c color.RGBA, amount float64) color.RGBA {
+	if c.A == 0 {
+		return c
+	}
+	blend := func(v, background uint8) uint8 {
+		return uint8(float64(v) + (float64(background)-float64(v))*amount)
+	}
+	return color.RGBA{
+		blend(c.R, coordinateBackground.R),
+		blend(c.G, coordinateBackground.G),
+		blend(c.B, coordinateBackground.B),
+		255,
+	}
+}
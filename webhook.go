@@ -0,0 +1,252 @@
+package beadmachine
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// webhookTimeout is the timeout of posting the completion notification, it is not limited by --timeout so that
+// conversions that timed out are still notified
+const webhookTimeout = 30 * time.Second
+
+// webhookThumbnailSize is the maximum width and height in pixel of the thumbnail of the notification
+const webhookThumbnailSize = 480
+
+// webhookDiscordFields is the maximum amount of bead counts that are shown as fields of a Discord notification
+const webhookDiscordFields = 12
+
+// webhookThumbnailName is the file name of the thumbnail attachment of a Discord notification
+const webhookThumbnailName = "pattern.png"
+
+// webhookSummary is the JSON body of the completion notification for generic webhooks
+type webhookSummary struct {
+	Content    string           `json:"content"` // summary text, chat webhooks show it as message
+	Text       string           `json:"text"`    // the summary text again for Slack compatible webhooks
+	Status     string           `json:"status"`  // succeeded or failed
+	Error      string           `json:"error,omitempty"`
+	Duration   float64          `json:"duration"` // in seconds
+	Patterns   []webhookPattern `json:"patterns"`
+	Beads      int              `json:"beads"`
+	BeadCounts map[string]int   `json:"beadCounts"`          // beads of all patterns
+	Thumbnail  string           `json:"thumbnail,omitempty"` // PNG data URL of the first pattern
+}
+
+// webhookPattern is a written pattern of the completion notification
+type webhookPattern struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Beads  int    `json:"beads"`
+	Colors int    `json:"colors"`
+}
+
+// validateWebhookURL returns an error if the webhook URL is not an absolute HTTP or HTTPS URL
+func validateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL '%s', expected a http or https URL", webhookURL)
+	}
+	return nil
+}
+
+// discordWebhook returns whether the URL is a Discord webhook, which gets the thumbnail as attachment of an embed
+func discordWebhook(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	discord := host == "discord.com" || host == "discordapp.com" ||
+		strings.HasSuffix(host, ".discord.com") || strings.HasSuffix(host, ".discordapp.com")
+	return discord && strings.HasPrefix(u.Path, "/api/webhooks/")
+}
+
+// notifyCompletion posts a summary of the run with a thumbnail, the bead counts and the duration to the webhook.
+// A failed notification is only logged, the conversion result is not affected by it.
+func (m *beadMachine) notifyCompletion(duration time.Duration, processErr error) {
+	summary, thumbnail, err := m.webhookSummary(duration, processErr)
+	if err == nil {
+		err = postWebhook(m.notifyWebhook, summary, thumbnail)
+	}
+	if err != nil {
+		m.logger.Warn("Sending completion notification failed", zap.Error(err))
+		return
+	}
+	m.logger.Debug("Completion notification sent", zap.String("status", summary.Status))
+}
+
+// webhookSummary returns the summary of all patterns written in the run and the PNG thumbnail of the first one
+func (m *beadMachine) webhookSummary(duration time.Duration, processErr error) (webhookSummary, []byte, error) {
+	summary := webhookSummary{
+		Status:     "succeeded",
+		Duration:   duration.Seconds(),
+		Patterns:   []webhookPattern{},
+		BeadCounts: make(map[string]int),
+	}
+	if processErr != nil {
+		summary.Status = "failed"
+		summary.Error = processErr.Error()
+	}
+	for _, entry := range m.galleryEntries {
+		stats := entry.pattern.Stats()
+		summary.Patterns = append(summary.Patterns, webhookPattern{
+			Name:   entry.name,
+			Width:  stats.Width,
+			Height: stats.Height,
+			Beads:  stats.Beads,
+			Colors: stats.Colors,
+		})
+		summary.Beads += stats.Beads
+		for bead, count := range stats.BeadCounts {
+			summary.BeadCounts[bead] += count
+		}
+	}
+
+	elapsed := duration.Round(100 * time.Millisecond)
+	if processErr != nil {
+		summary.Content = fmt.Sprintf("beadmachine failed after %s with %d written patterns: %s", elapsed, len(summary.Patterns), processErr)
+	} else {
+		summary.Content = fmt.Sprintf("beadmachine converted %d patterns in %s: %s beads in %s colors", len(summary.Patterns),
+			elapsed, m.formatInt(summary.Beads), m.formatInt(len(summary.BeadCounts)))
+	}
+	summary.Text = summary.Content
+
+	if len(m.galleryEntries) == 0 {
+		return summary, nil, nil
+	}
+	img := m.patternImage(m.galleryEntries[0].pattern)
+	thumbnail := imaging.Fit(img, webhookThumbnailSize, webhookThumbnailSize, imaging.NearestNeighbor)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, thumbnail); err != nil {
+		return summary, nil, errors.Wrap(err, "encoding thumbnail")
+	}
+	summary.Thumbnail = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	return summary, buf.Bytes(), nil
+}
+
+// webhookBeads returns the beads of the summary ordered by count
+func webhookBeads(summary webhookSummary) []string {
+	beads := make([]string, 0, len(summary.BeadCounts))
+	for bead := range summary.BeadCounts {
+		beads = append(beads, bead)
+	}
+	sort.Slice(beads, func(i, j int) bool {
+		if summary.BeadCounts[beads[i]] != summary.BeadCounts[beads[j]] {
+			return summary.BeadCounts[beads[i]] > summary.BeadCounts[beads[j]]
+		}
+		return beads[i] < beads[j]
+	})
+	return beads
+}
+
+// postWebhook posts the summary as JSON to the webhook, Discord webhooks get a multipart message with an embed that
+// shows the thumbnail and the most used beads
+func postWebhook(webhookURL string, summary webhookSummary, thumbnail []byte) error {
+	var body io.Reader
+	contentType := "application/json"
+	if discordWebhook(webhookURL) {
+		var err error
+		if body, contentType, err = discordMessage(summary, thumbnail); err != nil {
+			return err
+		}
+	} else {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return errors.Wrap(err, "marshalling notification")
+		}
+		body = bytes.NewReader(data)
+	}
+
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(webhookURL, contentType, body)
+	if err != nil {
+		return errors.Wrap(err, "posting notification")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("posting notification returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// discordMessage returns the multipart body and its content type of a Discord webhook message with the summary as
+// embed and the thumbnail as attached image
+func discordMessage(summary webhookSummary, thumbnail []byte) (io.Reader, string, error) {
+	color := 0x2E7D32
+	if summary.Status != "succeeded" {
+		color = 0xC62828
+	}
+	embed := map[string]interface{}{
+		"title": fmt.Sprintf("%d patterns, %d beads", len(summary.Patterns), summary.Beads),
+		"color": color,
+	}
+	var fields []map[string]interface{}
+	for i, bead := range webhookBeads(summary) {
+		if i == webhookDiscordFields {
+			break
+		}
+		fields = append(fields, map[string]interface{}{
+			"name":   bead,
+			"value":  fmt.Sprintf("%d", summary.BeadCounts[bead]),
+			"inline": true,
+		})
+	}
+	if len(fields) > 0 {
+		embed["fields"] = fields
+	}
+	message := map[string]interface{}{
+		"content": summary.Content,
+		"embeds":  []interface{}{embed},
+	}
+	if thumbnail != nil {
+		embed["image"] = map[string]string{"url": "attachment://" + webhookThumbnailName}
+		message["attachments"] = []map[string]interface{}{{"id": 0, "filename": webhookThumbnailName}}
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "marshalling notification")
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="payload_json"`)
+	header.Set("Content-Type", "application/json")
+	part, err := writer.CreatePart(header)
+	if err == nil {
+		_, err = part.Write(payload)
+	}
+	if err == nil && thumbnail != nil {
+		header = textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[0]"; filename="%s"`, webhookThumbnailName))
+		header.Set("Content-Type", "image/png")
+		if part, err = writer.CreatePart(header); err == nil {
+			_, err = part.Write(thumbnail)
+		}
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, "writing notification")
+	}
+	return &buf, writer.FormDataContentType(), nil
+}
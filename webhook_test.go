@@ -0,0 +1,51 @@
+package beadmachine
+
+import "testing"
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.slack.com/services/T000/B000/XXXX", true},
+		{"http://localhost:8080/hook", true},
+		{"https://discord.com/api/webhooks/1/token", true},
+		{"", false},
+		{"hooks.slack.com/services/T000", false},
+		{"localhost:8080", false},
+		{"ftp://example.com/hook", false},
+		{"file:///etc/passwd", false},
+		{"https://", false},
+		{"https://exa mple.com/", false},
+	}
+	for _, test := range tests {
+		if err := validateWebhookURL(test.url); (err == nil) != test.valid {
+			t.Errorf("validateWebhookURL(%q) = %v, expected valid %t", test.url, err, test.valid)
+		}
+	}
+}
+
+func TestDiscordWebhook(t *testing.T) {
+	tests := []struct {
+		url     string
+		discord bool
+	}{
+		{"https://discord.com/api/webhooks/1/token", true},
+		{"https://discordapp.com/api/webhooks/1/token", true},
+		{"https://ptb.discord.com/api/webhooks/1/token", true},
+		{"https://canary.discordapp.com/api/webhooks/1/token", true},
+		{"https://DISCORD.com/api/webhooks/1/token", true},
+		{"https://discord.com:443/api/webhooks/1/token", true},
+		{"https://discord.com/channels/1/2", false},
+		{"https://discord.com/", false},
+		{"https://evildiscord.com/api/webhooks/1/token", false},
+		{"https://discord.com.example.com/api/webhooks/1/token", false},
+		{"https://hooks.slack.com/api/webhooks/1/token", false},
+		{"://discord.com/api/webhooks/1/token", false},
+	}
+	for _, test := range tests {
+		if discord := discordWebhook(test.url); discord != test.discord {
+			t.Errorf("discordWebhook(%q) = %t, expected %t", test.url, discord, test.discord)
+		}
+	}
+}
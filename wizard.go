@@ -0,0 +1,156 @@
+package beadmachine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// wizardPreviewColumns is the maximum width of the terminal preview of the wizard
+const wizardPreviewColumns = 80
+
+// wizard asks the conversion settings interactively
+type wizard struct {
+	in     *bufio.Reader
+	out    io.Writer
+	closed bool // the input was closed, all further questions are answered with their default
+}
+
+// wizardCommand returns the command that interactively asks for the conversion settings
+func wizardCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "wizard",
+		Short: "Interactively create a bead pattern",
+		Args:  cobra.NoArgs,
+		RunE:  startWizard,
+	}
+}
+
+func startWizard(cmd *cobra.Command, args []string) error {
+	logger := logger(cmd)
+	w := &wizard{
+		in:  bufio.NewReader(cmd.InOrStdin()),
+		out: cmd.OutOrStdout(),
+	}
+
+	m := newBeadMachine(logger)
+	for {
+		m.inputFileName = w.ask("Image file", "")
+		if w.closed && m.inputFileName == "" {
+			return usageError(errors.New("no image file given"))
+		}
+		inputImage, err := readImageFile(m.inputFileName, true)
+		if err != nil {
+			fmt.Fprintf(w.out, "The image can not be read: %v\n", err)
+			continue
+		}
+
+		bounds := inputImage.Bounds()
+		fmt.Fprintf(w.out, "The image has %dx%d pixel.\n", bounds.Dx(), bounds.Dy())
+		suggestions := suggestSizes(logger, inputImage, m.boardDimension, 0, 0)
+		boardsWidth := boardsNeeded(suggestions[len(suggestions)/2].width, m.boardDimension)
+		m.boardsWidth = w.askInt(fmt.Sprintf("Width in boards of %d beads", m.boardDimension), boardsWidth)
+		height := float64(m.boardsWidth*m.boardDimension) * float64(bounds.Dy()) / float64(bounds.Dx())
+		m.height = int(math.Round(height))
+		m.width = m.boardsWidth * m.boardDimension
+		m.boardsWidth = 0
+		fmt.Fprintf(w.out, "The pattern will have %dx%d beads on %dx%d boards.\n",
+			m.width, m.height, boardsNeeded(m.width, m.boardDimension), boardsNeeded(m.height, m.boardDimension))
+		break
+	}
+
+	m.palette = w.ask("Palette", "colors_hama.json")
+	if colors := w.ask("Bead colors that you own, as comma separated codes like H1,H18 (empty for all)", ""); colors != "" {
+		m.colors = strings.Split(colors, ",")
+	}
+
+	pattern, err := m.convert()
+	if err != nil {
+		return err
+	}
+	if err = writeTerminalPreview(w.out, pattern, wizardPreviewColumns, true); err != nil {
+		return failureError(err)
+	}
+	if !w.askBool("Create the outputs for this pattern", true) {
+		return nil
+	}
+
+	if w.askBool("Write a PNG image", true) {
+		m.outputFileName = w.ask("PNG filename", defaultOutputFileName(m.inputFileName))
+	}
+	if w.askBool("Write a HTML pattern", true) {
+		m.htmlFileName = w.ask("HTML filename", strings.TrimSuffix(defaultOutputFileName(m.inputFileName), ".png")+".html")
+	}
+	if w.askBool("Write placement instructions", false) {
+		m.instructionsFileName = w.ask("Instructions filename, as text or .pdf file", strings.TrimSuffix(defaultOutputFileName(m.inputFileName), ".png")+".pdf")
+	}
+	if w.askBool("Write a poster PDF for printing", false) {
+		m.posterPaper = w.ask("Paper size", m.posterPaper)
+		if _, _, err = posterPaperSize(m.posterPaper); err != nil {
+			logger.Error("Invalid poster paper size", zap.Error(err))
+			return usageError(err)
+		}
+		m.posterFileName = w.ask("Poster filename", posterFileName(m.inputFileName))
+	}
+	return m.writeOutputs(pattern)
+}
+
+// ask asks for a value and returns the default if no value is entered
+func (w *wizard) ask(question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil {
+		w.closed = true
+		fmt.Fprintln(w.out)
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return defaultValue
+	}
+	return line
+}
+
+// askInt asks for a positive number until a valid one is entered
+func (w *wizard) askInt(question string, defaultValue int) int {
+	for {
+		value, err := strconv.Atoi(w.ask(question, strconv.Itoa(defaultValue)))
+		if err == nil && value > 0 {
+			return value
+		}
+		if w.closed {
+			return defaultValue
+		}
+		fmt.Fprintln(w.out, "Please enter a positive number.")
+	}
+}
+
+// askBool asks a yes or no question
+func (w *wizard) askBool(question string, defaultValue bool) bool {
+	hint := "y/N"
+	if defaultValue {
+		hint = "Y/n"
+	}
+	for {
+		switch strings.ToLower(w.ask(question+" ("+hint+")", "")) {
+		case "":
+			return defaultValue
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		fmt.Fprintln(w.out, "Please answer y or n.")
+	}
+}